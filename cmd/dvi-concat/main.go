@@ -0,0 +1,118 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi-concat concatenates DVI documents into a single DVI document.
+//
+// Usage:
+//
+//	$> dvi-concat [options] input1.dvi [input2.dvi [...]]
+//
+// The new DVI document is written to stdout when no output file is
+// provided.
+package main // import "star-tex.org/x/tex/cmd/dvi-concat"
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/dvi"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi-concat: ")
+
+	oname := flag.String("o", "", "path to the output DVI file (default: stdout)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi-concat concatenates DVI documents into a single DVI document.
+
+Usage: dvi-concat [options] input1.dvi [input2.dvi [...]]
+
+The preamble of the first document is kept: lengths of the other
+documents are converted to its units and magnification.
+Conflicting font numbers are renumbered.
+
+ex:
+ $> dvi-concat -o book.dvi ./ch1.dvi ./ch2.dvi ./ch3.dvi
+ $> dvi-concat ./ch1.dvi ./ch2.dvi > book.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	err := xmain(*oname, flag.Args())
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func xmain(oname string, inames []string) error {
+	raws := make([][]byte, len(inames))
+	for i, iname := range inames {
+		raw, err := os.ReadFile(iname)
+		if err != nil {
+			return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+		}
+		raws[i] = raw
+	}
+
+	if oname == "" {
+		o := bufio.NewWriter(os.Stdout)
+		defer o.Flush()
+		err := process(o, inames, raws)
+		if err != nil {
+			return fmt.Errorf("could not concatenate DVI files: %w", err)
+		}
+		return o.Flush()
+	}
+
+	o, err := os.Create(oname)
+	if err != nil {
+		return fmt.Errorf("could not create DVI file %q: %w", oname, err)
+	}
+	defer o.Close()
+
+	err = process(o, inames, raws)
+	if err != nil {
+		return fmt.Errorf("could not concatenate DVI files: %w", err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		return fmt.Errorf("could not close DVI file %q: %w", oname, err)
+	}
+
+	return nil
+}
+
+func process(w io.Writer, names []string, raws [][]byte) error {
+	progs := make([]dvi.Program, len(raws))
+	for i, raw := range raws {
+		prog, err := dvi.Compile(raw)
+		if err != nil {
+			return fmt.Errorf("could not compile DVI program %q: %w", names[i], err)
+		}
+		progs[i] = prog
+	}
+
+	err := dvi.Concat(w, progs...)
+	if err != nil {
+		return fmt.Errorf("could not write concatenated pages: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+)
+
+func TestProcess(t *testing.T) {
+	var (
+		names = []string{
+			"../../testdata/pages_golden.dvi",
+			"../../testdata/hello_golden.dvi",
+			"../../testdata/pages_golden.dvi",
+		}
+		raws = make([][]byte, len(names))
+		want []string
+	)
+	for i, name := range names {
+		raw, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("could not read DVI file: %+v", err)
+		}
+		raws[i] = raw
+
+		prog, err := dvi.Compile(raw)
+		if err != nil {
+			t.Fatalf("could not compile DVI file %q: %+v", name, err)
+		}
+		text, err := dvi.Text(prog)
+		if err != nil {
+			t.Fatalf("could not extract text of %q: %+v", name, err)
+		}
+		want = append(want, text...)
+	}
+
+	o := new(bytes.Buffer)
+	err := process(o, names, raws)
+	if err != nil {
+		t.Fatalf("could not concatenate DVI files: %+v", err)
+	}
+
+	prog, err := dvi.Compile(o.Bytes())
+	if err != nil {
+		t.Fatalf("could not compile concatenated DVI file: %+v", err)
+	}
+	got, err := dvi.Text(prog)
+	if err != nil {
+		t.Fatalf("could not extract text: %+v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid text:\ngot= %q\nwant=%q", got, want)
+	}
+
+	err = process(new(bytes.Buffer), []string{"invalid.dvi"}, [][]byte{[]byte("invalid")})
+	if err == nil {
+		t.Fatalf("expected an error for an invalid DVI file")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi-diff compares the pages of two DVI documents.
+//
+// Usage:
+//
+//	$> dvi-diff [options] old.dvi new.dvi
+//
+// dvi-diff exits with status 1 when the documents differ.
+package main // import "star-tex.org/x/tex/cmd/dvi-diff"
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/kpath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi-diff: ")
+
+	var (
+		texmf = flag.String("texmf", "", "path to TexMF root")
+		tol   = flag.Float64("tol", 0, "tolerance on positions and sizes, in TeX points")
+		js    = flag.Bool("json", false, "enable JSON output")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi-diff compares the pages of two DVI documents, as positioned glyphs and rules.
+
+Usage: dvi-diff [options] old.dvi new.dvi
+
+ex:
+ $> dvi-diff ./testdata/hello_golden.dvi ./hello.dvi
+ $> dvi-diff -tol=0.01 -json ./testdata/hello_golden.dvi ./hello.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		log.Fatalf("missing input dvi files")
+	}
+
+	ctx := kpath.New()
+	if *texmf != "" {
+		var err error
+		ctx, err = kpath.NewFromFS(os.DirFS(*texmf))
+		if err != nil {
+			log.Fatalf("could not create kpath context: %+v", err)
+		}
+	}
+
+	n, err := xmain(os.Stdout, flag.Arg(0), flag.Arg(1), ctx, *tol, *js)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	if n > 0 {
+		os.Exit(1)
+	}
+}
+
+func xmain(w io.Writer, aname, bname string, ctx kpath.Context, tol float64, js bool) (int, error) {
+	a, err := compile(aname)
+	if err != nil {
+		return 0, err
+	}
+	b, err := compile(bname)
+	if err != nil {
+		return 0, err
+	}
+	return process(w, a, b, ctx, tol, js)
+}
+
+func compile(fname string) (dvi.Program, error) {
+	raw, err := os.ReadFile(fname)
+	if err != nil {
+		return dvi.Program{}, fmt.Errorf("could not read DVI file %q: %w", fname, err)
+	}
+
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return prog, fmt.Errorf("could not compile DVI file %q: %w", fname, err)
+	}
+	return prog, nil
+}
+
+// process writes the differences between the provided DVI programs, and
+// returns their number.
+// tol is the tolerance on positions and sizes, in TeX points.
+func process(w io.Writer, a, b dvi.Program, ctx kpath.Context, tol float64, js bool) (int, error) {
+	pre := a.Pre()
+	diffs, err := dvi.Diff(a, b, &dvi.DiffOptions{
+		// convert TeX points into DVI units.
+		Tolerance: int32(tol * 254000 / 72.27 * float64(pre.Den) / float64(pre.Num)),
+		Machine:   []dvi.Option{dvi.WithContext(ctx)},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not diff DVI documents: %w", err)
+	}
+
+	if js {
+		if diffs == nil {
+			diffs = []dvi.Difference{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diffs)
+		if err != nil {
+			return 0, fmt.Errorf("could not encode differences: %w", err)
+		}
+		return len(diffs), nil
+	}
+
+	for _, d := range diffs {
+		_, err = fmt.Fprintf(w, "%v\n", d)
+		if err != nil {
+			return 0, fmt.Errorf("could not write differences: %w", err)
+		}
+	}
+	return len(diffs), nil
+}
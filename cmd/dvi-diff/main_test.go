@@ -0,0 +1,106 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/kpath"
+)
+
+func TestProcess(t *testing.T) {
+	raw, err := os.ReadFile("../../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	a, err := dvi.Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	// move the page number in the body of the first page by 2pt.
+	mod := append([]byte(nil), raw...)
+	if op := mod[141]; op != 146 {
+		t.Fatalf("invalid opcode %d: want right4", op)
+	}
+	binary.BigEndian.PutUint32(mod[142:], binary.BigEndian.Uint32(mod[142:])+2<<16)
+	b, err := dvi.Compile(mod)
+	if err != nil {
+		t.Fatalf("could not compile modified DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		b    dvi.Program
+		tol  float64
+		js   bool
+		want string
+		n    int
+	}{
+		{
+			name: "same",
+			b:    a,
+			want: "",
+		},
+		{
+			name: "same-json",
+			b:    a,
+			js:   true,
+			want: "[]\n",
+		},
+		{
+			name: "moved",
+			b:    b,
+			want: "page 1: glyph '1' (cmr10) moved 2pt right\n",
+			n:    1,
+		},
+		{
+			name: "moved-tol",
+			b:    b,
+			tol:  2,
+			want: "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := new(bytes.Buffer)
+			n, err := process(o, a, tc.b, kpath.New(), tc.tol, tc.js)
+			if err != nil {
+				t.Fatalf("could not diff DVI files: %+v", err)
+			}
+			if n != tc.n {
+				t.Fatalf("invalid number of differences: got=%d, want=%d", n, tc.n)
+			}
+			if got, want := o.String(), tc.want; got != want {
+				t.Fatalf("invalid output:\ngot= %q\nwant=%q", got, want)
+			}
+		})
+	}
+
+	o := new(bytes.Buffer)
+	_, err = process(o, a, b, kpath.New(), 0, true)
+	if err != nil {
+		t.Fatalf("could not diff DVI files: %+v", err)
+	}
+	var got []dvi.Difference
+	err = json.Unmarshal(o.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("could not decode JSON output: %+v", err)
+	}
+	want := []dvi.Difference{{
+		Page:   0,
+		Kind:   dvi.DiffMoved,
+		Item:   "glyph '1' (cmr10)",
+		Detail: "moved 2pt right",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid JSON output:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
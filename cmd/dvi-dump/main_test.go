@@ -31,6 +31,14 @@ func TestInterp(t *testing.T) {
 			name: "../../testdata/xcolor_golden.dvi",
 			want: "testdata/xcolor_golden.txt",
 		},
+		{
+			name: "../../testdata/ptex.dvi",
+			want: "testdata/ptex_golden.txt",
+		},
+		{
+			name: "../../testdata/xdv.dvi",
+			want: "testdata/xdv_golden.txt",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			f, err := os.Open(tc.name)
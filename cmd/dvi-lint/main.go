@@ -0,0 +1,137 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi-lint checks the structure of DVI documents.
+//
+// Usage:
+//
+//	$> dvi-lint [options] file1.dvi [file2.dvi [...]]
+//
+// dvi-lint exits with status 1 when problems are found.
+package main // import "star-tex.org/x/tex/cmd/dvi-lint"
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/kpath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi-lint: ")
+
+	var (
+		texmf = flag.String("texmf", "", "path to TexMF root")
+		js    = flag.Bool("json", false, "enable JSON output")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi-lint checks the structure of DVI documents.
+
+Usage: dvi-lint [options] file1.dvi [file2.dvi [...]]
+
+dvi-lint checks the back-pointers of pages, the postamble and its
+trailer, the balance of push and pop commands, the font definitions
+and the checksums of the TFM fonts.
+Problems are reported with their byte offset in the DVI file.
+
+ex:
+ $> dvi-lint ./testdata/hello_golden.dvi
+ $> dvi-lint -json ./hello.dvi ./pages.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	ctx := kpath.New()
+	if *texmf != "" {
+		var err error
+		ctx, err = kpath.NewFromFS(os.DirFS(*texmf))
+		if err != nil {
+			log.Fatalf("could not create kpath context: %+v", err)
+		}
+	}
+
+	n, err := xmain(flag.Args(), ctx, *js)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+	if n > 0 {
+		os.Exit(1)
+	}
+}
+
+func xmain(inames []string, ctx kpath.Context, js bool) (int, error) {
+	raws := make([][]byte, len(inames))
+	for i, iname := range inames {
+		raw, err := os.ReadFile(iname)
+		if err != nil {
+			return 0, fmt.Errorf("could not read DVI file %q: %w", iname, err)
+		}
+		raws[i] = raw
+	}
+
+	o := bufio.NewWriter(os.Stdout)
+	defer o.Flush()
+
+	n, err := process(o, inames, raws, ctx, js)
+	if err != nil {
+		return 0, err
+	}
+	return n, o.Flush()
+}
+
+// problem is a problem of a DVI file.
+type problem struct {
+	File string `json:"file"`
+	dvi.Problem
+}
+
+// process writes the problems of the provided DVI files, and returns
+// their number.
+func process(w io.Writer, names []string, raws [][]byte, ctx kpath.Context, js bool) (int, error) {
+	probs := []problem{}
+	for i, raw := range raws {
+		ps, err := dvi.Validate(raw, dvi.WithContext(ctx))
+		if err != nil {
+			return 0, fmt.Errorf("could not validate DVI file %q: %w", names[i], err)
+		}
+		for _, p := range ps {
+			probs = append(probs, problem{File: names[i], Problem: p})
+		}
+	}
+
+	if js {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(probs)
+		if err != nil {
+			return 0, fmt.Errorf("could not encode problems: %w", err)
+		}
+		return len(probs), nil
+	}
+
+	for _, p := range probs {
+		_, err := fmt.Fprintf(w, "%s:%v\n", p.File, p.Problem)
+		if err != nil {
+			return 0, fmt.Errorf("could not write problems: %w", err)
+		}
+	}
+	return len(probs), nil
+}
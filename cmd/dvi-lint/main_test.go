@@ -0,0 +1,99 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"star-tex.org/x/tex/kpath"
+)
+
+func TestProcess(t *testing.T) {
+	raw, err := os.ReadFile("../../testdata/hello_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+
+	// corrupt the maximum stack depth of the postamble.
+	mod := append([]byte(nil), raw...)
+	i := len(mod) - 1
+	for mod[i] == 223 {
+		i--
+	}
+	post := int(binary.BigEndian.Uint32(mod[i-4:]))
+	if op := mod[post]; op != 248 {
+		t.Fatalf("invalid opcode %d: want post", op)
+	}
+	binary.BigEndian.PutUint16(mod[post+25:], 0)
+
+	for _, tc := range []struct {
+		name  string
+		names []string
+		raws  [][]byte
+		js    bool
+		want  string
+		n     int
+	}{
+		{
+			name:  "valid",
+			names: []string{"hello.dvi"},
+			raws:  [][]byte{raw},
+			want:  "",
+		},
+		{
+			name:  "valid-json",
+			names: []string{"hello.dvi"},
+			raws:  [][]byte{raw},
+			js:    true,
+			want:  "[]\n",
+		},
+		{
+			name:  "max-stack",
+			names: []string{"hello.dvi", "mod.dvi"},
+			raws:  [][]byte{raw, mod},
+			want:  "mod.dvi:" + strconv.Itoa(post) + ": invalid maximum stack depth 0 (want at least 2)\n",
+			n:     1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := new(bytes.Buffer)
+			n, err := process(o, tc.names, tc.raws, kpath.New(), tc.js)
+			if err != nil {
+				t.Fatalf("could not lint DVI files: %+v", err)
+			}
+			if n != tc.n {
+				t.Fatalf("invalid number of problems: got=%d, want=%d", n, tc.n)
+			}
+			if got, want := o.String(), tc.want; got != want {
+				t.Fatalf("invalid output:\ngot= %q\nwant=%q", got, want)
+			}
+		})
+	}
+
+	o := new(bytes.Buffer)
+	_, err = process(o, []string{"mod.dvi"}, [][]byte{mod}, kpath.New(), true)
+	if err != nil {
+		t.Fatalf("could not lint DVI files: %+v", err)
+	}
+	var got []map[string]interface{}
+	err = json.Unmarshal(o.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("could not decode JSON output: %+v", err)
+	}
+	want := []map[string]interface{}{{
+		"file":   "mod.dvi",
+		"offset": float64(post),
+		"msg":    "invalid maximum stack depth 0 (want at least 2)",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid JSON output:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi-nup places several pages of a DVI document on each sheet
+// of a new DVI document.
+//
+// Usage:
+//
+//	$> dvi-nup [options] input.dvi [output.dvi]
+//
+// The new DVI document is written to stdout when no output file is
+// provided.
+package main // import "star-tex.org/x/tex/cmd/dvi-nup"
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"star-tex.org/x/tex/dvi"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi-nup: ")
+
+	var (
+		nup     = flag.String("nup", "2x1", "number of columns and rows of pages on each sheet")
+		booklet = flag.Bool("booklet", false, "lay out pages as folded booklets, 2 pages per sheet side")
+		sig     = flag.Int("signature", 0, "number of pages of each booklet (default: all the pages)")
+		scale   = flag.Float64("scale", 1, "scaling factor of the pages")
+		paper   = flag.String("paper", "", "size of the pages (default: from the papersize special, or 8.5in,11in)")
+		crop    = flag.Bool("crop", false, "draw crop marks around the pages")
+		margin  = flag.Float64("margin", 0, "margin around the pages of each sheet, in big points (default: 18 with -crop)")
+		gutter  = flag.Float64("gutter", 0, "space between the pages of each sheet, in big points (default: 36 with -crop)")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi-nup places several pages of a DVI document on each sheet of a new DVI document.
+
+Usage: dvi-nup [options] input.dvi [output.dvi]
+
+ex:
+ $> dvi-nup ./testdata/pages_golden.dvi out.dvi
+ $> dvi-nup -nup=2x2 -scale=0.5 -crop ./testdata/pages_golden.dvi out.dvi
+ $> dvi-nup -nup=2x1 -margin=36 -gutter=18 ./testdata/pages_golden.dvi out.dvi
+ $> dvi-nup -booklet -signature=16 -paper=148mm,210mm ./testdata/pages_golden.dvi > out.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	oname := ""
+	if flag.NArg() > 1 {
+		oname = flag.Arg(1)
+	}
+
+	opts := options{
+		nup:     *nup,
+		booklet: *booklet,
+		sig:     *sig,
+		scale:   *scale,
+		paper:   *paper,
+		crop:    *crop,
+		margin:  *margin,
+		gutter:  *gutter,
+	}
+
+	err := xmain(oname, flag.Arg(0), opts)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+type options struct {
+	nup     string  // columns and rows of pages, e.g. "2x1".
+	booklet bool    // booklet layout.
+	sig     int     // booklet signature.
+	scale   float64 // scaling factor.
+	paper   string  // size of the source pages.
+	crop    bool    // crop marks.
+	margin  float64 // margin around the pages, in big points.
+	gutter  float64 // space between the pages, in big points.
+}
+
+func xmain(oname, iname string, opts options) error {
+	raw, err := os.ReadFile(iname)
+	if err != nil {
+		return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+	}
+
+	if oname == "" {
+		o := bufio.NewWriter(os.Stdout)
+		defer o.Flush()
+		err = process(o, raw, opts)
+		if err != nil {
+			return fmt.Errorf("could not transform pages of DVI file %q: %w", iname, err)
+		}
+		return o.Flush()
+	}
+
+	o, err := os.Create(oname)
+	if err != nil {
+		return fmt.Errorf("could not create DVI file %q: %w", oname, err)
+	}
+	defer o.Close()
+
+	err = process(o, raw, opts)
+	if err != nil {
+		return fmt.Errorf("could not transform pages of DVI file %q: %w", iname, err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		return fmt.Errorf("could not close DVI file %q: %w", oname, err)
+	}
+
+	return nil
+}
+
+func process(w io.Writer, raw []byte, opts options) error {
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return fmt.Errorf("could not compile DVI program: %w", err)
+	}
+
+	if opts.scale <= 0 {
+		return fmt.Errorf("invalid scaling factor %g", opts.scale)
+	}
+
+	width, height, err := pageSize(prog, opts.paper)
+	if err != nil {
+		return fmt.Errorf("could not find page size: %w", err)
+	}
+
+	if opts.margin < 0 || opts.gutter < 0 {
+		return fmt.Errorf("invalid margin %g or gutter %g", opts.margin, opts.gutter)
+	}
+	if opts.crop {
+		// leave room for the crop marks, drawn 5/24in outside the pages.
+		if opts.margin == 0 {
+			opts.margin = 18
+		}
+		if opts.gutter == 0 {
+			opts.gutter = 36
+		}
+	}
+	var (
+		bp     = 65536 * 72.27 / 72 * spToDVI(prog)
+		margin = int32(math.Round(opts.margin * bp))
+		gutter = int32(math.Round(opts.gutter * bp))
+	)
+
+	var layout dvi.Layout
+	switch {
+	case opts.booklet:
+		sig := opts.sig
+		if sig <= 0 {
+			sig = prog.NumPages()
+		}
+		layout = dvi.Booklet(sig, width, height, opts.scale, margin, gutter)
+	default:
+		var cols, rows int
+		_, err = fmt.Sscanf(opts.nup, "%dx%d", &cols, &rows)
+		if err != nil || cols <= 0 || rows <= 0 {
+			return fmt.Errorf("invalid n-up layout %q", opts.nup)
+		}
+		layout = dvi.NUp(cols, rows, width, height, opts.scale, margin, gutter)
+	}
+	layout.CropMarks = opts.crop
+
+	err = dvi.Transform(w, prog, layout)
+	if err != nil {
+		return fmt.Errorf("could not write transformed pages: %w", err)
+	}
+
+	return nil
+}
+
+// pageSize returns the size of the pages of the program, in DVI units,
+// from the provided paper size, from the papersize special of the first
+// page, or US letter.
+func pageSize(prog dvi.Program, paper string) (w, h int32, err error) {
+	if paper == "" && prog.NumPages() > 0 {
+		_, cmds, err := prog.Page(0)
+		if err != nil {
+			return 0, 0, fmt.Errorf("could not read first page: %w", err)
+		}
+		for _, cmd := range cmds {
+			var v []byte
+			switch cmd := cmd.(type) {
+			case *dvi.CmdXXX1:
+				v = cmd.Value
+			case *dvi.CmdXXX2:
+				v = cmd.Value
+			case *dvi.CmdXXX3:
+				v = cmd.Value
+			case *dvi.CmdXXX4:
+				v = cmd.Value
+			}
+			if bytes.HasPrefix(v, []byte("papersize=")) {
+				paper = strings.TrimPrefix(string(v), "papersize=")
+				break
+			}
+		}
+	}
+	if paper == "" {
+		paper = "8.5in,11in"
+	}
+
+	w, h, err = dvi.ParsePaperSize(paper)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sp := spToDVI(prog)
+	w = int32(math.Round(float64(w) * sp))
+	h = int32(math.Round(float64(h) * sp))
+	return w, h, nil
+}
+
+// spToDVI returns the factor converting scaled points to the DVI units of
+// the program.
+func spToDVI(prog dvi.Program) float64 {
+	pre := prog.Pre()
+	return float64(pre.Den) / float64(pre.Num) * 254000 / 72.27 / 65536
+}
@@ -0,0 +1,81 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+)
+
+func TestProcess(t *testing.T) {
+	raw, err := os.ReadFile("../../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts options
+		want []string
+	}{
+		{
+			name: "2x1",
+			opts: options{nup: "2x1", scale: 0.5, crop: true},
+			want: []string{"page page\n1 2\n. .\n1 2\n", "page\n3\n.\n3\n"},
+		},
+		{
+			name: "2x1-margins",
+			opts: options{nup: "2x1", scale: 0.5, margin: 36, gutter: 18},
+			want: []string{"page page\n1 2\n. .\n1 2\n", "page\n3\n.\n3\n"},
+		},
+		{
+			name: "1x3",
+			opts: options{nup: "1x3", scale: 1, paper: "8.5in,11in"},
+			want: []string{"page\n1\n.\n1\npage\n2\n.\n2\npage\n3\n.\n3\n"},
+		},
+		{
+			name: "booklet",
+			opts: options{booklet: true, scale: 1},
+			want: []string{"page\n1\n.\n1\n", "page page\n2 3\n. .\n2 3\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := new(bytes.Buffer)
+			err := process(o, raw, tc.opts)
+			if err != nil {
+				t.Fatalf("could not transform pages: %+v", err)
+			}
+
+			prog, err := dvi.Compile(o.Bytes())
+			if err != nil {
+				t.Fatalf("could not compile transformed pages: %+v", err)
+			}
+			got, err := dvi.Text(prog)
+			if err != nil {
+				t.Fatalf("could not extract text: %+v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid text:\ngot= %q\nwant=%q", got, tc.want)
+			}
+		})
+	}
+
+	for _, opts := range []options{
+		{nup: "2", scale: 1},
+		{nup: "0x1", scale: 1},
+		{nup: "2x1", scale: 0},
+		{nup: "2x1", scale: 1, paper: "a4"},
+		{nup: "2x1", scale: 1, margin: -1},
+	} {
+		err := process(new(bytes.Buffer), raw, opts)
+		if err == nil {
+			t.Fatalf("expected an error for options %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi-select selects, reorders and reverses the pages of a DVI
+// document.
+//
+// Usage:
+//
+//	$> dvi-select [options] input.dvi [output.dvi]
+//
+// The new DVI document is written to stdout when no output file is
+// provided.
+package main // import "star-tex.org/x/tex/cmd/dvi-select"
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/dvi"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi-select: ")
+
+	var (
+		pages   = flag.String("pages", "=:", "comma-separated list of page ranges to select (e.g. 1:3,=5,=7:)")
+		reverse = flag.Bool("reverse", false, "reverse the order of the selected pages")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi-select selects, reorders and reverses the pages of a DVI document.
+
+Usage: dvi-select [options] input.dvi [output.dvi]
+
+Page ranges select pages by their \count0 value (e.g. 3:5),
+or by their position in the document when prefixed with '=' (e.g. =3:5).
+Omitted bounds extend to the first or last page, and ranges whose
+beginning is greater than their end select their pages in reverse order.
+
+ex:
+ $> dvi-select -pages=2 ./testdata/pages_golden.dvi out.dvi
+ $> dvi-select -pages==3:1 ./testdata/pages_golden.dvi out.dvi
+ $> dvi-select -pages==1,=1 -reverse ./testdata/pages_golden.dvi > out.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	oname := ""
+	if flag.NArg() > 1 {
+		oname = flag.Arg(1)
+	}
+
+	err := xmain(oname, flag.Arg(0), *pages, *reverse)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func xmain(oname, iname, pages string, reverse bool) error {
+	raw, err := os.ReadFile(iname)
+	if err != nil {
+		return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+	}
+
+	if oname == "" {
+		o := bufio.NewWriter(os.Stdout)
+		defer o.Flush()
+		err = process(o, raw, pages, reverse)
+		if err != nil {
+			return fmt.Errorf("could not select pages of DVI file %q: %w", iname, err)
+		}
+		return o.Flush()
+	}
+
+	o, err := os.Create(oname)
+	if err != nil {
+		return fmt.Errorf("could not create DVI file %q: %w", oname, err)
+	}
+	defer o.Close()
+
+	err = process(o, raw, pages, reverse)
+	if err != nil {
+		return fmt.Errorf("could not select pages of DVI file %q: %w", iname, err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		return fmt.Errorf("could not close DVI file %q: %w", oname, err)
+	}
+
+	return nil
+}
+
+func process(w io.Writer, raw []byte, pages string, reverse bool) error {
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return fmt.Errorf("could not compile DVI program: %w", err)
+	}
+
+	prs, err := dvi.ParsePageRanges(pages)
+	if err != nil {
+		return fmt.Errorf("could not parse page ranges: %w", err)
+	}
+
+	sel, err := dvi.SelectPages(prog, prs)
+	if err != nil {
+		return fmt.Errorf("could not select pages: %w", err)
+	}
+
+	if reverse {
+		for i, j := 0, len(sel)-1; i < j; i, j = i+1, j-1 {
+			sel[i], sel[j] = sel[j], sel[i]
+		}
+	}
+
+	err = dvi.Select(w, prog, sel)
+	if err != nil {
+		return fmt.Errorf("could not write selected pages: %w", err)
+	}
+
+	return nil
+}
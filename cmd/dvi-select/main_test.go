@@ -0,0 +1,64 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+)
+
+func TestProcess(t *testing.T) {
+	raw, err := os.ReadFile("../../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		pages   string
+		reverse bool
+		want    []int32
+	}{
+		{"=:", false, []int32{1, 2, 3}},
+		{"=:", true, []int32{3, 2, 1}},
+		{"2", false, []int32{2}},
+		{"3:1", false, []int32{3, 2, 1}},
+		{"=1,=1,3", true, []int32{3, 1, 1}},
+	} {
+		t.Run(tc.pages, func(t *testing.T) {
+			o := new(bytes.Buffer)
+			err := process(o, raw, tc.pages, tc.reverse)
+			if err != nil {
+				t.Fatalf("could not select pages: %+v", err)
+			}
+
+			prog, err := dvi.Compile(o.Bytes())
+			if err != nil {
+				t.Fatalf("could not compile selected pages: %+v", err)
+			}
+			var got []int32
+			for i := 0; i < prog.NumPages(); i++ {
+				bop, _, err := prog.Page(i)
+				if err != nil {
+					t.Fatalf("could not read page %d: %+v", i, err)
+				}
+				got = append(got, bop.C0)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid pages: got=%v, want=%v", got, tc.want)
+			}
+		})
+	}
+
+	for _, pages := range []string{"", "=4", "x"} {
+		err := process(new(bytes.Buffer), raw, pages, false)
+		if err == nil {
+			t.Fatalf("expected an error for pages %q", pages)
+		}
+	}
+}
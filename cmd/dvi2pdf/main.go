@@ -0,0 +1,124 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi2pdf converts a DVI document into a PDF document.
+//
+// Usage:
+//
+//	$> dvi2pdf [options] input.dvi [output.pdf]
+//
+// The Type1 fonts used by the DVI document are embedded (as subsets) in
+// the PDF document.
+package main // import "star-tex.org/x/tex/cmd/dvi2pdf"
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/dvi/pdf"
+	"star-tex.org/x/tex/kpath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi2pdf: ")
+
+	var (
+		texmf = flag.String("texmf", "", "path to TexMF root")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi2pdf converts a DVI document into a PDF document.
+
+Usage: dvi2pdf [options] input.dvi [output.pdf]
+
+ex:
+ $> dvi2pdf ./testdata/hello_golden.dvi
+ $> dvi2pdf -texmf /usr/share/texmf ./testdata/hello_golden.dvi out.pdf
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	var (
+		iname = flag.Arg(0)
+		oname = strings.TrimSuffix(iname, ".dvi") + ".pdf"
+	)
+	if flag.NArg() > 1 {
+		oname = flag.Arg(1)
+	}
+
+	err := xmain(oname, iname, *texmf)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func xmain(oname, iname, texmf string) error {
+	ctx := kpath.New()
+	if texmf != "" {
+		var err error
+		ctx, err = kpath.NewFromFS(os.DirFS(texmf))
+		if err != nil {
+			return fmt.Errorf("could not create kpath context: %w", err)
+		}
+	}
+
+	raw, err := os.ReadFile(iname)
+	if err != nil {
+		return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+	}
+
+	o, err := os.Create(oname)
+	if err != nil {
+		return fmt.Errorf("could not create PDF file %q: %w", oname, err)
+	}
+	defer o.Close()
+
+	err = process(o, raw, ctx)
+	if err != nil {
+		return fmt.Errorf("could not convert DVI file %q: %w", iname, err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		return fmt.Errorf("could not close PDF file %q: %w", oname, err)
+	}
+
+	return nil
+}
+
+func process(w io.Writer, raw []byte, ctx kpath.Context) error {
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return fmt.Errorf("could not compile DVI program: %w", err)
+	}
+
+	rdr := pdf.New(w, ctx, prog.Pre())
+	vm := dvi.NewMachine(dvi.WithContext(ctx), dvi.WithRenderer(rdr))
+	err = vm.Run(prog)
+	if err != nil {
+		return fmt.Errorf("could not interpret DVI program: %w", err)
+	}
+
+	err = rdr.Close()
+	if err != nil {
+		return fmt.Errorf("could not render PDF document: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "dvi2pdf-")
+	if err != nil {
+		t.Fatalf("could not create tmp dir: %+v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{
+		"hello_golden",
+		"pages_golden",
+		"xcolor_golden",
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				iname = filepath.Join("../../testdata", name+".dvi")
+				oname = filepath.Join(tmp, name+".pdf")
+			)
+			err := xmain(oname, iname, "")
+			if err != nil {
+				t.Fatalf("could not convert DVI file: %+v", err)
+			}
+
+			raw, err := os.ReadFile(oname)
+			if err != nil {
+				t.Fatalf("could not read PDF file: %+v", err)
+			}
+			if !bytes.HasPrefix(raw, []byte("%PDF-")) {
+				t.Fatalf("invalid PDF header")
+			}
+			if !bytes.HasSuffix(raw, []byte("%%EOF\n")) {
+				t.Fatalf("invalid PDF trailer")
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi2png rasterizes the pages of a DVI document into PNG images.
+//
+// Usage:
+//
+//	$> dvi2png [options] input.dvi
+//
+// Each page is written to its own PNG file, named after the -o pattern.
+package main // import "star-tex.org/x/tex/cmd/dvi2png"
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"star-tex.org/x/tex/dvi"
+	dvipng "star-tex.org/x/tex/dvi/png"
+	"star-tex.org/x/tex/kpath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi2png: ")
+
+	var (
+		texmf = flag.String("texmf", "", "path to TexMF root")
+		oname = flag.String("o", "", "pattern of output PNG files (%d is replaced by the page number)")
+		pages = flag.String("pages", "", "comma-separated list of page ranges to render (e.g. 1-3,5,7-)")
+		dpi   = flag.Float64("dpi", 150, "resolution of the images, in dots per inch")
+		ss    = flag.Int("aa", 4, "supersampling factor for anti-aliasing (1 disables anti-aliasing)")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi2png rasterizes the pages of a DVI document into PNG images.
+
+Usage: dvi2png [options] input.dvi
+
+ex:
+ $> dvi2png ./testdata/hello_golden.dvi
+ $> dvi2png -dpi=300 -pages=1,3 -o out-%%d.png ./testdata/pages_golden.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	sel, err := parsePages(*pages)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	err = xmain(
+		*oname, flag.Arg(0), *texmf, sel,
+		dvipng.WithResolution(*dpi),
+		dvipng.WithSupersampling(*ss),
+	)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func xmain(oname, iname, texmf string, sel pageRanges, opts ...dvipng.Option) error {
+	ctx := kpath.New()
+	if texmf != "" {
+		var err error
+		ctx, err = kpath.NewFromFS(os.DirFS(texmf))
+		if err != nil {
+			return fmt.Errorf("could not create kpath context: %w", err)
+		}
+	}
+
+	raw, err := os.ReadFile(iname)
+	if err != nil {
+		return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+	}
+
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return fmt.Errorf("could not compile DVI program: %w", err)
+	}
+
+	err = sel.check(prog.NumPages())
+	if err != nil {
+		return err
+	}
+
+	// indices of the selected pages, only those are rasterized.
+	var pages []int
+	for i := 0; i < prog.NumPages(); i++ {
+		if sel.contains(i + 1) {
+			pages = append(pages, i)
+		}
+	}
+
+	switch {
+	case oname == "":
+		oname = strings.TrimSuffix(iname, ".dvi")
+		switch prog.NumPages() {
+		case 1:
+			oname += ".png"
+		default:
+			oname += "-%d.png"
+		}
+	case len(pages) > 1 && !strings.Contains(oname, "%d"):
+		return fmt.Errorf("output pattern %q must contain %%d to render %d pages", oname, len(pages))
+	}
+
+	out := func(page int, img *image.RGBA) error {
+		name := oname
+		if strings.Contains(name, "%d") {
+			name = strings.Replace(name, "%d", strconv.Itoa(pages[page]+1), -1)
+		}
+		buf := new(bytes.Buffer)
+		err := png.Encode(buf, img)
+		if err != nil {
+			return fmt.Errorf("could not encode PNG image: %w", err)
+		}
+		return os.WriteFile(name, buf.Bytes(), 0644)
+	}
+
+	rdr := dvipng.New(out, ctx, prog.Pre(), opts...)
+	vm := dvi.NewMachine(dvi.WithContext(ctx), dvi.WithRenderer(rdr))
+	err = vm.RunPages(prog, pages)
+	if err != nil {
+		return fmt.Errorf("could not interpret DVI program: %w", err)
+	}
+
+	err = rdr.Close()
+	if err != nil {
+		return fmt.Errorf("could not render PNG images: %w", err)
+	}
+
+	return nil
+}
+
+// pageRanges is a list of inclusive ranges of 1-based page numbers.
+// An empty list selects all pages.
+type pageRanges [][2]int
+
+func (prs pageRanges) contains(page int) bool {
+	if len(prs) == 0 {
+		return true
+	}
+	for _, pr := range prs {
+		if pr[0] <= page && page <= pr[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks that each range selects at least one of the n pages of
+// a document.
+func (prs pageRanges) check(n int) error {
+	for _, pr := range prs {
+		if pr[0] > n {
+			return fmt.Errorf("invalid page range starting at page %d: document has %d pages", pr[0], n)
+		}
+	}
+	return nil
+}
+
+// parsePages parses a comma-separated list of page ranges, e.g. "1-3,5,7-".
+func parsePages(s string) (pageRanges, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var prs pageRanges
+	for _, v := range strings.Split(s, ",") {
+		var (
+			pr   = [2]int{1, int(^uint(0) >> 1)}
+			toks = strings.SplitN(strings.TrimSpace(v), "-", 2)
+			err  error
+		)
+		if toks[0] != "" {
+			pr[0], err = strconv.Atoi(toks[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid page range %q: %w", v, err)
+			}
+		}
+		switch {
+		case len(toks) == 1:
+			pr[1] = pr[0]
+		case toks[1] != "":
+			pr[1], err = strconv.Atoi(toks[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid page range %q: %w", v, err)
+			}
+		}
+		if pr[0] < 1 || pr[1] < pr[0] {
+			return nil, fmt.Errorf("invalid page range %q", v)
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
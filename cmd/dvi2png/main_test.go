@@ -0,0 +1,137 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	dvipng "star-tex.org/x/tex/dvi/png"
+)
+
+func TestConvert(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "dvi2png-")
+	if err != nil {
+		t.Fatalf("could not create tmp dir: %+v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sel, err := parsePages("1,3")
+	if err != nil {
+		t.Fatalf("could not parse page ranges: %+v", err)
+	}
+
+	var (
+		iname = "../../testdata/pages_golden.dvi"
+		oname = filepath.Join(tmp, "pages-%d.png")
+	)
+	err = xmain(oname, iname, "", sel, dvipng.WithResolution(30), dvipng.WithSupersampling(2))
+	if err != nil {
+		t.Fatalf("could not convert DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"pages-1.png", true},
+		{"pages-2.png", false},
+		{"pages-3.png", true},
+	} {
+		f, err := os.Open(filepath.Join(tmp, tc.name))
+		if !tc.want {
+			if err == nil {
+				f.Close()
+				t.Fatalf("unexpected file %q", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("could not open PNG file: %+v", err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("could not decode PNG file %q: %+v", tc.name, err)
+		}
+		if got, want := img.Bounds().Dx(), 255; got != want {
+			t.Fatalf("invalid image width: got=%d, want=%d", got, want)
+		}
+	}
+
+	// a single selected page may be written without a %d pattern.
+	sel, err = parsePages("2")
+	if err != nil {
+		t.Fatalf("could not parse page ranges: %+v", err)
+	}
+	err = xmain(filepath.Join(tmp, "page.png"), iname, "", sel, dvipng.WithResolution(30))
+	if err != nil {
+		t.Fatalf("could not convert page 2: %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "page.png")); err != nil {
+		t.Fatalf("could not stat PNG file: %+v", err)
+	}
+
+	sel, err = parsePages("1,3")
+	if err != nil {
+		t.Fatalf("could not parse page ranges: %+v", err)
+	}
+	err = xmain(filepath.Join(tmp, "page.png"), iname, "", sel)
+	if got, want := fmt.Sprint(err), `output pattern "`+filepath.Join(tmp, "page.png")+`" must contain %d to render 2 pages`; got != want {
+		t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+	}
+
+	sel, err = parsePages("2,4-")
+	if err != nil {
+		t.Fatalf("could not parse page ranges: %+v", err)
+	}
+	err = xmain(oname, iname, "", sel)
+	if got, want := fmt.Sprint(err), "invalid page range starting at page 4: document has 3 pages"; got != want {
+		t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+	}
+}
+
+func TestParsePages(t *testing.T) {
+	for _, tc := range []struct {
+		str  string
+		want pageRanges
+		err  bool
+	}{
+		{str: "", want: nil},
+		{str: "1", want: pageRanges{{1, 1}}},
+		{str: "1-3, 5", want: pageRanges{{1, 3}, {5, 5}}},
+		{str: "-2,7-", want: pageRanges{{1, 2}, {7, int(^uint(0) >> 1)}}},
+		{str: "0", err: true},
+		{str: "3-1", err: true},
+		{str: "a-b", err: true},
+	} {
+		t.Run(tc.str, func(t *testing.T) {
+			got, err := parsePages(tc.str)
+			switch {
+			case err != nil && !tc.err:
+				t.Fatalf("could not parse page ranges: %+v", err)
+			case err == nil && tc.err:
+				t.Fatalf("expected an error")
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid page ranges: got=%v, want=%v", got, tc.want)
+			}
+		})
+	}
+
+	prs := pageRanges{{2, 3}}
+	if err := prs.check(2); err != nil {
+		t.Fatalf("could not check page ranges: %+v", err)
+	}
+	for page, want := range map[int]bool{1: false, 2: true, 3: true, 4: false} {
+		if got := prs.contains(page); got != want {
+			t.Fatalf("invalid selection of page %d: got=%v, want=%v", page, got, want)
+		}
+	}
+}
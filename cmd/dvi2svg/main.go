@@ -0,0 +1,143 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi2svg converts the pages of a DVI document into SVG documents.
+//
+// Usage:
+//
+//	$> dvi2svg [options] input.dvi
+//
+// Each page is written to its own SVG file, named after the -o pattern.
+package main // import "star-tex.org/x/tex/cmd/dvi2svg"
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/dvi/svg"
+	"star-tex.org/x/tex/kpath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi2svg: ")
+
+	var (
+		texmf  = flag.String("texmf", "", "path to TexMF root")
+		oname  = flag.String("o", "", "pattern of output SVG files (%d is replaced by the page number)")
+		tight  = flag.Bool("tight", false, "crop pages to the bounding box of their content")
+		margin = flag.Float64("margin", 0, "margin around the tight bounding box, in big points")
+		fonts  = flag.String("fonts", "", "comma-separated list of font=family mappings, rendered as SVG text")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi2svg converts the pages of a DVI document into SVG documents.
+
+Usage: dvi2svg [options] input.dvi
+
+ex:
+ $> dvi2svg ./testdata/hello_golden.dvi
+ $> dvi2svg -tight -margin=2 -o out-%%d.svg ./testdata/pages_golden.dvi
+ $> dvi2svg -fonts=cmr10=serif,cmmi10=serif ./testdata/hello_golden.dvi
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	fmap, err := parseFontMap(*fonts)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	opts := []svg.Option{svg.WithFontMap(fmap)}
+	if *tight {
+		opts = append(opts, svg.WithTightBBox(*margin))
+	}
+
+	err = xmain(*oname, flag.Arg(0), *texmf, opts...)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func xmain(oname, iname, texmf string, opts ...svg.Option) error {
+	ctx := kpath.New()
+	if texmf != "" {
+		var err error
+		ctx, err = kpath.NewFromFS(os.DirFS(texmf))
+		if err != nil {
+			return fmt.Errorf("could not create kpath context: %w", err)
+		}
+	}
+
+	raw, err := os.ReadFile(iname)
+	if err != nil {
+		return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+	}
+
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return fmt.Errorf("could not compile DVI program: %w", err)
+	}
+
+	if oname == "" {
+		oname = strings.TrimSuffix(iname, ".dvi")
+		switch prog.NumPages() {
+		case 1:
+			oname += ".svg"
+		default:
+			oname += "-%d.svg"
+		}
+	}
+
+	out := func(page int, data []byte) error {
+		name := oname
+		if strings.Contains(name, "%d") {
+			name = strings.Replace(name, "%d", fmt.Sprint(page+1), -1)
+		}
+		return os.WriteFile(name, data, 0644)
+	}
+
+	rdr := svg.New(out, ctx, prog.Pre(), opts...)
+	vm := dvi.NewMachine(dvi.WithContext(ctx), dvi.WithRenderer(rdr))
+	err = vm.Run(prog)
+	if err != nil {
+		return fmt.Errorf("could not interpret DVI program: %w", err)
+	}
+
+	err = rdr.Close()
+	if err != nil {
+		return fmt.Errorf("could not render SVG documents: %w", err)
+	}
+
+	return nil
+}
+
+// parseFontMap parses a comma-separated list of font=family mappings.
+func parseFontMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		toks := strings.SplitN(v, "=", 2)
+		if len(toks) != 2 || toks[0] == "" || toks[1] == "" {
+			return nil, fmt.Errorf("invalid font mapping %q", v)
+		}
+		m[strings.TrimSpace(toks[0])] = strings.TrimSpace(toks[1])
+	}
+	return m, nil
+}
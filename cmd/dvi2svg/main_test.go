@@ -0,0 +1,82 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/dvi/svg"
+)
+
+func TestConvert(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "dvi2svg-")
+	if err != nil {
+		t.Fatalf("could not create tmp dir: %+v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, tc := range []struct {
+		name  string
+		oname string
+		opts  []svg.Option
+		want  []string
+	}{
+		{
+			name:  "hello_golden",
+			oname: "hello.svg",
+			want:  []string{"hello.svg"},
+		},
+		{
+			name:  "pages_golden",
+			oname: "pages-%d.svg",
+			opts:  []svg.Option{svg.WithTightBBox(2)},
+			want:  []string{"pages-1.svg", "pages-2.svg", "pages-3.svg"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				iname = filepath.Join("../../testdata", tc.name+".dvi")
+				oname = filepath.Join(tmp, tc.oname)
+			)
+			err := xmain(oname, iname, "", tc.opts...)
+			if err != nil {
+				t.Fatalf("could not convert DVI file: %+v", err)
+			}
+
+			for _, name := range tc.want {
+				raw, err := os.ReadFile(filepath.Join(tmp, name))
+				if err != nil {
+					t.Fatalf("could not read SVG file: %+v", err)
+				}
+				if !bytes.Contains(raw, []byte("<svg ")) {
+					t.Fatalf("invalid SVG file %q", name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFontMap(t *testing.T) {
+	got, err := parseFontMap("cmr10=serif, cmmi10 = Latin Modern Math")
+	if err != nil {
+		t.Fatalf("could not parse font map: %+v", err)
+	}
+	want := map[string]string{
+		"cmr10":  "serif",
+		"cmmi10": "Latin Modern Math",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid font map: got=%v, want=%v", got, want)
+	}
+
+	_, err = parseFontMap("cmr10")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command dvi2txt extracts the plain text of a DVI document.
+//
+// Usage:
+//
+//	$> dvi2txt [options] input.dvi [output.txt]
+//
+// Pages are written in order, separated by form feeds.
+package main // import "star-tex.org/x/tex/cmd/dvi2txt"
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/kpath"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dvi2txt: ")
+
+	var (
+		texmf = flag.String("texmf", "", "path to TexMF root")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `dvi2txt extracts the plain text of a DVI document.
+
+Usage: dvi2txt [options] input.dvi [output.txt]
+
+The text is written to stdout when no output file is provided.
+
+ex:
+ $> dvi2txt ./testdata/hello_golden.dvi
+ $> dvi2txt -texmf /usr/share/texmf ./testdata/hello_golden.dvi out.txt
+
+options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		log.Fatalf("missing input dvi file")
+	}
+
+	oname := ""
+	if flag.NArg() > 1 {
+		oname = flag.Arg(1)
+	}
+
+	err := xmain(oname, flag.Arg(0), *texmf)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+}
+
+func xmain(oname, iname, texmf string) error {
+	ctx := kpath.New()
+	if texmf != "" {
+		var err error
+		ctx, err = kpath.NewFromFS(os.DirFS(texmf))
+		if err != nil {
+			return fmt.Errorf("could not create kpath context: %w", err)
+		}
+	}
+
+	raw, err := os.ReadFile(iname)
+	if err != nil {
+		return fmt.Errorf("could not read DVI file %q: %w", iname, err)
+	}
+
+	if oname == "" {
+		o := bufio.NewWriter(os.Stdout)
+		defer o.Flush()
+		err = process(o, raw, ctx)
+		if err != nil {
+			return fmt.Errorf("could not extract text of DVI file %q: %w", iname, err)
+		}
+		return o.Flush()
+	}
+
+	o, err := os.Create(oname)
+	if err != nil {
+		return fmt.Errorf("could not create text file %q: %w", oname, err)
+	}
+	defer o.Close()
+
+	err = process(o, raw, ctx)
+	if err != nil {
+		return fmt.Errorf("could not extract text of DVI file %q: %w", iname, err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		return fmt.Errorf("could not close text file %q: %w", oname, err)
+	}
+
+	return nil
+}
+
+func process(w io.Writer, raw []byte, ctx kpath.Context) error {
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		return fmt.Errorf("could not compile DVI program: %w", err)
+	}
+
+	pages, err := dvi.Text(prog, dvi.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	for i, page := range pages {
+		if i > 0 {
+			_, err = io.WriteString(w, "\f")
+			if err != nil {
+				return fmt.Errorf("could not write text: %w", err)
+			}
+		}
+		_, err = io.WriteString(w, page)
+		if err != nil {
+			return fmt.Errorf("could not write text: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// gf-dump displays the content of a GF font file in a human-readable
+// format, as the gftype command of TeX Live.
+//
+// Usage: gf-dump [options] file.gf [output.txt]
+//
+// ex:
+//
+//	$> gf-dump ./font/gf/testdata/cmr10.gf
+//	$> gf-dump -mnemonics -images ./font/gf/testdata/cmr10.gf out.txt
+package main // import "star-tex.org/x/tex/cmd/gf-dump"
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/font/gf"
+)
+
+func init() {
+	log.SetPrefix("gf-dump: ")
+	log.SetFlags(0)
+
+	flag.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: gf-dump [options] file.gf [output.txt]
+
+gf-dump displays the content of a GF font file in a human-readable format.
+
+ex:
+ $> gf-dump ./font/gf/testdata/cmr10.gf
+ $> gf-dump -mnemonics -images ./font/gf/testdata/cmr10.gf out.txt
+
+options:
+`,
+		)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	var (
+		mnemonics = flag.Bool("mnemonics", false, "display the commands of each character")
+		images    = flag.Bool("images", false, "display the bitmap of each character")
+	)
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		log.Fatalf("missing path to input GF file")
+	}
+
+	xmain(flag.Args(), *mnemonics, *images)
+}
+
+func xmain(args []string, mnemonics, images bool) {
+	fname := args[0]
+	f, err := os.Open(fname)
+	if err != nil {
+		log.Fatalf("could not open file %q: %+v", fname, err)
+	}
+	defer f.Close()
+
+	var (
+		o     io.Writer = os.Stdout
+		oname           = ""
+	)
+
+	if len(args) > 1 {
+		oname = args[1]
+		txt, err := os.Create(oname)
+		if err != nil {
+			log.Fatalf("could not create output file %q: %+v", oname, err)
+		}
+		defer func() {
+			err := txt.Close()
+			if err != nil {
+				log.Fatalf("could not close output file %q: %+v", oname, err)
+			}
+		}()
+		o = txt
+	}
+
+	err = process(o, f, mnemonics, images)
+	if err != nil {
+		log.Fatalf("could not process GF file %q: %+v", fname, err)
+	}
+}
+
+func process(w io.Writer, r io.Reader, mnemonics, images bool) error {
+	fnt, err := gf.Parse(r)
+	if err != nil {
+		return fmt.Errorf("could not parse GF file: %w", err)
+	}
+
+	err = fnt.WriteText(w, mnemonics, images)
+	if err != nil {
+		return fmt.Errorf("could not write GF text: %w", err)
+	}
+
+	return nil
+}
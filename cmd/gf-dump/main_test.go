@@ -0,0 +1,66 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	for _, name := range []string{
+		"../../font/gf/testdata/cmr10.gf",
+	} {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatalf("could not open GF file: %+v", err)
+			}
+			defer f.Close()
+
+			o := new(bytes.Buffer)
+			err = process(o, f, false, false)
+			if err != nil {
+				t.Fatalf("could not process GF file: %+v", err)
+			}
+
+			want, err := os.ReadFile(strings.Replace(name, ".gf", "_golden.txt", 1))
+			if err != nil {
+				t.Fatalf("could not open reference file: %+v", err)
+			}
+
+			if got, want := o.Bytes(), want; !bytes.Equal(got, want) {
+				t.Fatalf("GF text outputs differ")
+			}
+		})
+	}
+}
+
+func TestProcessImages(t *testing.T) {
+	f, err := os.Open("../../font/gf/testdata/cmr10.gf")
+	if err != nil {
+		t.Fatalf("could not open GF file: %+v", err)
+	}
+	defer f.Close()
+
+	o := new(bytes.Buffer)
+	err = process(o, f, true, true)
+	if err != nil {
+		t.Fatalf("could not process GF file: %+v", err)
+	}
+
+	for _, want := range []string{
+		"34: beginning of char 65: 3<=m<=57 0<=n<=59\n(initially n=59) paint (26) 3\n42: newrow 26 (n=58) paint 3\n",
+		"250: eoc\n.<--This pixel's lower left corner is at (3,60) in METAFONT coordinates\n                          ***\n",
+		"*****************               ***********************\n'<--This pixel's upper left corner is at (3,0) in METAFONT coordinates\n",
+	} {
+		if !strings.Contains(o.String(), want) {
+			t.Fatalf("missing text output:\n%s", want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// gftopk converts a GF font file into a PK font file, as the gftopk
+// command of TeX Live.
+//
+// Usage: gftopk [options] file.gf [file.pk]
+//
+// ex:
+//
+//	$> gftopk ./font/gf/testdata/cmr10.gf
+//	$> gftopk ./font/gf/testdata/cmr10.gf cmr10.600pk
+package main // import "star-tex.org/x/tex/cmd/gftopk"
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"star-tex.org/x/tex/font/gf"
+	"star-tex.org/x/tex/font/pk"
+)
+
+func init() {
+	log.SetPrefix("gftopk: ")
+	log.SetFlags(0)
+
+	flag.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: gftopk [options] file.gf [file.pk]
+
+gftopk converts a GF font file into a PK font file.
+The PK file is named after the GF file when not provided.
+
+ex:
+ $> gftopk ./font/gf/testdata/cmr10.gf
+ $> gftopk ./font/gf/testdata/cmr10.gf cmr10.600pk
+
+options:
+`,
+		)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		log.Fatalf("missing path to input GF file")
+	}
+
+	xmain(flag.Args())
+}
+
+func xmain(args []string) {
+	fname := args[0]
+	f, err := os.Open(fname)
+	if err != nil {
+		log.Fatalf("could not open file %q: %+v", fname, err)
+	}
+	defer f.Close()
+
+	oname := pkName(fname)
+	if len(args) > 1 {
+		oname = args[1]
+	}
+
+	o, err := os.Create(oname)
+	if err != nil {
+		log.Fatalf("could not create output file %q: %+v", oname, err)
+	}
+	defer o.Close()
+
+	err = process(o, f)
+	if err != nil {
+		log.Fatalf("could not process GF file %q: %+v", fname, err)
+	}
+
+	err = o.Close()
+	if err != nil {
+		log.Fatalf("could not close output file %q: %+v", oname, err)
+	}
+}
+
+// pkName returns the name of the PK file for the provided GF file, in
+// the current directory: cmr10.600gf becomes cmr10.600pk.
+func pkName(fname string) string {
+	name := filepath.Base(fname)
+	if strings.HasSuffix(name, "gf") {
+		return strings.TrimSuffix(name, "gf") + "pk"
+	}
+	return name + ".pk"
+}
+
+func process(w io.Writer, r io.Reader) error {
+	src, err := gf.Parse(r)
+	if err != nil {
+		return fmt.Errorf("could not parse GF file: %w", err)
+	}
+
+	fnt, err := convert(&src)
+	if err != nil {
+		return fmt.Errorf("could not convert GF file: %w", err)
+	}
+
+	raw, err := fnt.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("could not encode PK file: %w", err)
+	}
+
+	_, err = w.Write(raw)
+	if err != nil {
+		return fmt.Errorf("could not write PK file: %w", err)
+	}
+
+	return nil
+}
+
+// convert converts the GF font into a PK font.
+// Blank rows and columns around the bitmap of each glyph are removed.
+func convert(src *gf.Font) (pk.Font, error) {
+	glyphs := make([]pk.Glyph, 0, src.NumGlyphs())
+	for _, g := range src.Glyphs() {
+		var (
+			mask       = g.Mask()
+			bbox       = blackBounds(mask)
+			dx, dy     = g.Escapement()
+			hoff, voff = g.Offset()
+		)
+		switch {
+		case bbox.Empty():
+			hoff, voff = 0, 0
+		default:
+			hoff -= int32(bbox.Min.X)
+			voff -= int32(bbox.Min.Y)
+		}
+		glyphs = append(glyphs, pk.NewGlyph(
+			g.Code(), g.Width(), dx, dy, hoff, voff,
+			mask.SubImage(bbox).(*image.Alpha),
+		))
+	}
+
+	specials := make([]pk.Special, 0, len(src.Specials()))
+	for _, spec := range src.Specials() {
+		specials = append(specials, pk.Special{
+			Data:    spec.Data,
+			Value:   spec.Value,
+			Numeric: spec.Numeric,
+		})
+	}
+
+	hppp, vppp := src.PixelsPerPoint()
+	return pk.New(
+		src.Comment(), src.DesignSize(), src.Checksum(), hppp, vppp,
+		glyphs, specials,
+	)
+}
+
+// blackBounds returns the smallest rectangle containing all the black
+// pixels of the bitmap.
+func blackBounds(mask *image.Alpha) image.Rectangle {
+	var bbox image.Rectangle
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		for x := mask.Rect.Min.X; x < mask.Rect.Max.X; x++ {
+			if mask.AlphaAt(x, y).A < 0x80 {
+				continue
+			}
+			bbox = bbox.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return bbox
+}
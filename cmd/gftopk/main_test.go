@@ -0,0 +1,51 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	f, err := os.Open("../../font/gf/testdata/cmr10.gf")
+	if err != nil {
+		t.Fatalf("could not open GF file: %+v", err)
+	}
+	defer f.Close()
+
+	o := new(bytes.Buffer)
+	err = process(o, f)
+	if err != nil {
+		t.Fatalf("could not process GF file: %+v", err)
+	}
+
+	want, err := os.ReadFile("../../font/pk/testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not read reference file: %+v", err)
+	}
+
+	if !bytes.Equal(o.Bytes(), want) {
+		t.Fatalf("PK outputs differ")
+	}
+}
+
+func TestPKName(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"cmr10.600gf", "cmr10.600pk"},
+		{"./fonts/cmr10.gf", "cmr10.pk"},
+		{"cmr10", "cmr10.pk"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pkName(tc.name); got != tc.want {
+				t.Fatalf("invalid PK name: got=%q, want=%q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// pk-dump displays the content of a PK font file in a human-readable
+// format, as the pktype command of TeX Live.
+//
+// Usage: pk-dump [options] file.pk [output.txt]
+//
+// ex:
+//
+//	$> pk-dump ./font/pk/testdata/cmr10.pk
+//	$> pk-dump ./font/pk/testdata/cmr10.pk out.txt
+package main // import "star-tex.org/x/tex/cmd/pk-dump"
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/font/pk"
+)
+
+func init() {
+	log.SetPrefix("pk-dump: ")
+	log.SetFlags(0)
+
+	flag.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			`Usage: pk-dump [options] file.pk [output.txt]
+
+pk-dump displays the content of a PK font file in a human-readable format.
+
+ex:
+ $> pk-dump ./font/pk/testdata/cmr10.pk
+ $> pk-dump ./font/pk/testdata/cmr10.pk out.txt
+
+options:
+`,
+		)
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		log.Fatalf("missing path to input PK file")
+	}
+
+	xmain(flag.Args())
+}
+
+func xmain(args []string) {
+	fname := args[0]
+	f, err := os.Open(fname)
+	if err != nil {
+		log.Fatalf("could not open file %q: %+v", fname, err)
+	}
+	defer f.Close()
+
+	var (
+		o     io.Writer = os.Stdout
+		oname           = ""
+	)
+
+	if len(args) > 1 {
+		oname = args[1]
+		txt, err := os.Create(oname)
+		if err != nil {
+			log.Fatalf("could not create output file %q: %+v", oname, err)
+		}
+		defer func() {
+			err := txt.Close()
+			if err != nil {
+				log.Fatalf("could not close output file %q: %+v", oname, err)
+			}
+		}()
+		o = txt
+	}
+
+	err = process(o, f)
+	if err != nil {
+		log.Fatalf("could not process PK file %q: %+v", fname, err)
+	}
+}
+
+func process(w io.Writer, r io.Reader) error {
+	fnt, err := pk.Parse(r)
+	if err != nil {
+		return fmt.Errorf("could not parse PK file: %w", err)
+	}
+
+	txt, err := fnt.MarshalText()
+	if err != nil {
+		return fmt.Errorf("could not encode PK file: %w", err)
+	}
+
+	_, err = w.Write(txt)
+	if err != nil {
+		return fmt.Errorf("could not write PK text: %w", err)
+	}
+
+	return nil
+}
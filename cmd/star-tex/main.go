@@ -20,12 +20,14 @@ import (
 
 var (
 	fset = flag.NewFlagSet("star-tex", flag.ContinueOnError)
+	opdf = fset.Bool("pdf", false, "enable PDF output")
 
-	usage = `Usage: star-tex [options] FILE.tex [FILE.dvi]
+	usage = `Usage: star-tex [options] FILE.tex [FILE.dvi|FILE.pdf]
 
 ex:
  $> star-tex ./testdata/hello.tex
  $> star-tex ./testdata/hello.tex ./out.dvi
+ $> star-tex -pdf ./testdata/hello.tex ./out.pdf
 
 options:
 `
@@ -58,26 +60,31 @@ func xmain(stdout, stderr io.Writer, args []string) int {
 		return 1
 	}
 
-	f, err := os.Open(args[0])
+	f, err := os.Open(fset.Arg(0))
 	if err != nil {
 		msg.Printf("could not open input TeX file: %+v", err)
 		return 1
 	}
 	defer f.Close()
 
-	oname := strings.Replace(filepath.Base(f.Name()), ".tex", ".dvi", 1)
-	if len(args) > 1 {
-		oname = args[1]
+	format, ext := tex.DVI, ".dvi"
+	if *opdf {
+		format, ext = tex.PDF, ".pdf"
+	}
+
+	oname := strings.Replace(filepath.Base(f.Name()), ".tex", ext, 1)
+	if fset.NArg() > 1 {
+		oname = fset.Arg(1)
 	}
 
 	o, err := os.Create(oname)
 	if err != nil {
-		msg.Printf("could not open output DVI file: %+v", err)
+		msg.Printf("could not open output file: %+v", err)
 		return 1
 	}
 	defer o.Close()
 
-	err = process(o, f, os.Stderr)
+	err = process(o, f, os.Stderr, format)
 	if err != nil {
 		msg.Printf("could not run star-tex: %+v", err)
 		return 1
@@ -85,16 +92,17 @@ func xmain(stdout, stderr io.Writer, args []string) int {
 
 	err = o.Close()
 	if err != nil {
-		msg.Printf("could not close output DVI file: %+v", err)
+		msg.Printf("could not close output file: %+v", err)
 		return 1
 	}
 
 	return 0
 }
 
-func process(o io.Writer, f io.Reader, stderr io.Writer) error {
+func process(o io.Writer, f io.Reader, stderr io.Writer, format tex.OutputFormat) error {
 	ctx := tex.NewEngine(stderr, os.Stdin)
 	ctx.Jobname = jobNameFrom(o)
+	ctx.Output = format
 	return ctx.Process(o, f)
 }
 
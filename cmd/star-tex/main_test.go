@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"star-tex.org/x/tex"
 	"star-tex.org/x/tex/internal/xtex"
 )
 
@@ -38,7 +39,7 @@ func TestProcess(t *testing.T) {
 			o := new(bytes.Buffer)
 			msg := new(bytes.Buffer)
 
-			err = process(o, r, msg)
+			err = process(o, r, msg, tex.DVI)
 			if err != nil {
 				t.Fatalf("could not process TeX document: %+v", err)
 			}
@@ -50,8 +51,61 @@ func TestProcess(t *testing.T) {
 
 			if got, want := o.Bytes(), want; !bytes.Equal(got, want) {
 				_ = os.WriteFile(oname, got, 0644)
-				t.Fatalf("DVI files compare different")
+				t.Fatalf("DVI files compare different (see: dvi-diff %s %s)", strings.Replace(name, ".tex", "_golden.dvi", 1), oname)
 			}
 		})
 	}
 }
+
+func TestProcessPDF(t *testing.T) {
+	xtex.TimeNow = func() time.Time {
+		return time.Date(1776, time.July, 4, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		xtex.TimeNow = time.Now
+	}()
+
+	const doc = `
+\pdfinfo{/Title (Hello)}
+\pdfoutline goto name{sec1} count 1 {Section}
+\pdfoutline goto page 1 {/Fit} {Subsection}
+\pdfdest name{sec1} xyz
+Hello, \pdfliteral{1 0 0 rg}World!
+\pdfannot width 2cm height 1cm depth 0pt {/Subtype /Link /A << /S /URI /URI (https://star-tex.org) >>}
+\pdfobj{<< /Foo (bar) >>}\message{obj=\the\pdflastobj}
+\bye
+`
+
+	o := new(bytes.Buffer)
+	msg := new(bytes.Buffer)
+
+	err := process(o, strings.NewReader(doc), msg, tex.PDF)
+	if err != nil {
+		t.Fatalf("could not process TeX document: %+v", err)
+	}
+
+	got := o.String()
+	for _, want := range []string{
+		"%PDF-1.5\n",
+		"/Type /Pages /Kids [",
+		"/Count 1 >>",
+		"/Type /Annot /Rect [",
+		"/URI (https://star-tex.org)",
+		"/Names << /Dests",
+		"(sec1) [",
+		"/Type /Outlines",
+		"/Title (Subsection)",
+		"/BaseFont /CMR10",
+		"/FontFile ",
+		"<< /Foo (bar) >>",
+		"/Title (Hello) /Producer (star-tex) /CreationDate (D:17760704120000)",
+		"startxref\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in PDF output", want)
+		}
+	}
+	if !strings.HasSuffix(got, "%%EOF\n") {
+		t.Errorf("invalid PDF trailer")
+	}
+}
@@ -6,6 +6,7 @@ package dvi
 
 import (
 	"fmt"
+	"unicode/utf16"
 
 	"star-tex.org/x/tex/internal/iobuf"
 )
@@ -207,6 +208,11 @@ type CmdBOP struct {
 
 func (CmdBOP) opcode() opCode { return opBOP }
 func (CmdBOP) Name() string   { return "bop" }
+
+// counts returns the \count0 to \count9 values of the page.
+func (c CmdBOP) counts() [10]int32 {
+	return [10]int32{c.C0, c.C1, c.C2, c.C3, c.C4, c.C5, c.C6, c.C7, c.C8, c.C9}
+}
 func (c CmdBOP) write(w *iobuf.Writer) {
 	w.WriteU8(uint8(c.opcode()))
 	w.WriteI32(c.C0)
@@ -834,7 +840,7 @@ func (c *CmdFntDef1) read(r *iobuf.Reader) {
 	c.Design = r.ReadI32()
 	area := r.ReadU8()
 	font := r.ReadU8()
-	buf := r.ReadBuf(int(area + font))
+	buf := r.ReadBuf(int(area) + int(font))
 	c.Area = string(buf[:area])
 	c.Font = string(buf[area:])
 }
@@ -869,7 +875,7 @@ func (c *CmdFntDef2) read(r *iobuf.Reader) {
 	c.Design = r.ReadI32()
 	area := r.ReadU8()
 	font := r.ReadU8()
-	buf := r.ReadBuf(int(area + font))
+	buf := r.ReadBuf(int(area) + int(font))
 	c.Area = string(buf[:area])
 	c.Font = string(buf[area:])
 }
@@ -904,7 +910,7 @@ func (c *CmdFntDef3) read(r *iobuf.Reader) {
 	c.Design = r.ReadI32()
 	area := r.ReadU8()
 	font := r.ReadU8()
-	buf := r.ReadBuf(int(area + font))
+	buf := r.ReadBuf(int(area) + int(font))
 	c.Area = string(buf[:area])
 	c.Font = string(buf[area:])
 }
@@ -939,7 +945,7 @@ func (c *CmdFntDef4) read(r *iobuf.Reader) {
 	c.Design = r.ReadI32()
 	area := r.ReadU8()
 	font := r.ReadU8()
-	buf := r.ReadBuf(int(area + font))
+	buf := r.ReadBuf(int(area) + int(font))
 	c.Area = string(buf[:area])
 	c.Font = string(buf[area:])
 }
@@ -1040,3 +1046,272 @@ func (c *CmdPostPost) read(r *iobuf.Reader) {
 		c.Trailer++
 	}
 }
+
+// XDV flags of native fonts.
+const (
+	XDVFlagVertical   = 0x0100 // the font is used for vertical text.
+	XDVFlagColored    = 0x0200 // the font definition holds a color.
+	XDVFlagVariations = 0x0800 // the font definition holds variation axes (XDV-5 only).
+	XDVFlagExtend     = 0x1000 // the font definition holds a horizontal extension.
+	XDVFlagSlant      = 0x2000 // the font definition holds a slant.
+	XDVFlagEmbolden   = 0x4000 // the font definition holds an emboldening factor.
+)
+
+// CmdPicFile includes a picture file in an XDV document.
+type CmdPicFile struct {
+	Flags  uint8    `json:"flags"`
+	Matrix [6]int32 `json:"matrix"` // Matrix is the transformation matrix of the picture, in 16.16 fixed point.
+	Page   uint16   `json:"page"`   // Page is the page of the picture file to include.
+	Path   string   `json:"path"`
+}
+
+func (CmdPicFile) opcode() opCode { return opPicFile }
+func (CmdPicFile) Name() string   { return "pic_file" }
+func (c CmdPicFile) write(w *iobuf.Writer) {
+	w.WriteU8(uint8(c.opcode()))
+	w.WriteU8(c.Flags)
+	for _, v := range c.Matrix {
+		w.WriteI32(v)
+	}
+	w.WriteU16(c.Page)
+	w.WriteU16(uint16(len(c.Path)))
+	w.WriteBuf([]byte(c.Path))
+}
+func (c *CmdPicFile) read(r *iobuf.Reader) {
+	_ = r.ReadU8()
+	c.Flags = r.ReadU8()
+	for i := range c.Matrix {
+		c.Matrix[i] = r.ReadI32()
+	}
+	c.Page = r.ReadU16()
+	n := r.ReadU16()
+	c.Path = string(r.ReadBuf(int(n)))
+}
+
+// CmdNativeFontDef defines a native (OpenType or TrueType) font of an XDV
+// document.
+//
+// XDV-6 and XDV-7 documents define native fonts by file and index.
+// XDV-5 documents define them by PostScript, family and style names.
+type CmdNativeFontDef struct {
+	ID       int32  `json:"id"`
+	Size     int32  `json:"size"`
+	Flags    uint16 `json:"flags"`
+	Font     string `json:"font"`             // Font is the path to the font file, or the PostScript name of the font.
+	Family   string `json:"family,omitempty"` // Family is the family name of the font (XDV-5 only).
+	Style    string `json:"style,omitempty"`  // Style is the style name of the font (XDV-5 only).
+	Index    uint32 `json:"index"`            // Index is the index of the font within its file.
+	Color    uint32 `json:"rgba,omitempty"`
+	Extend   int32  `json:"extend,omitempty"`
+	Slant    int32  `json:"slant,omitempty"`
+	Embolden int32  `json:"embolden,omitempty"`
+
+	byName bool   // whether the font is defined by name, as in XDV-5.
+	vars   string // variation axes and values of XDV-5 definitions, as encoded.
+}
+
+func (CmdNativeFontDef) opcode() opCode { return opNativeFontDef }
+func (CmdNativeFontDef) Name() string   { return "native_font_def" }
+func (c CmdNativeFontDef) write(w *iobuf.Writer) {
+	w.WriteU8(uint8(c.opcode()))
+	w.WriteI32(c.ID)
+	w.WriteI32(c.Size)
+	w.WriteU16(c.Flags)
+	if c.byName {
+		w.WriteU8(uint8(len(c.Font)))
+		w.WriteU8(uint8(len(c.Family)))
+		w.WriteU8(uint8(len(c.Style)))
+		w.WriteBuf([]byte(c.Font))
+		w.WriteBuf([]byte(c.Family))
+		w.WriteBuf([]byte(c.Style))
+	} else {
+		w.WriteU8(uint8(len(c.Font)))
+		w.WriteBuf([]byte(c.Font))
+		w.WriteU32(c.Index)
+	}
+	if c.Flags&XDVFlagColored != 0 {
+		w.WriteU32(c.Color)
+	}
+	if c.byName && c.Flags&XDVFlagVariations != 0 {
+		if c.vars == "" {
+			w.WriteU16(0) // no variation axes.
+		}
+		w.WriteBuf([]byte(c.vars))
+	}
+	if c.Flags&XDVFlagExtend != 0 {
+		w.WriteI32(c.Extend)
+	}
+	if c.Flags&XDVFlagSlant != 0 {
+		w.WriteI32(c.Slant)
+	}
+	if c.Flags&XDVFlagEmbolden != 0 {
+		w.WriteI32(c.Embolden)
+	}
+}
+func (c *CmdNativeFontDef) read(r *iobuf.Reader) {
+	_ = r.ReadU8()
+	c.ID = r.ReadI32()
+	c.Size = r.ReadI32()
+	c.Flags = r.ReadU16()
+	if c.byName {
+		var (
+			n1 = r.ReadU8()
+			n2 = r.ReadU8()
+			n3 = r.ReadU8()
+		)
+		c.Font = string(r.ReadBuf(int(n1)))
+		c.Family = string(r.ReadBuf(int(n2)))
+		c.Style = string(r.ReadBuf(int(n3)))
+	} else {
+		n := r.ReadU8()
+		c.Font = string(r.ReadBuf(int(n)))
+		c.Index = r.ReadU32()
+	}
+	if c.Flags&XDVFlagColored != 0 {
+		c.Color = r.ReadU32()
+	}
+	if c.byName && c.Flags&XDVFlagVariations != 0 {
+		beg := r.Pos()
+		n := r.ReadU16()
+		r.SetPos(beg)
+		c.vars = string(r.ReadBuf(2 + 8*int(n)))
+	}
+	if c.Flags&XDVFlagExtend != 0 {
+		c.Extend = r.ReadI32()
+	}
+	if c.Flags&XDVFlagSlant != 0 {
+		c.Slant = r.ReadI32()
+	}
+	if c.Flags&XDVFlagEmbolden != 0 {
+		c.Embolden = r.ReadI32()
+	}
+}
+
+// Glyph is a glyph of a native font, positioned relatively to the current
+// position.
+type Glyph struct {
+	X  int32  `json:"x"`
+	Y  int32  `json:"y"`
+	ID uint16 `json:"id"` // ID is the index of the glyph in the native font.
+}
+
+func writeGlyphs(w *iobuf.Writer, width int32, glyphs []Glyph) {
+	w.WriteI32(width)
+	w.WriteU16(uint16(len(glyphs)))
+	for _, g := range glyphs {
+		w.WriteI32(g.X)
+		w.WriteI32(g.Y)
+	}
+	for _, g := range glyphs {
+		w.WriteU16(g.ID)
+	}
+}
+
+func readGlyphs(r *iobuf.Reader) (int32, []Glyph) {
+	width := r.ReadI32()
+	glyphs := make([]Glyph, r.ReadU16())
+	for i := range glyphs {
+		glyphs[i].X = r.ReadI32()
+		glyphs[i].Y = r.ReadI32()
+	}
+	for i := range glyphs {
+		glyphs[i].ID = r.ReadU16()
+	}
+	return width, glyphs
+}
+
+// CmdGlyphs typesets glyphs of the current native font, and moves right
+// by Width.
+type CmdGlyphs struct {
+	Width  int32   `json:"w"`
+	Glyphs []Glyph `json:"glyphs"`
+}
+
+func (CmdGlyphs) opcode() opCode { return opGlyphs }
+func (CmdGlyphs) Name() string   { return "glyphs" }
+func (c CmdGlyphs) write(w *iobuf.Writer) {
+	w.WriteU8(uint8(c.opcode()))
+	writeGlyphs(w, c.Width, c.Glyphs)
+}
+func (c *CmdGlyphs) read(r *iobuf.Reader) {
+	_ = r.ReadU8()
+	c.Width, c.Glyphs = readGlyphs(r)
+}
+
+// CmdGlyphString typesets glyphs of the current native font on the
+// baseline, and moves right by Width.
+// It is the command of opcode 254 in XDV-5 and XDV-6 documents.
+type CmdGlyphString struct {
+	Width  int32   `json:"w"`
+	Glyphs []Glyph `json:"glyphs"` // Y is always zero.
+}
+
+func (CmdGlyphString) opcode() opCode { return opTextAndGlyphs }
+func (CmdGlyphString) Name() string   { return "glyph_string" }
+func (c CmdGlyphString) write(w *iobuf.Writer) {
+	w.WriteU8(uint8(c.opcode()))
+	w.WriteI32(c.Width)
+	w.WriteU16(uint16(len(c.Glyphs)))
+	for _, g := range c.Glyphs {
+		w.WriteI32(g.X)
+	}
+	for _, g := range c.Glyphs {
+		w.WriteU16(g.ID)
+	}
+}
+func (c *CmdGlyphString) read(r *iobuf.Reader) {
+	_ = r.ReadU8()
+	c.Width = r.ReadI32()
+	c.Glyphs = make([]Glyph, r.ReadU16())
+	for i := range c.Glyphs {
+		c.Glyphs[i].X = r.ReadI32()
+	}
+	for i := range c.Glyphs {
+		c.Glyphs[i].ID = r.ReadU16()
+	}
+}
+
+// CmdTextAndGlyphs typesets glyphs of the current native font, together
+// with the text they represent, and moves right by Width.
+type CmdTextAndGlyphs struct {
+	Text   string  `json:"text"`
+	Width  int32   `json:"w"`
+	Glyphs []Glyph `json:"glyphs"`
+}
+
+func (CmdTextAndGlyphs) opcode() opCode { return opTextAndGlyphs }
+func (CmdTextAndGlyphs) Name() string   { return "text_and_glyphs" }
+func (c CmdTextAndGlyphs) write(w *iobuf.Writer) {
+	w.WriteU8(uint8(c.opcode()))
+	text := utf16.Encode([]rune(c.Text))
+	w.WriteU16(uint16(len(text)))
+	for _, v := range text {
+		w.WriteU16(v)
+	}
+	writeGlyphs(w, c.Width, c.Glyphs)
+}
+func (c *CmdTextAndGlyphs) read(r *iobuf.Reader) {
+	_ = r.ReadU8()
+	text := make([]uint16, r.ReadU16())
+	for i := range text {
+		text[i] = r.ReadU16()
+	}
+	c.Text = string(utf16.Decode(text))
+	c.Width, c.Glyphs = readGlyphs(r)
+}
+
+// CmdDir sets the writing direction of a pTeX document.
+type CmdDir struct {
+	Dir Dir `json:"dir"`
+}
+
+func (CmdDir) opcode() opCode { return opDir }
+func (CmdDir) Name() string   { return "dir" }
+func (c CmdDir) write(w *iobuf.Writer) {
+	w.WriteU8(uint8(c.opcode()))
+	w.WriteU8(uint8(c.Dir))
+}
+func (c *CmdDir) read(r *iobuf.Reader) {
+	_ = r.ReadU8()
+	c.Dir = Dir(r.ReadU8())
+}
@@ -0,0 +1,230 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// colorSpecial handles the dvips color specials:
+//   - color push <color>
+//   - color pop
+//   - color <color>
+//   - background <color>
+func (m *Machine) colorSpecial(kind string, args []string) error {
+	switch kind {
+	case "color":
+		if len(args) == 0 {
+			return fmt.Errorf("dvi: missing color specification")
+		}
+		switch args[0] {
+		case "push":
+			c, err := parseColor(args[1:])
+			if err != nil {
+				return err
+			}
+			m.state.colors = append(m.state.colors, c)
+		case "pop":
+			if len(m.state.colors) <= 1 {
+				return fmt.Errorf("dvi: color stack underflow")
+			}
+			m.state.colors = m.state.colors[:len(m.state.colors)-1]
+		default:
+			c, err := parseColor(args)
+			if err != nil {
+				return err
+			}
+			// setting a color discards the whole color stack.
+			m.state.colors = append(m.state.colors[:0], c)
+		}
+	case "background":
+		c, err := parseColor(args)
+		if err != nil {
+			return err
+		}
+		if rdr, ok := m.rdr.(BackgroundRenderer); ok {
+			rdr.Background(c)
+		}
+	}
+	return nil
+}
+
+// color returns the current color.
+func (m *Machine) color() color.Color {
+	return m.state.colors[len(m.state.colors)-1]
+}
+
+// parseColor parses a dvips color specification.
+func parseColor(args []string) (color.Color, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("dvi: missing color specification")
+	}
+
+	model, args := args[0], args[1:]
+	vs := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("dvi: invalid %s color value %q: %w", model, arg, err)
+		}
+		vs[i] = clamp01(v)
+	}
+
+	want := 0
+	switch model {
+	case "gray":
+		want = 1
+	case "rgb", "hsb":
+		want = 3
+	case "cmyk":
+		want = 4
+	default:
+		c, ok := namedColors[model]
+		if !ok {
+			return nil, fmt.Errorf("dvi: unknown color %q", model)
+		}
+		return c, nil
+	}
+	if len(vs) != want {
+		return nil, fmt.Errorf(
+			"dvi: invalid number of %s color values (got=%d, want=%d)",
+			model, len(vs), want,
+		)
+	}
+
+	switch model {
+	case "gray":
+		return color.Gray{Y: u8(vs[0])}, nil
+	case "rgb":
+		return color.RGBA{R: u8(vs[0]), G: u8(vs[1]), B: u8(vs[2]), A: 0xff}, nil
+	case "hsb":
+		r, g, b := hsb2rgb(vs[0], vs[1], vs[2])
+		return color.RGBA{R: u8(r), G: u8(g), B: u8(b), A: 0xff}, nil
+	default:
+		return color.CMYK{C: u8(vs[0]), M: u8(vs[1]), Y: u8(vs[2]), K: u8(vs[3])}, nil
+	}
+}
+
+// hsb2rgb converts a color from the HSB (a.k.a. HSV) model to RGB.
+func hsb2rgb(h, s, b float64) (float64, float64, float64) {
+	if s == 0 {
+		return b, b, b
+	}
+	h = 6 * h
+	i := math.Floor(h)
+	f := h - i
+	var (
+		p = b * (1 - s)
+		q = b * (1 - s*f)
+		t = b * (1 - s*(1-f))
+	)
+	switch int(i) % 6 {
+	case 0:
+		return b, t, p
+	case 1:
+		return q, b, p
+	case 2:
+		return p, b, t
+	case 3:
+		return p, q, b
+	case 4:
+		return t, p, b
+	default:
+		return b, p, q
+	}
+}
+
+func clamp01(v float64) float64 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 1:
+		return 1
+	}
+	return v
+}
+
+func u8(v float64) uint8 {
+	return uint8(math.Round(v * 0xff))
+}
+
+func cmyk(c, m, y, k float64) color.Color {
+	return color.CMYK{C: u8(c), M: u8(m), Y: u8(y), K: u8(k)}
+}
+
+// namedColors holds the named colors of dvips (see color.pro).
+var namedColors = map[string]color.Color{
+	"GreenYellow":    cmyk(0.15, 0, 0.69, 0),
+	"Yellow":         cmyk(0, 0, 1, 0),
+	"Goldenrod":      cmyk(0, 0.10, 0.84, 0),
+	"Dandelion":      cmyk(0, 0.29, 0.84, 0),
+	"Apricot":        cmyk(0, 0.32, 0.52, 0),
+	"Peach":          cmyk(0, 0.50, 0.70, 0),
+	"Melon":          cmyk(0, 0.46, 0.50, 0),
+	"YellowOrange":   cmyk(0, 0.42, 1, 0),
+	"Orange":         cmyk(0, 0.61, 0.87, 0),
+	"BurntOrange":    cmyk(0, 0.51, 1, 0),
+	"Bittersweet":    cmyk(0, 0.75, 1, 0.24),
+	"RedOrange":      cmyk(0, 0.77, 0.87, 0),
+	"Mahogany":       cmyk(0, 0.85, 0.87, 0.35),
+	"Maroon":         cmyk(0, 0.87, 0.68, 0.32),
+	"BrickRed":       cmyk(0, 0.89, 0.94, 0.28),
+	"Red":            cmyk(0, 1, 1, 0),
+	"OrangeRed":      cmyk(0, 1, 0.50, 0),
+	"RubineRed":      cmyk(0, 1, 0.13, 0),
+	"WildStrawberry": cmyk(0, 0.96, 0.39, 0),
+	"Salmon":         cmyk(0, 0.53, 0.38, 0),
+	"CarnationPink":  cmyk(0, 0.63, 0, 0),
+	"Magenta":        cmyk(0, 1, 0, 0),
+	"VioletRed":      cmyk(0, 0.81, 0, 0),
+	"Rhodamine":      cmyk(0, 0.82, 0, 0),
+	"Mulberry":       cmyk(0.34, 0.90, 0, 0.02),
+	"RedViolet":      cmyk(0.07, 0.90, 0, 0.34),
+	"Fuchsia":        cmyk(0.47, 0.91, 0, 0.08),
+	"Lavender":       cmyk(0, 0.48, 0, 0),
+	"Thistle":        cmyk(0.12, 0.59, 0, 0),
+	"Orchid":         cmyk(0.32, 0.64, 0, 0),
+	"DarkOrchid":     cmyk(0.40, 0.80, 0.20, 0),
+	"Purple":         cmyk(0.45, 0.86, 0, 0),
+	"Plum":           cmyk(0.50, 1, 0, 0),
+	"Violet":         cmyk(0.79, 0.88, 0, 0),
+	"RoyalPurple":    cmyk(0.75, 0.90, 0, 0),
+	"BlueViolet":     cmyk(0.86, 0.91, 0, 0.04),
+	"Periwinkle":     cmyk(0.57, 0.55, 0, 0),
+	"CadetBlue":      cmyk(0.62, 0.57, 0.23, 0),
+	"CornflowerBlue": cmyk(0.65, 0.13, 0, 0),
+	"MidnightBlue":   cmyk(0.98, 0.13, 0, 0.43),
+	"NavyBlue":       cmyk(0.94, 0.54, 0, 0),
+	"RoyalBlue":      cmyk(1, 0.50, 0, 0),
+	"Blue":           cmyk(1, 1, 0, 0),
+	"Cerulean":       cmyk(0.94, 0.11, 0, 0),
+	"Cyan":           cmyk(1, 0, 0, 0),
+	"ProcessBlue":    cmyk(0.96, 0, 0, 0),
+	"SkyBlue":        cmyk(0.62, 0, 0.12, 0),
+	"Turquoise":      cmyk(0.85, 0, 0.20, 0),
+	"TealBlue":       cmyk(0.86, 0, 0.34, 0.02),
+	"Aquamarine":     cmyk(0.82, 0, 0.30, 0),
+	"BlueGreen":      cmyk(0.85, 0, 0.33, 0),
+	"Emerald":        cmyk(1, 0, 0.50, 0),
+	"JungleGreen":    cmyk(0.99, 0, 0.52, 0),
+	"SeaGreen":       cmyk(0.69, 0, 0.50, 0),
+	"Green":          cmyk(1, 0, 1, 0),
+	"ForestGreen":    cmyk(0.91, 0, 0.88, 0.12),
+	"PineGreen":      cmyk(0.92, 0, 0.59, 0.25),
+	"LimeGreen":      cmyk(0.50, 0, 1, 0),
+	"YellowGreen":    cmyk(0.44, 0, 0.74, 0),
+	"SpringGreen":    cmyk(0.26, 0, 0.76, 0),
+	"OliveGreen":     cmyk(0.64, 0, 0.95, 0.40),
+	"RawSienna":      cmyk(0, 0.72, 1, 0.45),
+	"Sepia":          cmyk(0, 0.83, 1, 0.70),
+	"Brown":          cmyk(0, 0.81, 1, 0.60),
+	"Tan":            cmyk(0.14, 0.42, 0.56, 0),
+	"Gray":           cmyk(0, 0, 0, 0.50),
+	"Black":          cmyk(0, 0, 0, 1),
+	"White":          cmyk(0, 0, 0, 0),
+}
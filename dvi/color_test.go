@@ -0,0 +1,180 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want color.Color
+		err  string
+	}{
+		{spec: "gray 0", want: color.Gray{Y: 0}},
+		{spec: "gray 0.5", want: color.Gray{Y: 128}},
+		{spec: "rgb 1 0 0", want: color.RGBA{R: 255, A: 255}},
+		{spec: "rgb 0 0 1.5", want: color.RGBA{B: 255, A: 255}},
+		{spec: "cmyk 0 1 1 0", want: color.CMYK{M: 255, Y: 255}},
+		{spec: "hsb 0 1 1", want: color.RGBA{R: 255, A: 255}},
+		{spec: "hsb 0.5 1 1", want: color.RGBA{G: 255, B: 255, A: 255}},
+		{spec: "hsb 0 0 0.5", want: color.RGBA{R: 128, G: 128, B: 128, A: 255}},
+		{spec: "Red", want: color.CMYK{M: 255, Y: 255}},
+		{spec: "Black", want: color.CMYK{K: 255}},
+		{spec: "", err: "dvi: missing color specification"},
+		{spec: "rgb 1 0", err: "dvi: invalid number of rgb color values (got=2, want=3)"},
+		{spec: "gray x", err: `dvi: invalid gray color value "x": strconv.ParseFloat: parsing "x": invalid syntax`},
+		{spec: "NotAColor", err: `dvi: unknown color "NotAColor"`},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			got, err := parseColor(strings.Fields(tc.spec))
+			switch {
+			case err != nil && tc.err != "":
+				if got, want := err.Error(), tc.err; got != want {
+					t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+				}
+				return
+			case err != nil:
+				t.Fatalf("could not parse color: %+v", err)
+			case tc.err != "":
+				t.Fatalf("expected an error (%s)", tc.err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid color: got=%#v, want=%#v", got, tc.want)
+			}
+		})
+	}
+}
+
+type colorRenderer struct {
+	nopRenderer
+	calls []string
+}
+
+func (rdr *colorRenderer) BOP(bop *CmdBOP) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("bop %d", bop.C0))
+}
+
+func (rdr *colorRenderer) Background(c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("background %v", c))
+}
+
+func (rdr *colorRenderer) DrawRule(x, y, w, h int32, c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("rule %v", c))
+}
+
+func TestColorSpecials(t *testing.T) {
+	prog := writeProgram(t, CmdPre{}, [][]Cmd{
+		{
+			&CmdXXX1{Value: []byte("background gray 0.5")},
+			&CmdSetRule{Height: 10, Width: 10},
+			&CmdXXX1{Value: []byte("color push rgb 1 0 0")},
+			&CmdSetRule{Height: 10, Width: 10},
+			&CmdXXX1{Value: []byte("color push Blue")},
+			&CmdSetRule{Height: 10, Width: 10},
+			&CmdXXX1{Value: []byte("color pop")},
+			&CmdPutRule{Height: 10, Width: 10},
+		},
+		{
+			&CmdSetRule{Height: 10, Width: 10},
+			&CmdXXX1{Value: []byte("color pop")},
+			&CmdSetRule{Height: 10, Width: 10},
+			&CmdXXX1{Value: []byte("color push gray 1")},
+			&CmdXXX1{Value: []byte("color cmyk 0 0 0 0.5")},
+			&CmdSetRule{Height: 10, Width: 10},
+			&CmdXXX1{Value: []byte("ps: unrelated")},
+		},
+	})
+
+	rdr := new(colorRenderer)
+	vm := NewMachine(WithRenderer(rdr))
+	err := vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI document: %+v", err)
+	}
+
+	want := []string{
+		"bop 1",
+		"background {128}",
+		"rule {0}",
+		"rule {255 0 0 255}",
+		"rule {255 255 0 0}",
+		"rule {255 0 0 255}",
+		// the color stack is reset at each page.
+		"bop 2",
+		"rule {0}",
+		"rule {0}",
+		"rule {0 0 0 128}",
+	}
+	if !reflect.DeepEqual(rdr.calls, want) {
+		t.Fatalf("invalid renderer calls:\ngot= %q\nwant=%q", rdr.calls, want)
+	}
+
+	// only the provided pages are run.
+	rdr.calls = nil
+	err = vm.RunPages(prog, []int{1})
+	if err != nil {
+		t.Fatalf("could not run page 2: %+v", err)
+	}
+	if got, want := rdr.calls[0], "bop 2"; got != want {
+		t.Fatalf("invalid first page: got=%q, want=%q", got, want)
+	}
+	err = vm.RunPages(prog, []int{2})
+	if got, want := fmt.Sprint(err), "dvi: invalid page index 2"; got != want {
+		t.Fatalf("invalid error: got=%s, want=%s", got, want)
+	}
+
+	// the color stack is reset for each run.
+	rdr.calls = nil
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not re-run DVI document: %+v", err)
+	}
+	if got, want := rdr.calls[2], "rule {0}"; got != want {
+		t.Fatalf("invalid color after reset: got=%q, want=%q", got, want)
+	}
+}
+
+func TestColorSpecialsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		special string
+		want    string
+	}{
+		{"color pop", "dvi: color stack underflow"},
+		{"color", "dvi: missing color specification"},
+		{"color push", "dvi: missing color specification"},
+		{"color push NotAColor", `dvi: unknown color "NotAColor"`},
+		{"background rgb 1", "dvi: invalid number of rgb color values (got=1, want=3)"},
+	} {
+		t.Run(tc.special, func(t *testing.T) {
+			prog := writeProgram(t, CmdPre{}, [][]Cmd{{
+				&CmdXXX1{Value: []byte(tc.special)},
+				&CmdSetRule{Height: 10, Width: 10},
+			}})
+
+			// invalid color specials are reported and ignored.
+			var (
+				log = new(strings.Builder)
+				rdr = new(colorRenderer)
+				vm  = NewMachine(WithRenderer(rdr), WithLogOutput(log))
+			)
+			err := vm.Run(prog)
+			if err != nil {
+				t.Fatalf("could not run DVI document: %+v", err)
+			}
+			if want := "(warning: " + tc.want + ")"; !strings.Contains(log.String(), want) {
+				t.Fatalf("could not find warning %q in log:\n%s", want, log.String())
+			}
+			if got, want := rdr.calls, []string{"bop 1", "rule {0}"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid renderer calls:\ngot= %q\nwant=%q", got, want)
+			}
+		})
+	}
+}
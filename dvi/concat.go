@@ -0,0 +1,94 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Concat writes to w a new DVI document made of the pages of the provided
+// programs, one after the other.
+//
+// The preamble of the first program is kept. Lengths of the other programs
+// are converted to its units and magnification, so that their pages keep
+// their physical size.
+// Fonts with identical definitions share a single font number, and fonts
+// whose numbers conflict with the ones of previous programs are renumbered.
+// The back-pointers of the pages and the postamble are computed anew.
+func Concat(w io.Writer, progs ...Program) error {
+	if len(progs) == 0 {
+		return fmt.Errorf("dvi: no DVI program to concatenate")
+	}
+
+	var (
+		pre  = progs[0].Pre()
+		dw   = NewWriter(w, pre)
+		defs = make(map[int]bool)
+		ids  = make(map[FontDef]int) // output font numbers, keyed by definitions without ID.
+		used = make(map[int]bool)    // output font numbers already assigned.
+	)
+	pre = dw.pre
+	for i, prog := range progs {
+		if prog.pre.Num == 0 || prog.pre.Den == 0 || prog.pre.Mag == 0 {
+			return fmt.Errorf("dvi: invalid preamble of program %d", i+1)
+		}
+		var (
+			// unit converts DVI units of the program to the output units.
+			unit = float64(int64(prog.pre.Num)*int64(pre.Den)) / float64(int64(prog.pre.Den)*int64(pre.Num))
+			// mag converts magnified lengths of the program to the output magnification.
+			mag = float64(prog.pre.Mag) / float64(pre.Mag)
+
+			fonts = make(map[int]FontDef, len(prog.fonts))
+		)
+		for _, def := range prog.Fonts() {
+			src := def.ID
+			def.Size = int32(math.Round(float64(def.Size) * unit * mag))
+			def.Design = int32(math.Round(float64(def.Design) * unit))
+
+			key := def
+			key.ID = 0
+			id, ok := ids[key]
+			if !ok {
+				id = src
+				for used[id] {
+					id++
+				}
+				ids[key] = id
+				used[id] = true
+			}
+			def.ID = id
+			fonts[src] = def
+		}
+
+		tr := transformer{
+			w:     dw,
+			prog:  prog,
+			scale: unit * mag,
+			defs:  defs,
+			fonts: fonts,
+		}
+		for j := 0; j < prog.NumPages(); j++ {
+			bop, cmds, err := prog.Page(j)
+			if err != nil {
+				return fmt.Errorf("dvi: could not read page %d of program %d: %w", j+1, i+1, err)
+			}
+			err = dw.BeginPage(bop.counts())
+			if err != nil {
+				return err
+			}
+			err = tr.page(cmds)
+			if err != nil {
+				return fmt.Errorf("dvi: could not write page %d of program %d: %w", j+1, i+1, err)
+			}
+			err = dw.EndPage()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return dw.Close()
+}
@@ -0,0 +1,144 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	const pt = 1 << 16
+
+	build := func(pre CmdPre, fonts []FontDef) Program {
+		t.Helper()
+		pages := make([][]Cmd, len(fonts))
+		for i, def := range fonts {
+			pages[i] = []Cmd{
+				&CmdFntDef1{ID: uint8(def.ID), Size: def.Size, Design: def.Design, Font: def.Name},
+				&CmdDown4{Value: def.Size},
+				&CmdRight4{Value: def.Size},
+				&CmdFntNum{ID: uint8(def.ID)},
+				&CmdSetChar{Value: 'a'},
+			}
+		}
+		return writeProgram(t, pre, pages)
+	}
+
+	var (
+		a = build(CmdPre{Msg: "chapter 1"}, []FontDef{
+			{ID: 0, Size: 10 * pt, Design: 10 * pt, Name: "cmr10"},
+			{ID: 1, Size: 12 * pt, Design: 10 * pt, Name: "cmr10"},
+		})
+		// same fonts, with a magnification of 2 and units of 2sp.
+		b = build(CmdPre{Num: 2 * TeXNum, Mag: 2000, Msg: "chapter 2"}, []FontDef{
+			{ID: 1, Size: 5 * pt / 2, Design: 5 * pt, Name: "cmr10"},
+			{ID: 3, Size: 3 * pt, Design: 5 * pt, Name: "cmr10"},
+			{ID: 0, Size: 5 * pt, Design: 5 * pt, Name: "cmbx10"},
+		})
+	)
+
+	buf := new(bytes.Buffer)
+	err := Concat(buf, a, b)
+	if err != nil {
+		t.Fatalf("could not concatenate DVI documents: %+v", err)
+	}
+	prog, err := Compile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not compile concatenated DVI document: %+v", err)
+	}
+
+	if got, want := prog.Comment(), a.Comment(); got != want {
+		t.Fatalf("invalid comment: got=%q, want=%q", got, want)
+	}
+	if got, want := prog.NumPages(), 5; got != want {
+		t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+	}
+	if got, want := prog.post.Pages, uint16(5); got != want {
+		t.Fatalf("invalid postamble number of pages: got=%d, want=%d", got, want)
+	}
+	if got, want := prog.Fonts(), []FontDef{
+		{ID: 0, Size: 10 * pt, Design: 10 * pt, Name: "cmr10"},
+		{ID: 1, Size: 12 * pt, Design: 10 * pt, Name: "cmr10"},
+		{ID: 2, Size: 20 * pt, Design: 10 * pt, Name: "cmbx10"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid fonts:\ngot= %+v\nwant=%+v", got, want)
+	}
+
+	var counts []int32
+	for i := 0; i < prog.NumPages(); i++ {
+		bop, _, err := prog.Page(i)
+		if err != nil {
+			t.Fatalf("could not read page %d: %+v", i+1, err)
+		}
+		counts = append(counts, bop.C0)
+	}
+	if got, want := counts, []int32{1, 2, 1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid page counts: got=%v, want=%v", got, want)
+	}
+
+	pages, err := recordPages(prog, nil)
+	if err != nil {
+		t.Fatalf("could not run concatenated DVI document: %+v", err)
+	}
+	for i, want := range []diffItem{
+		{x: 10 * pt, y: 10 * pt, size: 10 * pt},
+		{x: 12 * pt, y: 12 * pt, size: 12 * pt},
+		{x: 10 * pt, y: 10 * pt, size: 10 * pt},
+		{x: 12 * pt, y: 12 * pt, size: 12 * pt},
+		{x: 20 * pt, y: 20 * pt, size: 20 * pt},
+	} {
+		it := pages[i].items[0]
+		if it.x != want.x || it.y != want.y || it.size != want.size {
+			t.Fatalf("invalid glyph on page %d: got=(%d, %d) size=%d, want=(%d, %d) size=%d",
+				i+1, it.x, it.y, it.size, want.x, want.y, want.size,
+			)
+		}
+	}
+
+	err = Concat(new(bytes.Buffer))
+	if err == nil {
+		t.Fatalf("expected an error without DVI documents")
+	}
+}
+
+func TestConcatGolden(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	prog, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = Concat(buf, prog, prog)
+	if err != nil {
+		t.Fatalf("could not concatenate DVI documents: %+v", err)
+	}
+	cat, err := Compile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not compile concatenated DVI document: %+v", err)
+	}
+	if got, want := cat.Fonts(), prog.Fonts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid fonts:\ngot= %+v\nwant=%+v", got, want)
+	}
+
+	got, err := Text(cat)
+	if err != nil {
+		t.Fatalf("could not extract text: %+v", err)
+	}
+	want, err := Text(prog)
+	if err != nil {
+		t.Fatalf("could not extract text: %+v", err)
+	}
+	want = append(want, want...)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid text:\ngot= %q\nwant=%q", got, want)
+	}
+}
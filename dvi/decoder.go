@@ -0,0 +1,502 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// Decoder decodes DVI commands from an input stream.
+//
+// Decoder reads its input incrementally: only the command being decoded
+// is held in memory.
+type Decoder struct {
+	r   *bufio.Reader
+	buf []byte // bytes of the command being decoded
+	pos int64  // position of the next command
+	err error
+
+	page bool  // whether decoding stops after the first eop.
+	vers uint8 // DVI id of the document, or zero if unknown.
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Pos returns the position in the input stream of the next command.
+func (dec *Decoder) Pos() int64 {
+	return dec.pos
+}
+
+// Next decodes and returns the next DVI command.
+// Next returns io.EOF after the post_post command has been decoded.
+func (dec *Decoder) Next() (Cmd, error) {
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	cmd, err := dec.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		dec.err = fmt.Errorf("dvi: could not decode command at %d: %w", dec.pos, err)
+		return nil, dec.err
+	}
+
+	switch op := cmd.opcode(); {
+	case op == opPostPost:
+		dec.err = io.EOF
+	case op == opEOP && dec.page:
+		dec.err = io.EOF
+	}
+	return cmd, nil
+}
+
+func (dec *Decoder) next() (Cmd, error) {
+	v, err := dec.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	op := opCode(v[0])
+	if !op.valid(dec.vers) {
+		return nil, fmt.Errorf("unknown opcode %d", op)
+	}
+
+	// commands may alias their input buffer (e.g. xxx), so it can not be
+	// reused across commands.
+	dec.buf = nil
+	n, err := cmdSize(op, dec.vers, dec.field)
+	if err != nil {
+		return nil, err
+	}
+	err = dec.fill(n)
+	if err != nil {
+		return nil, err
+	}
+	buf := dec.buf
+	if op == opPostPost {
+		// consume the trailing 223's.
+		for {
+			c, err := dec.r.ReadByte()
+			if err != nil {
+				break
+			}
+			if c != dviEOF {
+				_ = dec.r.UnreadByte()
+				break
+			}
+			buf = append(buf, c)
+		}
+	}
+
+	cmd := op.cmdOf(dec.vers)
+	cmd.read(iobuf.NewReader(buf))
+	if pre, ok := cmd.(*CmdPre); ok {
+		dec.vers = pre.Version
+	}
+	dec.pos += int64(len(buf))
+	return cmd, nil
+}
+
+// cmdSize returns the size in bytes of a command with opcode op, in a
+// document with the provided DVI id.
+// field returns the big-endian unsigned integer of n bytes located at
+// offset off of the command.
+func cmdSize(op opCode, version uint8, field func(off, n int) (int, error)) (int, error) {
+	switch {
+	case op < opSet1:
+		return 1, nil
+	case op <= opSet4:
+		return 1 + int(op-opSet1) + 1, nil
+	case op == opSetRule, op == opPutRule:
+		return 9, nil
+	case op <= opPut4:
+		return 1 + int(op-opPut1) + 1, nil
+	case op == opNOP, op == opEOP, op == opPush, op == opPop:
+		return 1, nil
+	case op == opBOP:
+		return 45, nil
+	case op <= opRight4:
+		return 1 + int(op-opRight1) + 1, nil
+	case op == opW0, op == opX0, op == opY0, op == opZ0:
+		return 1, nil
+	case op <= opW4:
+		return 1 + int(op-opW1) + 1, nil
+	case op <= opX4:
+		return 1 + int(op-opX1) + 1, nil
+	case op <= opDown4:
+		return 1 + int(op-opDown1) + 1, nil
+	case op <= opY4:
+		return 1 + int(op-opY1) + 1, nil
+	case op <= opZ4:
+		return 1 + int(op-opZ1) + 1, nil
+	case op < opFnt1:
+		return 1, nil
+	case op <= opFnt4:
+		return 1 + int(op-opFnt1) + 1, nil
+	case op <= opXXX4:
+		k := int(op-opXXX1) + 1
+		n, err := field(1, k)
+		if err != nil {
+			return 0, err
+		}
+		return 1 + k + n, nil
+	case op <= opFntDef4:
+		k := int(op-opFntDef1) + 1
+		hdr := 1 + k + 4 + 4 + 4
+		a, err := field(hdr, 1)
+		if err != nil {
+			return 0, err
+		}
+		l, err := field(hdr+1, 1)
+		if err != nil {
+			return 0, err
+		}
+		return hdr + 2 + a + l, nil
+	case op == opPre:
+		k, err := field(14, 1)
+		if err != nil {
+			return 0, err
+		}
+		return 15 + k, nil
+	case op == opPost:
+		return 29, nil
+	case op == opPostPost:
+		return 6, nil
+	case op == opPicFile:
+		n, err := field(28, 2)
+		if err != nil {
+			return 0, err
+		}
+		return 30 + n, nil
+	case op == opNativeFontDef && version == xdv5Version:
+		flags, err := field(9, 2)
+		if err != nil {
+			return 0, err
+		}
+		n := 14
+		for i := 0; i < 3; i++ {
+			l, err := field(11+i, 1)
+			if err != nil {
+				return 0, err
+			}
+			n += l
+		}
+		if flags&XDVFlagColored != 0 {
+			n += 4
+		}
+		if flags&XDVFlagVariations != 0 {
+			nv, err := field(n, 2)
+			if err != nil {
+				return 0, err
+			}
+			n += 2 + 8*nv
+		}
+		for _, flag := range []int{XDVFlagExtend, XDVFlagSlant, XDVFlagEmbolden} {
+			if flags&flag != 0 {
+				n += 4
+			}
+		}
+		return n, nil
+	case op == opNativeFontDef:
+		flags, err := field(9, 2)
+		if err != nil {
+			return 0, err
+		}
+		l, err := field(11, 1)
+		if err != nil {
+			return 0, err
+		}
+		n := 12 + l + 4
+		for _, flag := range []int{XDVFlagColored, XDVFlagExtend, XDVFlagSlant, XDVFlagEmbolden} {
+			if flags&flag != 0 {
+				n += 4
+			}
+		}
+		return n, nil
+	case op == opGlyphs:
+		n, err := field(5, 2)
+		if err != nil {
+			return 0, err
+		}
+		return 7 + 10*n, nil
+	case op == opTextAndGlyphs && (version == xdv5Version || version == xdv6Version):
+		n, err := field(5, 2)
+		if err != nil {
+			return 0, err
+		}
+		return 7 + 6*n, nil
+	case op == opTextAndGlyphs:
+		l, err := field(1, 2)
+		if err != nil {
+			return 0, err
+		}
+		hdr := 3 + 2*l + 4
+		n, err := field(hdr, 2)
+		if err != nil {
+			return 0, err
+		}
+		return hdr + 2 + 10*n, nil
+	case op == opDir:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("unknown opcode %d", op)
+}
+
+// chunkSize is the maximum number of bytes read at once by a Decoder.
+const chunkSize = 64 << 10
+
+// fill reads the command being decoded until it holds n bytes.
+//
+// The command is read by chunks, and its buffer grows with the bytes
+// actually read, so that the lengths of corrupted commands can not
+// trigger large allocations.
+func (dec *Decoder) fill(n int) error {
+	for len(dec.buf) < n {
+		var (
+			m = len(dec.buf)
+			k = n - m
+		)
+		if k > chunkSize {
+			k = chunkSize
+		}
+		if cap(dec.buf) < m+k {
+			c := 2*m + k
+			if c > n {
+				c = n
+			}
+			buf := make([]byte, m, c)
+			copy(buf, dec.buf)
+			dec.buf = buf
+		}
+		dec.buf = dec.buf[:m+k]
+		_, err := io.ReadFull(dec.r, dec.buf[m:])
+		if err != nil {
+			dec.buf = dec.buf[:m]
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCmd checks that the command at the current position of r, with
+// opcode op, lies within the input of a document with the provided DVI id.
+func checkCmd(r *iobuf.Reader, op opCode, version uint8) error {
+	if r.Pos() < 0 || r.Pos() >= r.Len() {
+		return io.ErrUnexpectedEOF
+	}
+	p := r.Bytes()
+	n, err := cmdSize(op, version, func(off, n int) (int, error) {
+		if off+n > len(p) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return beUint(p[off : off+n])
+	})
+	if err != nil {
+		return err
+	}
+	if n > len(p) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// field returns the big-endian unsigned integer of n bytes, located
+// at offset off of the command being decoded.
+// The fields of a command are thus read one after the other, and may lie
+// beyond the buffer of the underlying reader.
+func (dec *Decoder) field(off, n int) (int, error) {
+	err := dec.fill(off + n)
+	if err != nil {
+		return 0, err
+	}
+	return beUint(dec.buf[off : off+n])
+}
+
+// beUint decodes the provided big-endian unsigned length.
+func beUint(p []byte) (int, error) {
+	var v uint64
+	for _, c := range p {
+		v = v<<8 | uint64(c)
+	}
+	if v > 1<<31-1 {
+		return 0, fmt.Errorf("invalid length %d", v)
+	}
+	return int(v), nil
+}
+
+// PageReader provides random access to the pages of a DVI document.
+//
+// PageReader reads the postamble of the document first, and then seeks
+// to the requested pages.
+type PageReader struct {
+	r    io.ReaderAt
+	size int64
+
+	pre     CmdPre
+	post    CmdPost
+	fonts   []FontDef
+	natives []CmdNativeFontDef
+	pages   []int64 // positions of the bop commands
+}
+
+// NewPageReader returns a PageReader reading the DVI document of the
+// provided size from r.
+func NewPageReader(r io.ReaderAt, size int64) (*PageReader, error) {
+	pr := &PageReader{r: r, size: size}
+
+	dec := NewDecoder(io.NewSectionReader(r, 0, size))
+	cmd, err := dec.Next()
+	if err != nil {
+		return nil, fmt.Errorf("dvi: could not read preamble: %w", err)
+	}
+	pre, ok := cmd.(*CmdPre)
+	if !ok {
+		return nil, errNoPre
+	}
+	pr.pre = *pre
+
+	post, err := pr.postPointer()
+	if err != nil {
+		return nil, err
+	}
+
+	dec = NewDecoder(io.NewSectionReader(r, post, size-post))
+	dec.pos = post
+	dec.vers = pr.pre.Version
+	cmd, err = dec.Next()
+	if err != nil {
+		return nil, fmt.Errorf("dvi: could not read postamble: %w", err)
+	}
+	p, ok := cmd.(*CmdPost)
+	if !ok {
+		return nil, fmt.Errorf("dvi: could not locate postamble: %w", errInvalidDVI)
+	}
+	pr.post = *p
+
+loop:
+	for {
+		cmd, err := dec.Next()
+		if err != nil {
+			return nil, fmt.Errorf("dvi: could not read postamble: %w", err)
+		}
+		switch cmd := cmd.(type) {
+		case *CmdFntDef1:
+			pr.fonts = append(pr.fonts, FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+		case *CmdFntDef2:
+			pr.fonts = append(pr.fonts, FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+		case *CmdFntDef3:
+			pr.fonts = append(pr.fonts, FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+		case *CmdFntDef4:
+			pr.fonts = append(pr.fonts, FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+		case *CmdNativeFontDef:
+			pr.natives = append(pr.natives, *cmd)
+		case *CmdNOP:
+		case *CmdPostPost:
+			break loop
+		default:
+			return nil, fmt.Errorf("dvi: invalid command %s in postamble: %w", cmd.Name(), errInvalidDVI)
+		}
+	}
+
+	// walk the back-pointers of the pages.
+	pr.pages = make([]int64, int(pr.post.Pages))
+	var (
+		bop = int64(int32(pr.post.BOP))
+		buf = make([]byte, 45)
+	)
+	for i := len(pr.pages) - 1; i >= 0; i-- {
+		if bop < 0 || bop+int64(len(buf)) > size {
+			return nil, fmt.Errorf("dvi: invalid pointer to page %d: %w", i, errInvalidDVI)
+		}
+		_, err = r.ReadAt(buf, bop)
+		if err != nil {
+			return nil, fmt.Errorf("dvi: could not read page %d: %w", i, err)
+		}
+		if opCode(buf[0]) != opBOP {
+			return nil, fmt.Errorf("dvi: could not locate page %d: %w", i, errInvalidDVI)
+		}
+		pr.pages[i] = bop
+		bop = int64(int32(binary.BigEndian.Uint32(buf[41:])))
+	}
+	if bop != -1 {
+		return nil, fmt.Errorf("dvi: invalid number of pages: %w", errInvalidDVI)
+	}
+
+	return pr, nil
+}
+
+// postPointer returns the position of the postamble.
+func (pr *PageReader) postPointer() (int64, error) {
+	// the post_post command is followed by at least 4 bytes of padding.
+	const n = 64
+	var (
+		beg = pr.size - n
+		buf []byte
+	)
+	if beg < 0 {
+		beg = 0
+	}
+	buf = make([]byte, pr.size-beg)
+	_, err := pr.r.ReadAt(buf, beg)
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("dvi: could not read post-postamble: %w", err)
+	}
+
+	i := len(buf) - 1
+	for i >= 0 && buf[i] == dviEOF {
+		i--
+	}
+	if i < 5 || opCode(buf[i-5]) != opPostPost {
+		return 0, fmt.Errorf("dvi: could not find post-postamble: %w", errInvalidDVI)
+	}
+	if v := buf[i]; !versionMatch(pr.pre.Version, v) {
+		return 0, fmt.Errorf("dvi: version skew (pre=%d, post=%d)", pr.pre.Version, v)
+	}
+	post := int64(binary.BigEndian.Uint32(buf[i-4:]))
+	if post >= pr.size {
+		return 0, fmt.Errorf("dvi: invalid postamble pointer: %w", errInvalidDVI)
+	}
+	return post, nil
+}
+
+// Pre returns the preamble of the document.
+func (pr *PageReader) Pre() CmdPre { return pr.pre }
+
+// Post returns the postamble of the document.
+func (pr *PageReader) Post() CmdPost { return pr.post }
+
+// Fonts returns the font definitions of the postamble of the document.
+func (pr *PageReader) Fonts() []FontDef { return pr.fonts }
+
+// NativeFonts returns the native font definitions of the postamble of
+// the document. Only XDV documents have native fonts.
+func (pr *PageReader) NativeFonts() []CmdNativeFontDef { return pr.natives }
+
+// NumPages returns the number of pages of the document.
+func (pr *PageReader) NumPages() int { return len(pr.pages) }
+
+// Page returns a decoder for the commands of the i-th page of the
+// document, from its bop command to its eop command.
+func (pr *PageReader) Page(i int) *Decoder {
+	if i < 0 || i >= len(pr.pages) {
+		return &Decoder{err: fmt.Errorf("dvi: invalid page index %d", i)}
+	}
+	pos := pr.pages[i]
+	dec := NewDecoder(io.NewSectionReader(pr.r, pos, pr.size-pos))
+	dec.pos = pos
+	dec.page = true
+	dec.vers = pr.pre.Version
+	return dec
+}
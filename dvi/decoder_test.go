@@ -0,0 +1,292 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+var goldenDVIs = []string{
+	"../testdata/hello_golden.dvi",
+	"../testdata/pages_golden.dvi",
+	"../testdata/xcolor_golden.dvi",
+}
+
+// decodeAll decodes all the commands of the provided DVI program, from
+// memory.
+func decodeAll(raw []byte) []Cmd {
+	var (
+		r    = iobuf.NewReader(raw)
+		cmds []Cmd
+	)
+	for r.Pos() < r.Len() {
+		cmd := opCode(r.PeekU8()).cmd()
+		cmd.read(r)
+		cmds = append(cmds, cmd)
+		if cmd.opcode() == opPostPost {
+			break
+		}
+	}
+	return cmds
+}
+
+func TestDecoder(t *testing.T) {
+	for _, fname := range goldenDVIs {
+		t.Run(fname, func(t *testing.T) {
+			raw, err := os.ReadFile(fname)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+
+			var (
+				dec  = NewDecoder(iotest.OneByteReader(bytes.NewReader(raw)))
+				cmds []Cmd
+			)
+			for {
+				cmd, err := dec.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("could not decode command: %+v", err)
+				}
+				cmds = append(cmds, cmd)
+			}
+
+			if got, want := cmds, decodeAll(raw); !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid commands:\ngot= %v\nwant=%v", got, want)
+			}
+			if got, want := dec.Pos(), int64(len(raw)); got != want {
+				t.Fatalf("invalid position: got=%d, want=%d", got, want)
+			}
+
+			_, err = dec.Next()
+			if err != io.EOF {
+				t.Fatalf("invalid error: %+v", err)
+			}
+		})
+	}
+}
+
+// longXDV returns an XDV document with a text_and_glyphs command longer
+// than the buffer of a Decoder.
+func longXDV() []byte {
+	text := strings.Repeat("x", 3000)
+	return writeDVI(CmdPre{Version: xdvVersion, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, [][]Cmd{{
+		&CmdNativeFontDef{ID: 1, Size: xdvPt, Font: "otf"},
+		&CmdFnt1{ID: 1},
+		&CmdTextAndGlyphs{Text: text, Width: xdvPt, Glyphs: []Glyph{{ID: 1}}},
+	}})
+}
+
+func TestDecoderLongCommand(t *testing.T) {
+	raw := longXDV()
+
+	var (
+		dec  = NewDecoder(bytes.NewReader(raw))
+		cmds []Cmd
+	)
+	for {
+		cmd, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not decode command: %+v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	if got, want := cmds, decodeAll(raw); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid commands:\ngot= %v\nwant=%v", got, want)
+	}
+
+	pr, err := NewPageReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("could not create page reader: %+v", err)
+	}
+	dec = pr.Page(0)
+	for {
+		_, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not decode page: %+v", err)
+		}
+	}
+
+	err = Dump(bytes.NewReader(raw), func(Cmd) error { return nil })
+	if err != nil {
+		t.Fatalf("could not dump document: %+v", err)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/hello_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{
+			name: "empty",
+			raw:  nil,
+			want: "dvi: could not decode command at 0: unexpected EOF",
+		},
+		{
+			name: "truncated",
+			raw:  raw[:20],
+			want: "dvi: could not decode command at 0: unexpected EOF",
+		},
+		{
+			name: "unknown-opcode",
+			raw:  []byte{byte(opPush), 250},
+			want: "dvi: could not decode command at 1: unknown opcode 250",
+		},
+		{
+			name: "huge-special",
+			raw:  []byte{byte(opXXX4), 0x7f, 0xff, 0xff, 0xff, 'a'},
+			want: "dvi: could not decode command at 0: unexpected EOF",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dec := NewDecoder(bytes.NewReader(tc.raw))
+			for {
+				_, err := dec.Next()
+				if err == nil {
+					continue
+				}
+				if err.Error() != tc.want {
+					t.Fatalf("invalid error:\ngot= %v\nwant=%s", err, tc.want)
+				}
+				if tc.name != "unknown-opcode" && !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("invalid error type: %+v", err)
+				}
+				return
+			}
+		})
+	}
+
+	// the declared length of a corrupted command is not allocated upfront.
+	var (
+		raw4 = []byte{byte(opXXX4), 0x7f, 0xff, 0xff, 0xff, 'a'}
+		ms0  runtime.MemStats
+		ms1  runtime.MemStats
+	)
+	runtime.ReadMemStats(&ms0)
+	_, err = NewDecoder(bytes.NewReader(raw4)).Next()
+	runtime.ReadMemStats(&ms1)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if n := ms1.TotalAlloc - ms0.TotalAlloc; n > 1<<20 {
+		t.Fatalf("too many bytes allocated: %d", n)
+	}
+}
+
+func TestPageReader(t *testing.T) {
+	for _, fname := range goldenDVIs {
+		t.Run(fname, func(t *testing.T) {
+			raw, err := os.ReadFile(fname)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+
+			prog, err := Compile(raw)
+			if err != nil {
+				t.Fatalf("could not compile DVI file: %+v", err)
+			}
+
+			pr, err := NewPageReader(bytes.NewReader(raw), int64(len(raw)))
+			if err != nil {
+				t.Fatalf("could not create page reader: %+v", err)
+			}
+
+			if got, want := pr.Pre(), prog.pre; got != want {
+				t.Fatalf("invalid preamble:\ngot= %#v\nwant=%#v", got, want)
+			}
+			if got, want := pr.Post(), prog.post; got != want {
+				t.Fatalf("invalid postamble:\ngot= %#v\nwant=%#v", got, want)
+			}
+			if got, want := len(pr.Fonts()), len(prog.fonts); got != want {
+				t.Fatalf("invalid number of fonts: got=%d, want=%d", got, want)
+			}
+			for _, def := range pr.Fonts() {
+				want := prog.fonts[def.ID]
+				if def.Name != want.Name || def.Size != want.Size || def.Checksum != want.Checksum {
+					t.Fatalf("invalid font %d:\ngot= %#v\nwant=%#v", def.ID, def, want)
+				}
+			}
+
+			if got, want := pr.NumPages(), len(prog.pages); got != want {
+				t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+			}
+			for i := pr.NumPages() - 1; i >= 0; i-- {
+				var (
+					dec  = pr.Page(i)
+					cmds []Cmd
+				)
+				for {
+					cmd, err := dec.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("could not decode page %d: %+v", i, err)
+					}
+					cmds = append(cmds, cmd)
+				}
+
+				span := prog.pages[i]
+				want := decodeAll(raw[span.beg:span.end])
+				if !reflect.DeepEqual(cmds, want) {
+					t.Fatalf("invalid page %d:\ngot= %v\nwant=%v", i, cmds, want)
+				}
+			}
+
+			_, err = pr.Page(-1).Next()
+			if err == nil || err.Error() != "dvi: invalid page index -1" {
+				t.Fatalf("invalid error: %+v", err)
+			}
+		})
+	}
+}
+
+func TestPageReaderErrors(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/hello_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"no-pre", raw[1:]},
+		{"truncated", raw[:len(raw)-10]},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewPageReader(bytes.NewReader(tc.raw), int64(len(tc.raw)))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
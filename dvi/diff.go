@@ -0,0 +1,418 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DiffOptions describes the possible options given to Diff.
+type DiffOptions struct {
+	// Tolerance is the maximum horizontal and vertical distance, in DVI
+	// units, between the positions (or the sizes) of two items deemed
+	// equal.
+	Tolerance int32
+
+	// Machine holds the options of the DVI machines running the programs.
+	Machine []Option
+}
+
+// DiffKind describes the kind of a Difference.
+type DiffKind string
+
+const (
+	DiffAdded   DiffKind = "added"   // item only in the second document.
+	DiffRemoved DiffKind = "removed" // item only in the first document.
+	DiffMoved   DiffKind = "moved"   // item at a different position.
+	DiffChanged DiffKind = "changed" // item with a different size, color or value.
+)
+
+// Difference is a difference between two DVI documents.
+type Difference struct {
+	Page   int      `json:"page"`   // Page is the index of the page, or -1 for the whole document.
+	Kind   DiffKind `json:"kind"`   // Kind is the kind of the difference.
+	Item   string   `json:"item"`   // Item describes the differing item, e.g. "glyph 'x' (cmr10)".
+	Detail string   `json:"detail"` // Detail describes the difference, e.g. "moved 2.1pt right".
+}
+
+func (d Difference) String() string {
+	switch d.Page {
+	case -1:
+		return fmt.Sprintf("document: %s %s", d.Item, d.Detail)
+	default:
+		return fmt.Sprintf("page %d: %s %s", d.Page+1, d.Item, d.Detail)
+	}
+}
+
+// Diff compares two DVI programs page by page, as positioned glyphs and
+// rules, and returns their differences.
+//
+// Glyphs and rules are paired in drawing order. Paired items whose
+// positions differ by more than the tolerance are reported as moved;
+// unpaired items are reported as added or removed.
+// Preamble comments are ignored. Lengths are reported in TeX points,
+// according to the preamble of the first program.
+//
+// If opts is nil, sensible defaults will be used.
+func Diff(a, b Program, opts *DiffOptions) ([]Difference, error) {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	pa, err := recordPages(a, opts.Machine)
+	if err != nil {
+		return nil, fmt.Errorf("dvi: could not run first program: %w", err)
+	}
+	pb, err := recordPages(b, opts.Machine)
+	if err != nil {
+		return nil, fmt.Errorf("dvi: could not run second program: %w", err)
+	}
+
+	d := differ{
+		tol: opts.Tolerance,
+		pt:  float64(a.pre.Num) / float64(a.pre.Den) * 72.27 / 254000,
+	}
+	d.document(a, b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		switch {
+		case i >= len(pb):
+			d.add(i, DiffRemoved, "page", "removed")
+		case i >= len(pa):
+			d.add(i, DiffAdded, "page", "added")
+		default:
+			d.page(i, pa[i], pb[i])
+		}
+	}
+	return d.diffs, nil
+}
+
+// diffItem is a glyph or a rule drawn on a page.
+type diffItem struct {
+	rule  bool
+	x, y  int32
+	w, h  int32 // size of the rule.
+	font  string
+	size  int32
+	code  rune
+	text  string
+	color [4]uint32
+}
+
+// key returns the identity of the item, used to pair items.
+func (it diffItem) key() string {
+	if it.rule {
+		return "rule"
+	}
+	return fmt.Sprintf("%s@%d:%d", it.font, it.size, it.code)
+}
+
+// diffPage is a page of glyphs and rules.
+type diffPage struct {
+	bop   CmdBOP
+	items []diffItem
+}
+
+// pageRecorder is a Renderer recording the glyphs and rules of pages.
+type pageRecorder struct {
+	pages []diffPage
+	encs  map[string]textEncoding
+}
+
+func recordPages(p Program, opts []Option) ([]diffPage, error) {
+	rdr := &pageRecorder{encs: make(map[string]textEncoding)}
+	vm := NewMachine(append(opts[:len(opts):len(opts)], WithRenderer(rdr))...)
+	err := vm.Run(p)
+	if err != nil {
+		return nil, err
+	}
+	return rdr.pages, nil
+}
+
+func (rec *pageRecorder) BOP(bop *CmdBOP) {
+	rec.pages = append(rec.pages, diffPage{bop: *bop})
+}
+
+func (rec *pageRecorder) EOP() {}
+
+func (rec *pageRecorder) DrawGlyph(x, y int32, font Font, glyph rune, c color.Color) {
+	enc, ok := rec.encs[font.Name()]
+	if !ok {
+		enc = encodingOf(font.Metrics().CodingScheme())
+		rec.encs[font.Name()] = enc
+	}
+	page := &rec.pages[len(rec.pages)-1]
+	page.items = append(page.items, diffItem{
+		x:     x,
+		y:     y,
+		font:  font.Name(),
+		size:  font.Size(),
+		code:  glyph,
+		text:  enc.text(glyph),
+		color: rgba(c),
+	})
+}
+
+func (rec *pageRecorder) DrawRule(x, y, w, h int32, c color.Color) {
+	page := &rec.pages[len(rec.pages)-1]
+	page.items = append(page.items, diffItem{
+		rule:  true,
+		x:     x,
+		y:     y,
+		w:     w,
+		h:     h,
+		color: rgba(c),
+	})
+}
+
+func rgba(c color.Color) [4]uint32 {
+	r, g, b, a := c.RGBA()
+	return [4]uint32{r, g, b, a}
+}
+
+type differ struct {
+	tol   int32
+	pt    float64 // converts DVI units to TeX points.
+	diffs []Difference
+}
+
+func (d *differ) add(page int, kind DiffKind, item, format string, args ...interface{}) {
+	d.diffs = append(d.diffs, Difference{
+		Page:   page,
+		Kind:   kind,
+		Item:   item,
+		Detail: fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *differ) document(a, b Program) {
+	if a.pre.Num != b.pre.Num || a.pre.Den != b.pre.Den {
+		d.add(-1, DiffChanged, "unit", "changed from %d/%d to %d/%d", a.pre.Num, a.pre.Den, b.pre.Num, b.pre.Den)
+	}
+	if a.pre.Mag != b.pre.Mag {
+		d.add(-1, DiffChanged, "magnification", "changed from %d to %d", a.pre.Mag, b.pre.Mag)
+	}
+	if a.npages != b.npages {
+		d.add(-1, DiffChanged, "number of pages", "changed from %d to %d", a.npages, b.npages)
+	}
+}
+
+func (d *differ) page(i int, a, b diffPage) {
+	ca, cb := a.bop.counts(), b.bop.counts()
+	for j := range ca {
+		if ca[j] != cb[j] {
+			d.add(i, DiffChanged, fmt.Sprintf(`\count%d`, j), "changed from %d to %d", ca[j], cb[j])
+		}
+	}
+
+	for _, pair := range alignItems(a.items, b.items) {
+		switch {
+		case pair[1] < 0:
+			it := a.items[pair[0]]
+			d.add(i, DiffRemoved, d.name(it), "removed from %s", d.pos(it))
+		case pair[0] < 0:
+			it := b.items[pair[1]]
+			d.add(i, DiffAdded, d.name(it), "added at %s", d.pos(it))
+		default:
+			d.item(i, a.items[pair[0]], b.items[pair[1]])
+		}
+	}
+}
+
+func (d *differ) item(page int, a, b diffItem) {
+	name := d.name(a)
+	if dx, dy := b.x-a.x, b.y-a.y; absI32(dx) > d.tol || absI32(dy) > d.tol {
+		var moves []string
+		switch {
+		case dx > 0:
+			moves = append(moves, d.length(dx)+" right")
+		case dx < 0:
+			moves = append(moves, d.length(-dx)+" left")
+		}
+		switch {
+		case dy > 0:
+			moves = append(moves, d.length(dy)+" down")
+		case dy < 0:
+			moves = append(moves, d.length(-dy)+" up")
+		}
+		d.add(page, DiffMoved, name, "moved %s", strings.Join(moves, ", "))
+	}
+	if a.rule && (absI32(b.w-a.w) > d.tol || absI32(b.h-a.h) > d.tol) {
+		d.add(page, DiffChanged, name, "resized to %s×%s", d.length(b.w), d.length(b.h))
+	}
+	if a.color != b.color {
+		d.add(page, DiffChanged, name, "changed color")
+	}
+}
+
+// name returns a description of the item.
+func (d *differ) name(it diffItem) string {
+	if it.rule {
+		return fmt.Sprintf("rule %s×%s", d.length(it.w), d.length(it.h))
+	}
+	if it.text != "" {
+		return fmt.Sprintf("glyph '%s' (%s)", it.text, it.font)
+	}
+	return fmt.Sprintf("glyph %d (%s)", it.code, it.font)
+}
+
+func (d *differ) pos(it diffItem) string {
+	return fmt.Sprintf("(%s, %s)", d.length(it.x), d.length(it.y))
+}
+
+// length formats the provided length in TeX points, rounded to 0.01pt.
+func (d *differ) length(v int32) string {
+	pt := math.Round(float64(v)*d.pt*100) / 100
+	return strconv.FormatFloat(pt, 'f', -1, 64) + "pt"
+}
+
+// alignItems pairs the items of a and b sharing the same key, following
+// a longest common subsequence of their keys.
+// Unpaired items are paired with -1.
+func alignItems(a, b []diffItem) [][2]int {
+	var (
+		beg   = 0
+		ea    = len(a)
+		eb    = len(b)
+		pairs [][2]int
+	)
+	for beg < ea && beg < eb && a[beg].key() == b[beg].key() {
+		pairs = append(pairs, [2]int{beg, beg})
+		beg++
+	}
+	for ea > beg && eb > beg && a[ea-1].key() == b[eb-1].key() {
+		ea--
+		eb--
+	}
+
+	al := aligner{
+		ka:    make([]string, ea-beg),
+		kb:    make([]string, eb-beg),
+		beg:   beg,
+		pairs: pairs,
+	}
+	for i := range al.ka {
+		al.ka[i] = a[beg+i].key()
+	}
+	for j := range al.kb {
+		al.kb[j] = b[beg+j].key()
+	}
+	al.align(0, len(al.ka), 0, len(al.kb))
+	pairs = al.pairs
+
+	for k := 0; k < len(a)-ea; k++ {
+		pairs = append(pairs, [2]int{ea + k, eb + k})
+	}
+	return pairs
+}
+
+// aligner computes a longest common subsequence of two lists of keys in
+// linear space, with Hirschberg's algorithm.
+type aligner struct {
+	ka, kb []string
+	beg    int // index of the first keys in the items.
+	pairs  [][2]int
+}
+
+func (al *aligner) pair(i, j int) {
+	if i >= 0 {
+		i += al.beg
+	}
+	if j >= 0 {
+		j += al.beg
+	}
+	al.pairs = append(al.pairs, [2]int{i, j})
+}
+
+// align pairs the keys of ka[i0:i1] and kb[j0:j1].
+func (al *aligner) align(i0, i1, j0, j1 int) {
+	switch {
+	case i0 == i1:
+		for j := j0; j < j1; j++ {
+			al.pair(-1, j)
+		}
+		return
+	case j0 == j1:
+		for i := i0; i < i1; i++ {
+			al.pair(i, -1)
+		}
+		return
+	case i1-i0 == 1:
+		for j := j0; j < j1; j++ {
+			if al.ka[i0] != al.kb[j] {
+				continue
+			}
+			for k := j0; k < j; k++ {
+				al.pair(-1, k)
+			}
+			al.pair(i0, j)
+			for k := j + 1; k < j1; k++ {
+				al.pair(-1, k)
+			}
+			return
+		}
+		al.pair(i0, -1)
+		for j := j0; j < j1; j++ {
+			al.pair(-1, j)
+		}
+		return
+	}
+
+	// split kb where the LCS of the two halves of ka is the longest.
+	var (
+		mid  = (i0 + i1) / 2
+		m    = j1 - j0
+		fwd  = al.lcs(i0, mid, j0, j1, false)
+		bwd  = al.lcs(mid, i1, j0, j1, true)
+		k    = 0
+		best = int32(-1)
+	)
+	for j := 0; j <= m; j++ {
+		if v := fwd[j] + bwd[m-j]; v > best {
+			best, k = v, j
+		}
+	}
+	al.align(i0, mid, j0, j0+k)
+	al.align(mid, i1, j0+k, j1)
+}
+
+// lcs returns the lengths of the LCS of ka[i0:i1] and of the prefixes
+// kb[j0:j0+j], or of the suffixes kb[j1-j:j1] when rev is true.
+func (al *aligner) lcs(i0, i1, j0, j1 int, rev bool) []int32 {
+	var (
+		m    = j1 - j0
+		prev = make([]int32, m+1)
+		cur  = make([]int32, m+1)
+	)
+	for ii := 0; ii < i1-i0; ii++ {
+		i := i0 + ii
+		if rev {
+			i = i1 - 1 - ii
+		}
+		for jj := 1; jj <= m; jj++ {
+			j := j0 + jj - 1
+			if rev {
+				j = j1 - jj
+			}
+			switch {
+			case al.ka[i] == al.kb[j]:
+				cur[jj] = prev[jj-1] + 1
+			case prev[jj] >= cur[jj-1]:
+				cur[jj] = prev[jj]
+			default:
+				cur[jj] = cur[jj-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+var (
+	_ Renderer = (*pageRecorder)(nil)
+)
@@ -0,0 +1,186 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	const pt = 1 << 16
+
+	build := func(msg string, page2 []Cmd, npages int) Program {
+		t.Helper()
+		pages := make([][]Cmd, npages)
+		for i := range pages {
+			pages[i] = []Cmd{
+				&CmdDown4{Value: 20 * pt},
+				&CmdFntNum{ID: 0},
+				&CmdSetChar{Value: 'a'},
+			}
+			if i == 0 {
+				pages[i] = append([]Cmd{
+					&CmdFntDef1{ID: 0, Size: 10 * pt, Design: 10 * pt, Font: "cmr10"},
+				}, pages[i]...)
+			}
+			if i == 1 {
+				pages[i] = append(pages[i], page2...)
+			}
+		}
+		return writeProgram(t, CmdPre{Num: 25400000, Den: 473628672, Mag: 1000, Msg: msg}, pages)
+	}
+
+	var (
+		a = build("old", []Cmd{
+			&CmdSetChar{Value: 'x'},
+			&CmdSetChar{Value: 'y'},
+			&CmdSetRule{Height: pt, Width: 10 * pt},
+		}, 2)
+		b = build("new", []Cmd{
+			&CmdRight4{Value: 2*pt + pt/10},
+			&CmdSetChar{Value: 'x'},
+			&CmdSetChar{Value: 'z'},
+			&CmdSetRule{Height: pt, Width: 10*pt + pt/100},
+		}, 3)
+	)
+
+	diffs, err := Diff(a, a, nil)
+	if err != nil {
+		t.Fatalf("could not diff DVI documents: %+v", err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+
+	for _, tc := range []struct {
+		tol  int32
+		want []string
+	}{
+		{
+			tol: 0,
+			want: []string{
+				"document: number of pages changed from 2 to 3",
+				"page 2: glyph 'x' (cmr10) moved 2.1pt right",
+				"page 2: glyph 'y' (cmr10) removed from (10.28pt, 20pt)",
+				"page 2: glyph 'z' (cmr10) added at (12.38pt, 20pt)",
+				"page 2: rule 10pt×1pt moved 1.27pt right",
+				"page 2: rule 10pt×1pt resized to 10.01pt×1pt",
+				"page 3: page added",
+			},
+		},
+		{
+			tol: pt / 10,
+			want: []string{
+				"document: number of pages changed from 2 to 3",
+				"page 2: glyph 'x' (cmr10) moved 2.1pt right",
+				"page 2: glyph 'y' (cmr10) removed from (10.28pt, 20pt)",
+				"page 2: glyph 'z' (cmr10) added at (12.38pt, 20pt)",
+				"page 2: rule 10pt×1pt moved 1.27pt right",
+				"page 3: page added",
+			},
+		},
+	} {
+		diffs, err := Diff(a, b, &DiffOptions{Tolerance: tc.tol})
+		if err != nil {
+			t.Fatalf("could not diff DVI documents: %+v", err)
+		}
+		got := make([]string, len(diffs))
+		for i, d := range diffs {
+			got[i] = d.String()
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("invalid differences (tol=%d):\ngot= %q\nwant=%q", tc.tol, got, tc.want)
+		}
+	}
+}
+
+func TestDiffGolden(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	a, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	// change the comment of the preamble, and encode the pages anew.
+	var (
+		buf  = new(bytes.Buffer)
+		w    *Writer
+		post bool
+	)
+	err = Dump(bytes.NewReader(raw), func(cmd Cmd) error {
+		switch cmd := cmd.(type) {
+		case *CmdPre:
+			pre := *cmd
+			pre.Msg = " TeX output 1776.07.04:1200"
+			w = NewWriter(buf, pre)
+			return nil
+		case *CmdPost:
+			post = true
+			return w.Close()
+		}
+		if post {
+			return nil
+		}
+		if cmd, ok := cmd.(*CmdRight4); ok {
+			// let the writer choose the encoding of the move.
+			return w.Right(cmd.Value)
+		}
+		return w.WriteCmd(cmd)
+	})
+	if err != nil {
+		t.Fatalf("could not rewrite DVI file: %+v", err)
+	}
+	if bytes.Equal(buf.Bytes(), raw) {
+		t.Fatalf("rewritten DVI file should differ")
+	}
+
+	b, err := Compile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not compile rewritten DVI file: %+v", err)
+	}
+
+	diffs, err := Diff(a, b, nil)
+	if err != nil {
+		t.Fatalf("could not diff DVI documents: %+v", err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("unexpected differences: %v", diffs)
+	}
+}
+
+func TestAlignItems(t *testing.T) {
+	items := func(s string) []diffItem {
+		its := make([]diffItem, len(s))
+		for i, c := range s {
+			its[i] = diffItem{font: "cmr10", code: c}
+		}
+		return its
+	}
+	for _, tc := range []struct {
+		a, b string
+		want [][2]int
+	}{
+		{a: "", b: "", want: nil},
+		{a: "abc", b: "", want: [][2]int{{0, -1}, {1, -1}, {2, -1}}},
+		{a: "", b: "ab", want: [][2]int{{-1, 0}, {-1, 1}}},
+		{a: "abc", b: "abc", want: [][2]int{{0, 0}, {1, 1}, {2, 2}}},
+		{a: "axbyc", b: "abzc", want: [][2]int{{0, 0}, {1, -1}, {2, 1}, {3, -1}, {-1, 2}, {4, 3}}},
+		{a: "xabcy", b: "zabcw", want: [][2]int{{0, -1}, {-1, 0}, {1, 1}, {2, 2}, {3, 3}, {4, -1}, {-1, 4}}},
+		{a: "abcabba", b: "cbabac", want: [][2]int{{0, -1}, {1, -1}, {2, 0}, {3, -1}, {4, 1}, {-1, 2}, {5, 3}, {6, 4}, {-1, 5}}},
+	} {
+		t.Run(tc.a+"-"+tc.b, func(t *testing.T) {
+			got := alignItems(items(tc.a), items(tc.b))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid alignment:\ngot= %v\nwant=%v", got, tc.want)
+			}
+		})
+	}
+}
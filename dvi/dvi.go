@@ -14,8 +14,6 @@ import (
 	"fmt"
 	"image/color"
 	"io"
-
-	"star-tex.org/x/tex/internal/iobuf"
 )
 
 // Renderer defines the protocol to draw a DVI document.
@@ -27,6 +25,82 @@ type Renderer interface {
 	DrawRule(x, y, w, h int32, c color.Color)
 }
 
+// BackgroundRenderer is a Renderer that can paint the background of pages.
+type BackgroundRenderer interface {
+	Renderer
+
+	// Background sets the background color of the current page.
+	Background(c color.Color)
+}
+
+// PixelRenderer is a Renderer drawing on a device with a fixed resolution.
+//
+// The Machine draws the glyphs and rules of a PixelRenderer at positions
+// rounded to device pixels, following the rounding rules of dvitype.
+type PixelRenderer interface {
+	Renderer
+
+	// Resolution returns the resolution of the device, in dots per inch.
+	Resolution() float64
+
+	// DrawGlyphPixel draws the provided glyph with its reference point
+	// at the (hh,vv) pixel.
+	DrawGlyphPixel(hh, vv int32, font Font, glyph rune, c color.Color)
+
+	// DrawRulePixel draws a filled rectangle of size (w,h) pixels, with
+	// its bottom left corner at the (hh,vv) pixel.
+	DrawRulePixel(hh, vv, w, h int32, c color.Color)
+}
+
+// Dir is the writing direction of a pTeX document.
+type Dir uint8
+
+const (
+	DirHorizontal Dir = 0 // characters are set from left to right.
+	DirVertical   Dir = 1 // characters are set from top to bottom.
+	DirDownToUp   Dir = 3 // characters are set from bottom to top.
+)
+
+func (d Dir) String() string {
+	switch d {
+	case DirHorizontal:
+		return "horizontal"
+	case DirVertical:
+		return "vertical"
+	case DirDownToUp:
+		return "down-to-up"
+	default:
+		return fmt.Sprintf("Dir(%d)", uint8(d))
+	}
+}
+
+// DirRenderer is a Renderer that is notified of the changes of the
+// writing direction of pTeX documents.
+//
+// In the vertical directions, the Machine moves the current position
+// down (or up) when setting characters and moving right, and hands
+// renderers the rotated extent of rules.
+type DirRenderer interface {
+	Renderer
+
+	// Dir sets the writing direction of the next glyphs.
+	// Pages begin with DirHorizontal.
+	Dir(d Dir)
+}
+
+// XDVRenderer is a Renderer that can draw the native glyphs and the
+// pictures of XDV documents.
+type XDVRenderer interface {
+	Renderer
+
+	// DrawNativeGlyph draws the glyph with the provided index of a native
+	// font, with its reference point at (x,y).
+	DrawNativeGlyph(x, y int32, font *CmdNativeFontDef, glyph uint16, c color.Color)
+
+	// DrawPicFile draws the provided picture, at (x,y).
+	DrawPicFile(x, y int32, pic *CmdPicFile)
+}
+
 type nopRenderer struct{}
 
 func (nopRenderer) BOP(cmd *CmdBOP) {}
@@ -41,33 +115,19 @@ var (
 
 // Dump reads r until EOF and calls f for each decoded DVI command.
 func Dump(r io.Reader, f func(cmd Cmd) error) error {
-	buf, err := io.ReadAll(r)
-	if err != nil {
-		return fmt.Errorf("dvi: could not read DVI program: %w", err)
-	}
-
-	rr := iobuf.NewReader(buf)
-
+	dec := NewDecoder(r)
 	for {
-		var (
-			op  = opCode(rr.PeekU8())
-			cmd = op.cmd()
-		)
-		if cmd == nil {
-			return fmt.Errorf("dvi: unknown opcode %v (v=0x%x)", op, op)
+		cmd, err := dec.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
 		}
 
-		cmd.read(rr)
-
 		err = f(cmd)
 		if err != nil {
 			return fmt.Errorf("dvi: could not call user provided function: %w", err)
 		}
-
-		if cmd.opcode() == opPostPost {
-			break
-		}
 	}
-
-	return nil
 }
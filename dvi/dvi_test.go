@@ -8,8 +8,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"image/color"
 	"io"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -89,12 +91,33 @@ func TestCompiler(t *testing.T) {
 			if got, want := buf.Bytes(), want; !bytes.Equal(got, want) {
 				oname := strings.Replace(tc.json, ".json", ".dvi", 1)
 				_ = os.WriteFile(oname, got, 0644)
-				t.Fatalf("DVI files differ: got=%d, want=%d", len(got), len(want))
+				t.Fatalf("DVI files differ: got=%d, want=%d%s", len(got), len(want), diffDVI(got, want))
 			}
 		})
 	}
 }
 
+// diffDVI describes the differences between the pages of two DVI documents.
+func diffDVI(got, want []byte) string {
+	pgot, err := Compile(got)
+	if err != nil {
+		return fmt.Sprintf("\ncould not compile DVI document: %+v", err)
+	}
+	pwant, err := Compile(want)
+	if err != nil {
+		return fmt.Sprintf("\ncould not compile reference DVI document: %+v", err)
+	}
+	diffs, err := Diff(pwant, pgot, nil)
+	if err != nil {
+		return fmt.Sprintf("\ncould not diff DVI documents: %+v", err)
+	}
+	o := new(strings.Builder)
+	for _, d := range diffs {
+		fmt.Fprintf(o, "\n%v", d)
+	}
+	return o.String()
+}
+
 type compiler struct {
 	r io.Reader
 	w io.Writer
@@ -306,3 +329,49 @@ func (c jsonCmd) cmd() (Cmd, error) {
 
 	return cmd, err
 }
+
+type pixelRenderer struct {
+	nopRenderer
+	calls []string
+}
+
+func (rdr *pixelRenderer) Resolution() float64 { return 72.27 }
+
+func (rdr *pixelRenderer) DrawRule(x, y, w, h int32, c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("rule %d %d %d %d", x, y, w, h))
+}
+
+func (rdr *pixelRenderer) DrawGlyphPixel(hh, vv int32, font Font, glyph rune, c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("glyph-pixel %d %d %d", hh, vv, glyph))
+}
+
+func (rdr *pixelRenderer) DrawRulePixel(hh, vv, w, h int32, c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("rule-pixel %d %d %d %d", hh, vv, w, h))
+}
+
+func TestPixelRenderer(t *testing.T) {
+	const pt = 1 << 16
+
+	prog := writeProgram(t, CmdPre{}, [][]Cmd{{
+		&CmdRight4{Value: 3*pt + pt/2},
+		&CmdDown4{Value: 10 * pt},
+		&CmdSetRule{Height: 2 * pt, Width: pt + 1},
+		&CmdPutRule{Height: 0, Width: 5 * pt},
+		&CmdSetRule{Height: pt, Width: pt},
+	}})
+
+	rdr := new(pixelRenderer)
+	vm := NewMachine(WithRenderer(rdr))
+	err := vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI document: %+v", err)
+	}
+
+	want := []string{
+		"rule-pixel 4 10 2 2",
+		"rule-pixel 6 10 1 1",
+	}
+	if !reflect.DeepEqual(rdr.calls, want) {
+		t.Fatalf("invalid renderer calls:\ngot= %q\nwant=%q", rdr.calls, want)
+	}
+}
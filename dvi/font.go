@@ -11,6 +11,24 @@ import (
 // Font describes a DVI font, with TeX Font Metrics and its
 // associated font glyph data.
 type Font struct {
-	font *tfm.Font
-	face *tfm.Face
+	name   string
+	size   int32
+	design int32
+	font   *tfm.Font
+	face   *tfm.Face
 }
+
+// Name returns the name of the font, e.g. "cmr10".
+func (fnt Font) Name() string { return fnt.name }
+
+// Size returns the scaled size of the font, in DVI units.
+func (fnt Font) Size() int32 { return fnt.size }
+
+// DesignSize returns the design size of the font, in DVI units.
+func (fnt Font) DesignSize() int32 { return fnt.design }
+
+// Metrics returns the TeX Font Metrics of the font.
+func (fnt Font) Metrics() *tfm.Font { return fnt.font }
+
+// Face returns the TFM face of the font, scaled at the font size.
+func (fnt Font) Face() *tfm.Face { return fnt.face }
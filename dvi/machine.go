@@ -6,13 +6,13 @@ package dvi
 
 import (
 	"fmt"
-	"image/color"
 	"io"
 	"sort"
 	"strings"
 
 	"star-tex.org/x/tex/font/fixed"
 	"star-tex.org/x/tex/font/tfm"
+	"star-tex.org/x/tex/internal/iobuf"
 	"star-tex.org/x/tex/kpath"
 )
 
@@ -21,15 +21,27 @@ const (
 )
 
 // Machine defines a DVI machine, handling DVI registers and DVI commands.
+//
+// Characters of virtual fonts are drawn by executing their VF packets:
+// renderers are only handed glyphs of real fonts.
 type Machine struct {
 	rdr Renderer
 	ktx kpath.Context
 
 	state state
+	page  int   // index of the current page
+	vers  uint8 // DVI id of the program
+
+	specials  []special
+	paper     struct{ w, h int32 }
+	landscape bool
+	headers   []string
 
 	conv     float32 // converts DVI units to pixels
 	trueConv float32 // converts unmagnified DVI units to pixels
 
+	vfdepth int // nesting level of the virtual font packet being executed
+
 	w   io.Writer
 	buf []byte // 80-col buffer of text
 }
@@ -49,6 +61,8 @@ func NewMachine(opts ...Option) Machine {
 		rdr:   cfg.rdr,
 		state: newState(),
 
+		specials: newSpecials(cfg.specials),
+
 		w:   cfg.out,
 		buf: make([]byte, 0, 80-len("[]\n")),
 	}
@@ -67,10 +81,30 @@ func (m *Machine) Run(p Program) error {
 	return nil
 }
 
+// RunPages executes the pages of the DVI program with the provided
+// 0-based indices, in the provided order, on this DVI machine.
+func (m *Machine) RunPages(p Program, pages []int) error {
+	m.load(p)
+	for _, i := range pages {
+		if i < 0 || i >= len(p.pages) {
+			return fmt.Errorf("dvi: invalid page index %d", i)
+		}
+		err := m.run(p, i)
+		if err != nil {
+			return fmt.Errorf("dvi: could not process page %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
 func (m *Machine) load(p Program) {
 
 	m.printf("numerator/denominator=%d/%d\n", p.pre.Num, p.pre.Den)
 	res := float32(300.0)
+	if rdr, ok := m.rdr.(PixelRenderer); ok {
+		res = float32(rdr.Resolution())
+	}
 	conv := float32(p.pre.Num) / 254000.0 * (res / float32(p.pre.Den))
 	m.trueConv = conv
 	m.conv = conv * float32(p.pre.Mag) / 1000.0
@@ -83,7 +117,12 @@ func (m *Machine) load(p Program) {
 		p.post.Pages,
 	)
 
+	m.vers = p.pre.Version
 	m.state.fonts = p.fonts
+	m.paper.w = 0
+	m.paper.h = 0
+	m.landscape = false
+	m.headers = nil
 	fonts := make([]int, 0, len(p.fonts))
 	for id := range p.fonts {
 		fonts = append(fonts, id)
@@ -103,7 +142,6 @@ func (m *Machine) run(p Program, ip int) error {
 	var (
 		beg = int(p.pages[ip].beg)
 		end = int(p.pages[ip].end)
-		eop = false
 	)
 
 	p.r.SetPos(beg)
@@ -112,26 +150,56 @@ func (m *Machine) run(p Program, ip int) error {
 		return errNoBOP
 	}
 
+	err := checkCmd(p.r, op, m.vers)
+	if err != nil {
+		return fmt.Errorf("dvi: could not read bop: %w", err)
+	}
 	bop := op.cmd().(*CmdBOP)
 	bop.read(p.r)
 	m.state.reset()
+	m.page = ip
 
 	m.printf(" \n%d: beginning of page %d \n", beg, bop.C0)
 
 	m.rdr.BOP(bop)
 
-	for p.r.Pos() < end {
-		pos := p.r.Pos()
-		switch op := opCode(p.r.PeekU8()); op {
+	eop, err := m.exec(p.r, end)
+	if err != nil {
+		return err
+	}
+	if !eop {
+		return errNoEOP
+	}
+
+	return nil
+}
+
+// exec executes the DVI commands of r, up to the end position.
+// exec reports whether an end of page command has been executed.
+func (m *Machine) exec(r *iobuf.Reader, end int) (eop bool, err error) {
+	for r.Pos() < end {
+		pos := r.Pos()
+		op := opCode(r.PeekU8())
+		if !op.valid(m.vers) {
+			return eop, fmt.Errorf("dvi: unknown opcode %d", op)
+		}
+		err = checkCmd(r, op, m.vers)
+		if err != nil {
+			return eop, fmt.Errorf("dvi: could not read %s: %w", op.cmdOf(m.vers).Name(), err)
+		}
+		switch op := opCode(r.PeekU8()); op {
 		case opBOP, opPre, opPost, opPostPost:
-			return fmt.Errorf("dvi: invalid opcode=%s inside a page", op.cmd().Name())
+			return eop, fmt.Errorf("dvi: invalid opcode=%s inside a page", op.cmd().Name())
 
 		case opEOP:
+			if m.vfdepth > 0 {
+				return eop, fmt.Errorf("dvi: invalid opcode=eop inside a virtual font packet")
+			}
 			eop = true
 			m.flushText()
 			m.printf("%d: eop", pos)
 
-			op.cmd().read(p.r)
+			op.cmd().read(r)
 			m.rdr.EOP()
 
 			lvl := len(m.state.stack) - 1
@@ -166,7 +234,7 @@ func (m *Machine) run(p Program, ip int) error {
 			opSetChar120, opSetChar121, opSetChar122, opSetChar123, opSetChar124,
 			opSetChar125, opSetChar126, opSetChar127:
 			cmd := op.cmd().(*CmdSetChar)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			switch {
 			case cmd.Value > ' ' && cmd.Value <= '~':
@@ -177,134 +245,134 @@ func (m *Machine) run(p Program, ip int) error {
 			m.printf("%d: %s", pos, strings.Replace(cmd.Name(), "_", "", -1))
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not set char %q: %w", op, err)
+				return eop, fmt.Errorf("could not set char %q: %w", op, err)
 			}
 
 		case opSet1:
 			cmd := op.cmd().(*CmdSet1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: set1 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not set1: %w", err)
+				return eop, fmt.Errorf("could not set1: %w", err)
 			}
 
 		case opSet2:
 			cmd := op.cmd().(*CmdSet2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: set2 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not set2: %w", err)
+				return eop, fmt.Errorf("could not set2: %w", err)
 			}
 
 		case opSet3:
 			cmd := op.cmd().(*CmdSet3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: set3 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not set3: %w", err)
+				return eop, fmt.Errorf("could not set3: %w", err)
 			}
 
 		case opSet4:
 			cmd := op.cmd().(*CmdSet4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: set4 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not set4: %w", err)
+				return eop, fmt.Errorf("could not set4: %w", err)
 			}
 
 		case opSetRule:
 			cmd := op.cmd().(*CmdSetRule)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: setrule", pos)
 
 			err := m.drawRule(cmd.opcode(), cmd.Height, cmd.Width)
 			if err != nil {
-				return fmt.Errorf("could not setrule(%d, %d): %w", cmd.Height, cmd.Width, err)
+				return eop, fmt.Errorf("could not setrule(%d, %d): %w", cmd.Height, cmd.Width, err)
 			}
 
 		case opPut1:
 			cmd := op.cmd().(*CmdPut1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: put1 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not put1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not put1(%d): %w", cmd.Value, err)
 			}
 
 		case opPut2:
 			cmd := op.cmd().(*CmdPut2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: put2 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not put2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not put2(%d): %w", cmd.Value, err)
 			}
 
 		case opPut3:
 			cmd := op.cmd().(*CmdPut3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: put3 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not put3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not put3(%d): %w", cmd.Value, err)
 			}
 
 		case opPut4:
 			cmd := op.cmd().(*CmdPut4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: put4 %d", pos, cmd.Value)
 
 			err := m.drawGlyph(cmd.opcode(), int32(cmd.Value))
 			if err != nil {
-				return fmt.Errorf("could not put4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not put4(%d): %w", cmd.Value, err)
 			}
 
 		case opPutRule:
 			cmd := op.cmd().(*CmdPutRule)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.flushText()
 			m.printf("%d: putrule", pos)
 
 			err := m.drawRule(cmd.opcode(), cmd.Height, cmd.Width)
 			if err != nil {
-				return fmt.Errorf("could not putrule(%d, %d): %w", cmd.Height, cmd.Width, err)
+				return eop, fmt.Errorf("could not putrule(%d, %d): %w", cmd.Height, cmd.Width, err)
 			}
 
 		case opPush:
 			m.flushText()
 			m.printf("%d: push \n", pos)
 			lvl := len(m.state.stack) - 1
-			op.cmd().(*CmdPush).read(p.r)
+			op.cmd().(*CmdPush).read(r)
 			m.state.push()
 			cur := m.state.cur()
 			m.printf("level %d:(h=%d,v=%d,w=%d,x=%d,y=%d,z=%d,hh=%d,vv=%d)",
@@ -316,8 +384,15 @@ func (m *Machine) run(p Program, ip int) error {
 		case opPop:
 			m.flushText()
 			m.printf("%d: pop \n", pos)
-			op.cmd().(*CmdPop).read(p.r)
+			op.cmd().(*CmdPop).read(r)
+			if len(m.state.stack) <= 1 {
+				return eop, fmt.Errorf("dvi: unbalanced push/pop")
+			}
+			dir := m.state.cur().dir
 			m.state.pop()
+			if cur := m.state.cur(); cur.dir != dir {
+				m.notifyDir(cur.dir)
+			}
 
 			lvl := len(m.state.stack) - 1
 			cur := m.state.cur()
@@ -329,7 +404,7 @@ func (m *Machine) run(p Program, ip int) error {
 
 		case opRight1:
 			cmd := op.cmd().(*CmdRight1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.hh = m.outSpace(cmd.Value)
@@ -337,12 +412,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not right1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not right1(%d): %w", cmd.Value, err)
 			}
 
 		case opRight2:
 			cmd := op.cmd().(*CmdRight2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.hh = m.outSpace(cmd.Value)
@@ -350,12 +425,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not right2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not right2(%d): %w", cmd.Value, err)
 			}
 
 		case opRight3:
 			cmd := op.cmd().(*CmdRight3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.hh = m.outSpace(cmd.Value)
@@ -363,12 +438,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not right3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not right3(%d): %w", cmd.Value, err)
 			}
 
 		case opRight4:
 			cmd := op.cmd().(*CmdRight4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.hh = m.outSpace(cmd.Value)
@@ -376,12 +451,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not right4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not right4(%d): %w", cmd.Value, err)
 			}
 
 		case opW0:
 			cmd := op.cmd().(*CmdW0)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.hh = m.outSpace(cur.w)
@@ -389,12 +464,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cur.w)
 			if err != nil {
-				return fmt.Errorf("could not w0(%d): %w", cur.w, err)
+				return eop, fmt.Errorf("could not w0(%d): %w", cur.w, err)
 			}
 
 		case opW1:
 			cmd := op.cmd().(*CmdW1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.w = cmd.Value
@@ -403,12 +478,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not w1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not w1(%d): %w", cmd.Value, err)
 			}
 
 		case opW2:
 			cmd := op.cmd().(*CmdW2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.w = cmd.Value
@@ -417,12 +492,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not w2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not w2(%d): %w", cmd.Value, err)
 			}
 
 		case opW3:
 			cmd := op.cmd().(*CmdW3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.w = cmd.Value
@@ -431,12 +506,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not w3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not w3(%d): %w", cmd.Value, err)
 			}
 
 		case opW4:
 			cmd := op.cmd().(*CmdW4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.w = cmd.Value
@@ -445,12 +520,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not w4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not w4(%d): %w", cmd.Value, err)
 			}
 
 		case opX0:
 			cmd := op.cmd().(*CmdX0)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.hh = m.outSpace(cur.x)
@@ -458,12 +533,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cur.x)
 			if err != nil {
-				return fmt.Errorf("could not x0(%d): %w", cur.x, err)
+				return eop, fmt.Errorf("could not x0(%d): %w", cur.x, err)
 			}
 
 		case opX1:
 			cmd := op.cmd().(*CmdX1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.x = cmd.Value
@@ -472,12 +547,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not x1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not x1(%d): %w", cmd.Value, err)
 			}
 
 		case opX2:
 			cmd := op.cmd().(*CmdX2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.x = cmd.Value
@@ -486,12 +561,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not x2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not x2(%d): %w", cmd.Value, err)
 			}
 
 		case opX3:
 			cmd := op.cmd().(*CmdX3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.x = cmd.Value
@@ -500,12 +575,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not x3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not x3(%d): %w", cmd.Value, err)
 			}
 
 		case opX4:
 			cmd := op.cmd().(*CmdX4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.x = cmd.Value
@@ -514,12 +589,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.moveright(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not x4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not x4(%d): %w", cmd.Value, err)
 			}
 
 		case opDown1:
 			cmd := op.cmd().(*CmdDown1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.vv = m.outVMove(cmd.Value)
@@ -528,12 +603,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not down1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not down1(%d): %w", cmd.Value, err)
 			}
 
 		case opDown2:
 			cmd := op.cmd().(*CmdDown2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.vv = m.outVMove(cmd.Value)
@@ -542,12 +617,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not down2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not down2(%d): %w", cmd.Value, err)
 			}
 
 		case opDown3:
 			cmd := op.cmd().(*CmdDown3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.vv = m.outVMove(cmd.Value)
@@ -556,12 +631,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not down3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not down3(%d): %w", cmd.Value, err)
 			}
 
 		case opDown4:
 			cmd := op.cmd().(*CmdDown4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.vv = m.outVMove(cmd.Value)
@@ -570,12 +645,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not down4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not down4(%d): %w", cmd.Value, err)
 			}
 
 		case opY0:
 			cmd := op.cmd().(*CmdY0)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.vv = m.outVMove(cur.y)
@@ -584,12 +659,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cur.y)
 			if err != nil {
-				return fmt.Errorf("could not y0(%d): %w", cur.y, err)
+				return eop, fmt.Errorf("could not y0(%d): %w", cur.y, err)
 			}
 
 		case opY1:
 			cmd := op.cmd().(*CmdY1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.y = cmd.Value
@@ -599,12 +674,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not y1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not y1(%d): %w", cmd.Value, err)
 			}
 
 		case opY2:
 			cmd := op.cmd().(*CmdY2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.y = cmd.Value
@@ -614,12 +689,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not y2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not y2(%d): %w", cmd.Value, err)
 			}
 
 		case opY3:
 			cmd := op.cmd().(*CmdY3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.y = cmd.Value
@@ -629,12 +704,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not y3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not y3(%d): %w", cmd.Value, err)
 			}
 
 		case opY4:
 			cmd := op.cmd().(*CmdY4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.y = cmd.Value
@@ -644,12 +719,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not y4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not y4(%d): %w", cmd.Value, err)
 			}
 
 		case opZ0:
 			cmd := op.cmd().(*CmdZ0)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.vv = m.outVMove(cur.z)
@@ -658,12 +733,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cur.z)
 			if err != nil {
-				return fmt.Errorf("could not z0(%d): %w", cur.z, err)
+				return eop, fmt.Errorf("could not z0(%d): %w", cur.z, err)
 			}
 
 		case opZ1:
 			cmd := op.cmd().(*CmdZ1)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.z = cmd.Value
@@ -673,12 +748,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not z1(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not z1(%d): %w", cmd.Value, err)
 			}
 
 		case opZ2:
 			cmd := op.cmd().(*CmdZ2)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.z = cmd.Value
@@ -688,12 +763,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not z2(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not z2(%d): %w", cmd.Value, err)
 			}
 
 		case opZ3:
 			cmd := op.cmd().(*CmdZ3)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.z = cmd.Value
@@ -703,12 +778,12 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not z3(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not z3(%d): %w", cmd.Value, err)
 			}
 
 		case opZ4:
 			cmd := op.cmd().(*CmdZ4)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			cur := m.state.cur()
 			cur.z = cmd.Value
@@ -718,7 +793,7 @@ func (m *Machine) run(p Program, ip int) error {
 
 			err := m.movedown(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not z4(%d): %w", cmd.Value, err)
+				return eop, fmt.Errorf("could not z4(%d): %w", cmd.Value, err)
 			}
 
 		case opFntNum00, opFntNum01, opFntNum02, opFntNum03, opFntNum04,
@@ -735,7 +810,7 @@ func (m *Machine) run(p Program, ip int) error {
 			opFntNum55, opFntNum56, opFntNum57, opFntNum58, opFntNum59,
 			opFntNum60, opFntNum61, opFntNum62, opFntNum63:
 			cmd := op.cmd().(*CmdFntNum)
-			cmd.read(p.r)
+			cmd.read(r)
 
 			m.state.f = int(cmd.ID)
 			m.flushText()
@@ -746,7 +821,7 @@ func (m *Machine) run(p Program, ip int) error {
 
 		case opFnt1:
 			cmd := op.cmd().(*CmdFnt1)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.state.f = int(cmd.ID)
 			m.flushText()
 			m.printf(
@@ -756,7 +831,7 @@ func (m *Machine) run(p Program, ip int) error {
 
 		case opFnt2:
 			cmd := op.cmd().(*CmdFnt2)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.state.f = int(cmd.ID)
 			m.flushText()
 			m.printf(
@@ -766,7 +841,7 @@ func (m *Machine) run(p Program, ip int) error {
 
 		case opFnt3:
 			cmd := op.cmd().(*CmdFnt3)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.state.f = int(cmd.ID)
 			m.flushText()
 			m.printf(
@@ -776,7 +851,7 @@ func (m *Machine) run(p Program, ip int) error {
 
 		case opFnt4:
 			cmd := op.cmd().(*CmdFnt4)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.state.f = int(cmd.ID)
 			m.flushText()
 			m.printf(
@@ -786,51 +861,51 @@ func (m *Machine) run(p Program, ip int) error {
 
 		case opXXX1:
 			cmd := op.cmd().(*CmdXXX1)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: xxx '%s'", pos, cmd.Value)
 
 			err := m.handleSpecial(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not xxx1 %q: %w", cmd.Value, err)
+				m.warnf("could not xxx1 %q: %v", cmd.Value, err)
 			}
 
 		case opXXX2:
 			cmd := op.cmd().(*CmdXXX2)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: xxx '%s'", pos, cmd.Value)
 
 			err := m.handleSpecial(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not xxx2 %q: %w", cmd.Value, err)
+				m.warnf("could not xxx2 %q: %v", cmd.Value, err)
 			}
 
 		case opXXX3:
 			cmd := op.cmd().(*CmdXXX3)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: xxx '%s'", pos, cmd.Value)
 
 			err := m.handleSpecial(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not xxx3 %q: %w", cmd.Value, err)
+				m.warnf("could not xxx3 %q: %v", cmd.Value, err)
 			}
 
 		case opXXX4:
 			cmd := op.cmd().(*CmdXXX4)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: xxx '%s'", pos, cmd.Value)
 
 			err := m.handleSpecial(cmd.Value)
 			if err != nil {
-				return fmt.Errorf("could not xxx4 %q: %w", cmd.Value, err)
+				m.warnf("could not xxx4 %q: %v", cmd.Value, err)
 			}
 
 		case opFntDef1:
 			cmd := op.cmd().(*CmdFntDef1)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: fntdef1 %d: %s", pos, cmd.ID, cmd.Font)
 
@@ -843,12 +918,12 @@ func (m *Machine) run(p Program, ip int) error {
 				Name:     cmd.Font,
 			})
 			if err != nil {
-				return fmt.Errorf("could not fntdef1 %d: %w", cmd.ID, err)
+				return eop, fmt.Errorf("could not fntdef1 %d: %w", cmd.ID, err)
 			}
 
 		case opFntDef2:
 			cmd := op.cmd().(*CmdFntDef2)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: fntdef2 %d: %s", pos, cmd.ID, cmd.Font)
 
@@ -861,12 +936,12 @@ func (m *Machine) run(p Program, ip int) error {
 				Name:     cmd.Font,
 			})
 			if err != nil {
-				return fmt.Errorf("could not fntdef2 %d: %w", cmd.ID, err)
+				return eop, fmt.Errorf("could not fntdef2 %d: %w", cmd.ID, err)
 			}
 
 		case opFntDef3:
 			cmd := op.cmd().(*CmdFntDef3)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: fntdef3 %d: %s", pos, cmd.ID, cmd.Font)
 
@@ -879,12 +954,12 @@ func (m *Machine) run(p Program, ip int) error {
 				Name:     cmd.Font,
 			})
 			if err != nil {
-				return fmt.Errorf("could not fntdef3 %d: %w", cmd.ID, err)
+				return eop, fmt.Errorf("could not fntdef3 %d: %w", cmd.ID, err)
 			}
 
 		case opFntDef4:
 			cmd := op.cmd().(*CmdFntDef4)
-			cmd.read(p.r)
+			cmd.read(r)
 			m.flushText()
 			m.printf("%d: fntdef4 %d: %s", pos, cmd.ID, cmd.Font)
 
@@ -897,22 +972,89 @@ func (m *Machine) run(p Program, ip int) error {
 				Name:     cmd.Font,
 			})
 			if err != nil {
-				return fmt.Errorf("could not fntdef4 %d: %w", cmd.ID, err)
+				return eop, fmt.Errorf("could not fntdef4 %d: %w", cmd.ID, err)
+			}
+
+		case opDir:
+			cmd := op.cmd().(*CmdDir)
+			cmd.read(r)
+			m.flushText()
+			m.printf("%d: dir %d", pos, cmd.Dir)
+
+			switch cmd.Dir {
+			case DirHorizontal, DirVertical, DirDownToUp:
+				m.state.cur().dir = cmd.Dir
+				m.notifyDir(cmd.Dir)
+			default:
+				return eop, fmt.Errorf("could not dir %d: invalid direction", cmd.Dir)
+			}
+
+		case opNativeFontDef:
+			cmd := op.cmdOf(m.vers).(*CmdNativeFontDef)
+			cmd.read(r)
+			m.flushText()
+			m.printf("%d: nativefontdef %d: %s", pos, cmd.ID, cmd.Font)
+
+			m.state.fonts[int(cmd.ID)] = fntdef{
+				ID:     int(cmd.ID),
+				Size:   cmd.Size,
+				Name:   cmd.Font,
+				native: cmd,
+			}
+
+		case opGlyphs:
+			cmd := op.cmd().(*CmdGlyphs)
+			cmd.read(r)
+			m.flushText()
+			m.printf("%d: glyphs %d", pos, len(cmd.Glyphs))
+
+			err := m.drawGlyphs(cmd.Width, cmd.Glyphs)
+			if err != nil {
+				return eop, fmt.Errorf("could not glyphs: %w", err)
+			}
+
+		case opTextAndGlyphs:
+			switch cmd := op.cmdOf(m.vers).(type) {
+			case *CmdGlyphString:
+				cmd.read(r)
+				m.flushText()
+				m.printf("%d: glyphstring %d", pos, len(cmd.Glyphs))
+
+				err := m.drawGlyphs(cmd.Width, cmd.Glyphs)
+				if err != nil {
+					return eop, fmt.Errorf("could not glyph_string: %w", err)
+				}
+			case *CmdTextAndGlyphs:
+				cmd.read(r)
+				m.flushText()
+				m.printf("%d: textandglyphs '%s' %d", pos, cmd.Text, len(cmd.Glyphs))
+
+				err := m.drawGlyphs(cmd.Width, cmd.Glyphs)
+				if err != nil {
+					return eop, fmt.Errorf("could not text_and_glyphs %q: %w", cmd.Text, err)
+				}
+			}
+
+		case opPicFile:
+			cmd := op.cmd().(*CmdPicFile)
+			cmd.read(r)
+			m.flushText()
+			m.printf("%d: picfile '%s' page %d", pos, cmd.Path, cmd.Page)
+
+			if rdr, ok := m.rdr.(XDVRenderer); ok {
+				cur := m.state.cur()
+				rdr.DrawPicFile(cur.h, cur.v, cmd)
 			}
 
 		default:
 			cmd := op.cmd()
-			cmd.read(p.r)
+			cmd.read(r)
 			panic(fmt.Errorf("invalid dvi command %q (op=%d)", op.cmd().Name(), op))
 		}
 		m.printf(" \n")
 	}
 
-	if !eop {
-		return errNoEOP
-	}
-
-	return nil
+	return eop, nil
 }
 
 // drawGlyph finishes a command that either sets or puts a character.
@@ -920,12 +1062,31 @@ func (m *Machine) drawGlyph(op opCode, cmd int32) error {
 
 	cur := m.state.cur()
 
+	if def := m.state.fonts[m.state.f]; def.native != nil {
+		return fmt.Errorf("dvi: can not set character %d of native font %q", cmd, def.Name)
+	}
+
 	face, err := m.face(m.state.f)
 	if err != nil {
 		return err
 	}
 
-	m.rdr.DrawGlyph(cur.h, cur.v, m.font(), rune(cmd), color.Black)
+	switch vfnt := m.state.fonts[m.state.f].vf; {
+	case vfnt != nil:
+		err = m.drawVirtual(vfnt, rune(cmd))
+		if err != nil {
+			return err
+		}
+		// executing the packet may have reallocated the stack.
+		cur = m.state.cur()
+	default:
+		switch rdr := m.rdr.(type) {
+		case PixelRenderer:
+			rdr.DrawGlyphPixel(cur.hh, cur.vv, m.font(), rune(cmd), m.color())
+		default:
+			rdr.DrawGlyph(cur.h, cur.v, m.font(), rune(cmd), m.color())
+		}
+	}
 
 	adv, ok := face.GlyphAdvance(rune(cmd))
 	if !ok {
@@ -951,8 +1112,31 @@ func (m *Machine) drawRule(op opCode, height, width int32) error {
 		m.printf(" (%dx%d pixels)", m.rulepixels(height), m.rulepixels(width))
 	}
 
-	cur := m.state.cur()
-	m.rdr.DrawRule(cur.h, cur.v, width, height, color.Black)
+	var (
+		cur  = m.state.cur()
+		x, y = cur.h, cur.v
+		w, h = width, height
+
+		hh, vv = cur.hh, cur.vv
+	)
+	// in the vertical directions, rules extend along the writing direction.
+	switch cur.dir {
+	case DirVertical:
+		y, w, h = cur.v+width, height, width
+		vv = m.pixels(y)
+	case DirDownToUp:
+		x, w, h = cur.h-height, height, width
+		hh = m.pixels(x)
+	}
+
+	switch rdr := m.rdr.(type) {
+	case PixelRenderer:
+		if height > 0 && width > 0 {
+			rdr.DrawRulePixel(hh, vv, m.rulepixels(w), m.rulepixels(h), m.color())
+		}
+	default:
+		rdr.DrawRule(x, y, w, h, m.color())
+	}
 
 	if op == opPutRule {
 		return nil
@@ -963,8 +1147,66 @@ func (m *Machine) drawRule(op opCode, height, width int32) error {
 	return m.moveright(width)
 }
 
-// moveright finishes a command that sets h += q.
+// drawGlyphs finishes a command that sets glyphs of a native font.
+func (m *Machine) drawGlyphs(width int32, glyphs []Glyph) error {
+	def := m.state.fonts[m.state.f]
+	if def.native == nil {
+		return fmt.Errorf("dvi: current font %q is not a native font", def.Name)
+	}
+
+	cur := m.state.cur()
+	if rdr, ok := m.rdr.(XDVRenderer); ok {
+		c := m.color()
+		for _, g := range glyphs {
+			rdr.DrawNativeGlyph(cur.h+g.X, cur.v+g.Y, def.native, g.ID, c)
+		}
+	}
+
+	cur.hh += m.pixels(width)
+	return m.moveright(width)
+}
+
+// notifyDir notifies the renderer of a change of the writing direction.
+func (m *Machine) notifyDir(dir Dir) {
+	if rdr, ok := m.rdr.(DirRenderer); ok {
+		rdr.Dir(dir)
+	}
+}
+
+// moveright finishes a command that moves right by q, along the current
+// writing direction.
 func (m *Machine) moveright(q int32) error {
+	cur := m.state.cur()
+	switch cur.dir {
+	case DirVertical, DirDownToUp:
+		// h is left unchanged: undo the adjustments of hh.
+		cur.hh = m.pixels(cur.h)
+		if cur.dir == DirDownToUp {
+			q = -q
+		}
+		return m.movev(q)
+	}
+	return m.moveh(q)
+}
+
+// movedown finishes a command that moves down by q, along the current
+// writing direction.
+func (m *Machine) movedown(q int32) error {
+	cur := m.state.cur()
+	switch cur.dir {
+	case DirVertical, DirDownToUp:
+		// v is left unchanged: undo the adjustments of vv.
+		cur.vv = m.pixels(cur.v)
+		if cur.dir == DirVertical {
+			q = -q
+		}
+		return m.moveh(q)
+	}
+	return m.movev(q)
+}
+
+// moveh sets h += q.
+func (m *Machine) moveh(q int32) error {
 	cur := m.state.cur()
 	old := cur.h
 	hhh := m.pixels(cur.h + q)
@@ -981,8 +1223,8 @@ func (m *Machine) moveright(q int32) error {
 	return nil
 }
 
-// movedown finishes a command that sets v += q.
-func (m *Machine) movedown(q int32) error {
+// movev sets v += q.
+func (m *Machine) movev(q int32) error {
 	cur := m.state.cur()
 	old := cur.v
 	vvv := m.pixels(cur.v + q)
@@ -1063,7 +1305,6 @@ func (m *Machine) face(i int) (*tfm.Face, error) {
 
 func (m *Machine) loadFont(i int) (*tfm.Face, error) {
 	def := m.state.fonts[i]
-	// FIXME: add support for non-TFM fonts?
 	name, err := m.ktx.Find(def.Name + ".tfm")
 	if err != nil {
 		return nil, fmt.Errorf("could not find TFM font %q: %w", def.Name, err)
@@ -1084,6 +1325,11 @@ func (m *Machine) loadFont(i int) (*tfm.Face, error) {
 	})
 	def.font = &font
 	def.face = &face
+
+	def.vf, err = m.loadVF(def)
+	if err != nil {
+		return nil, err
+	}
 	m.state.fonts[i] = def
 
 	return def.face, nil
@@ -1094,8 +1340,13 @@ func (m *Machine) font() Font {
 	if err != nil {
 		panic(err)
 	}
+	def := m.state.fonts[m.state.f]
 	return Font{
-		face: face,
+		name:   def.Name,
+		size:   def.Size,
+		design: def.Design,
+		font:   def.font,
+		face:   face,
 	}
 }
 
@@ -1143,10 +1394,12 @@ func (m *Machine) outVMove(v int32) int32 {
 	return cur.vv
 }
 
-func (m *Machine) handleSpecial(p []byte) error {
-	return nil
-}
-
 func (m *Machine) printf(format string, args ...interface{}) {
 	fmt.Fprintf(m.w, format, args...)
 }
+
+// warnf reports a problem of the DVI program that does not stop its
+// execution.
+func (m *Machine) warnf(format string, args ...interface{}) {
+	m.printf(" (warning: "+format+")", args...)
+}
@@ -9,9 +9,20 @@ import "fmt"
 const (
 	dviEOF = 223
 
-	dviVersion = 2
+	dviVersion = 2 // DVI documents produced by TeX.
+
+	ptexVersion = 3 // post_post id of pTeX DVI documents with direction changes.
+
+	xdv5Version = 5 // XDV documents of older XeTeX versions, with native fonts defined by name.
+	xdv6Version = 6 // XDV documents of older XeTeX versions, with glyph_string commands.
+	xdvVersion  = 7 // XDV documents produced by XeTeX, with text_and_glyphs commands.
 )
 
+// isXDV reports whether the provided DVI id denotes an XDV document.
+func isXDV(version uint8) bool {
+	return xdv5Version <= version && version <= xdvVersion
+}
+
 type opCode uint8
 
 const (
@@ -267,6 +278,48 @@ const (
 	opPostPost                 // postamble ending
 )
 
+// DVI extensions.
+const (
+	opPicFile       opCode = 251 // XDV: include a picture
+	opNativeFontDef opCode = 252 // XDV: define the meaning of a native font number
+	opGlyphs        opCode = 253 // XDV: typeset glyphs and move right
+	opTextAndGlyphs opCode = 254 // XDV: typeset glyphs, with their text, and move right (glyph_string in XDV-5 and XDV-6)
+	opDir           opCode = 255 // pTeX: set the writing direction
+)
+
+// versionMatch reports whether the DVI ids of the preamble and of the
+// post-postamble of a document match.
+// pTeX documents with direction changes have a post_post id of 3.
+func versionMatch(pre, post uint8) bool {
+	return pre == post || (pre == dviVersion && post == ptexVersion)
+}
+
+// valid reports whether op is a valid opcode for documents with the
+// provided DVI id. A zero id accepts all the known opcodes.
+func (op opCode) valid(version uint8) bool {
+	switch {
+	case op <= opPostPost:
+		return true
+	case op == opDir:
+		return version == 0 || version == dviVersion || version == ptexVersion
+	case opPicFile <= op && op <= opTextAndGlyphs:
+		return version == 0 || isXDV(version)
+	}
+	return false
+}
+
+// cmdOf returns a new command for the opcode, as laid out in documents
+// with the provided DVI id.
+func (op opCode) cmdOf(version uint8) Cmd {
+	switch {
+	case op == opNativeFontDef && version == xdv5Version:
+		return &CmdNativeFontDef{byName: true}
+	case op == opTextAndGlyphs && (version == xdv5Version || version == xdv6Version):
+		return &CmdGlyphString{}
+	}
+	return op.cmd()
+}
+
 func (op opCode) cmd() Cmd {
 	switch op {
 	case opSetChar000, opSetChar001, opSetChar002, opSetChar003, opSetChar004,
@@ -427,6 +480,16 @@ func (op opCode) cmd() Cmd {
 		return &CmdPost{}
 	case opPostPost:
 		return &CmdPostPost{}
+	case opPicFile:
+		return &CmdPicFile{}
+	case opNativeFontDef:
+		return &CmdNativeFontDef{}
+	case opGlyphs:
+		return &CmdGlyphs{}
+	case opTextAndGlyphs:
+		return &CmdTextAndGlyphs{}
+	case opDir:
+		return &CmdDir{}
 	default:
 		panic(fmt.Errorf("dvi: unknown opcode 0x%x (%d)", op, op))
 	}
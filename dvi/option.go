@@ -5,6 +5,7 @@
 package dvi
 
 import (
+	"fmt"
 	"io"
 
 	"star-tex.org/x/tex/kpath"
@@ -16,6 +17,8 @@ type config struct {
 	ctx kpath.Context
 	rdr Renderer
 	out io.Writer
+
+	specials []special
 }
 
 func newConfig() *config {
@@ -46,3 +49,21 @@ func WithLogOutput(w io.Writer) Option {
 		return nil
 	}
 }
+
+// WithSpecialHandler registers a handler for the \special commands whose
+// payload starts with the provided prefix.
+// The handler with the longest matching prefix is invoked.
+// Handlers registered with WithSpecialHandler take precedence over the
+// builtin handlers of the Machine.
+func WithSpecialHandler(prefix string, h SpecialHandler) Option {
+	return func(cfg *config) error {
+		if h == nil {
+			return fmt.Errorf("dvi: nil special handler for prefix %q", prefix)
+		}
+		cfg.specials = append(cfg.specials, special{
+			prefix: prefix,
+			handle: func(_ *Machine, s Special) error { return h(s) },
+		})
+		return nil
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pdf implements a DVI renderer producing PDF documents.
+//
+// The Type1 font programs of the DVI fonts are located with kpath and
+// embedded as subsets in the PDF document.
+// Fonts without a Type1 font program are referenced but not embedded.
+package pdf // import "star-tex.org/x/tex/dvi/pdf"
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+	"strings"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/font/tfm"
+	"star-tex.org/x/tex/font/type1"
+	xpdf "star-tex.org/x/tex/internal/pdf"
+	"star-tex.org/x/tex/kpath"
+)
+
+const (
+	// TeX places the origin of the page 1in from the top and left edges
+	// of the paper.
+	margin = 72 // in big points
+
+	spToBP = 72 / 72.27 / 65536 // converts scaled points to big points
+)
+
+// Renderer renders DVI documents as PDF documents.
+type Renderer struct {
+	w   *xpdf.Writer
+	ktx kpath.Context
+	err error
+
+	conv   float64    // converts DVI units to big points
+	paper  [2]float64 // width and height of the paper, in big points
+	parent xpdf.Ref   // reference of the pages tree
+	res    xpdf.Ref   // reference of the shared resources
+	pages  []xpdf.Ref
+
+	fonts map[string]*font
+
+	page struct {
+		content bytes.Buffer
+		bg      color.Color
+		fill    color.Color
+		font    *font
+		size    float64
+		text    bool // whether a text object is opened
+	}
+}
+
+type font struct {
+	id   int
+	ref  xpdf.Ref
+	name string
+	tfm  *tfm.Font
+	used [256]bool
+}
+
+var (
+	_ dvi.Renderer           = (*Renderer)(nil)
+	_ dvi.BackgroundRenderer = (*Renderer)(nil)
+	_ dvi.SpecialRenderer    = (*Renderer)(nil)
+)
+
+// New returns a new PDF renderer writing the document described by the
+// provided DVI preamble to w.
+// Font programs are located with the provided kpath context.
+//
+// Close must be called to finish the PDF document.
+func New(w io.Writer, ctx kpath.Context, pre dvi.CmdPre) *Renderer {
+	rdr := &Renderer{
+		w:     xpdf.NewWriter(w),
+		ktx:   ctx,
+		paper: [2]float64{612, 792}, // US letter, as dvips.
+		fonts: make(map[string]*font),
+	}
+	n, d, mag := float64(pre.Num), float64(pre.Den), float64(pre.Mag)
+	if n == 0 || d == 0 {
+		n, d = dvi.TeXNum, dvi.TeXDen
+	}
+	if mag == 0 {
+		mag = dvi.TeXMag
+	}
+	// DVI units are n/d 10^-7 meters.
+	rdr.conv = n / d * 1e-7 / 0.0254 * 72 * mag / 1000
+	rdr.parent = rdr.w.Alloc()
+	rdr.res = rdr.w.Alloc()
+	return rdr
+}
+
+// BOP starts a new page.
+func (rdr *Renderer) BOP(bop *dvi.CmdBOP) {
+	rdr.page.content.Reset()
+	rdr.page.bg = nil
+	rdr.page.fill = color.Black
+	rdr.page.font = nil
+	rdr.page.text = false
+}
+
+// EOP finishes the current page.
+func (rdr *Renderer) EOP() {
+	rdr.endText()
+
+	var (
+		o    bytes.Buffer
+		w, h = rdr.paper[0], rdr.paper[1]
+	)
+	if bg := rdr.page.bg; bg != nil {
+		fmt.Fprintf(&o, "q %s 0 0 %s %s re f Q\n", fillColor(bg), num(w), num(h))
+	}
+	fmt.Fprintf(&o, "1 0 0 1 %s %s cm\n", num(margin), num(h-margin))
+	o.Write(rdr.page.content.Bytes())
+
+	var (
+		page    = rdr.w.Alloc()
+		content = rdr.w.Alloc()
+	)
+	rdr.check(rdr.w.WriteStream(content, "", o.Bytes()))
+	rdr.check(rdr.w.WriteObject(page, fmt.Sprintf(
+		"<< /Type /Page /Parent %v /MediaBox [0 0 %s %s] /Resources %v /Contents %v >>",
+		rdr.parent, num(w), num(h), rdr.res, content,
+	)))
+	rdr.pages = append(rdr.pages, page)
+}
+
+// Background sets the background color of the current page.
+func (rdr *Renderer) Background(c color.Color) {
+	rdr.page.bg = c
+}
+
+// Special handles the papersize= special, to set the size of the paper.
+func (rdr *Renderer) Special(s dvi.Special) error {
+	if s.Prefix != "papersize=" {
+		return nil
+	}
+	data := strings.TrimSpace(string(s.Data))
+	w, h, err := dvi.ParsePaperSize(data[len(s.Prefix):])
+	if err != nil {
+		return err
+	}
+	rdr.paper[0] = float64(w) * spToBP
+	rdr.paper[1] = float64(h) * spToBP
+	return nil
+}
+
+// DrawGlyph draws the provided glyph at the (x,y) position, in DVI units.
+func (rdr *Renderer) DrawGlyph(x, y int32, font dvi.Font, glyph rune, c color.Color) {
+	if glyph < 0 || glyph > 255 {
+		rdr.check(fmt.Errorf("pdf: invalid glyph %d in font %q", glyph, font.Name()))
+		return
+	}
+	fnt := rdr.font(font)
+	fnt.used[glyph] = true
+
+	o := &rdr.page.content
+	if !rdr.page.text {
+		o.WriteString("BT\n")
+		rdr.page.text = true
+	}
+	rdr.setFill(c)
+	if size := float64(font.Size()) * rdr.conv; fnt != rdr.page.font || size != rdr.page.size {
+		fmt.Fprintf(o, "/F%d %s Tf\n", fnt.id, num(size))
+		rdr.page.font = fnt
+		rdr.page.size = size
+	}
+	fmt.Fprintf(o, "1 0 0 1 %s %s Tm <%02x> Tj\n", num(rdr.x(x)), num(rdr.y(y)), glyph)
+}
+
+// DrawRule draws a filled rectangle of size (w,h) at the (x,y) position,
+// in DVI units.
+// The (x,y) position is the bottom left corner of the rectangle.
+func (rdr *Renderer) DrawRule(x, y, w, h int32, c color.Color) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	rdr.endText()
+	rdr.setFill(c)
+	fmt.Fprintf(
+		&rdr.page.content, "%s %s %s %s re f\n",
+		num(rdr.x(x)), num(rdr.y(y)),
+		num(float64(w)*rdr.conv), num(float64(h)*rdr.conv),
+	)
+}
+
+// Close writes the fonts, the pages tree and the trailer of the PDF
+// document.
+// Close does not close the underlying io.Writer.
+func (rdr *Renderer) Close() error {
+	fonts := make([]*font, 0, len(rdr.fonts))
+	for _, fnt := range rdr.fonts {
+		fonts = append(fonts, fnt)
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].id < fonts[j].id })
+
+	var res strings.Builder
+	res.WriteString("<< /ProcSet [/PDF /Text] /Font <<")
+	for _, fnt := range fonts {
+		rdr.writeFont(fnt)
+		fmt.Fprintf(&res, " /F%d %v", fnt.id, fnt.ref)
+	}
+	res.WriteString(" >> >>")
+	rdr.check(rdr.w.WriteObject(rdr.res, res.String()))
+
+	var kids strings.Builder
+	for i, page := range rdr.pages {
+		if i > 0 {
+			kids.WriteString(" ")
+		}
+		kids.WriteString(page.String())
+	}
+	rdr.check(rdr.w.WriteObject(rdr.parent, fmt.Sprintf(
+		"<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(rdr.pages),
+	)))
+
+	var (
+		root = rdr.w.Alloc()
+		info = rdr.w.Alloc()
+	)
+	rdr.check(rdr.w.WriteObject(root, fmt.Sprintf("<< /Type /Catalog /Pages %v >>", rdr.parent)))
+	rdr.check(rdr.w.WriteObject(info, "<< /Producer (star-tex) >>"))
+	if rdr.err != nil {
+		return rdr.err
+	}
+
+	err := rdr.w.Close(root, info)
+	if err != nil {
+		return fmt.Errorf("pdf: could not close PDF document: %w", err)
+	}
+	return nil
+}
+
+func (rdr *Renderer) check(err error) {
+	if err != nil && rdr.err == nil {
+		rdr.err = err
+	}
+}
+
+// x converts the provided horizontal DVI position to the page coordinates.
+func (rdr *Renderer) x(v int32) float64 { return float64(v) * rdr.conv }
+
+// y converts the provided vertical DVI position to the page coordinates.
+func (rdr *Renderer) y(v int32) float64 { return -float64(v) * rdr.conv }
+
+func (rdr *Renderer) endText() {
+	if !rdr.page.text {
+		return
+	}
+	rdr.page.content.WriteString("ET\n")
+	rdr.page.text = false
+	rdr.page.font = nil
+}
+
+func (rdr *Renderer) setFill(c color.Color) {
+	if c == nil {
+		c = color.Black
+	}
+	if c == rdr.page.fill {
+		return
+	}
+	rdr.page.content.WriteString(fillColor(c) + "\n")
+	rdr.page.fill = c
+}
+
+// font returns the PDF font associated with the provided DVI font.
+func (rdr *Renderer) font(f dvi.Font) *font {
+	fnt, ok := rdr.fonts[f.Name()]
+	if ok {
+		return fnt
+	}
+	fnt = &font{
+		id:   len(rdr.fonts) + 1,
+		ref:  rdr.w.Alloc(),
+		name: f.Name(),
+		tfm:  f.Metrics(),
+	}
+	rdr.fonts[fnt.name] = fnt
+	return fnt
+}
+
+// writeFont writes the font dictionary of fnt, embedding a subset of its
+// Type1 font program when it can be found.
+func (rdr *Renderer) writeFont(fnt *font) {
+	var (
+		first, last = -1, -1
+		o           strings.Builder
+	)
+	for c, used := range fnt.used {
+		if !used {
+			continue
+		}
+		if first < 0 {
+			first = c
+		}
+		last = c
+	}
+	if first < 0 {
+		first, last = 0, 0
+	}
+
+	t1, err := rdr.loadType1(fnt.name)
+	if err != nil {
+		t1 = nil
+	}
+
+	var (
+		base   = strings.ToUpper(fnt.name)
+		enc    [256]string
+		glyphs []string
+	)
+	if t1 != nil {
+		enc = t1.Encoding()
+		for c, used := range fnt.used {
+			if used && enc[c] != "" {
+				glyphs = append(glyphs, enc[c])
+			}
+		}
+		sub, err := t1.Subset(glyphs)
+		if err != nil {
+			rdr.check(fmt.Errorf("pdf: could not subset font %q: %w", fnt.name, err))
+			return
+		}
+		t1 = &sub
+		base = xpdf.SubsetTag(glyphs) + "+" + t1.Name()
+	}
+
+	fmt.Fprintf(&o, "<< /Type /Font /Subtype /Type1 /BaseFont /%s", base)
+	fmt.Fprintf(&o, " /FirstChar %d /LastChar %d /Widths [", first, last)
+	for c := first; c <= last; c++ {
+		var wd float64
+		if fnt.used[c] && fnt.tfm != nil {
+			adv, ok := fnt.tfm.GlyphAdvance(rune(c))
+			if ok {
+				wd = float64(adv) / (1 << 20) * 1000
+			}
+		}
+		fmt.Fprintf(&o, " %s", num(wd))
+	}
+	o.WriteString(" ]")
+
+	if t1 != nil {
+		o.WriteString(" /Encoding << /Type /Encoding /Differences [")
+		for c, used := range fnt.used {
+			if used && enc[c] != "" {
+				fmt.Fprintf(&o, " %d /%s", c, enc[c])
+			}
+		}
+		o.WriteString(" ] >>")
+
+		file, err := xpdf.EmbedType1(rdr.w, t1)
+		rdr.check(err)
+
+		var charset strings.Builder
+		for _, name := range glyphs {
+			charset.WriteString("/" + name)
+		}
+		flags := 4
+		if t1.IsFixedPitch() {
+			flags |= 1
+		}
+		var (
+			bbox = t1.FontBBox()
+			desc = rdr.w.Alloc()
+		)
+		rdr.check(rdr.w.WriteObject(desc, fmt.Sprintf(
+			"<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%s %s %s %s] /ItalicAngle %s /Ascent %s /Descent %s /CapHeight %s /StemV 80 /CharSet (%s) /FontFile %v >>",
+			base, flags,
+			num(bbox[0]), num(bbox[1]), num(bbox[2]), num(bbox[3]),
+			num(t1.ItalicAngle()), num(bbox[3]), num(bbox[1]), num(bbox[3]),
+			charset.String(), file,
+		)))
+		fmt.Fprintf(&o, " /FontDescriptor %v", desc)
+	}
+	o.WriteString(" >>")
+	rdr.check(rdr.w.WriteObject(fnt.ref, o.String()))
+}
+
+// loadType1 locates and parses the Type1 font program of the TeX font name.
+func (rdr *Renderer) loadType1(name string) (*type1.Font, error) {
+	fname, err := rdr.ktx.Find(name + ".pfb")
+	if err != nil {
+		return nil, err
+	}
+	f, err := rdr.ktx.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fnt, err := type1.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	return &fnt, nil
+}
+
+// fillColor returns the PDF operator setting the fill color to c.
+func fillColor(c color.Color) string {
+	switch c := c.(type) {
+	case color.Gray:
+		return num(float64(c.Y)/0xff) + " g"
+	case color.Gray16:
+		return num(float64(c.Y)/0xffff) + " g"
+	case color.CMYK:
+		return fmt.Sprintf(
+			"%s %s %s %s k",
+			num(float64(c.C)/0xff), num(float64(c.M)/0xff),
+			num(float64(c.Y)/0xff), num(float64(c.K)/0xff),
+		)
+	default:
+		r, g, b, _ := c.RGBA()
+		return fmt.Sprintf(
+			"%s %s %s rg",
+			num(float64(r)/0xffff), num(float64(g)/0xffff), num(float64(b)/0xffff),
+		)
+	}
+}
+
+// num formats v as a PDF real number.
+func num(v float64) string { return xpdf.Real(v) }
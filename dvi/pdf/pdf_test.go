@@ -0,0 +1,181 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/kpath"
+)
+
+func TestRenderer(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pages int
+		want  []string
+	}{
+		{
+			name:  "../../testdata/hello_golden.dvi",
+			pages: 1,
+			want: []string{
+				"/BaseFont /RKEUFR+CMR10",
+				"/BaseFont /CMMI10",
+				"1 0 0 1 19.9253 -9.9626 Tm <54> Tj",
+			},
+		},
+		{
+			name:  "../../testdata/pages_golden.dvi",
+			pages: 3,
+		},
+		{
+			name:  "../../testdata/xcolor_golden.dvi",
+			pages: 1,
+			want: []string{
+				"/MediaBox [0 0 612 792]",
+				"0 0 1 rg",
+				"0 0.5098 1 0 k",
+				"239.4911 -149.4396 42.8394 12.8961 re f",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := os.ReadFile(tc.name)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+
+			prog, err := dvi.Compile(raw)
+			if err != nil {
+				t.Fatalf("could not compile DVI file: %+v", err)
+			}
+
+			var (
+				ctx = kpath.New()
+				out = new(bytes.Buffer)
+				rdr = New(out, ctx, prog.Pre())
+				vm  = dvi.NewMachine(dvi.WithContext(ctx), dvi.WithRenderer(rdr))
+			)
+			err = vm.Run(prog)
+			if err != nil {
+				t.Fatalf("could not run DVI program: %+v", err)
+			}
+			err = rdr.Close()
+			if err != nil {
+				t.Fatalf("could not close PDF renderer: %+v", err)
+			}
+
+			doc := inflate(t, out.Bytes())
+			checkXRef(t, out.Bytes())
+
+			if got, want := strings.Count(doc, "/Type /Page "), tc.pages; got != want {
+				t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(doc, want) {
+					t.Fatalf("could not find %q in PDF document", want)
+				}
+			}
+		})
+	}
+}
+
+func TestRendererPaperSize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := dvi.NewWriter(buf, dvi.CmdPre{})
+	w.BeginPage([10]int32{1})
+	w.Special([]byte("papersize=210mm,297mm"))
+	w.Special([]byte("background rgb 1 1 0"))
+	w.Down(1 << 16)
+	w.SetRule(1<<16, 2<<16)
+	w.EndPage()
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("could not write DVI document: %+v", err)
+	}
+
+	prog, err := dvi.Compile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not compile DVI document: %+v", err)
+	}
+
+	var (
+		out = new(bytes.Buffer)
+		rdr = New(out, kpath.New(), prog.Pre())
+		vm  = dvi.NewMachine(dvi.WithRenderer(rdr))
+	)
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI program: %+v", err)
+	}
+	err = rdr.Close()
+	if err != nil {
+		t.Fatalf("could not close PDF renderer: %+v", err)
+	}
+
+	doc := inflate(t, out.Bytes())
+	for _, want := range []string{
+		"/MediaBox [0 0 595.2756 841.8898]",
+		"q 1 1 0 rg 0 0 595.2756 841.8898 re f Q\n1 0 0 1 72 769.8898 cm\n",
+		"0 -0.9963 1.9925 0.9963 re f",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("could not find %q in PDF document:\n%s", want, doc)
+		}
+	}
+}
+
+var reStream = regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`)
+
+// inflate returns the PDF document with its streams decompressed.
+func inflate(t *testing.T, doc []byte) string {
+	t.Helper()
+	return reStream.ReplaceAllStringFunc(string(doc), func(s string) string {
+		data := reStream.FindStringSubmatch(s)[1]
+		r, err := zlib.NewReader(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("could not open stream: %+v", err)
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("could not inflate stream: %+v", err)
+		}
+		return "stream\n" + string(raw) + "\nendstream"
+	})
+}
+
+// checkXRef checks the offsets of the cross-reference table.
+func checkXRef(t *testing.T, doc []byte) {
+	t.Helper()
+	i := bytes.LastIndex(doc, []byte("startxref\n"))
+	if i < 0 {
+		t.Fatalf("could not find startxref")
+	}
+	xref, err := strconv.Atoi(string(bytes.Fields(doc[i+len("startxref\n"):])[0]))
+	if err != nil {
+		t.Fatalf("could not parse startxref: %+v", err)
+	}
+	lines := strings.Split(string(doc[xref:]), "\n")
+	n, err := strconv.Atoi(strings.Fields(lines[1])[1])
+	if err != nil {
+		t.Fatalf("could not parse xref size: %+v", err)
+	}
+	for obj := 1; obj < n; obj++ {
+		off, err := strconv.Atoi(lines[2+obj][:10])
+		if err != nil {
+			t.Fatalf("could not parse xref entry %d: %+v", obj, err)
+		}
+		if want := strconv.Itoa(obj) + " 0 obj\n"; !bytes.HasPrefix(doc[off:], []byte(want)) {
+			t.Fatalf("invalid xref entry for object %d", obj)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package png implements a DVI renderer rasterizing pages into images,
+// in the spirit of dvipng.
+//
+// Glyphs are drawn from the bitmaps of the PK fonts located with kpath,
+// and rules follow the pixel rounding rules of dvitype.
+// Glyphs of fonts without a PK font are not drawn.
+// Anti-aliasing is performed via supersampling.
+package png // import "star-tex.org/x/tex/dvi/png"
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/font/pk"
+	"star-tex.org/x/tex/kpath"
+)
+
+// Output consumes the image of a page.
+// page is the 0-based index of the page among the pages run by the
+// machine: the index of the page in the DVI document for Machine.Run.
+type Output func(page int, img *image.RGBA) error
+
+// Option configures a Renderer.
+type Option func(cfg *config)
+
+type config struct {
+	dpi float64
+	ss  int
+	bg  color.Color
+}
+
+// WithResolution sets the resolution of the images, in dots per inch.
+// The default resolution is 150 dpi.
+func WithResolution(dpi float64) Option {
+	return func(cfg *config) {
+		cfg.dpi = dpi
+	}
+}
+
+// WithSupersampling sets the supersampling factor used for anti-aliasing:
+// each pixel is computed from n×n sub-pixels.
+// The default factor is 4. A factor of 1 disables anti-aliasing.
+func WithSupersampling(n int) Option {
+	return func(cfg *config) {
+		cfg.ss = n
+	}
+}
+
+// WithBackground sets the default background color of the pages.
+// The default background color is white.
+func WithBackground(c color.Color) Option {
+	return func(cfg *config) {
+		cfg.bg = c
+	}
+}
+
+// Renderer rasterizes DVI documents.
+type Renderer struct {
+	out Output
+	ktx kpath.Context
+	cfg config
+	err error
+
+	mag   float64    // magnification of the document
+	paper [2]float64 // width and height of the paper, in inches
+	fonts map[string]*pk.Font
+	masks map[glyphKey]*mask
+	npage int
+
+	page struct {
+		img *image.RGBA // content of the page, over a transparent background.
+		bg  color.Color
+	}
+}
+
+type glyphKey struct {
+	font string
+	size int32
+	code rune
+}
+
+// mask is the coverage of a glyph on the sub-pixel grid.
+type mask struct {
+	img        *image.Alpha
+	hoff, voff int // offset of the top-left sub-pixel from the reference point.
+}
+
+var (
+	_ dvi.Renderer           = (*Renderer)(nil)
+	_ dvi.PixelRenderer      = (*Renderer)(nil)
+	_ dvi.BackgroundRenderer = (*Renderer)(nil)
+	_ dvi.SpecialRenderer    = (*Renderer)(nil)
+)
+
+// New returns a new PNG renderer for the document described by the
+// provided DVI preamble.
+// The image of each page is passed to out.
+// PK fonts are located with the provided kpath context.
+func New(out Output, ctx kpath.Context, pre dvi.CmdPre, opts ...Option) *Renderer {
+	rdr := &Renderer{
+		out: out,
+		ktx: ctx,
+		cfg: config{
+			dpi: 150,
+			ss:  4,
+			bg:  color.White,
+		},
+		mag:   float64(pre.Mag) / 1000,
+		paper: [2]float64{8.5, 11}, // US letter, as dvips.
+		fonts: make(map[string]*pk.Font),
+		masks: make(map[glyphKey]*mask),
+	}
+	for _, opt := range opts {
+		opt(&rdr.cfg)
+	}
+	if rdr.cfg.ss < 1 {
+		rdr.cfg.ss = 1
+	}
+	if rdr.mag == 0 {
+		rdr.mag = 1
+	}
+	return rdr
+}
+
+// Resolution returns the resolution of the sub-pixel grid, in dots per inch.
+func (rdr *Renderer) Resolution() float64 {
+	return rdr.cfg.dpi * float64(rdr.cfg.ss)
+}
+
+// BOP starts a new page.
+func (rdr *Renderer) BOP(bop *dvi.CmdBOP) {
+	rdr.page.img = nil
+	rdr.page.bg = rdr.cfg.bg
+}
+
+// EOP finishes the current page and passes its image to the output.
+func (rdr *Renderer) EOP() {
+	page := rdr.npage
+	rdr.npage++
+
+	var (
+		src = rdr.canvas()
+		dst = image.NewRGBA(src.Bounds())
+	)
+	if bg := rdr.page.bg; bg != nil {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+	draw.Draw(dst, dst.Bounds(), src, image.Point{}, draw.Over)
+
+	if rdr.err != nil {
+		return
+	}
+	err := rdr.out(page, dst)
+	if err != nil {
+		rdr.err = fmt.Errorf("png: could not output page %d: %w", page, err)
+	}
+}
+
+// Background sets the background color of the current page.
+func (rdr *Renderer) Background(c color.Color) {
+	rdr.page.bg = c
+}
+
+// Special handles the papersize= special, to set the size of the paper.
+func (rdr *Renderer) Special(s dvi.Special) error {
+	if s.Prefix != "papersize=" {
+		return nil
+	}
+	data := bytes.TrimSpace(s.Data)
+	w, h, err := dvi.ParsePaperSize(string(data[len(s.Prefix):]))
+	if err != nil {
+		return err
+	}
+	const spToIn = 1 / 72.27 / 65536
+	rdr.paper[0] = float64(w) * spToIn
+	rdr.paper[1] = float64(h) * spToIn
+	return nil
+}
+
+// DrawGlyph is a no-op: glyphs are drawn by DrawGlyphPixel.
+func (rdr *Renderer) DrawGlyph(x, y int32, font dvi.Font, glyph rune, c color.Color) {}
+
+// DrawRule is a no-op: rules are drawn by DrawRulePixel.
+func (rdr *Renderer) DrawRule(x, y, w, h int32, c color.Color) {}
+
+// DrawGlyphPixel draws the provided glyph with its reference point at
+// the (hh,vv) sub-pixel.
+func (rdr *Renderer) DrawGlyphPixel(hh, vv int32, font dvi.Font, glyph rune, c color.Color) {
+	m, err := rdr.mask(font, glyph)
+	if err != nil {
+		rdr.check(err)
+		return
+	}
+	if m == nil {
+		return
+	}
+	var (
+		off = rdr.offset()
+		x   = int(hh) + off - m.hoff
+		y   = int(vv) + off - m.voff
+	)
+	rdr.fill(x, y, m.img, c)
+}
+
+// DrawRulePixel draws a filled rectangle of size (w,h) sub-pixels, with
+// its bottom left corner at the (hh,vv) sub-pixel.
+func (rdr *Renderer) DrawRulePixel(hh, vv, w, h int32, c color.Color) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	var (
+		ss  = rdr.cfg.ss
+		off = rdr.offset()
+		x0  = int(hh) + off
+		y0  = int(vv) + off - int(h)
+		x1  = x0 + int(w)
+		y1  = y0 + int(h)
+		r   = image.Rect(floorDiv(x0, ss), floorDiv(y0, ss), ceilDiv(x1, ss), ceilDiv(y1, ss))
+		dst = image.NewAlpha(r)
+	)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		ny := overlap(y*ss, y*ss+ss, y0, y1)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			nx := overlap(x*ss, x*ss+ss, x0, x1)
+			dst.Pix[dst.PixOffset(x, y)] = uint8(nx * ny * 0xff / (ss * ss))
+		}
+	}
+	rdr.draw(dst, c)
+}
+
+// Close reports the first error encountered while rendering pages.
+// Close does not close the underlying outputs.
+func (rdr *Renderer) Close() error {
+	return rdr.err
+}
+
+func (rdr *Renderer) check(err error) {
+	if err != nil && rdr.err == nil {
+		rdr.err = err
+	}
+}
+
+// offset returns the position of the DVI origin on the sub-pixel grid:
+// TeX places the origin of the page 1in from the top and left edges of
+// the paper.
+func (rdr *Renderer) offset() int {
+	return int(math.Round(rdr.Resolution()))
+}
+
+// canvas returns the image of the current page.
+func (rdr *Renderer) canvas() *image.RGBA {
+	if rdr.page.img == nil {
+		var (
+			w = int(math.Round(rdr.paper[0] * rdr.cfg.dpi))
+			h = int(math.Round(rdr.paper[1] * rdr.cfg.dpi))
+		)
+		rdr.page.img = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	return rdr.page.img
+}
+
+// fill draws the sub-pixel mask src, with its top-left sub-pixel at (x,y).
+func (rdr *Renderer) fill(x, y int, src *image.Alpha, c color.Color) {
+	var (
+		ss = rdr.cfg.ss
+		sr = src.Bounds().Add(image.Pt(x, y))
+		r  = image.Rect(floorDiv(sr.Min.X, ss), floorDiv(sr.Min.Y, ss), ceilDiv(sr.Max.X, ss), ceilDiv(sr.Max.Y, ss))
+	)
+	if ss == 1 {
+		dst := *src
+		dst.Rect = sr
+		rdr.draw(&dst, c)
+		return
+	}
+
+	var (
+		dst = image.NewAlpha(r)
+		sum = make([]int, r.Dx()*r.Dy())
+	)
+	for sy := 0; sy < src.Rect.Dy(); sy++ {
+		row := src.Pix[sy*src.Stride:]
+		y := floorDiv(sr.Min.Y+sy, ss) - r.Min.Y
+		for sx := 0; sx < src.Rect.Dx(); sx++ {
+			if row[sx] == 0 {
+				continue
+			}
+			x := floorDiv(sr.Min.X+sx, ss) - r.Min.X
+			sum[y*r.Dx()+x] += int(row[sx])
+		}
+	}
+	for i, v := range sum {
+		dst.Pix[(i/r.Dx())*dst.Stride+i%r.Dx()] = uint8(v / (ss * ss))
+	}
+	rdr.draw(dst, c)
+}
+
+// draw composites the color c through the mask onto the current page.
+func (rdr *Renderer) draw(mask *image.Alpha, c color.Color) {
+	if c == nil {
+		c = color.Black
+	}
+	img := rdr.canvas()
+	r := mask.Bounds().Intersect(img.Bounds())
+	if r.Empty() {
+		return
+	}
+	draw.DrawMask(img, r, image.NewUniform(c), image.Point{}, mask, r.Min, draw.Over)
+}
+
+// mask returns the sub-pixel mask of the provided glyph.
+func (rdr *Renderer) mask(font dvi.Font, glyph rune) (*mask, error) {
+	key := glyphKey{font.Name(), font.Size(), glyph}
+	if m, ok := rdr.masks[key]; ok {
+		return m, nil
+	}
+
+	fnt, err := rdr.font(font.Name())
+	if err != nil {
+		return nil, err
+	}
+	if fnt == nil {
+		return nil, nil
+	}
+	g := fnt.Glyph(glyph)
+	if g == nil {
+		return nil, fmt.Errorf("png: font %q has no glyph %d", font.Name(), glyph)
+	}
+
+	scale := rdr.Resolution() * rdr.mag / fnt.Resolution()
+	if design := font.DesignSize(); design > 0 {
+		scale *= float64(font.Size()) / float64(design)
+	}
+
+	var (
+		src        = g.Mask()
+		hoff, voff = g.Offset()
+		gw, gh     = src.Rect.Dx(), src.Rect.Dy()
+		w          = int(math.Ceil(float64(gw)*scale - 1e-6))
+		h          = int(math.Ceil(float64(gh)*scale - 1e-6))
+		m          = &mask{
+			img:  image.NewAlpha(image.Rect(0, 0, w, h)),
+			hoff: int(math.Round(float64(hoff) * scale)),
+			voff: int(math.Round(float64(voff) * scale)),
+		}
+	)
+	for y := 0; y < h; y++ {
+		sy := int((float64(y) + 0.5) / scale)
+		if sy >= gh {
+			sy = gh - 1
+		}
+		for x := 0; x < w; x++ {
+			sx := int((float64(x) + 0.5) / scale)
+			if sx >= gw {
+				sx = gw - 1
+			}
+			m.img.Pix[y*m.img.Stride+x] = src.Pix[sy*src.Stride+sx]
+		}
+	}
+	if w == 0 || h == 0 {
+		m = nil
+	}
+	rdr.masks[key] = m
+	return m, nil
+}
+
+// font locates and parses the PK font with the provided name.
+// font returns a nil font when no PK font could be found.
+func (rdr *Renderer) font(name string) (*pk.Font, error) {
+	if fnt, ok := rdr.fonts[name]; ok {
+		return fnt, nil
+	}
+
+	fname, err := rdr.ktx.Find(name + ".pk")
+	if err != nil {
+		rdr.fonts[name] = nil
+		return nil, nil
+	}
+	f, err := rdr.ktx.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("png: could not open PK font %q: %w", name, err)
+	}
+	defer f.Close()
+
+	fnt, err := pk.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("png: could not parse PK font %q: %w", name, err)
+	}
+	rdr.fonts[name] = &fnt
+	return &fnt, nil
+}
+
+// overlap returns the length of the intersection of [a0,a1) and [b0,b1).
+func overlap(a0, a1, b0, b1 int) int {
+	lo, hi := a0, a1
+	if b0 > lo {
+		lo = b0
+	}
+	if b1 < hi {
+		hi = b1
+	}
+	if hi < lo {
+		return 0
+	}
+	return hi - lo
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int) int {
+	return -floorDiv(-a, b)
+}
@@ -0,0 +1,157 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/kpath"
+)
+
+func render(t *testing.T, raw []byte, opts ...Option) []*image.RGBA {
+	t.Helper()
+
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	var (
+		pages []*image.RGBA
+		ctx   = kpath.New()
+		out   = func(page int, img *image.RGBA) error {
+			if page != len(pages) {
+				t.Fatalf("invalid page index: got=%d, want=%d", page, len(pages))
+			}
+			pages = append(pages, img)
+			return nil
+		}
+		rdr = New(out, ctx, prog.Pre(), opts...)
+		vm  = dvi.NewMachine(dvi.WithContext(ctx), dvi.WithRenderer(rdr))
+	)
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI program: %+v", err)
+	}
+	err = rdr.Close()
+	if err != nil {
+		t.Fatalf("could not render PNG: %+v", err)
+	}
+	return pages
+}
+
+func TestRenderer(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pages int
+	}{
+		{"../../testdata/hello_golden.dvi", 1},
+		{"../../testdata/pages_golden.dvi", 3},
+		{"../../testdata/xcolor_golden.dvi", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := os.ReadFile(tc.name)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+			pages := render(t, raw, WithResolution(50), WithSupersampling(2))
+			if got, want := len(pages), tc.pages; got != want {
+				t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+			}
+			for i, img := range pages {
+				if got, want := img.Bounds(), image.Rect(0, 0, 425, 550); got != want {
+					t.Fatalf("invalid bounds for page %d: got=%v, want=%v", i, got, want)
+				}
+				var ink int
+				for i := 0; i < len(img.Pix); i += 4 {
+					if img.Pix[i] < 0x80 {
+						ink++
+					}
+				}
+				if ink == 0 {
+					t.Fatalf("page %d is blank", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRendererRules(t *testing.T) {
+	const px = 473628 // about 1/10in, in scaled points.
+
+	buf := new(bytes.Buffer)
+	w := dvi.NewWriter(buf, dvi.CmdPre{})
+	w.BeginPage([10]int32{1})
+	w.Special([]byte("papersize=1in,1in"))
+	w.Special([]byte("background rgb 0 0 1"))
+	w.Special([]byte("color push rgb 1 0 0"))
+	w.Push()
+	w.Right(-10 * px)
+	w.Down(-5 * px)
+	w.SetRule(2*px, 3*px)
+	w.Pop()
+	w.Push()
+	w.Right(-5 * px)
+	w.Down(-1 * px)
+	w.SetRule(px, 3*px/2)
+	w.Pop()
+	w.Special([]byte("color pop"))
+	w.EndPage()
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("could not write DVI document: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		ss   int
+		want map[image.Point]color.RGBA
+	}{
+		{
+			ss: 1,
+			want: map[image.Point]color.RGBA{
+				{0, 0}: {0, 0, 0xff, 0xff},
+				{0, 3}: {0xff, 0, 0, 0xff},
+				{2, 4}: {0xff, 0, 0, 0xff},
+				{3, 4}: {0, 0, 0xff, 0xff},
+				{2, 5}: {0, 0, 0xff, 0xff},
+				{5, 8}: {0xff, 0, 0, 0xff},
+				{6, 8}: {0xff, 0, 0, 0xff},
+			},
+		},
+		{
+			ss: 2,
+			want: map[image.Point]color.RGBA{
+				{5, 8}: {0xff, 0, 0, 0xff},
+				{6, 8}: {0x7f, 0, 0x80, 0xff},
+			},
+		},
+		{
+			ss: 4,
+			want: map[image.Point]color.RGBA{
+				{0, 0}: {0, 0, 0xff, 0xff},
+				{0, 3}: {0xff, 0, 0, 0xff},
+				{2, 4}: {0xff, 0, 0, 0xff},
+				{3, 4}: {0, 0, 0xff, 0xff},
+				{2, 5}: {0, 0, 0xff, 0xff},
+			},
+		},
+	} {
+		pages := render(t, buf.Bytes(), WithResolution(10), WithSupersampling(tc.ss))
+		img := pages[0]
+		if got, want := img.Bounds(), image.Rect(0, 0, 10, 10); got != want {
+			t.Fatalf("ss=%d: invalid bounds: got=%v, want=%v", tc.ss, got, want)
+		}
+		for pt, want := range tc.want {
+			if got := img.RGBAAt(pt.X, pt.Y); got != want {
+				t.Fatalf("ss=%d: invalid pixel at %v: got=%v, want=%v", tc.ss, pt, got, want)
+			}
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"star-tex.org/x/tex/internal/iobuf"
 )
@@ -26,6 +27,7 @@ type span struct {
 	end uint32
 }
 
+// Program is a compiled DVI document.
 type Program struct {
 	r *iobuf.Reader
 
@@ -44,18 +46,26 @@ type Program struct {
 	}
 }
 
+// Compile compiles the provided DVI document.
 func Compile(instr []byte) (Program, error) {
 	prog := Program{
 		r:     iobuf.NewReader(instr),
 		fonts: make(map[int]fntdef),
 	}
 
-	if opCode(prog.r.PeekU8()) != opPre {
+	if prog.r.Len() == 0 || opCode(prog.r.PeekU8()) != opPre {
 		return prog, errNoPre
 	}
+	err := checkCmd(prog.r, opPre, 0)
+	if err != nil {
+		return prog, fmt.Errorf("dvi: could not read preamble: %w", err)
+	}
 
 	prog.pre.read(prog.r)
-	if prog.pre.Version != dviVersion {
+	switch v := prog.pre.Version; {
+	case v == dviVersion, v == ptexVersion, isXDV(v):
+		// ok.
+	default:
 		return prog, errInvalidVersion
 	}
 
@@ -65,7 +75,7 @@ func Compile(instr []byte) (Program, error) {
 	)
 
 	// locate post- and post-postamble
-	_, err := prog.r.Seek(5, io.SeekEnd)
+	_, err = prog.r.Seek(5, io.SeekEnd)
 	if err != nil {
 		return prog, fmt.Errorf("dvi: could not find post-postamble: %w", err)
 	}
@@ -82,7 +92,7 @@ func Compile(instr []byte) (Program, error) {
 		}
 	}
 
-	if vers != prog.pre.Version {
+	if !versionMatch(prog.pre.Version, vers) {
 		return prog, fmt.Errorf(
 			"dvi: version skew (pre=%d, post=%d)",
 			prog.pre.Version, vers,
@@ -104,14 +114,32 @@ func Compile(instr []byte) (Program, error) {
 		return prog, fmt.Errorf("dvi: could not seek to postamble: %w", err)
 	}
 
-	if opCode(prog.r.PeekU8()) != opPost {
+	if prog.r.Pos() >= prog.r.Len() || opCode(prog.r.PeekU8()) != opPost {
 		return prog, fmt.Errorf("dvi: could not locate postamble: %w", errInvalidDVI)
 	}
+	err = checkCmd(prog.r, opPost, prog.pre.Version)
+	if err != nil {
+		return prog, fmt.Errorf("dvi: could not read postamble: %w", err)
+	}
 	prog.post.read(prog.r)
+	prog.max.width = int(prog.post.Width)
+	prog.max.height = int(prog.post.Height)
+	prog.max.stack = int(prog.post.MaxStack)
 
 fonts:
 	for {
-		switch op := opCode(prog.r.PeekU8()); op {
+		if prog.r.Pos() >= prog.r.Len() {
+			return prog, fmt.Errorf("dvi: could not read postamble: %w", io.ErrUnexpectedEOF)
+		}
+		op := opCode(prog.r.PeekU8())
+		if !op.valid(prog.pre.Version) {
+			break fonts
+		}
+		err = checkCmd(prog.r, op, prog.pre.Version)
+		if err != nil {
+			return prog, fmt.Errorf("dvi: could not read postamble %s: %w", op.cmdOf(prog.pre.Version).Name(), err)
+		}
+		switch op {
 		case opFntDef1:
 			cmd := op.cmd().(*CmdFntDef1)
 			cmd.read(prog.r)
@@ -156,6 +184,15 @@ fonts:
 				Area:     cmd.Area,
 				Name:     cmd.Font,
 			})
+		case opNativeFontDef:
+			cmd := op.cmdOf(prog.pre.Version).(*CmdNativeFontDef)
+			cmd.read(prog.r)
+			prog.defineFont(int(cmd.ID), fntdef{
+				ID:     int(cmd.ID),
+				Size:   cmd.Size,
+				Name:   cmd.Font,
+				native: cmd,
+			})
 		case opNOP:
 			cmd := op.cmd()
 			cmd.read(prog.r)
@@ -165,16 +202,23 @@ fonts:
 	}
 
 	bop = prog.post.BOP
-	prog.pages = make([]span, int(prog.post.Pages))
+	prog.npages = int(prog.post.Pages)
+	prog.pages = make([]span, prog.npages)
 	page := len(prog.pages)
 	// build pages look-up table.
 	for bop != ^uint32(0) {
+		if page == 0 {
+			return prog, fmt.Errorf("dvi: invalid number of pages: %w", errInvalidDVI)
+		}
 		page--
 		prog.pages[page].end = eop
 		_, err = prog.r.Seek(int64(bop), io.SeekStart)
 		if err != nil {
 			return prog, fmt.Errorf("dvi: could not seek to page %d: %w", page, err)
 		}
+		if prog.r.Pos() >= int(eop) {
+			return prog, fmt.Errorf("dvi: invalid pointer to page %d: %w", page, errInvalidDVI)
+		}
 
 		var (
 			pos = uint32(prog.r.Pos())
@@ -184,10 +228,14 @@ fonts:
 		if op != opBOP {
 			return prog, fmt.Errorf("could not seek to BOP page=%d: op=%v", page, op.cmd().Name())
 		}
+		err = checkCmd(prog.r, op, prog.pre.Version)
+		if err != nil {
+			return prog, fmt.Errorf("dvi: could not read page %d: %w", page, err)
+		}
 
 		cmd := op.cmd().(*CmdBOP)
 		cmd.read(prog.r)
-		prog.pages[int(cmd.C0)-1].beg = pos
+		prog.pages[page].beg = pos
 		bop = uint32(cmd.Prev)
 	}
 
@@ -198,3 +246,110 @@ fonts:
 func (prog *Program) defineFont(id int, def fntdef) {
 	prog.fonts[id] = def
 }
+
+// Pre returns the preamble of the DVI document.
+func (prog *Program) Pre() CmdPre { return prog.pre }
+
+// Post returns the postamble of the DVI document.
+func (prog *Program) Post() CmdPost { return prog.post }
+
+// Comment returns the comment of the preamble of the DVI document.
+func (prog *Program) Comment() string { return prog.pre.Msg }
+
+// MaxStack returns the maximum stack depth of the DVI document.
+func (prog *Program) MaxStack() int { return prog.max.stack }
+
+// MaxWidth returns the width of the widest page of the DVI document,
+// in DVI units.
+func (prog *Program) MaxWidth() int { return prog.max.width }
+
+// MaxHeight returns the height plus depth of the tallest page of the DVI
+// document, in DVI units.
+func (prog *Program) MaxHeight() int { return prog.max.height }
+
+// NumPages returns the number of pages of the DVI document.
+func (prog *Program) NumPages() int { return prog.npages }
+
+// Fonts returns the font definitions of the postamble of the DVI
+// document, sorted by font number.
+// Native fonts of XDV documents are returned by NativeFonts.
+func (prog *Program) Fonts() []FontDef {
+	ids := make([]int, 0, len(prog.fonts))
+	for id, def := range prog.fonts {
+		if def.native != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	fonts := make([]FontDef, len(ids))
+	for i, id := range ids {
+		def := prog.fonts[id]
+		fonts[i] = FontDef{
+			ID:       def.ID,
+			Checksum: def.Checksum,
+			Size:     def.Size,
+			Design:   def.Design,
+			Area:     def.Area,
+			Name:     def.Name,
+		}
+	}
+	return fonts
+}
+
+// NativeFonts returns the native font definitions of the postamble of
+// the XDV document, sorted by font number.
+func (prog *Program) NativeFonts() []CmdNativeFontDef {
+	var fonts []CmdNativeFontDef
+	for _, def := range prog.fonts {
+		if def.native != nil {
+			fonts = append(fonts, *def.native)
+		}
+	}
+	sort.Slice(fonts, func(i, j int) bool { return fonts[i].ID < fonts[j].ID })
+	return fonts
+}
+
+// Page returns the bop command of the i-th page of the DVI document,
+// together with the commands of that page, up to (but excluding) its
+// eop command.
+func (prog *Program) Page(i int) (CmdBOP, []Cmd, error) {
+	if i < 0 || i >= len(prog.pages) {
+		return CmdBOP{}, nil, fmt.Errorf("dvi: invalid page index %d", i)
+	}
+
+	var (
+		r   = *prog.r // do not modify the state of the program reader.
+		beg = int(prog.pages[i].beg)
+		end = int(prog.pages[i].end)
+		bop CmdBOP
+	)
+	r.SetPos(beg)
+	if opCode(r.PeekU8()) != opBOP {
+		return bop, nil, errNoBOP
+	}
+	bop.read(&r)
+
+	var cmds []Cmd
+	for r.Pos() < end {
+		switch op := opCode(r.PeekU8()); op {
+		case opBOP, opPre, opPost, opPostPost:
+			return bop, nil, fmt.Errorf("dvi: invalid opcode=%s inside a page", op.cmd().Name())
+		case opEOP:
+			return bop, cmds, nil
+		default:
+			if !op.valid(prog.pre.Version) {
+				return bop, nil, fmt.Errorf("dvi: unknown opcode %d inside a page", op)
+			}
+			cmd := op.cmdOf(prog.pre.Version)
+			err := checkCmd(&r, op, prog.pre.Version)
+			if err != nil {
+				return bop, nil, fmt.Errorf("dvi: could not read %s: %w", cmd.Name(), err)
+			}
+			cmd.read(&r)
+			cmds = append(cmds, cmd)
+		}
+	}
+	return bop, nil, errNoEOP
+}
@@ -0,0 +1,96 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+
+	prog, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	if got, want := prog.Comment(), " TeX output 2021.04.02:1805"; got != want {
+		t.Fatalf("invalid comment: got=%q, want=%q", got, want)
+	}
+	if got, want := prog.Pre().Mag, int32(1000); got != want {
+		t.Fatalf("invalid magnification: got=%d, want=%d", got, want)
+	}
+	if got, want := prog.MaxStack(), 2; got != want {
+		t.Fatalf("invalid max stack: got=%d, want=%d", got, want)
+	}
+	if got, want := prog.MaxWidth(), 30785863; got != want {
+		t.Fatalf("invalid max width: got=%d, want=%d", got, want)
+	}
+	if got, want := prog.MaxHeight(), 43725786; got != want {
+		t.Fatalf("invalid max height: got=%d, want=%d", got, want)
+	}
+	if got, want := prog.NumPages(), 3; got != want {
+		t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+	}
+
+	pr, err := NewPageReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatalf("could not create page reader: %+v", err)
+	}
+
+	if got, want := prog.Fonts(), pr.Fonts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid fonts:\ngot= %#v\nwant=%#v", got, want)
+	}
+
+	for i := 0; i < prog.NumPages(); i++ {
+		bop, cmds, err := prog.Page(i)
+		if err != nil {
+			t.Fatalf("could not read page %d: %+v", i, err)
+		}
+		if got, want := bop.C0, int32(i+1); got != want {
+			t.Fatalf("invalid page %d number: got=%d, want=%d", i, got, want)
+		}
+
+		var want []Cmd
+		dec := pr.Page(i)
+		for {
+			cmd, err := dec.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("could not decode page %d: %+v", i, err)
+			}
+			want = append(want, cmd)
+		}
+		if got, want := bop, *want[0].(*CmdBOP); got != want {
+			t.Fatalf("invalid page %d bop:\ngot= %#v\nwant=%#v", i, got, want)
+		}
+		if got, want := cmds, want[1:len(want)-1]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("invalid page %d:\ngot= %v\nwant=%v", i, got, want)
+		}
+	}
+
+	// accessing pages does not modify the state of the program.
+	vm := NewMachine()
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI program: %+v", err)
+	}
+
+	for _, i := range []int{-1, prog.NumPages()} {
+		_, _, err := prog.Page(i)
+		if err == nil {
+			t.Fatalf("expected an error for page %d", i)
+		}
+	}
+}
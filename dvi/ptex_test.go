@@ -0,0 +1,116 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"reflect"
+	"testing"
+)
+
+// ptexDocument returns a small pTeX DVI document, with a page typeset
+// vertically.
+func ptexDocument() []byte {
+	var (
+		pre = CmdPre{
+			Version: dviVersion,
+			Num:     TeXNum, Den: TeXDen, Mag: TeXMag,
+			Msg: " pTeX output 1776.07.04:1200",
+		}
+		cmr10 = &CmdFntDef1{ID: 0, Checksum: 0x4bf16079, Size: 10 * xdvPt, Design: 10 * xdvPt, Font: "cmr10"}
+	)
+	return writeDVI(pre, [][]Cmd{{
+		cmr10,
+		&CmdFntNum{ID: 0},
+		&CmdDown3{Value: 20 * xdvPt},
+		&CmdRight3{Value: 10 * xdvPt},
+		&CmdDir{Dir: DirVertical},
+		&CmdSetChar{Value: 'A'},
+		&CmdRight3{Value: 2 * xdvPt},
+		&CmdDown3{Value: 3 * xdvPt},
+		&CmdSetRule{Height: xdvPt, Width: 4 * xdvPt},
+		&CmdPush{},
+		&CmdDir{Dir: DirDownToUp},
+		&CmdPut1{Value: 'B'},
+		&CmdRight3{Value: xdvPt},
+		&CmdPutRule{Height: xdvPt, Width: 4 * xdvPt},
+		&CmdPop{},
+		&CmdSetChar{Value: 'C'},
+	}})
+}
+
+func TestPTeX(t *testing.T) {
+	prog, err := Compile(ptexDocument())
+	if err != nil {
+		t.Fatalf("could not compile pTeX document: %+v", err)
+	}
+
+	rec := new(xdvRecorder)
+	vm := NewMachine(WithRenderer(rec))
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run pTeX document: %+v", err)
+	}
+
+	if got, want := rec.dirs, []Dir{DirVertical, DirDownToUp, DirVertical}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid directions: got=%v, want=%v", got, want)
+	}
+
+	adv, ok := rec.fonts[0].Face().GlyphAdvance('A')
+	if !ok {
+		t.Fatalf("could not find advance of glyph 'A'")
+	}
+	var (
+		x = int32(7 * xdvPt)
+		y = 20*xdvPt + int32(adv) + 2*xdvPt
+	)
+	if got, want := rec.glyphs, []xdvItem{
+		{10 * xdvPt, 20 * xdvPt, "cmr10", 'A', rec.glyphs[0].c},
+		{x, y + 4*xdvPt, "cmr10", 'B', rec.glyphs[0].c},
+		{x, y + 4*xdvPt, "cmr10", 'C', rec.glyphs[0].c},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid glyphs:\ngot= %v\nwant=%v", got, want)
+	}
+	if got, want := rec.rules, [][4]int32{
+		{x, y + 4*xdvPt, xdvPt, 4 * xdvPt},
+		{x - xdvPt, y + 3*xdvPt, xdvPt, 4 * xdvPt},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid rules:\ngot= %v\nwant=%v", got, want)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{
+			name: "invalid-dir",
+			raw: encodeDVI(CmdPre{Version: dviVersion, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, ptexVersion, nil, [][]Cmd{{
+				&CmdDir{Dir: 2},
+			}}),
+		},
+		{
+			name: "dir-in-xdv",
+			raw: encodeDVI(CmdPre{Version: 7, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, 7, nil, [][]Cmd{{
+				&CmdDir{Dir: DirVertical},
+			}}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prog, err := Compile(tc.raw)
+			if err != nil {
+				t.Fatalf("could not compile document: %+v", err)
+			}
+			vm := NewMachine()
+			err = vm.Run(prog)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+
+	_, err = Compile(encodeDVI(CmdPre{Version: dviVersion, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, 5, nil, nil))
+	if err == nil {
+		t.Fatalf("expected an error for a version skew")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"unicode"
+)
+
+// SearchOptions describes the possible options given to Search.
+type SearchOptions struct {
+	IgnoreCase bool     // IgnoreCase enables case-insensitive matching.
+	Machine    []Option // Machine holds the options of the DVI machine running the program.
+}
+
+// Match is a match of a Search query.
+type Match struct {
+	Page  int               // Page is the index of the page of the match.
+	Boxes []image.Rectangle // Boxes are the bounding boxes of the matched glyphs, in DVI units.
+}
+
+// Search returns the matches of the provided query in the text of the
+// DVI program, in reading order.
+//
+// The text of the program is extracted as Text does.
+// Ligatures match the characters they were made of, and words hyphenated
+// across a line break match with or without their hyphen.
+// Runs of white space in the query match a word space or a line break.
+//
+// If opts is nil, sensible defaults will be used.
+func Search(prog Program, query string, opts *SearchOptions) ([]Match, error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+	q := []rune(strings.Join(strings.Fields(query), " "))
+	if len(q) == 0 {
+		return nil, fmt.Errorf("dvi: empty search query")
+	}
+
+	rdr := NewTextRenderer()
+	vm := NewMachine(append(opts.Machine[:len(opts.Machine):len(opts.Machine)], WithRenderer(rdr))...)
+	err := vm.Run(prog)
+	if err != nil {
+		return nil, fmt.Errorf("dvi: could not extract text: %w", err)
+	}
+
+	var matches []Match
+	for page, lines := range rdr.lines {
+		var (
+			cells  = searchCells(lines)
+			glyphs []*textGlyph
+		)
+		for i := 0; i < len(cells); {
+			glyphs = glyphs[:0]
+			n := matchCells(cells[i:], q, opts.IgnoreCase, &glyphs)
+			if n < 0 {
+				i++
+				continue
+			}
+			matches = append(matches, Match{Page: page, Boxes: glyphBoxes(glyphs)})
+			i += n
+		}
+	}
+	return matches, nil
+}
+
+// searchCell is a rune of the searchable text of a page.
+type searchCell struct {
+	r     rune
+	glyph *textGlyph // glyph of the rune, or nil for white space.
+	soft  bool       // whether the rune is a hyphen ending a line.
+}
+
+// searchCells returns the searchable text of the provided lines.
+func searchCells(lines []textLine) []searchCell {
+	var cells []searchCell
+	for i := range lines {
+		line := &lines[i]
+		if i > 0 {
+			switch last := &cells[len(cells)-1]; {
+			case last.r == '-' && last.glyph != nil:
+				last.soft = true
+			default:
+				cells = append(cells, searchCell{r: ' '})
+			}
+		}
+		for j := range line.glyphs {
+			g := &line.glyphs[j]
+			if line.spaceBefore(j) {
+				cells = append(cells, searchCell{r: ' '})
+			}
+			for _, r := range g.text {
+				cells = append(cells, searchCell{r: r, glyph: g})
+			}
+		}
+	}
+	return cells
+}
+
+// matchCells matches the query at the start of the provided cells, and
+// returns the number of matched cells, or -1.
+// The glyphs of the match are appended to glyphs.
+func matchCells(cells []searchCell, q []rune, fold bool, glyphs *[]*textGlyph) int {
+	if len(q) == 0 {
+		return 0
+	}
+	if len(cells) == 0 {
+		return -1
+	}
+	cell := cells[0]
+	if cell.soft {
+		// try the word without its hyphen first.
+		n := len(*glyphs)
+		if m := matchCells(cells[1:], q, fold, glyphs); m >= 0 {
+			return m + 1
+		}
+		*glyphs = (*glyphs)[:n]
+	}
+	if !equalRunes(cell.r, q[0], fold) {
+		return -1
+	}
+	if cell.glyph != nil && (len(*glyphs) == 0 || (*glyphs)[len(*glyphs)-1] != cell.glyph) {
+		*glyphs = append(*glyphs, cell.glyph)
+	}
+	m := matchCells(cells[1:], q[1:], fold, glyphs)
+	if m < 0 {
+		return -1
+	}
+	return m + 1
+}
+
+func equalRunes(a, b rune, fold bool) bool {
+	if a == b {
+		return true
+	}
+	return fold && unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+// glyphBoxes returns the bounding boxes of the provided glyphs, from
+// their TFM width, height and depth.
+func glyphBoxes(glyphs []*textGlyph) []image.Rectangle {
+	boxes := make([]image.Rectangle, len(glyphs))
+	for i, g := range glyphs {
+		face := g.font.Face()
+		ht, _ := face.GlyphHeight(g.code)
+		dp, _ := face.GlyphDepth(g.code)
+		boxes[i] = image.Rect(
+			int(g.x), int(g.y-int32(ht)),
+			int(g.x+g.adv), int(g.y+int32(dp)),
+		)
+	}
+	return boxes
+}
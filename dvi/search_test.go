@@ -0,0 +1,144 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"image"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/hello_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	prog, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		fold  bool
+		want  int
+	}{
+		{"continuous", false, 4},
+		{"Continuous", false, 0},
+		{"Continuous", true, 4},
+		{"the  function", false, 1},
+		{"THE FUNCTION", true, 2},
+		{"non-zero", false, 1},
+		{"definitions", false, 1},
+		{"xyzzy", true, 0},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := Search(prog, tc.query, &SearchOptions{IgnoreCase: tc.fold})
+			if err != nil {
+				t.Fatalf("could not search: %+v", err)
+			}
+			if len(got) != tc.want {
+				t.Fatalf("invalid number of matches: got=%d, want=%d", len(got), tc.want)
+			}
+		})
+	}
+
+	_, err = Search(prog, " ", nil)
+	if err == nil {
+		t.Fatalf("expected an error for an empty query")
+	}
+}
+
+func TestSearchBoxes(t *testing.T) {
+	const pt = 1 << 16
+	prog := writeProgram(t, CmdPre{Num: 25400000, Den: 473628672, Mag: 1000}, [][]Cmd{{
+		&CmdFntDef1{ID: 0, Size: 10 * pt, Design: 10 * pt, Font: "cmr10"},
+		&CmdDown4{Value: 20 * pt},
+		&CmdFntNum{ID: 0},
+		&CmdPush{},
+		// "office con-" on the first line, with a ffi ligature.
+		&CmdSetChar{Value: 'o'},
+		&CmdSetChar{Value: 0x0e},
+		&CmdSetChar{Value: 'c'},
+		&CmdSetChar{Value: 'e'},
+		&CmdRight4{Value: 3 * pt},
+		&CmdSetChar{Value: 'c'},
+		&CmdSetChar{Value: 'o'},
+		&CmdSetChar{Value: 'n'},
+		&CmdSetChar{Value: '-'},
+		&CmdPop{},
+		&CmdDown4{Value: 12 * pt},
+		// "tinue" on the second line.
+		&CmdSetChar{Value: 't'},
+		&CmdSetChar{Value: 'i'},
+		&CmdSetChar{Value: 'n'},
+		&CmdSetChar{Value: 'u'},
+		&CmdSetChar{Value: 'e'},
+	}})
+
+	for _, tc := range []struct {
+		query string
+		want  []Match
+	}{
+		{
+			query: "fic",
+			want: []Match{{
+				Page: 0,
+				Boxes: []image.Rectangle{
+					image.Rect(327681, 855609, 873816, 1310720),   // ffi
+					image.Rect(873816, 1028552, 1165087, 1310720), // c
+				},
+			}},
+		},
+		{
+			query: "continue",
+			want: []Match{{
+				Page: 0,
+				Boxes: []image.Rectangle{
+					image.Rect(1652966, 1028552, 1944237, 1310720), // c
+					image.Rect(1944237, 1028552, 2271918, 1310720), // o
+					image.Rect(2271918, 1028552, 2636008, 1310720), // n
+					image.Rect(0, 1694054, 254863, 2097152),        // t
+					image.Rect(254863, 1659464, 436908, 2097152),   // i
+					image.Rect(436908, 1814984, 800998, 2097152),   // n
+					image.Rect(800998, 1814984, 1165088, 2097152),  // u
+					image.Rect(1165088, 1814984, 1456359, 2097152), // e
+				},
+			}},
+		},
+		{
+			query: "con-tinue",
+			want: []Match{{
+				Page: 0,
+				Boxes: []image.Rectangle{
+					image.Rect(1652966, 1028552, 1944237, 1310720), // c
+					image.Rect(1944237, 1028552, 2271918, 1310720), // o
+					image.Rect(2271918, 1028552, 2636008, 1310720), // n
+					image.Rect(2636008, 1028552, 2854461, 1310720), // -
+					image.Rect(0, 1694054, 254863, 2097152),        // t
+					image.Rect(254863, 1659464, 436908, 2097152),   // i
+					image.Rect(436908, 1814984, 800998, 2097152),   // n
+					image.Rect(800998, 1814984, 1165088, 2097152),  // u
+					image.Rect(1165088, 1814984, 1456359, 2097152), // e
+				},
+			}},
+		},
+		{
+			query: "con- tinue",
+			want:  nil,
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := Search(prog, tc.query, nil)
+			if err != nil {
+				t.Fatalf("could not search: %+v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid matches:\ngot= %v\nwant=%v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PageRange is an inclusive range of pages of a DVI document.
+type PageRange struct {
+	Beg, End int32 // Beg and End are the bounds of the range.
+	Index    bool  // Index selects pages by 1-based position, rather than by \count0.
+}
+
+// ParsePageRanges parses a comma-separated list of page ranges.
+//
+// "3:5" selects the pages whose \count0 is between 3 and 5, and "=3:5"
+// selects the third to fifth pages of the document. "7" and "=7" select
+// a single \count0 value or page.
+// Omitted bounds, as in ":5" or "=3:", extend to the first or last page.
+// A range whose beginning is greater than its end selects its pages in
+// reverse order.
+func ParsePageRanges(s string) ([]PageRange, error) {
+	var prs []PageRange
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		var pr PageRange
+		if strings.HasPrefix(v, "=") {
+			pr.Index = true
+			v = v[1:]
+		}
+		if v == "" {
+			return nil, fmt.Errorf("dvi: invalid empty page range")
+		}
+		toks := strings.SplitN(v, ":", 2)
+		parse := func(tok string, def int32) (int32, error) {
+			if tok == "" && len(toks) == 2 {
+				return def, nil
+			}
+			n, err := strconv.ParseInt(tok, 10, 32)
+			if err != nil {
+				return 0, fmt.Errorf("dvi: invalid page range %q: %w", v, err)
+			}
+			return int32(n), nil
+		}
+		var err error
+		pr.Beg, err = parse(toks[0], math.MinInt32)
+		if err != nil {
+			return nil, err
+		}
+		pr.End = pr.Beg
+		if len(toks) == 2 {
+			pr.End, err = parse(toks[1], math.MaxInt32)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if pr.Index && ((pr.Beg < 1 && pr.Beg != math.MinInt32) || pr.End < 1) {
+			return nil, fmt.Errorf("dvi: invalid page range %q", v)
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
+
+// SelectPages returns the 0-based indices of the pages of the program
+// selected by the provided page ranges, in the order of the ranges.
+// A page selected by several ranges appears several times.
+func SelectPages(prog Program, ranges []PageRange) ([]int, error) {
+	counts := make([]int32, prog.NumPages())
+	for i := range counts {
+		bop, _, err := prog.Page(i)
+		if err != nil {
+			return nil, fmt.Errorf("dvi: could not read page %d: %w", i+1, err)
+		}
+		counts[i] = bop.C0
+	}
+
+	var pages []int
+	for _, pr := range ranges {
+		switch {
+		case pr.Index:
+			beg, end := int64(pr.Beg), int64(pr.End)
+			if beg == math.MinInt32 {
+				beg = 1
+			}
+			if end == math.MaxInt32 {
+				end = int64(len(counts))
+			}
+			if beg > int64(len(counts)) || end > int64(len(counts)) {
+				return nil, fmt.Errorf("dvi: page range %d:%d out of bounds (pages=%d)", beg, end, len(counts))
+			}
+			step := int64(1)
+			if beg > end {
+				step = -1
+			}
+			for i := beg; ; i += step {
+				pages = append(pages, int(i-1))
+				if i == end {
+					break
+				}
+			}
+		case pr.Beg <= pr.End:
+			for i, c := range counts {
+				if pr.Beg <= c && c <= pr.End {
+					pages = append(pages, i)
+				}
+			}
+		default:
+			for i := len(counts) - 1; i >= 0; i-- {
+				if c := counts[i]; pr.End <= c && c <= pr.Beg {
+					pages = append(pages, i)
+				}
+			}
+		}
+	}
+	return pages, nil
+}
+
+// Select writes to w a new DVI document made of the pages of the program
+// with the provided 0-based indices, in the provided order.
+//
+// Pages may be selected several times. The preamble of the program is
+// kept, and the font definitions are written before the first use of
+// each font: fonts unused by the selected pages are dropped.
+// The back-pointers of the pages and the postamble are computed anew.
+func Select(w io.Writer, prog Program, pages []int) error {
+	var (
+		dw   = NewWriter(w, prog.Pre())
+		defs = make(map[int]bool)
+	)
+	for _, i := range pages {
+		bop, cmds, err := prog.Page(i)
+		if err != nil {
+			return fmt.Errorf("dvi: could not read page %d: %w", i+1, err)
+		}
+		err = dw.BeginPage(bop.counts())
+		if err != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			switch cmd := cmd.(type) {
+			case *CmdFntDef1, *CmdFntDef2, *CmdFntDef3, *CmdFntDef4:
+				// fonts are defined when first used.
+				continue
+			case *CmdFntNum:
+				err = prog.defineFontOn(dw, defs, int(cmd.ID))
+			case *CmdFnt1:
+				err = prog.defineFontOn(dw, defs, int(cmd.ID))
+			case *CmdFnt2:
+				err = prog.defineFontOn(dw, defs, int(cmd.ID))
+			case *CmdFnt3:
+				err = prog.defineFontOn(dw, defs, int(cmd.ID))
+			case *CmdFnt4:
+				err = prog.defineFontOn(dw, defs, int(cmd.ID))
+			}
+			if err != nil {
+				return err
+			}
+			err = dw.WriteCmd(cmd)
+			if err != nil {
+				return err
+			}
+		}
+		err = dw.EndPage()
+		if err != nil {
+			return err
+		}
+	}
+	return dw.Close()
+}
+
+// defineFontOn defines the font id of the program on the provided writer,
+// unless it was already defined.
+func (prog *Program) defineFontOn(w *Writer, defs map[int]bool, id int) error {
+	return prog.defineScaledFontOn(w, defs, id, 1)
+}
+
+// defineScaledFontOn defines the font id of the program on the provided
+// writer, with its size scaled by the provided factor, unless it was
+// already defined.
+func (prog *Program) defineScaledFontOn(w *Writer, defs map[int]bool, id int, scale float64) error {
+	if defs[id] {
+		return nil
+	}
+	def, ok := prog.fonts[id]
+	if !ok {
+		return fmt.Errorf("dvi: undefined font %d", id)
+	}
+	if def.native != nil {
+		return fmt.Errorf("dvi: native font %d (%s) not supported", id, def.Name)
+	}
+	defs[id] = true
+	return w.DefineFont(FontDef{
+		ID:       def.ID,
+		Checksum: def.Checksum,
+		Size:     int32(math.Round(float64(def.Size) * scale)),
+		Design:   def.Design,
+		Area:     def.Area,
+		Name:     def.Name,
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParsePageRanges(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		want []PageRange
+		err  bool
+	}{
+		{spec: "3", want: []PageRange{{Beg: 3, End: 3}}},
+		{spec: "=3", want: []PageRange{{Beg: 3, End: 3, Index: true}}},
+		{spec: "-2:4", want: []PageRange{{Beg: -2, End: 4}}},
+		{spec: "5:1", want: []PageRange{{Beg: 5, End: 1}}},
+		{
+			spec: ":4, =2:",
+			want: []PageRange{
+				{Beg: math.MinInt32, End: 4},
+				{Beg: 2, End: math.MaxInt32, Index: true},
+			},
+		},
+		{spec: "", err: true},
+		{spec: "1,", err: true},
+		{spec: "a:2", err: true},
+		{spec: "1:2:3", err: true},
+		{spec: "=0", err: true},
+		{spec: "=:-1", err: true},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			got, err := ParsePageRanges(tc.spec)
+			switch {
+			case err != nil && !tc.err:
+				t.Fatalf("could not parse page ranges: %+v", err)
+			case err == nil && tc.err:
+				t.Fatalf("expected an error")
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid page ranges:\ngot= %+v\nwant=%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	prog, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		spec  string
+		pages []int
+	}{
+		{"=1:", []int{0, 1, 2}},
+		{"=3,=1", []int{2, 0}},
+		{"=:", []int{0, 1, 2}},
+		{"=3:1", []int{2, 1, 0}},
+		{"3:2", []int{2, 1}},
+		{"2:,1", []int{1, 2, 0}},
+		{"4:9", nil},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			prs, err := ParsePageRanges(tc.spec)
+			if err != nil {
+				t.Fatalf("could not parse page ranges: %+v", err)
+			}
+			pages, err := SelectPages(prog, prs)
+			if err != nil {
+				t.Fatalf("could not select pages: %+v", err)
+			}
+			if !reflect.DeepEqual(pages, tc.pages) {
+				t.Fatalf("invalid pages: got=%v, want=%v", pages, tc.pages)
+			}
+
+			buf := new(bytes.Buffer)
+			err = Select(buf, prog, pages)
+			if err != nil {
+				t.Fatalf("could not write selected pages: %+v", err)
+			}
+
+			sel, err := Compile(buf.Bytes())
+			if err != nil {
+				t.Fatalf("could not compile selected pages: %+v", err)
+			}
+			if got, want := sel.NumPages(), len(pages); got != want {
+				t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+			}
+			if got, want := sel.Comment(), prog.Comment(); got != want {
+				t.Fatalf("invalid comment: got=%q, want=%q", got, want)
+			}
+
+			got, err := Text(sel)
+			if err != nil {
+				t.Fatalf("could not extract text: %+v", err)
+			}
+			all, err := Text(prog)
+			if err != nil {
+				t.Fatalf("could not extract text: %+v", err)
+			}
+			var want []string
+			for _, i := range pages {
+				want = append(want, all[i])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid text:\ngot= %q\nwant=%q", got, want)
+			}
+		})
+	}
+
+	_, err = SelectPages(prog, []PageRange{{Beg: 1, End: 4, Index: true}})
+	if err == nil {
+		t.Fatalf("expected an error for an out of bounds page range")
+	}
+}
+
+func TestSelectFonts(t *testing.T) {
+	var (
+		defs = []FontDef{
+			{ID: 0, Size: 10 << 16, Design: 10 << 16, Name: "cmr10"},
+			{ID: 300, Size: 10 << 16, Design: 10 << 16, Name: "cmbx10"},
+		}
+		prog = writeProgram(t, CmdPre{Msg: "fonts"}, [][]Cmd{
+			{
+				&CmdFntDef1{ID: 0, Size: 10 << 16, Design: 10 << 16, Font: "cmr10"},
+				&CmdFntNum{ID: 0},
+				&CmdSetChar{Value: 'a'},
+			},
+			{
+				&CmdFntDef2{ID: 300, Size: 10 << 16, Design: 10 << 16, Font: "cmbx10"},
+				&CmdFnt2{ID: 300},
+				&CmdSetChar{Value: 'a'},
+			},
+		})
+	)
+
+	for _, tc := range []struct {
+		pages []int
+		fonts []FontDef
+	}{
+		{[]int{0}, defs[:1]},
+		{[]int{1}, defs[1:]},
+		{[]int{1, 0, 1}, defs},
+		{nil, []FontDef{}},
+	} {
+		buf := new(bytes.Buffer)
+		err := Select(buf, prog, tc.pages)
+		if err != nil {
+			t.Fatalf("could not select pages %v: %+v", tc.pages, err)
+		}
+		sel, err := Compile(buf.Bytes())
+		if err != nil {
+			t.Fatalf("could not compile pages %v: %+v", tc.pages, err)
+		}
+		if got, want := sel.Fonts(), tc.fonts; !reflect.DeepEqual(got, want) {
+			t.Fatalf("invalid fonts for pages %v:\ngot= %+v\nwant=%+v", tc.pages, got, want)
+		}
+
+		var fntdefs int
+		err = Dump(bytes.NewReader(buf.Bytes()), func(cmd Cmd) error {
+			switch cmd.(type) {
+			case *CmdFntDef1, *CmdFntDef2:
+				fntdefs++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("could not dump pages %v: %+v", tc.pages, err)
+		}
+		// fonts are defined once in the pages, and once in the postamble.
+		if got, want := fntdefs, 2*len(tc.fonts); got != want {
+			t.Fatalf("invalid number of font definitions for pages %v: got=%d, want=%d", tc.pages, got, want)
+		}
+	}
+
+	err := Select(new(bytes.Buffer), prog, []int{2})
+	if err == nil {
+		t.Fatalf("expected an error for an invalid page")
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Special describes a \special command, as encountered by a Machine.
+type Special struct {
+	Page   int    // Index of the current page.
+	H, V   int32  // Current position on the page, in DVI units.
+	Prefix string // Prefix of the handler of the special, e.g. "ps:".
+	Data   []byte // Raw payload of the special, including its prefix.
+}
+
+// SpecialHandler handles \special commands.
+//
+// Errors of special handlers do not stop the Machine: they are reported
+// on its log output and the special is skipped.
+type SpecialHandler func(s Special) error
+
+// SpecialRenderer is a Renderer that handles \special commands.
+//
+// Specials that are not consumed by a handler registered with
+// WithSpecialHandler are forwarded to the renderer, including the ones
+// already interpreted by the Machine (color, papersize=, ...).
+type SpecialRenderer interface {
+	Renderer
+
+	Special(s Special) error
+}
+
+type special struct {
+	prefix string
+	handle func(m *Machine, s Special) error
+}
+
+// builtinSpecials are the specials interpreted by the Machine.
+var builtinSpecials = []special{
+	{"color", (*Machine).colorSpecials},
+	{"background", (*Machine).colorSpecials},
+	{"papersize=", (*Machine).paperSizeSpecial},
+	{"header=", (*Machine).headerSpecial},
+	{"landscape", (*Machine).landscapeSpecial},
+	{"ps:", (*Machine).forwardSpecial},
+	{"pdf:", (*Machine).forwardSpecial},
+	{"html:", (*Machine).forwardSpecial},
+}
+
+// newSpecials returns the special handlers of a Machine, sorted by
+// decreasing prefix length.
+// User handlers take precedence over builtin handlers with the same prefix.
+func newSpecials(user []special) []special {
+	var (
+		specials = make([]special, 0, len(user)+len(builtinSpecials))
+		seen     = make(map[string]bool)
+	)
+	for i := len(user) - 1; i >= 0; i-- {
+		if seen[user[i].prefix] {
+			continue
+		}
+		seen[user[i].prefix] = true
+		specials = append(specials, user[i])
+	}
+	for _, s := range builtinSpecials {
+		if seen[s.prefix] {
+			continue
+		}
+		specials = append(specials, s)
+	}
+	sort.SliceStable(specials, func(i, j int) bool {
+		return len(specials[i].prefix) > len(specials[j].prefix)
+	})
+	return specials
+}
+
+func (m *Machine) handleSpecial(p []byte) error {
+	cur := m.state.cur()
+	s := Special{
+		Page: m.page,
+		H:    cur.h,
+		V:    cur.v,
+		Data: p,
+	}
+	data := bytes.TrimLeft(p, " ")
+	for _, h := range m.specials {
+		if !bytes.HasPrefix(data, []byte(h.prefix)) {
+			continue
+		}
+		s.Prefix = h.prefix
+		return h.handle(m, s)
+	}
+	return m.forwardSpecial(s)
+}
+
+// forwardSpecial forwards the special to the renderer, if it handles
+// specials.
+func (m *Machine) forwardSpecial(s Special) error {
+	rdr, ok := m.rdr.(SpecialRenderer)
+	if !ok {
+		return nil
+	}
+	return rdr.Special(s)
+}
+
+func (m *Machine) colorSpecials(s Special) error {
+	args := strings.Fields(string(s.Data))
+	if args[0] != s.Prefix {
+		// e.g. "colorful".
+		s.Prefix = ""
+		return m.forwardSpecial(s)
+	}
+	// like dvips, invalid color specials are reported and ignored.
+	err := m.colorSpecial(args[0], args[1:])
+	if err != nil {
+		m.warnf("%v", err)
+	}
+	return m.forwardSpecial(s)
+}
+
+// arg returns the argument of the special, i.e. its payload without its
+// prefix.
+func (s Special) arg() string {
+	data := strings.TrimLeft(string(s.Data), " ")
+	return strings.TrimSpace(data[len(s.Prefix):])
+}
+
+func (m *Machine) paperSizeSpecial(s Special) error {
+	w, h, err := ParsePaperSize(s.arg())
+	if err != nil {
+		return err
+	}
+	m.paper.w = w
+	m.paper.h = h
+	return m.forwardSpecial(s)
+}
+
+func (m *Machine) headerSpecial(s Special) error {
+	name := s.arg()
+	if name == "" {
+		return fmt.Errorf("dvi: missing header file name")
+	}
+	m.headers = append(m.headers, name)
+	return m.forwardSpecial(s)
+}
+
+func (m *Machine) landscapeSpecial(s Special) error {
+	if strings.TrimSpace(string(s.Data)) == s.Prefix {
+		m.landscape = true
+	} else {
+		s.Prefix = ""
+	}
+	return m.forwardSpecial(s)
+}
+
+// PaperSize returns the paper size, in scaled points, as set by the last
+// papersize= special.
+// PaperSize returns zero values when no paper size was set.
+func (m *Machine) PaperSize() (w, h int32) {
+	return m.paper.w, m.paper.h
+}
+
+// Landscape returns whether a landscape special was encountered.
+func (m *Machine) Landscape() bool {
+	return m.landscape
+}
+
+// Headers returns the names of the PostScript header files requested
+// with header= specials.
+func (m *Machine) Headers() []string {
+	return m.headers
+}
+
+// ParsePaperSize parses the argument of a papersize= special, e.g.
+// "210mm,297mm", and returns the width and height in scaled points.
+func ParsePaperSize(s string) (w, h int32, err error) {
+	toks := strings.Split(s, ",")
+	if len(toks) != 2 {
+		return 0, 0, fmt.Errorf("dvi: invalid paper size %q", s)
+	}
+	w, err = parseDimen(toks[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("dvi: invalid paper width: %w", err)
+	}
+	h, err = parseDimen(toks[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("dvi: invalid paper height: %w", err)
+	}
+	return w, h, nil
+}
+
+// units holds the size of TeX units, in points.
+var units = map[string]float64{
+	"pt": 1,
+	"pc": 12,
+	"in": 72.27,
+	"bp": 72.27 / 72,
+	"cm": 72.27 / 2.54,
+	"mm": 72.27 / 25.4,
+	"dd": 1238.0 / 1157,
+	"cc": 12 * 1238.0 / 1157,
+	"sp": 1.0 / 65536,
+}
+
+// parseDimen parses a TeX dimension, e.g. "10.5pt", and returns its value
+// in scaled points.
+func parseDimen(s string) (int32, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid dimension %q", s)
+	}
+	var (
+		num  = strings.TrimSuffix(s[:len(s)-2], "true")
+		unit = s[len(s)-2:]
+	)
+	size, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid dimension %q: unknown unit %q", s, unit)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid dimension %q: %w", s, err)
+	}
+	v = math.Round(v * size * 65536)
+	if math.Abs(v) > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid dimension %q: too large", s)
+	}
+	return int32(v), nil
+}
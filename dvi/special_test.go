@@ -0,0 +1,166 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type specialRenderer struct {
+	nopRenderer
+	calls []string
+}
+
+func (rdr *specialRenderer) Special(s Special) error {
+	rdr.calls = append(rdr.calls, fmt.Sprintf(
+		"page=%d h=%d v=%d prefix=%q data=%q", s.Page, s.H, s.V, s.Prefix, s.Data,
+	))
+	return nil
+}
+
+func TestSpecials(t *testing.T) {
+	prog := writeProgram(t, CmdPre{}, [][]Cmd{
+		{
+			&CmdXXX1{Value: []byte("papersize=210mm,297mm")},
+			&CmdXXX1{Value: []byte("header=foo.pro")},
+			&CmdXXX1{Value: []byte("landscape")},
+			&CmdRight1{Value: 10},
+			&CmdDown1{Value: 20},
+			&CmdXXX1{Value: []byte("ps: 0 0 moveto")},
+			&CmdXXX1{Value: []byte("ps:: special")},
+		},
+		{
+			&CmdXXX1{Value: []byte(" pdf: dest")},
+			&CmdXXX1{Value: []byte("html:<a>")},
+			&CmdXXX1{Value: []byte("my:1")},
+			&CmdXXX1{Value: []byte("em:graph")},
+			&CmdXXX1{Value: []byte("colorful")},
+		},
+	})
+
+	var (
+		rdr  = new(specialRenderer)
+		mine []string
+	)
+	vm := NewMachine(
+		WithRenderer(rdr),
+		WithSpecialHandler("my:", func(s Special) error {
+			mine = append(mine, string(s.Data))
+			return nil
+		}),
+		WithSpecialHandler("ps::", func(s Special) error {
+			mine = append(mine, string(s.Data))
+			return nil
+		}),
+	)
+	err := vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI document: %+v", err)
+	}
+
+	want := []string{
+		`page=0 h=0 v=0 prefix="papersize=" data="papersize=210mm,297mm"`,
+		`page=0 h=0 v=0 prefix="header=" data="header=foo.pro"`,
+		`page=0 h=0 v=0 prefix="landscape" data="landscape"`,
+		`page=0 h=10 v=20 prefix="ps:" data="ps: 0 0 moveto"`,
+		`page=1 h=0 v=0 prefix="pdf:" data=" pdf: dest"`,
+		`page=1 h=0 v=0 prefix="html:" data="html:<a>"`,
+		`page=1 h=0 v=0 prefix="" data="em:graph"`,
+		`page=1 h=0 v=0 prefix="" data="colorful"`,
+	}
+	if !reflect.DeepEqual(rdr.calls, want) {
+		t.Fatalf("invalid specials:\ngot= %q\nwant=%q", rdr.calls, want)
+	}
+	if got, want := mine, []string{"ps:: special", "my:1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid user specials:\ngot= %q\nwant=%q", got, want)
+	}
+
+	if w, h := vm.PaperSize(); w != 39158276 || h != 55380990 {
+		t.Fatalf("invalid paper size: w=%d, h=%d", w, h)
+	}
+	if !vm.Landscape() {
+		t.Fatalf("invalid landscape")
+	}
+	if got, want := vm.Headers(), []string{"foo.pro"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid headers: got=%q, want=%q", got, want)
+	}
+}
+
+func TestSpecialHandlerError(t *testing.T) {
+	prog := writeProgram(t, CmdPre{}, [][]Cmd{{
+		&CmdXXX1{Value: []byte("ps: boom")},
+		&CmdXXX1{Value: []byte("papersize=10pt")},
+		&CmdXXX1{Value: []byte("header=")},
+		&CmdXXX1{Value: []byte("ps: ok")},
+	}})
+
+	var (
+		log = new(strings.Builder)
+		ps  []string
+		vm  = NewMachine(WithLogOutput(log), WithSpecialHandler("ps:", func(s Special) error {
+			ps = append(ps, string(s.Data))
+			if string(s.Data) == "ps: boom" {
+				return fmt.Errorf("boom")
+			}
+			return nil
+		}))
+	)
+	// errors of special handlers are reported and the specials skipped.
+	err := vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI document: %+v", err)
+	}
+	if got, want := ps, []string{"ps: boom", "ps: ok"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid specials:\ngot= %q\nwant=%q", got, want)
+	}
+	for _, want := range []string{
+		`(warning: could not xxx1 "ps: boom": boom)`,
+		`(warning: could not xxx1 "papersize=10pt": dvi: invalid paper size "10pt")`,
+		`(warning: could not xxx1 "header=": dvi: missing header file name)`,
+	} {
+		if !strings.Contains(log.String(), want) {
+			t.Fatalf("could not find warning %q in log:\n%s", want, log.String())
+		}
+	}
+	if w, h := vm.PaperSize(); w != 0 || h != 0 {
+		t.Fatalf("invalid paper size: w=%d, h=%d", w, h)
+	}
+}
+
+func TestParsePaperSize(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		w, h int32
+		err  string
+	}{
+		{s: "614.295pt,794.96999pt", w: 40258437, h: 52099153},
+		{s: "8.5in,11in", w: 40258437, h: 52099154},
+		{s: "8.5truein, 11truein", w: 40258437, h: 52099154},
+		{s: "595bp,842bp", w: 39140147, h: 55388242},
+		{s: "10sp,1pc", w: 10, h: 786432},
+		{s: "10pt", err: `dvi: invalid paper size "10pt"`},
+		{s: "10pt,10xx", err: `dvi: invalid paper height: invalid dimension "10xx": unknown unit "xx"`},
+		{s: "apt,10pt", err: `dvi: invalid paper width: invalid dimension "apt": strconv.ParseFloat: parsing "a": invalid syntax`},
+	} {
+		t.Run(tc.s, func(t *testing.T) {
+			w, h, err := ParsePaperSize(tc.s)
+			if tc.err != "" {
+				if got := fmt.Sprint(err); got != tc.err {
+					t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not parse paper size: %+v", err)
+			}
+			if w != tc.w || h != tc.h {
+				t.Fatalf("invalid paper size: got=(%d, %d), want=(%d, %d)", w, h, tc.w, tc.h)
+			}
+		})
+	}
+}
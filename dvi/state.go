@@ -5,6 +5,8 @@
 package dvi
 
 import (
+	"image/color"
+
 	"star-tex.org/x/tex/font/tfm"
 )
 
@@ -13,6 +15,8 @@ type regs struct {
 	h int32 // h is the current horizontal position on the page.
 	v int32 // v is the current vertical position on the page.
 
+	dir Dir // dir is the current writing direction (pTeX).
+
 	w int32 // horizontal spacing
 	x int32 // horizontal spacing
 	y int32 // vertical spacing
@@ -33,18 +37,26 @@ type fntdef struct {
 	mag  int32
 	font *tfm.Font
 	face *tfm.Face
+	vf   *vfont // nil for non-virtual fonts.
+
+	native *CmdNativeFontDef // nil for non-native fonts.
 }
 
 type state struct {
 	fonts map[int]fntdef
 	f     int // current font
 	stack []regs
+
+	// colors is the color stack.
+	// The color stack is reset at the beginning of each page.
+	colors []color.Color
 }
 
 func newState() state {
 	return state{
-		fonts: make(map[int]fntdef),
-		stack: make([]regs, 1),
+		fonts:  make(map[int]fntdef),
+		stack:  make([]regs, 1),
+		colors: []color.Color{color.Black},
 	}
 }
 
@@ -52,6 +64,7 @@ func (st *state) reset() {
 	st.stack = st.stack[:1]
 	st.stack[0] = regs{}
 	st.f = -1
+	st.colors = append(st.colors[:0], color.Black)
 }
 
 func (st *state) cur() *regs {
@@ -0,0 +1,398 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package svg implements a DVI renderer producing one SVG document per
+// page.
+//
+// Glyphs are drawn as paths, from the outlines of the Type1 font programs
+// of the DVI fonts located with kpath, or as text elements for the fonts
+// without a Type1 font program or listed in a font map.
+package svg // import "star-tex.org/x/tex/dvi/svg"
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/font/type1"
+	"star-tex.org/x/tex/kpath"
+)
+
+const (
+	// TeX places the origin of the page 1in from the top and left edges
+	// of the paper.
+	margin = 72 // in big points
+
+	spToBP = 72 / 72.27 / 65536 // converts scaled points to big points
+)
+
+// Output consumes the SVG document of a page.
+// page is the index of the page in the DVI document.
+type Output func(page int, svg []byte) error
+
+// Option configures a Renderer.
+type Option func(cfg *config)
+
+type config struct {
+	tight  bool
+	margin float64
+	fonts  map[string]string
+}
+
+// WithTightBBox crops the pages to the bounding box of their content,
+// extended by the provided margin, in big points.
+func WithTightBBox(margin float64) Option {
+	return func(cfg *config) {
+		cfg.tight = true
+		cfg.margin = margin
+	}
+}
+
+// WithFontMap renders the glyphs of the TeX fonts listed in m as SVG text
+// elements, using the associated CSS font family.
+// Characters are mapped to Unicode assuming the TeX text (OT1) encoding.
+func WithFontMap(m map[string]string) Option {
+	return func(cfg *config) {
+		cfg.fonts = m
+	}
+}
+
+// Renderer renders DVI documents as SVG documents.
+type Renderer struct {
+	out Output
+	ktx kpath.Context
+	cfg config
+	err error
+
+	conv  float64    // converts DVI units to big points
+	paper [2]float64 // width and height of the paper, in big points
+	fonts map[string]*font
+	npage int
+
+	page struct {
+		buf  bytes.Buffer
+		bg   color.Color
+		defs map[string]*outline
+		bbox [4]float64 // xmin, ymin, xmax, ymax, in big points.
+		ink  bool       // whether the page has content.
+	}
+}
+
+type font struct {
+	name   string
+	glyphs *outlines // nil when glyphs are rendered as text.
+	family string
+}
+
+var (
+	_ dvi.Renderer           = (*Renderer)(nil)
+	_ dvi.BackgroundRenderer = (*Renderer)(nil)
+	_ dvi.SpecialRenderer    = (*Renderer)(nil)
+)
+
+// New returns a new SVG renderer for the document described by the
+// provided DVI preamble.
+// The SVG document of each page is passed to out.
+// Font programs are located with the provided kpath context.
+func New(out Output, ctx kpath.Context, pre dvi.CmdPre, opts ...Option) *Renderer {
+	rdr := &Renderer{
+		out:   out,
+		ktx:   ctx,
+		paper: [2]float64{612, 792}, // US letter, as dvips.
+		fonts: make(map[string]*font),
+	}
+	for _, opt := range opts {
+		opt(&rdr.cfg)
+	}
+	n, d, mag := float64(pre.Num), float64(pre.Den), float64(pre.Mag)
+	if n == 0 || d == 0 {
+		n, d = dvi.TeXNum, dvi.TeXDen
+	}
+	if mag == 0 {
+		mag = dvi.TeXMag
+	}
+	// DVI units are n/d 10^-7 meters.
+	rdr.conv = n / d * 1e-7 / 0.0254 * 72 * mag / 1000
+	return rdr
+}
+
+// BOP starts a new page.
+func (rdr *Renderer) BOP(bop *dvi.CmdBOP) {
+	rdr.page.buf.Reset()
+	rdr.page.bg = nil
+	rdr.page.defs = make(map[string]*outline)
+	rdr.page.bbox = [4]float64{}
+	rdr.page.ink = false
+}
+
+// EOP finishes the current page and passes its SVG document to the
+// output.
+func (rdr *Renderer) EOP() {
+	page := rdr.npage
+	rdr.npage++
+
+	var (
+		o    bytes.Buffer
+		bbox = [4]float64{0, 0, rdr.paper[0], rdr.paper[1]}
+	)
+	if rdr.cfg.tight && rdr.page.ink {
+		m := rdr.cfg.margin
+		bbox = [4]float64{
+			rdr.page.bbox[0] - m, rdr.page.bbox[1] - m,
+			rdr.page.bbox[2] + m, rdr.page.bbox[3] + m,
+		}
+	}
+	w, h := bbox[2]-bbox[0], bbox[3]-bbox[1]
+
+	o.WriteString("<?xml version='1.0' encoding='UTF-8'?>\n")
+	fmt.Fprintf(
+		&o, "<svg version='1.1' xmlns='http://www.w3.org/2000/svg' xmlns:xlink='http://www.w3.org/1999/xlink' width='%spt' height='%spt' viewBox='%s %s %s %s'>\n",
+		num(w), num(h), num(bbox[0]), num(bbox[1]), num(w), num(h),
+	)
+	if len(rdr.page.defs) > 0 {
+		ids := make([]string, 0, len(rdr.page.defs))
+		for id := range rdr.page.defs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		o.WriteString("<defs>\n")
+		for _, id := range ids {
+			fmt.Fprintf(&o, "<path id='%s' d='%s'/>\n", id, rdr.page.defs[id].path)
+		}
+		o.WriteString("</defs>\n")
+	}
+	if bg := rdr.page.bg; bg != nil {
+		fmt.Fprintf(
+			&o, "<rect x='%s' y='%s' width='%s' height='%s' fill='%s'/>\n",
+			num(bbox[0]), num(bbox[1]), num(w), num(h), fill(bg),
+		)
+	}
+	o.Write(rdr.page.buf.Bytes())
+	o.WriteString("</svg>\n")
+
+	if rdr.err != nil {
+		return
+	}
+	err := rdr.out(page, o.Bytes())
+	if err != nil {
+		rdr.err = fmt.Errorf("svg: could not output page %d: %w", page, err)
+	}
+}
+
+// Background sets the background color of the current page.
+func (rdr *Renderer) Background(c color.Color) {
+	rdr.page.bg = c
+}
+
+// Special handles the papersize= special, to set the size of the paper.
+func (rdr *Renderer) Special(s dvi.Special) error {
+	if s.Prefix != "papersize=" {
+		return nil
+	}
+	data := bytes.TrimSpace(s.Data)
+	w, h, err := dvi.ParsePaperSize(string(data[len(s.Prefix):]))
+	if err != nil {
+		return err
+	}
+	rdr.paper[0] = float64(w) * spToBP
+	rdr.paper[1] = float64(h) * spToBP
+	return nil
+}
+
+// DrawGlyph draws the provided glyph at the (x,y) position, in DVI units.
+func (rdr *Renderer) DrawGlyph(x, y int32, font dvi.Font, glyph rune, c color.Color) {
+	var (
+		fnt  = rdr.font(font)
+		size = float64(font.Size()) * rdr.conv
+		xx   = rdr.x(x)
+		yy   = rdr.y(y)
+		o    = &rdr.page.buf
+	)
+
+	if fnt.glyphs != nil {
+		g, err := fnt.glyphs.glyph(glyph)
+		if err != nil {
+			rdr.check(err)
+			return
+		}
+		if g.path == "" {
+			return
+		}
+		id := fmt.Sprintf("%s-%d", fnt.name, glyph)
+		rdr.page.defs[id] = g
+		s := size / 1000
+		fmt.Fprintf(
+			o, "<use xlink:href='#%s' transform='matrix(%s 0 0 %s %s %s)'%s/>\n",
+			id, num(s), num(-s), num(xx), num(yy), fillAttr(c),
+		)
+		rdr.extend(xx+g.bbox[0]*s, yy-g.bbox[3]*s, xx+g.bbox[2]*s, yy-g.bbox[1]*s)
+		return
+	}
+
+	fmt.Fprintf(
+		o, "<text x='%s' y='%s' font-family='%s' font-size='%s'%s>%s</text>\n",
+		num(xx), num(yy), html.EscapeString(fnt.family), num(size), fillAttr(c),
+		html.EscapeString(string(textRune(glyph))),
+	)
+	if metrics := font.Metrics(); metrics != nil {
+		var (
+			wd, _ = metrics.GlyphAdvance(glyph)
+			ht, _ = metrics.GlyphHeight(glyph)
+			dp, _ = metrics.GlyphDepth(glyph)
+			scale = size / (1 << 20)
+		)
+		rdr.extend(xx, yy-float64(ht)*scale, xx+float64(wd)*scale, yy+float64(dp)*scale)
+	}
+}
+
+// DrawRule draws a filled rectangle of size (w,h) at the (x,y) position,
+// in DVI units.
+// The (x,y) position is the bottom left corner of the rectangle.
+func (rdr *Renderer) DrawRule(x, y, w, h int32, c color.Color) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	var (
+		xx = rdr.x(x)
+		yy = rdr.y(y)
+		ww = float64(w) * rdr.conv
+		hh = float64(h) * rdr.conv
+	)
+	fmt.Fprintf(
+		&rdr.page.buf, "<rect x='%s' y='%s' width='%s' height='%s'%s/>\n",
+		num(xx), num(yy-hh), num(ww), num(hh), fillAttr(c),
+	)
+	rdr.extend(xx, yy-hh, xx+ww, yy)
+}
+
+// Close reports the first error encountered while rendering pages.
+// Close does not close the underlying outputs.
+func (rdr *Renderer) Close() error {
+	return rdr.err
+}
+
+func (rdr *Renderer) check(err error) {
+	if err != nil && rdr.err == nil {
+		rdr.err = err
+	}
+}
+
+// x converts the provided horizontal DVI position to the page coordinates.
+func (rdr *Renderer) x(v int32) float64 { return margin + float64(v)*rdr.conv }
+
+// y converts the provided vertical DVI position to the page coordinates.
+func (rdr *Renderer) y(v int32) float64 { return margin + float64(v)*rdr.conv }
+
+// extend extends the bounding box of the page content.
+func (rdr *Renderer) extend(x0, y0, x1, y1 float64) {
+	bbox := &rdr.page.bbox
+	if !rdr.page.ink {
+		*bbox = [4]float64{x0, y0, x1, y1}
+		rdr.page.ink = true
+		return
+	}
+	bbox[0] = math.Min(bbox[0], x0)
+	bbox[1] = math.Min(bbox[1], y0)
+	bbox[2] = math.Max(bbox[2], x1)
+	bbox[3] = math.Max(bbox[3], y1)
+}
+
+// font returns the SVG font associated with the provided DVI font.
+func (rdr *Renderer) font(f dvi.Font) *font {
+	fnt, ok := rdr.fonts[f.Name()]
+	if ok {
+		return fnt
+	}
+	fnt = &font{
+		name:   f.Name(),
+		family: f.Name(),
+	}
+	rdr.fonts[fnt.name] = fnt
+
+	if family, ok := rdr.cfg.fonts[fnt.name]; ok {
+		fnt.family = family
+		return fnt
+	}
+
+	t1, err := rdr.loadType1(fnt.name)
+	if err != nil {
+		return fnt
+	}
+	fnt.glyphs = newOutlines(t1)
+	return fnt
+}
+
+// loadType1 locates and parses the Type1 font program of the TeX font name.
+func (rdr *Renderer) loadType1(name string) (*type1.Font, error) {
+	fname, err := rdr.ktx.Find(name + ".pfb")
+	if err != nil {
+		return nil, err
+	}
+	f, err := rdr.ktx.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fnt, err := type1.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	return &fnt, nil
+}
+
+// ot1 maps the non-ASCII characters of the TeX text (OT1) encoding to
+// Unicode.
+var ot1 = map[rune]rune{
+	0: 'Γ', 1: 'Δ', 2: 'Θ', 3: 'Λ', 4: 'Ξ', 5: 'Π', 6: 'Σ', 7: 'Υ',
+	8: 'Φ', 9: 'Ψ', 10: 'Ω', 11: 'ﬀ', 12: 'ﬁ', 13: 'ﬂ', 14: 'ﬃ', 15: 'ﬄ',
+	16: 'ı', 17: 'ȷ', 18: '`', 19: '´', 20: 'ˇ', 21: '˘', 22: '¯', 23: '˚',
+	24: '¸', 25: 'ß', 26: 'æ', 27: 'œ', 28: 'ø', 29: 'Æ', 30: 'Œ', 31: 'Ø',
+	34: '”', 60: '¡', 62: '¿', 92: '“', 123: '–', 124: '—',
+	125: '˝', 126: '˜', 127: '¨',
+}
+
+// textRune returns the Unicode character of the provided OT1 character
+// code.
+func textRune(code rune) rune {
+	if r, ok := ot1[code]; ok {
+		return r
+	}
+	if code < 0x20 || code > 0x7e {
+		return '�'
+	}
+	return code
+}
+
+// fillAttr returns the SVG fill attribute for the color c, or an empty
+// string for black.
+func fillAttr(c color.Color) string {
+	if c == nil {
+		return ""
+	}
+	if r, g, b, a := c.RGBA(); r == 0 && g == 0 && b == 0 && a == 0xffff {
+		return ""
+	}
+	return " fill='" + fill(c) + "'"
+}
+
+// fill returns the SVG color value of c.
+func fill(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// num formats v as an SVG number.
+func num(v float64) string {
+	v = math.Round(v*1e4) / 1e4
+	if v == 0 {
+		v = 0 // avoid -0.
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
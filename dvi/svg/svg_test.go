@@ -0,0 +1,177 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"star-tex.org/x/tex/dvi"
+	"star-tex.org/x/tex/font/type1"
+	"star-tex.org/x/tex/kpath"
+)
+
+func render(t *testing.T, raw []byte, opts ...Option) []string {
+	t.Helper()
+
+	prog, err := dvi.Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	var (
+		pages []string
+		ctx   = kpath.New()
+		out   = func(page int, svg []byte) error {
+			if page != len(pages) {
+				t.Fatalf("invalid page index: got=%d, want=%d", page, len(pages))
+			}
+			pages = append(pages, string(svg))
+			return nil
+		}
+		rdr = New(out, ctx, prog.Pre(), opts...)
+		vm  = dvi.NewMachine(dvi.WithContext(ctx), dvi.WithRenderer(rdr))
+	)
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI program: %+v", err)
+	}
+	err = rdr.Close()
+	if err != nil {
+		t.Fatalf("could not render SVG: %+v", err)
+	}
+
+	for i, page := range pages {
+		dec := xml.NewDecoder(strings.NewReader(page))
+		for {
+			_, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("invalid XML document for page %d: %+v", i, err)
+			}
+		}
+	}
+	return pages
+}
+
+func TestRenderer(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  []Option
+		pages int
+		want  []string
+	}{
+		{
+			name:  "../../testdata/hello_golden.dvi",
+			pages: 1,
+			want: []string{
+				"width='612pt' height='792pt' viewBox='0 0 612 792'",
+				"<path id='cmr10-84' d='M",
+				"<use xlink:href='#cmr10-84' transform='matrix(0.01 0 0 -0.01 91.9253 81.9626)'/>",
+				"<text x='275.5944' y='81.9626' font-family='cmti10' font-size='9.9626'>a</text>",
+			},
+		},
+		{
+			name:  "../../testdata/hello_golden.dvi",
+			opts:  []Option{WithFontMap(map[string]string{"cmr10": "Latin Modern Roman"})},
+			pages: 1,
+			want: []string{
+				"<text x='91.9253' y='81.9626' font-family='Latin Modern Roman' font-size='9.9626'>T</text>",
+			},
+		},
+		{
+			name:  "../../testdata/pages_golden.dvi",
+			pages: 3,
+		},
+		{
+			name:  "../../testdata/xcolor_golden.dvi",
+			pages: 1,
+			want: []string{
+				"fill='#0000ff'/>",
+				"<rect x='311.4911' y='208.5435' width='42.8394' height='12.8961' fill='#ff7d00'/>",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := os.ReadFile(tc.name)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+			pages := render(t, raw, tc.opts...)
+			if got, want := len(pages), tc.pages; got != want {
+				t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(pages[0], want) {
+					t.Fatalf("could not find %q in SVG document:\n%s", want, pages[0])
+				}
+			}
+		})
+	}
+}
+
+func TestRendererTightBBox(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := dvi.NewWriter(buf, dvi.CmdPre{})
+	w.BeginPage([10]int32{1})
+	w.Special([]byte("background gray 0.5"))
+	w.Down(10 << 16)
+	w.SetRule(2<<16, 3<<16)
+	w.EndPage()
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("could not write DVI document: %+v", err)
+	}
+
+	pages := render(t, buf.Bytes(), WithTightBBox(1))
+	if got, want := len(pages), 1; got != want {
+		t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+	}
+	for _, want := range []string{
+		"width='4.9888pt' height='3.9925pt' viewBox='71 78.9701 4.9888 3.9925'",
+		"<rect x='71' y='78.9701' width='4.9888' height='3.9925' fill='#808080'/>",
+		"<rect x='72' y='79.9701' width='2.9888' height='1.9925'/>",
+	} {
+		if !strings.Contains(pages[0], want) {
+			t.Fatalf("could not find %q in SVG document:\n%s", want, pages[0])
+		}
+	}
+}
+
+func TestOutlines(t *testing.T) {
+	f, err := os.Open("../../internal/tds/fonts/type1/public/amsfonts/cm/cmr10.pfb")
+	if err != nil {
+		t.Fatalf("could not open font file: %+v", err)
+	}
+	defer f.Close()
+
+	t1, err := type1.Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse font: %+v", err)
+	}
+	fnt := newOutlines(&t1)
+
+	g, err := fnt.glyph('A')
+	if err != nil {
+		t.Fatalf("could not interpret glyph: %+v", err)
+	}
+	if got, want := g.bbox, [4]float64{32, 0, 717, 716}; got != want {
+		t.Fatalf("invalid bbox: got=%v, want=%v", got, want)
+	}
+	if !strings.HasPrefix(g.path, "M398 696C393 709 391 716 375 716") || !strings.HasSuffix(g.path, "M345 584L458 259L233 259Z") {
+		t.Fatalf("invalid path: %q", g.path)
+	}
+
+	_, err = fnt.glyph(300)
+	if err == nil {
+		t.Fatalf("expected an error for an invalid glyph")
+	}
+}
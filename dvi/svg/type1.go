@@ -0,0 +1,88 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"star-tex.org/x/tex/font/type1"
+)
+
+// outlines holds the glyph outlines of a Type1 font program.
+type outlines struct {
+	fnt    *type1.Font
+	enc    [256]string
+	glyphs map[string]*outline
+}
+
+// outline is a glyph outline, in glyph space units.
+type outline struct {
+	path string     // SVG path data.
+	bbox [4]float64 // xmin, ymin, xmax, ymax.
+}
+
+func newOutlines(fnt *type1.Font) *outlines {
+	return &outlines{
+		fnt:    fnt,
+		enc:    fnt.Encoding(),
+		glyphs: make(map[string]*outline),
+	}
+}
+
+// glyph returns the outline of the glyph with the provided character code.
+func (fnt *outlines) glyph(code rune) (*outline, error) {
+	if code < 0 || code > 255 || fnt.enc[code] == "" {
+		return nil, fmt.Errorf("svg: no glyph for code %d in font %q", code, fnt.fnt.Name())
+	}
+	name := fnt.enc[code]
+	if g, ok := fnt.glyphs[name]; ok {
+		return g, nil
+	}
+	g, err := fnt.fnt.Glyph(name)
+	if err != nil {
+		return nil, fmt.Errorf("svg: could not load glyph: %w", err)
+	}
+
+	var o strings.Builder
+	for _, seg := range g.Segments() {
+		switch seg.Op {
+		case type1.SegmentOpMoveTo:
+			printf(&o, "M", seg.Args[:1])
+		case type1.SegmentOpLineTo:
+			printf(&o, "L", seg.Args[:1])
+		case type1.SegmentOpCubeTo:
+			printf(&o, "C", seg.Args[:3])
+		case type1.SegmentOpClose:
+			o.WriteString("Z")
+		}
+	}
+	out := &outline{path: o.String(), bbox: g.Bounds()}
+	fnt.glyphs[name] = out
+	return out, nil
+}
+
+func printf(o *strings.Builder, op string, pts []type1.Point) {
+	o.WriteString(op)
+	for i, pt := range pts {
+		if i > 0 {
+			o.WriteString(" ")
+		}
+		o.WriteString(coord(pt.X))
+		o.WriteString(" ")
+		o.WriteString(coord(pt.Y))
+	}
+}
+
+// coord formats a glyph space coordinate.
+func coord(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		v = 0 // avoid -0.
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
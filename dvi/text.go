@@ -0,0 +1,172 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// Text returns the plain text of each page of the provided DVI program,
+// in reading order.
+//
+// Glyphs are mapped to Unicode according to the coding scheme of their
+// TFM font, and ligatures are reversed to the characters they were made
+// of.
+// Word spaces and line breaks are inferred from the positions of the
+// glyphs, as dvitype does.
+func Text(prog Program, opts ...Option) ([]string, error) {
+	rdr := NewTextRenderer()
+	vm := NewMachine(append(opts[:len(opts):len(opts)], WithRenderer(rdr))...)
+	err := vm.Run(prog)
+	if err != nil {
+		return nil, fmt.Errorf("dvi: could not extract text: %w", err)
+	}
+	return rdr.Pages(), nil
+}
+
+// TextRenderer is a Renderer that extracts the text of DVI pages.
+type TextRenderer struct {
+	pages  []string
+	lines  [][]textLine // lines of each page.
+	glyphs []textGlyph  // glyphs of the current page.
+	encs   map[string]textEncoding
+}
+
+// NewTextRenderer returns a new renderer extracting the text of DVI pages.
+func NewTextRenderer() *TextRenderer {
+	return &TextRenderer{
+		encs: make(map[string]textEncoding),
+	}
+}
+
+// Pages returns the text of the pages rendered so far.
+func (tr *TextRenderer) Pages() []string {
+	return tr.pages
+}
+
+func (tr *TextRenderer) BOP(bop *CmdBOP) {
+	tr.glyphs = tr.glyphs[:0]
+}
+
+func (tr *TextRenderer) EOP() {
+	var (
+		o     = new(strings.Builder)
+		lines = layoutText(tr.glyphs)
+	)
+	for _, line := range lines {
+		for i, g := range line.glyphs {
+			if line.spaceBefore(i) {
+				o.WriteByte(' ')
+			}
+			o.WriteString(g.text)
+		}
+		o.WriteByte('\n')
+	}
+	tr.pages = append(tr.pages, o.String())
+	tr.lines = append(tr.lines, lines)
+}
+
+func (tr *TextRenderer) DrawGlyph(x, y int32, font Font, glyph rune, c color.Color) {
+	tr.glyphs = append(tr.glyphs, newTextGlyph(x, y, font, glyph, tr.encoding(font)))
+}
+
+func (tr *TextRenderer) DrawRule(x, y, w, h int32, c color.Color) {}
+
+func (tr *TextRenderer) encoding(font Font) textEncoding {
+	enc, ok := tr.encs[font.Name()]
+	if !ok {
+		enc = encodingOf(font.Metrics().CodingScheme())
+		tr.encs[font.Name()] = enc
+	}
+	return enc
+}
+
+// textGlyph is a glyph drawn on a page, together with its text.
+type textGlyph struct {
+	x, y  int32 // position of the reference point, in DVI units.
+	adv   int32 // advance width, in DVI units.
+	space int32 // width of a thin space of the font, in DVI units.
+	font  Font
+	code  rune
+	text  string
+}
+
+func newTextGlyph(x, y int32, font Font, code rune, enc textEncoding) textGlyph {
+	adv, _ := font.Face().GlyphAdvance(code)
+	return textGlyph{
+		x:     x,
+		y:     y,
+		adv:   int32(adv),
+		space: font.Size() / 6, // this is a 3-unit "thin space"
+		font:  font,
+		code:  code,
+		text:  enc.text(code),
+	}
+}
+
+// textLine is a line of glyphs sharing the same baseline.
+type textLine struct {
+	base   int32 // baseline of the line, in DVI units.
+	glyphs []textGlyph
+}
+
+// spaceBefore returns whether a word space separates the i-th glyph of
+// the line from the previous one.
+func (line textLine) spaceBefore(i int) bool {
+	if i == 0 {
+		return false
+	}
+	var (
+		prev = line.glyphs[i-1]
+		cur  = line.glyphs[i]
+		gap  = cur.x - (prev.x + prev.adv)
+	)
+	return gap >= cur.space || gap <= -4*cur.space
+}
+
+// layoutText gathers the provided glyphs into lines, in reading order.
+//
+// A glyph belongs to a line when its vertical distance to the baseline of
+// that line is less than five thin spaces, as for the vertical moves of
+// dvitype.
+// Lines are sorted from top to bottom, and the glyphs of a line from left
+// to right.
+func layoutText(glyphs []textGlyph) []textLine {
+	var lines []textLine
+	for _, g := range glyphs {
+		if g.text == "" {
+			continue
+		}
+		i := len(lines) - 1
+		for ; i >= 0; i-- {
+			if absI32(g.y-lines[i].base) < 5*g.space {
+				break
+			}
+		}
+		if i < 0 {
+			lines = append(lines, textLine{base: g.y})
+			i = len(lines) - 1
+		}
+		lines[i].glyphs = append(lines[i].glyphs, g)
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].base < lines[j].base
+	})
+	for _, line := range lines {
+		glyphs := line.glyphs
+		sort.SliceStable(glyphs, func(i, j int) bool {
+			return glyphs[i].x < glyphs[j].x
+		})
+	}
+	return lines
+}
+
+var (
+	_ Renderer = (*TextRenderer)(nil)
+)
@@ -0,0 +1,97 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	prog, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+
+	got, err := Text(prog)
+	if err != nil {
+		t.Fatalf("could not extract text: %+v", err)
+	}
+	want := []string{
+		"page\n1\n.\n1\n",
+		"page\n2\n.\n2\n",
+		"page\n3\n.\n3\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid text:\ngot= %q\nwant=%q", got, want)
+	}
+}
+
+func TestTextLayout(t *testing.T) {
+	const (
+		pt    = 1 << 16
+		space = 3*pt + pt/3 // inter-word space of cmr10.
+	)
+	var (
+		text = func(font uint8, s ...uint8) []Cmd {
+			cmds := []Cmd{&CmdFntNum{ID: font}}
+			for _, c := range s {
+				cmds = append(cmds, &CmdSetChar{Value: c})
+			}
+			return cmds
+		}
+		right = func(dx int32) []Cmd { return []Cmd{&CmdRight4{Value: dx}} }
+		down  = func(dy int32) []Cmd { return []Cmd{&CmdDown4{Value: dy}} }
+		page  []Cmd
+	)
+	for i, name := range []string{"cmr10", "cmtt10", "cmmi10", "cmsy10"} {
+		page = append(page, &CmdFntDef1{ID: uint8(i), Size: 10 * pt, Design: 10 * pt, Font: name})
+	}
+	for _, cmds := range [][]Cmd{
+		down(20 * pt),
+		{&CmdPush{}},
+		// second line, drawn first.
+		down(12 * pt),
+		text(1, 'g', 'o', ' ', 'r', 'u', 'n'),
+		right(space),
+		text(2, 0x0b), // α
+		right(pt),     // kern.
+		text(3, 0x14), // ≤
+		right(pt),
+		text(0, '1'),
+		{&CmdPop{}},
+		text(0, 'A', 0x0c, 'n', 'e'), // Afine, with a fi ligature.
+		right(space),
+		text(0, 'o', 0x0e, 'c', 'e'), // office, with a ffi ligature.
+		right(space),
+		text(0, '1', 0x7b, '2'), // 1--2
+		right(space),
+		text(0, 0x7c), // ---
+		right(space),
+		text(0, 0x5c, 'q', 0x22), // ``q''
+		down(-3 * pt),            // superscript.
+		text(0, '2'),
+	} {
+		page = append(page, cmds...)
+	}
+
+	prog := writeProgram(t, CmdPre{Num: 25400000, Den: 473628672, Mag: 1000}, [][]Cmd{page})
+
+	got, err := Text(prog)
+	if err != nil {
+		t.Fatalf("could not extract text: %+v", err)
+	}
+	want := []string{
+		"Afine office 1--2 --- “q”2\ngo␣run α≤1\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid text:\ngot= %q\nwant=%q", got, want)
+	}
+}
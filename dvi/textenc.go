@@ -0,0 +1,141 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"strings"
+)
+
+// textEncoding maps the character codes of a font to their text.
+// Codes that are not in the table are dropped.
+type textEncoding map[rune]string
+
+// encodingOf returns the text encoding of the provided TFM coding scheme,
+// or nil if the coding scheme is unknown.
+func encodingOf(scheme string) textEncoding {
+	switch strings.ToUpper(strings.TrimSpace(scheme)) {
+	case "TEX TEXT", "TEX TEXT WITHOUT F-LIGATURES":
+		return encTeXText
+	case "TEX TYPEWRITER TEXT":
+		return encTeXTypewriter
+	case "TEX MATH ITALIC":
+		return encTeXMathItalic
+	case "TEX MATH SYMBOLS":
+		return encTeXMathSymbols
+	case "TEX MATH EXTENSION":
+		return encTeXMathExtension
+	}
+	return nil
+}
+
+// text returns the text of the provided character code.
+// Character codes of unknown encodings are read as ASCII.
+func (enc textEncoding) text(c rune) string {
+	if enc == nil {
+		if ' ' < c && c < 0x7f {
+			return string(c)
+		}
+		return ""
+	}
+	return enc[c]
+}
+
+// asciiRange adds the printable ASCII characters from beg to end to enc.
+func asciiRange(enc textEncoding, beg, end rune) textEncoding {
+	for c := beg; c <= end; c++ {
+		if _, dup := enc[c]; !dup {
+			enc[c] = string(c)
+		}
+	}
+	return enc
+}
+
+// encTeXText is the OT1 encoding of the Computer Modern text fonts.
+// Ligatures are reversed to the characters they were made of.
+var encTeXText = asciiRange(textEncoding{
+	0x00: "Γ", 0x01: "Δ", 0x02: "Θ", 0x03: "Λ", 0x04: "Ξ", 0x05: "Π",
+	0x06: "Σ", 0x07: "Υ", 0x08: "Φ", 0x09: "Ψ", 0x0a: "Ω",
+	0x0b: "ff", 0x0c: "fi", 0x0d: "fl", 0x0e: "ffi", 0x0f: "ffl",
+	0x10: "ı", 0x11: "ȷ", 0x12: "`", 0x13: "´", 0x14: "ˇ", 0x15: "˘",
+	0x16: "¯", 0x17: "˚", 0x18: "¸", 0x19: "ß", 0x1a: "æ", 0x1b: "œ",
+	0x1c: "ø", 0x1d: "Æ", 0x1e: "Œ", 0x1f: "Ø",
+	0x22: "”", 0x27: "’", 0x3c: "¡", 0x3e: "¿",
+	0x5c: "“", 0x5e: "ˆ", 0x5f: "˙", 0x60: "‘",
+	0x7b: "--", 0x7c: "---", 0x7d: "˝", 0x7e: "˜", 0x7f: "¨",
+}, '!', '~')
+
+// encTeXTypewriter is the encoding of the Computer Modern typewriter fonts.
+var encTeXTypewriter = asciiRange(textEncoding{
+	0x00: "Γ", 0x01: "Δ", 0x02: "Θ", 0x03: "Λ", 0x04: "Ξ", 0x05: "Π",
+	0x06: "Σ", 0x07: "Υ", 0x08: "Φ", 0x09: "Ψ", 0x0a: "Ω",
+	0x0b: "↑", 0x0c: "↓", 0x0d: "'", 0x0e: "¡", 0x0f: "¿",
+	0x10: "ı", 0x11: "ȷ", 0x12: "`", 0x13: "´", 0x14: "ˇ", 0x15: "˘",
+	0x16: "¯", 0x17: "˚", 0x18: "¸", 0x19: "ß", 0x1a: "æ", 0x1b: "œ",
+	0x1c: "ø", 0x1d: "Æ", 0x1e: "Œ", 0x1f: "Ø",
+	0x20: "␣", 0x27: "’", 0x60: "‘", 0x7f: "¨",
+}, '!', '~')
+
+// encTeXMathItalic is the encoding of the Computer Modern math italic
+// fonts.
+var encTeXMathItalic = asciiRange(textEncoding{
+	0x00: "Γ", 0x01: "Δ", 0x02: "Θ", 0x03: "Λ", 0x04: "Ξ", 0x05: "Π",
+	0x06: "Σ", 0x07: "Υ", 0x08: "Φ", 0x09: "Ψ", 0x0a: "Ω",
+	0x0b: "α", 0x0c: "β", 0x0d: "γ", 0x0e: "δ", 0x0f: "ϵ", 0x10: "ζ",
+	0x11: "η", 0x12: "θ", 0x13: "ι", 0x14: "κ", 0x15: "λ", 0x16: "μ",
+	0x17: "ν", 0x18: "ξ", 0x19: "π", 0x1a: "ρ", 0x1b: "σ", 0x1c: "τ",
+	0x1d: "υ", 0x1e: "ϕ", 0x1f: "χ", 0x20: "ψ", 0x21: "ω", 0x22: "ε",
+	0x23: "ϑ", 0x24: "ϖ", 0x25: "ϱ", 0x26: "ς", 0x27: "φ",
+	0x28: "↼", 0x29: "↽", 0x2a: "⇀", 0x2b: "⇁", 0x2e: "▹", 0x2f: "◃",
+	0x3a: ".", 0x3b: ",", 0x3c: "<", 0x3d: "/", 0x3e: ">", 0x3f: "⋆",
+	0x40: "∂", 0x5b: "♭", 0x5c: "♮", 0x5d: "♯", 0x5e: "⌣", 0x5f: "⌢",
+	0x60: "ℓ", 0x7b: "ı", 0x7c: "ȷ", 0x7d: "℘",
+}, '0', 'z')
+
+// encTeXMathSymbols is the encoding of the Computer Modern math symbol
+// fonts.
+var encTeXMathSymbols = asciiRange(textEncoding{
+	0x00: "−", 0x01: "·", 0x02: "×", 0x03: "∗", 0x04: "÷", 0x05: "⋄",
+	0x06: "±", 0x07: "∓", 0x08: "⊕", 0x09: "⊖", 0x0a: "⊗", 0x0b: "⊘",
+	0x0c: "⊙", 0x0d: "◯", 0x0e: "∘", 0x0f: "∙", 0x10: "≍", 0x11: "≡",
+	0x12: "⊆", 0x13: "⊇", 0x14: "≤", 0x15: "≥", 0x16: "⪯", 0x17: "⪰",
+	0x18: "∼", 0x19: "≈", 0x1a: "⊂", 0x1b: "⊃", 0x1c: "≪", 0x1d: "≫",
+	0x1e: "≺", 0x1f: "≻", 0x20: "←", 0x21: "→", 0x22: "↑", 0x23: "↓",
+	0x24: "↔", 0x25: "↗", 0x26: "↘", 0x27: "≃", 0x28: "⇐", 0x29: "⇒",
+	0x2a: "⇑", 0x2b: "⇓", 0x2c: "⇔", 0x2d: "↖", 0x2e: "↙", 0x2f: "∝",
+	0x30: "′", 0x31: "∞", 0x32: "∈", 0x33: "∋", 0x34: "△", 0x35: "▽",
+	0x36: "̸", 0x38: "∀", 0x39: "∃", 0x3a: "¬", 0x3b: "∅",
+	0x3c: "ℜ", 0x3d: "ℑ", 0x3e: "⊤", 0x3f: "⊥", 0x40: "ℵ",
+	0x5b: "∪", 0x5c: "∩", 0x5d: "⊎", 0x5e: "∧", 0x5f: "∨", 0x60: "⊢",
+	0x61: "⊣", 0x62: "⌊", 0x63: "⌋", 0x64: "⌈", 0x65: "⌉", 0x66: "{",
+	0x67: "}", 0x68: "⟨", 0x69: "⟩", 0x6a: "|", 0x6b: "‖", 0x6c: "↕",
+	0x6d: "⇕", 0x6e: "\\", 0x6f: "≀", 0x70: "√", 0x71: "⨿", 0x72: "∇",
+	0x73: "∫", 0x74: "⊔", 0x75: "⊓", 0x76: "⊑", 0x77: "⊒", 0x78: "§",
+	0x79: "†", 0x7a: "‡", 0x7b: "¶", 0x7c: "♣", 0x7d: "♢", 0x7e: "♡",
+	0x7f: "♠",
+}, 'A', 'Z')
+
+// encTeXMathExtension is the encoding of the Computer Modern math
+// extension font.
+// Pieces of extensible delimiters are dropped.
+var encTeXMathExtension = textEncoding{
+	0x00: "(", 0x01: ")", 0x02: "[", 0x03: "]", 0x04: "⌊", 0x05: "⌋",
+	0x06: "⌈", 0x07: "⌉", 0x08: "{", 0x09: "}", 0x0a: "⟨", 0x0b: "⟩",
+	0x0c: "|", 0x0d: "‖", 0x0e: "/", 0x0f: "\\",
+	0x10: "(", 0x11: ")", 0x12: "(", 0x13: ")", 0x14: "[", 0x15: "]",
+	0x16: "⌊", 0x17: "⌋", 0x18: "⌈", 0x19: "⌉", 0x1a: "{", 0x1b: "}",
+	0x1c: "⟨", 0x1d: "⟩", 0x1e: "/", 0x1f: "\\",
+	0x20: "(", 0x21: ")", 0x22: "[", 0x23: "]", 0x24: "⌊", 0x25: "⌋",
+	0x26: "⌈", 0x27: "⌉", 0x28: "{", 0x29: "}", 0x2a: "⟨", 0x2b: "⟩",
+	0x2c: "/", 0x2d: "\\", 0x2e: "/", 0x2f: "\\",
+	0x44: "⟨", 0x45: "⟩", 0x46: "⨆", 0x47: "⨆", 0x48: "∮", 0x49: "∮",
+	0x4a: "⨀", 0x4b: "⨀", 0x4c: "⨁", 0x4d: "⨁", 0x4e: "⨂", 0x4f: "⨂",
+	0x50: "∑", 0x51: "∏", 0x52: "∫", 0x53: "⋃", 0x54: "⋂", 0x55: "⨄",
+	0x56: "⋀", 0x57: "⋁", 0x58: "∑", 0x59: "∏", 0x5a: "∫", 0x5b: "⋃",
+	0x5c: "⋂", 0x5d: "⨄", 0x5e: "⋀", 0x5f: "⋁", 0x60: "∐", 0x61: "∐",
+	0x62: "ˆ", 0x63: "ˆ", 0x64: "ˆ", 0x65: "˜", 0x66: "˜", 0x67: "˜",
+	0x68: "[", 0x69: "]", 0x6a: "⌊", 0x6b: "⌋", 0x6c: "⌈", 0x6d: "⌉",
+	0x6e: "{", 0x6f: "}", 0x70: "√", 0x71: "√", 0x72: "√", 0x73: "√",
+	0x74: "√",
+}
@@ -0,0 +1,455 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Layout describes how the pages of a DVI document are placed on the
+// sheets of a new DVI document.
+//
+// Source pages are grouped into signatures of Pages pages, and each
+// signature is laid out on len(Sheets) sheets.
+type Layout struct {
+	Pages  int           // Pages is the number of source pages of a signature.
+	Sheets [][]Placement // Sheets holds the placements of the source pages on each sheet of a signature.
+
+	Width, Height int32   // Width and Height are the size of the source pages, in DVI units.
+	Scale         float64 // Scale is the scaling factor of the source pages. Zero means no scaling.
+
+	// SheetWidth and SheetHeight are the size of the output sheets, in DVI
+	// units. When non-zero, a papersize special is written on the first
+	// sheet, and the papersize specials of the source pages are dropped.
+	SheetWidth, SheetHeight int32
+
+	CropMarks bool // CropMarks enables the crop marks drawn as rules around each page.
+}
+
+// Placement places a source page on an output sheet.
+type Placement struct {
+	Page int   // Page is the index of the source page within its signature.
+	X, Y int32 // X and Y are the position of the top left corner of the page on the sheet, in DVI units.
+}
+
+// NUp returns a layout placing cols×rows source pages of the provided
+// size on each sheet, from left to right and top to bottom.
+// Pages are separated by gutter, and surrounded by margin, in DVI units.
+func NUp(cols, rows int, width, height int32, scale float64, margin, gutter int32) Layout {
+	s := scaleOf(scale)
+	var (
+		w = int32(math.Round(float64(width) * s))
+		h = int32(math.Round(float64(height) * s))
+
+		sheet = make([]Placement, 0, cols*rows)
+	)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			sheet = append(sheet, Placement{
+				Page: len(sheet),
+				X:    margin + int32(c)*(w+gutter),
+				Y:    margin + int32(r)*(h+gutter),
+			})
+		}
+	}
+	return Layout{
+		Pages:       cols * rows,
+		Sheets:      [][]Placement{sheet},
+		Width:       width,
+		Height:      height,
+		Scale:       scale,
+		SheetWidth:  2*margin + int32(cols)*w + int32(cols-1)*gutter,
+		SheetHeight: 2*margin + int32(rows)*h + int32(rows-1)*gutter,
+	}
+}
+
+// Booklet returns a layout placing source pages of the provided size
+// side by side, two per sheet side, in the order needed to fold the
+// printed sheets into booklets of signature pages.
+// signature is rounded up to a multiple of 4.
+// The two pages are separated by gutter, and surrounded by margin, in DVI
+// units.
+func Booklet(signature int, width, height int32, scale float64, margin, gutter int32) Layout {
+	if signature < 4 {
+		signature = 4
+	}
+	signature = (signature + 3) / 4 * 4
+
+	s := scaleOf(scale)
+	var (
+		w      = int32(math.Round(float64(width) * s))
+		h      = int32(math.Round(float64(height) * s))
+		sheets = make([][]Placement, signature/2)
+	)
+	for i := range sheets {
+		l, r := signature-1-i, i
+		if i%2 == 1 {
+			l, r = r, l
+		}
+		sheets[i] = []Placement{
+			{Page: l, X: margin, Y: margin},
+			{Page: r, X: margin + w + gutter, Y: margin},
+		}
+	}
+	return Layout{
+		Pages:       signature,
+		Sheets:      sheets,
+		Width:       width,
+		Height:      height,
+		Scale:       scale,
+		SheetWidth:  2*margin + 2*w + gutter,
+		SheetHeight: 2*margin + h,
+	}
+}
+
+func scaleOf(scale float64) float64 {
+	if scale == 0 {
+		return 1
+	}
+	return scale
+}
+
+// Transform writes to w a new DVI document made of the pages of the
+// program laid out on sheets, as described by the layout.
+//
+// Pages are scaled by scaling their movements and rules, and by
+// rescaling the sizes of their fonts.
+// Placements of missing source pages, at the end of the last signature,
+// are left blank.
+func Transform(w io.Writer, prog Program, layout Layout) error {
+	if layout.Pages <= 0 || len(layout.Sheets) == 0 {
+		return fmt.Errorf("dvi: invalid layout with %d pages and %d sheets", layout.Pages, len(layout.Sheets))
+	}
+	for _, sheet := range layout.Sheets {
+		for _, p := range sheet {
+			if p.Page < 0 || p.Page >= layout.Pages {
+				return fmt.Errorf("dvi: invalid layout page %d (pages=%d)", p.Page, layout.Pages)
+			}
+		}
+	}
+
+	tr := transformer{
+		w:      NewWriter(w, prog.Pre()),
+		prog:   prog,
+		layout: layout,
+		scale:  scaleOf(layout.Scale),
+		inch:   int32(math.Round(254000 * float64(prog.pre.Den) / float64(prog.pre.Num))),
+		defs:   make(map[int]bool),
+	}
+
+	var (
+		npages = prog.NumPages()
+		nsigs  = (npages + layout.Pages - 1) / layout.Pages
+		sheet  = int32(0)
+	)
+	for sig := 0; sig < nsigs; sig++ {
+		for _, places := range layout.Sheets {
+			sheet++
+			err := tr.w.BeginPage([10]int32{sheet})
+			if err != nil {
+				return err
+			}
+			if sheet == 1 && layout.SheetWidth > 0 && layout.SheetHeight > 0 {
+				err = tr.w.Special([]byte(fmt.Sprintf(
+					"papersize=%dsp,%dsp", layout.SheetWidth, layout.SheetHeight,
+				)))
+				if err != nil {
+					return err
+				}
+			}
+			for _, p := range places {
+				page := sig*layout.Pages + p.Page
+				if page >= npages {
+					continue
+				}
+				err = tr.place(page, p)
+				if err != nil {
+					return fmt.Errorf("dvi: could not place page %d: %w", page+1, err)
+				}
+			}
+			err = tr.w.EndPage()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tr.w.Close()
+}
+
+type transformer struct {
+	w      *Writer
+	prog   Program
+	layout Layout
+	scale  float64
+	inch   int32           // one inch, in DVI units.
+	defs   map[int]bool    // output fonts already defined.
+	fonts  map[int]FontDef // output definitions of the fonts of the program, when renumbered.
+
+	regs []wregs // scaled w, x, y and z registers of the source page.
+}
+
+func (tr *transformer) s(v int32) int32 {
+	return int32(math.Round(float64(v) * tr.scale))
+}
+
+// place draws the provided source page on the current sheet.
+func (tr *transformer) place(i int, p Placement) error {
+	_, cmds, err := tr.prog.Page(i)
+	if err != nil {
+		return err
+	}
+
+	// the reference point of a page is one inch below and to the right of
+	// its top left corner.
+	var (
+		w  = tr.w
+		in = tr.s(tr.inch)
+	)
+	for _, f := range []func() error{
+		w.Push,
+		func() error { return w.Right(p.X - tr.inch + in) },
+		func() error { return w.Down(p.Y - tr.inch + in) },
+	} {
+		err = f()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tr.page(cmds)
+	if err != nil {
+		return err
+	}
+
+	err = w.Pop()
+	if err != nil {
+		return err
+	}
+
+	if tr.layout.CropMarks {
+		return tr.cropMarks(p)
+	}
+	return nil
+}
+
+// page writes the provided commands of a source page, scaled.
+func (tr *transformer) page(cmds []Cmd) error {
+	tr.regs = append(tr.regs[:0], wregs{})
+	for _, cmd := range cmds {
+		err := tr.cmd(cmd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cmd writes the provided command of a source page, scaled.
+func (tr *transformer) cmd(cmd Cmd) error {
+	var (
+		w  = tr.w
+		st = &tr.regs[len(tr.regs)-1]
+	)
+	switch cmd := cmd.(type) {
+	case *CmdFntDef1, *CmdFntDef2, *CmdFntDef3, *CmdFntDef4:
+		// fonts are defined when first used.
+		return nil
+	case *CmdFntNum:
+		return tr.font(int(cmd.ID))
+	case *CmdFnt1:
+		return tr.font(int(cmd.ID))
+	case *CmdFnt2:
+		return tr.font(int(cmd.ID))
+	case *CmdFnt3:
+		return tr.font(int(cmd.ID))
+	case *CmdFnt4:
+		return tr.font(int(cmd.ID))
+	case *CmdPush:
+		tr.regs = append(tr.regs, *st)
+		return w.Push()
+	case *CmdPop:
+		if len(tr.regs) == 1 {
+			return fmt.Errorf("dvi: pop without push")
+		}
+		tr.regs = tr.regs[:len(tr.regs)-1]
+		return w.Pop()
+	case *CmdSetRule:
+		return w.SetRule(tr.s(cmd.Height), tr.s(cmd.Width))
+	case *CmdPutRule:
+		return w.PutRule(tr.s(cmd.Height), tr.s(cmd.Width))
+	case *CmdRight1:
+		return w.Right(tr.s(cmd.Value))
+	case *CmdRight2:
+		return w.Right(tr.s(cmd.Value))
+	case *CmdRight3:
+		return w.Right(tr.s(cmd.Value))
+	case *CmdRight4:
+		return w.Right(tr.s(cmd.Value))
+	case *CmdW0:
+		return w.Right(st.w)
+	case *CmdW1:
+		st.w = tr.s(cmd.Value)
+		return w.Right(st.w)
+	case *CmdW2:
+		st.w = tr.s(cmd.Value)
+		return w.Right(st.w)
+	case *CmdW3:
+		st.w = tr.s(cmd.Value)
+		return w.Right(st.w)
+	case *CmdW4:
+		st.w = tr.s(cmd.Value)
+		return w.Right(st.w)
+	case *CmdX0:
+		return w.Right(st.x)
+	case *CmdX1:
+		st.x = tr.s(cmd.Value)
+		return w.Right(st.x)
+	case *CmdX2:
+		st.x = tr.s(cmd.Value)
+		return w.Right(st.x)
+	case *CmdX3:
+		st.x = tr.s(cmd.Value)
+		return w.Right(st.x)
+	case *CmdX4:
+		st.x = tr.s(cmd.Value)
+		return w.Right(st.x)
+	case *CmdDown1:
+		return w.Down(tr.s(cmd.Value))
+	case *CmdDown2:
+		return w.Down(tr.s(cmd.Value))
+	case *CmdDown3:
+		return w.Down(tr.s(cmd.Value))
+	case *CmdDown4:
+		return w.Down(tr.s(cmd.Value))
+	case *CmdY0:
+		return w.Down(st.y)
+	case *CmdY1:
+		st.y = tr.s(cmd.Value)
+		return w.Down(st.y)
+	case *CmdY2:
+		st.y = tr.s(cmd.Value)
+		return w.Down(st.y)
+	case *CmdY3:
+		st.y = tr.s(cmd.Value)
+		return w.Down(st.y)
+	case *CmdY4:
+		st.y = tr.s(cmd.Value)
+		return w.Down(st.y)
+	case *CmdZ0:
+		return w.Down(st.z)
+	case *CmdZ1:
+		st.z = tr.s(cmd.Value)
+		return w.Down(st.z)
+	case *CmdZ2:
+		st.z = tr.s(cmd.Value)
+		return w.Down(st.z)
+	case *CmdZ3:
+		st.z = tr.s(cmd.Value)
+		return w.Down(st.z)
+	case *CmdZ4:
+		st.z = tr.s(cmd.Value)
+		return w.Down(st.z)
+	case *CmdXXX1:
+		return tr.special(cmd, cmd.Value)
+	case *CmdXXX2:
+		return tr.special(cmd, cmd.Value)
+	case *CmdXXX3:
+		return tr.special(cmd, cmd.Value)
+	case *CmdXXX4:
+		return tr.special(cmd, cmd.Value)
+	}
+	return w.WriteCmd(cmd)
+}
+
+// font selects the font id of the program, defining it first if needed.
+func (tr *transformer) font(id int) error {
+	if tr.fonts == nil {
+		err := tr.prog.defineScaledFontOn(tr.w, tr.defs, id, tr.scale)
+		if err != nil {
+			return err
+		}
+		return tr.w.SetFont(id)
+	}
+
+	def, ok := tr.fonts[id]
+	if !ok {
+		return fmt.Errorf("dvi: undefined font %d", id)
+	}
+	if !tr.defs[def.ID] {
+		tr.defs[def.ID] = true
+		err := tr.w.DefineFont(def)
+		if err != nil {
+			return err
+		}
+	}
+	return tr.w.SetFont(def.ID)
+}
+
+func (tr *transformer) special(cmd Cmd, data []byte) error {
+	if tr.layout.SheetWidth > 0 && tr.layout.SheetHeight > 0 && bytes.HasPrefix(data, []byte("papersize=")) {
+		// the paper size of the sheets replaces the one of the pages.
+		return nil
+	}
+	return tr.w.WriteCmd(cmd)
+}
+
+// cropMarks draws crop marks at the corners of the placed page.
+// Marks extend 1/24+1/6 inch outside of the page, and are only fully
+// visible with large enough margin and gutter.
+func (tr *transformer) cropMarks(p Placement) error {
+	var (
+		x0 = p.X
+		y0 = p.Y
+		x1 = p.X + tr.s(tr.layout.Width)
+		y1 = p.Y + tr.s(tr.layout.Height)
+
+		n   = tr.inch / 6   // length of a mark.
+		gap = tr.inch / 24  // gap between a mark and its corner.
+		t   = tr.inch / 180 // thickness of a mark.
+	)
+	for _, c := range [][2]int32{{x0, y0}, {x1, y0}, {x0, y1}, {x1, y1}} {
+		var (
+			x, y = c[0], c[1]
+			dx   = -gap - n // horizontal mark, outside of the page.
+			dy   = -gap - n // vertical mark, outside of the page.
+		)
+		if x == x1 {
+			dx = gap
+		}
+		if y == y1 {
+			dy = gap
+		}
+		err := tr.rule(x+dx, y-t/2, n, t)
+		if err != nil {
+			return err
+		}
+		err = tr.rule(x-t/2, y+dy, t, n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rule draws a rule of size (w,h) with its top left corner at (x,y) on
+// the sheet.
+func (tr *transformer) rule(x, y, w, h int32) error {
+	for _, f := range []func() error{
+		tr.w.Push,
+		func() error { return tr.w.Right(x - tr.inch) },
+		func() error { return tr.w.Down(y + h - tr.inch) },
+		func() error { return tr.w.PutRule(h, w) },
+		tr.w.Pop,
+	} {
+		err := f()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLayouts(t *testing.T) {
+	nup := NUp(2, 2, 100, 200, 0.5, 0, 0)
+	if got, want := nup.Sheets, [][]Placement{{
+		{Page: 0, X: 0, Y: 0},
+		{Page: 1, X: 50, Y: 0},
+		{Page: 2, X: 0, Y: 100},
+		{Page: 3, X: 50, Y: 100},
+	}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid 2x2 sheets:\ngot= %+v\nwant=%+v", got, want)
+	}
+	if nup.Pages != 4 || nup.SheetWidth != 100 || nup.SheetHeight != 200 {
+		t.Fatalf("invalid 2x2 layout: %+v", nup)
+	}
+
+	var (
+		book  = Booklet(7, 100, 200, 0, 0, 0)
+		pages [][2]int
+	)
+	for _, sheet := range book.Sheets {
+		pages = append(pages, [2]int{sheet[0].Page, sheet[1].Page})
+	}
+	if got, want := pages, [][2]int{{7, 0}, {1, 6}, {5, 2}, {3, 4}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid booklet pages: got=%v, want=%v", got, want)
+	}
+	if book.Pages != 8 || book.SheetWidth != 200 || book.SheetHeight != 200 {
+		t.Fatalf("invalid booklet layout: %+v", book)
+	}
+
+	nup = NUp(2, 1, 100, 200, 0, 10, 4)
+	if got, want := nup.Sheets, [][]Placement{{
+		{Page: 0, X: 10, Y: 10},
+		{Page: 1, X: 114, Y: 10},
+	}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid 2x1 sheets with margins:\ngot= %+v\nwant=%+v", got, want)
+	}
+	if nup.SheetWidth != 224 || nup.SheetHeight != 220 {
+		t.Fatalf("invalid 2x1 layout with margins: %+v", nup)
+	}
+
+	book = Booklet(4, 100, 200, 0, 10, 4)
+	if got, want := book.Sheets[0], []Placement{
+		{Page: 3, X: 10, Y: 10},
+		{Page: 0, X: 114, Y: 10},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid booklet sheet with margins:\ngot= %+v\nwant=%+v", got, want)
+	}
+	if book.SheetWidth != 224 || book.SheetHeight != 220 {
+		t.Fatalf("invalid booklet layout with margins: %+v", book)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	prog, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("could not compile DVI file: %+v", err)
+	}
+	src, err := recordPages(prog, nil)
+	if err != nil {
+		t.Fatalf("could not run DVI file: %+v", err)
+	}
+
+	var (
+		in     = int32(254000 * float64(prog.pre.Den) / float64(prog.pre.Num))
+		width  = in * 17 / 2
+		height = in * 11
+	)
+
+	for _, tc := range []struct {
+		name   string
+		layout Layout
+		crop   bool
+		text   []string
+	}{
+		{
+			name:   "2x1",
+			layout: NUp(2, 1, width, height, 0.5, in/4, in/2),
+			crop:   true,
+			text:   []string{"page page\n1 2\n. .\n1 2\n", "page\n3\n.\n3\n"},
+		},
+		{
+			name:   "booklet",
+			layout: Booklet(4, width, height, 0, 0, 0),
+			text:   []string{"page\n1\n.\n1\n", "page page\n2 3\n. .\n2 3\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.layout.CropMarks = tc.crop
+			buf := new(bytes.Buffer)
+			err := Transform(buf, prog, tc.layout)
+			if err != nil {
+				t.Fatalf("could not transform pages: %+v", err)
+			}
+			out, err := Compile(buf.Bytes())
+			if err != nil {
+				t.Fatalf("could not compile transformed pages: %+v", err)
+			}
+
+			text, err := Text(out)
+			if err != nil {
+				t.Fatalf("could not extract text: %+v", err)
+			}
+			if !reflect.DeepEqual(text, tc.text) {
+				t.Fatalf("invalid text:\ngot= %q\nwant=%q", text, tc.text)
+			}
+
+			s := scaleOf(tc.layout.Scale)
+			for _, def := range out.Fonts() {
+				if got, want := def.Size, int32(float64(prog.fonts[def.ID].Size)*s); got != want {
+					t.Fatalf("invalid size for font %q: got=%d, want=%d", def.Name, got, want)
+				}
+			}
+
+			dst, err := recordPages(out, nil)
+			if err != nil {
+				t.Fatalf("could not run transformed pages: %+v", err)
+			}
+			p := tc.layout.Sheets[0][len(tc.layout.Sheets[0])-1]
+			var (
+				glyph = src[p.Page].items[0]
+				got   = dst[0].items
+				dx    = p.X - in + int32(float64(in)*s)
+				x     = dx + int32(float64(glyph.x)*s)
+				y     = p.Y - in + int32(float64(in+glyph.y)*s)
+				found bool
+				rules int
+			)
+			for _, it := range got {
+				if it.rule {
+					rules++
+					// rules are drawn relative to the reference point of
+					// the sheet, one inch from its top left corner.
+					x0, y0 := it.x+in, it.y-it.h+in
+					if x0 < 0 || y0 < 0 || x0+it.w > tc.layout.SheetWidth || y0+it.h > tc.layout.SheetHeight {
+						t.Fatalf("crop mark %+v outside of sheet (%d, %d)", it, tc.layout.SheetWidth, tc.layout.SheetHeight)
+					}
+					continue
+				}
+				if it.code == glyph.code && absI32(it.x-x) <= 1 && absI32(it.y-y) <= 1 {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("could not find glyph %q of page %d at (%d, %d)", glyph.text, p.Page+1, x, y)
+			}
+			want := 0
+			if tc.crop {
+				want = 8 * len(tc.layout.Sheets[0])
+			}
+			if rules != want {
+				t.Fatalf("invalid number of crop marks: got=%d, want=%d", rules, want)
+			}
+		})
+	}
+
+	err = Transform(new(bytes.Buffer), prog, Layout{Pages: 1, Sheets: [][]Placement{{{Page: 1}}}})
+	if err == nil {
+		t.Fatalf("expected an error for an invalid layout")
+	}
+}
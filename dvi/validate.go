@@ -0,0 +1,351 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"star-tex.org/x/tex/font/tfm"
+)
+
+// Problem is a structural problem of a DVI document, found by Validate.
+type Problem struct {
+	Offset int64  `json:"offset"` // Offset is the position in bytes of the faulty command.
+	Msg    string `json:"msg"`    // Msg describes the problem.
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d: %s", p.Offset, p.Msg)
+}
+
+// Validate checks the structure of the provided DVI document and returns
+// its problems, in order of appearance.
+//
+// Validate checks:
+//   - the back-pointers of the bop commands,
+//   - the postamble, its pointer and the post_post trailer,
+//   - the balance of push and pop commands against the maximum stack
+//     depth of the postamble,
+//   - that fonts are defined before being used,
+//   - that font definitions of the pages agree with the postamble,
+//   - that checksums of font definitions agree with their TFM files.
+//
+// The kpath context of the options is used to locate TFM files.
+func Validate(raw []byte, opts ...Option) ([]Problem, error) {
+	cfg := newConfig()
+	for _, opt := range opts {
+		err := opt(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("dvi: could not setup validation: %w", err)
+		}
+	}
+
+	v := validator{
+		raw:   raw,
+		cfg:   cfg,
+		dec:   NewDecoder(bytes.NewReader(raw)),
+		bop:   -1,
+		post:  -1,
+		page:  make(map[int]fontDefAt),
+		fonts: make(map[int]fontDefAt),
+		sums:  make(map[string]uint32),
+	}
+	v.run()
+	sort.SliceStable(v.probs, func(i, j int) bool {
+		return v.probs[i].Offset < v.probs[j].Offset
+	})
+	return v.probs, nil
+}
+
+// fontDefAt is a font definition and its position in the document.
+type fontDefAt struct {
+	pos int64
+	def interface{} // FontDef or CmdNativeFontDef.
+}
+
+type validator struct {
+	raw   []byte
+	cfg   *config
+	dec   *Decoder
+	probs []Problem
+
+	pre    *CmdPre
+	bop    int64 // position of the last bop.
+	post   int64 // position of the postamble.
+	npages int
+	inPage bool
+	depth  int // current stack depth.
+	stack  int // maximum stack depth.
+
+	page  map[int]fontDefAt // fonts defined in pages.
+	fonts map[int]fontDefAt // fonts defined in the postamble.
+	sums  map[string]uint32 // checksums of TFM files.
+}
+
+func (v *validator) add(pos int64, format string, args ...interface{}) {
+	v.probs = append(v.probs, Problem{Offset: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) run() {
+	end := int64(len(v.raw))
+	for {
+		pos := v.dec.Pos()
+		cmd, err := v.dec.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) || pos == end {
+				// a missing postamble is reported below.
+				break
+			}
+			if e := errors.Unwrap(err); e != nil {
+				err = e
+			}
+			v.add(pos, "could not decode command: %v", err)
+			return
+		}
+
+		if v.pre == nil {
+			pre, ok := cmd.(*CmdPre)
+			if !ok {
+				v.add(pos, "missing preamble")
+				return
+			}
+			v.pre = pre
+			switch vers := pre.Version; {
+			case vers == dviVersion, vers == ptexVersion, isXDV(vers):
+			default:
+				v.add(pos, "invalid DVI version %d", vers)
+			}
+			continue
+		}
+
+		v.cmd(pos, cmd)
+	}
+
+	switch {
+	case v.post < 0:
+		v.add(end, "missing postamble")
+	case v.dec.Pos() != end:
+		v.add(v.dec.Pos(), "unexpected data after post_post trailer")
+	}
+}
+
+func (v *validator) cmd(pos int64, cmd Cmd) {
+	if v.post >= 0 {
+		v.postamble(pos, cmd)
+		return
+	}
+
+	switch cmd := cmd.(type) {
+	case *CmdNOP:
+		return
+	case *CmdPre:
+		v.add(pos, "unexpected preamble")
+		return
+	case *CmdBOP:
+		if v.inPage {
+			v.add(pos, "missing eop before bop")
+		}
+		if prev := int64(cmd.Prev); prev != v.bop {
+			v.add(pos, "invalid bop back-pointer %d (want %d)", prev, v.bop)
+		}
+		v.bop = pos
+		v.npages++
+		v.inPage = true
+		v.depth = 0
+		return
+	case *CmdPost:
+		if v.inPage {
+			v.add(pos, "missing eop before postamble")
+		}
+		v.post = pos
+		v.postamble(pos, cmd)
+		return
+	}
+
+	if id, def, ok := fontDefOf(cmd); ok {
+		// font definitions may also appear between pages.
+		v.pageFont(pos, id, def)
+		return
+	}
+
+	if !v.inPage {
+		v.add(pos, "command %s outside of a page", cmd.Name())
+		return
+	}
+
+	switch cmd := cmd.(type) {
+	case *CmdEOP:
+		if v.depth != 0 {
+			v.add(pos, "unbalanced push/pop at end of page (level %d)", v.depth)
+		}
+		v.inPage = false
+	case *CmdPush:
+		v.depth++
+		if v.depth > v.stack {
+			v.stack = v.depth
+		}
+	case *CmdPop:
+		if v.depth == 0 {
+			v.add(pos, "pop with an empty stack")
+			return
+		}
+		v.depth--
+	default:
+		if id, ok := fontNumOf(cmd); ok {
+			if _, ok := v.page[id]; !ok {
+				v.add(pos, "font %d used before it is defined", id)
+			}
+		}
+	}
+}
+
+func (v *validator) postamble(pos int64, cmd Cmd) {
+	switch cmd := cmd.(type) {
+	case *CmdPost:
+		if bop := int64(int32(cmd.BOP)); bop != v.bop {
+			v.add(pos, "invalid postamble pointer to last page %d (want %d)", bop, v.bop)
+		}
+		if cmd.Num != v.pre.Num || cmd.Den != v.pre.Den || cmd.Mag != v.pre.Mag {
+			v.add(pos,
+				"postamble units (num=%d, den=%d, mag=%d) differ from preamble (num=%d, den=%d, mag=%d)",
+				cmd.Num, cmd.Den, cmd.Mag, v.pre.Num, v.pre.Den, v.pre.Mag,
+			)
+		}
+		if int(cmd.Pages) != v.npages {
+			v.add(pos, "invalid number of pages %d (want %d)", cmd.Pages, v.npages)
+		}
+		if int(cmd.MaxStack) < v.stack {
+			v.add(pos, "invalid maximum stack depth %d (want at least %d)", cmd.MaxStack, v.stack)
+		}
+	case *CmdNOP:
+	case *CmdPostPost:
+		if post := int64(cmd.BOP); post != v.post {
+			v.add(pos, "invalid post pointer %d (want %d)", post, v.post)
+		}
+		if !versionMatch(v.pre.Version, cmd.Version) {
+			v.add(pos, "version skew (pre=%d, post_post=%d)", v.pre.Version, cmd.Version)
+		}
+		if cmd.Trailer < 4 {
+			v.add(pos, "post_post trailer has %d bytes of value %d (want at least 4)", cmd.Trailer, dviEOF)
+		}
+		if n := v.dec.Pos(); n%4 != 0 {
+			v.add(pos, "document length %d is not a multiple of 4", n)
+		}
+		for id, pdef := range v.page {
+			if _, ok := v.fonts[id]; !ok {
+				v.add(pdef.pos, "font %d is missing from the postamble", id)
+			}
+		}
+	default:
+		id, def, ok := fontDefOf(cmd)
+		if !ok {
+			v.add(pos, "invalid command %s in postamble", cmd.Name())
+			return
+		}
+		if _, dup := v.fonts[id]; dup {
+			v.add(pos, "font %d defined twice in the postamble", id)
+			return
+		}
+		v.fonts[id] = fontDefAt{pos: pos, def: def}
+		pdef, ok := v.page[id]
+		switch {
+		case !ok:
+			v.checksum(pos, id, def)
+		case pdef.def != def:
+			v.add(pos, "fnt_def %d differs from its definition at %d", id, pdef.pos)
+		}
+	}
+}
+
+func (v *validator) pageFont(pos int64, id int, def interface{}) {
+	pdef, ok := v.page[id]
+	if ok {
+		if pdef.def != def {
+			v.add(pos, "fnt_def %d differs from its definition at %d", id, pdef.pos)
+		}
+		return
+	}
+	v.page[id] = fontDefAt{pos: pos, def: def}
+	v.checksum(pos, id, def)
+}
+
+// checksum checks the checksum of a font definition against its TFM file.
+func (v *validator) checksum(pos int64, id int, def interface{}) {
+	fnt, ok := def.(FontDef)
+	if !ok || fnt.Checksum == 0 {
+		return
+	}
+	sum, ok := v.sums[fnt.Name]
+	if !ok {
+		var err error
+		sum, err = v.tfmChecksum(fnt.Name)
+		if err != nil {
+			v.add(pos, "font %d: %v", id, err)
+			return
+		}
+		v.sums[fnt.Name] = sum
+	}
+	if sum != 0 && sum != fnt.Checksum {
+		v.add(pos, "font %d (%s): checksum %o differs from TFM checksum %o", id, fnt.Name, fnt.Checksum, sum)
+	}
+}
+
+func (v *validator) tfmChecksum(name string) (uint32, error) {
+	fname, err := v.cfg.ctx.Find(name + ".tfm")
+	if err != nil {
+		return 0, fmt.Errorf("could not find TFM font %q: %w", name, err)
+	}
+
+	f, err := v.cfg.ctx.Open(fname)
+	if err != nil {
+		return 0, fmt.Errorf("could not open TFM font %q: %w", name, err)
+	}
+	defer f.Close()
+
+	font, err := tfm.Parse(f)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse TFM font %q: %w", name, err)
+	}
+	return font.Checksum(), nil
+}
+
+// fontDefOf returns the font number and definition of a font definition
+// command.
+func fontDefOf(cmd Cmd) (int, interface{}, bool) {
+	switch cmd := cmd.(type) {
+	case *CmdFntDef1:
+		return int(cmd.ID), FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font}, true
+	case *CmdFntDef2:
+		return int(cmd.ID), FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font}, true
+	case *CmdFntDef3:
+		return int(cmd.ID), FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font}, true
+	case *CmdFntDef4:
+		return int(cmd.ID), FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font}, true
+	case *CmdNativeFontDef:
+		return int(cmd.ID), *cmd, true
+	}
+	return 0, nil, false
+}
+
+// fontNumOf returns the font number selected by a fnt command.
+func fontNumOf(cmd Cmd) (int, bool) {
+	switch cmd := cmd.(type) {
+	case *CmdFntNum:
+		return int(cmd.ID), true
+	case *CmdFnt1:
+		return int(cmd.ID), true
+	case *CmdFnt2:
+		return int(cmd.ID), true
+	case *CmdFnt3:
+		return int(cmd.ID), true
+	case *CmdFnt4:
+		return int(cmd.ID), true
+	}
+	return 0, false
+}
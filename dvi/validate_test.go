@@ -0,0 +1,250 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, fname := range []string{
+		"../testdata/hello_golden.dvi",
+		"../testdata/pages_golden.dvi",
+		"../testdata/xcolor_golden.dvi",
+		"../testdata/ptex.dvi",
+		"../testdata/xdv.dvi",
+	} {
+		t.Run(fname, func(t *testing.T) {
+			raw, err := os.ReadFile(fname)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+			probs, err := Validate(raw)
+			if err != nil {
+				t.Fatalf("could not validate DVI file: %+v", err)
+			}
+			if len(probs) != 0 {
+				t.Fatalf("invalid DVI file: %v", probs)
+			}
+		})
+	}
+
+	// commands longer than the buffer of a Decoder are valid.
+	probs, err := Validate(longXDV())
+	if err != nil {
+		t.Fatalf("could not validate long XDV document: %+v", err)
+	}
+	if len(probs) != 0 {
+		t.Fatalf("invalid long XDV document: %v", probs)
+	}
+
+	raw, err := os.ReadFile("../testdata/pages_golden.dvi")
+	if err != nil {
+		t.Fatalf("could not read DVI file: %+v", err)
+	}
+	// locate the commands to corrupt.
+	var (
+		bops []int64
+		def  []int64 // positions of the fnt_def commands of the pages.
+		fnts []int64 // positions of the fnt_def commands of the postamble.
+		post int64
+		pp   int64 // position of post_post.
+		dec  = NewDecoder(bytes.NewReader(raw))
+	)
+	for {
+		pos := dec.Pos()
+		cmd, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not decode DVI file: %+v", err)
+		}
+		switch cmd.(type) {
+		case *CmdBOP:
+			bops = append(bops, pos)
+		case *CmdFntDef1:
+			if post == 0 {
+				def = append(def, pos)
+			} else {
+				fnts = append(fnts, pos)
+			}
+		case *CmdPost:
+			post = pos
+		case *CmdPostPost:
+			pp = pos
+		}
+	}
+	var (
+		bop = bops[1]
+		pdf = def[0]  // first fnt_def of the pages.
+		fnt = fnts[0] // first fnt_def of the postamble.
+	)
+
+	for _, tc := range []struct {
+		name string
+		edit func(raw []byte) []byte
+		want []Problem
+	}{
+		{
+			name: "bop-back-pointer",
+			edit: func(raw []byte) []byte {
+				binary.BigEndian.PutUint32(raw[bop+41:], 7)
+				return raw
+			},
+			want: []Problem{
+				{bop, fmt.Sprintf("invalid bop back-pointer 7 (want %d)", bops[0])},
+			},
+		},
+		{
+			name: "post-pointer",
+			edit: func(raw []byte) []byte {
+				binary.BigEndian.PutUint32(raw[pp+1:], 42)
+				return raw
+			},
+			want: []Problem{
+				{pp, fmt.Sprintf("invalid post pointer 42 (want %d)", post)},
+			},
+		},
+		{
+			name: "trailer",
+			edit: func(raw []byte) []byte {
+				return raw[:pp+6+2]
+			},
+			want: []Problem{
+				{pp, "post_post trailer has 2 bytes of value 223 (want at least 4)"},
+				{pp, fmt.Sprintf("document length %d is not a multiple of 4", pp+6+2)},
+			},
+		},
+		{
+			name: "trailing-data",
+			edit: func(raw []byte) []byte {
+				return append(raw, 0, 0, 0, 0)
+			},
+			want: []Problem{
+				{int64(len(raw)), "unexpected data after post_post trailer"},
+			},
+		},
+		{
+			name: "pages",
+			edit: func(raw []byte) []byte {
+				binary.BigEndian.PutUint16(raw[post+27:], 2)
+				return raw
+			},
+			want: []Problem{
+				{post, fmt.Sprintf("invalid number of pages 2 (want %d)", len(bops))},
+			},
+		},
+		{
+			name: "max-stack",
+			edit: func(raw []byte) []byte {
+				binary.BigEndian.PutUint16(raw[post+25:], 0)
+				return raw
+			},
+			want: []Problem{
+				{post, "invalid maximum stack depth 0 (want at least 2)"},
+			},
+		},
+		{
+			name: "postamble-fnt-def",
+			edit: func(raw []byte) []byte {
+				raw[fnt+5] ^= 0xff // checksum.
+				return raw
+			},
+			want: []Problem{
+				{fnt, fmt.Sprintf("fnt_def 0 differs from its definition at %d", pdf)},
+			},
+		},
+		{
+			name: "checksum",
+			edit: func(raw []byte) []byte {
+				raw[fnt+5] ^= 0xff // checksum of the postamble.
+				raw[pdf+5] ^= 0xff // checksum of the page.
+				return raw
+			},
+			want: []Problem{
+				{pdf, "font 0 (cmr10): checksum 11374260206 differs from TFM checksum 11374260171"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := tc.edit(append([]byte(nil), raw...))
+			got, err := Validate(raw)
+			if err != nil {
+				t.Fatalf("could not validate DVI file: %+v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid problems:\ngot= %v\nwant=%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateStructure(t *testing.T) {
+	pre := CmdPre{Version: dviVersion, Num: TeXNum, Den: TeXDen, Mag: TeXMag}
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want []string
+	}{
+		{
+			name: "unbalanced",
+			raw: encodeDVI(pre, dviVersion, nil, [][]Cmd{
+				{&CmdPush{}, &CmdPush{}, &CmdPop{}},
+				{&CmdPop{}},
+			}),
+			want: []string{
+				"unbalanced push/pop at end of page (level 1)",
+				"pop with an empty stack",
+				"invalid maximum stack depth 0 (want at least 2)",
+			},
+		},
+		{
+			name: "undefined-font",
+			raw: encodeDVI(pre, dviVersion, nil, [][]Cmd{
+				{&CmdFntNum{ID: 3}, &CmdSetChar{Value: 'a'}},
+			}),
+			want: []string{
+				"font 3 used before it is defined",
+			},
+		},
+		{
+			name: "missing-font",
+			raw: encodeDVI(pre, dviVersion, nil, [][]Cmd{
+				{&CmdFntDef1{ID: 1, Size: xdvPt, Design: xdvPt, Font: "cmr10"}, &CmdFnt1{ID: 1}},
+			}),
+			want: []string{
+				"font 1 is missing from the postamble",
+			},
+		},
+		{
+			name: "no-postamble",
+			raw:  encodeDVI(pre, dviVersion, nil, [][]Cmd{{}})[:61],
+			want: []string{
+				"missing postamble",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			probs, err := Validate(tc.raw)
+			if err != nil {
+				t.Fatalf("could not validate DVI file: %+v", err)
+			}
+			var got []string
+			for _, p := range probs {
+				got = append(got, p.Msg)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("invalid problems:\ngot= %q\nwant=%q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"star-tex.org/x/tex/font/vf"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+const (
+	maxVFDepth = 10 // maximum nesting of virtual fonts.
+)
+
+// vfont is a virtual font, loaded at a given size.
+type vfont struct {
+	name    string
+	size    int32 // size of the virtual font, in DVI units.
+	font    *vf.Font
+	fonts   map[int]fntdef  // local fonts.
+	first   int             // default local font.
+	packets map[rune][]byte // scaled DVI packets.
+}
+
+// loadVF loads the virtual font for the provided font definition.
+// loadVF returns nil if the font is not a virtual font.
+func (m *Machine) loadVF(def fntdef) (*vfont, error) {
+	name, err := m.ktx.Find(def.Name + ".vf")
+	if err != nil {
+		return nil, nil
+	}
+
+	f, err := m.ktx.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open VF font %q: %w", def.Name, err)
+	}
+	defer f.Close()
+
+	font, err := vf.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse VF font %q: %w", def.Name, err)
+	}
+
+	vfnt := &vfont{
+		name:    def.Name,
+		size:    def.Size,
+		font:    &font,
+		fonts:   make(map[int]fntdef, len(font.Fonts())),
+		first:   -1,
+		packets: make(map[rune][]byte),
+	}
+	for i, fd := range font.Fonts() {
+		id := int(fd.ID)
+		if i == 0 {
+			vfnt.first = id
+		}
+		vfnt.fonts[id] = fntdef{
+			ID:       id,
+			Checksum: fd.Checksum,
+			Size:     scaled(int32(fd.Scale), def.Size),
+			Design:   (int32(fd.Design) + 8) >> 4, // from 2^-20pt to sp.
+			Area:     fd.Area,
+			Name:     fd.Name,
+			mag:      1000,
+		}
+	}
+	return vfnt, nil
+}
+
+// packet returns the DVI packet of the provided glyph, with dimensions
+// in DVI units.
+func (vfnt *vfont) packet(code rune) ([]byte, error) {
+	if pkt, ok := vfnt.packets[code]; ok {
+		return pkt, nil
+	}
+	g := vfnt.font.Glyph(code)
+	if g == nil {
+		return nil, fmt.Errorf("dvi: virtual font %q has no glyph %d", vfnt.name, code)
+	}
+	pkt, err := scalePacket(g.DVI(), vfnt.size)
+	if err != nil {
+		return nil, fmt.Errorf("dvi: invalid packet for glyph %d of virtual font %q: %w", code, vfnt.name, err)
+	}
+	vfnt.packets[code] = pkt
+	return pkt, nil
+}
+
+// drawVirtual executes the DVI packet of the provided glyph of a virtual
+// font.
+// The packet is executed with the local fonts of the virtual font, inside
+// an implicit push/pop pair, with the w, x, y and z registers set to zero.
+func (m *Machine) drawVirtual(vfnt *vfont, code rune) error {
+	if m.vfdepth >= maxVFDepth {
+		return fmt.Errorf("dvi: too many nested virtual fonts")
+	}
+	pkt, err := vfnt.packet(code)
+	if err != nil {
+		return err
+	}
+
+	var (
+		fonts = m.state.fonts
+		f     = m.state.f
+		lvl   = len(m.state.stack)
+		w     = m.w
+		buf   = append([]byte(nil), m.buf...)
+	)
+	m.state.push()
+	cur := m.state.cur()
+	cur.w, cur.x, cur.y, cur.z = 0, 0, 0, 0
+	m.state.fonts = vfnt.fonts
+	m.state.f = vfnt.first
+	m.w = io.Discard
+	m.vfdepth++
+
+	_, err = m.exec(iobuf.NewReader(pkt), len(pkt))
+
+	m.vfdepth--
+	m.w = w
+	m.buf = append(m.buf[:0], buf...)
+	m.state.fonts = fonts
+	m.state.f = f
+	m.state.stack = m.state.stack[:lvl]
+
+	if err != nil {
+		return fmt.Errorf("dvi: could not execute glyph %d of virtual font %q: %w", code, vfnt.name, err)
+	}
+	return nil
+}
+
+// scalePacket converts the dimensions of a VF packet, expressed as
+// fractions of the size z of the virtual font, into DVI units.
+// Movements are rewritten with their 4-bytes variants.
+func scalePacket(src []byte, z int32) ([]byte, error) {
+	var (
+		dec = NewDecoder(bytes.NewReader(src))
+		o   = new(bytes.Buffer)
+		w   = iobuf.NewWriter(o)
+	)
+	for dec.Pos() < int64(len(src)) {
+		cmd, err := dec.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch c := cmd.(type) {
+		case *CmdSetRule:
+			c.Height = scaled(c.Height, z)
+			c.Width = scaled(c.Width, z)
+		case *CmdPutRule:
+			c.Height = scaled(c.Height, z)
+			c.Width = scaled(c.Width, z)
+		case *CmdRight1:
+			cmd = &CmdRight4{Value: scaled(c.Value, z)}
+		case *CmdRight2:
+			cmd = &CmdRight4{Value: scaled(c.Value, z)}
+		case *CmdRight3:
+			cmd = &CmdRight4{Value: scaled(c.Value, z)}
+		case *CmdRight4:
+			c.Value = scaled(c.Value, z)
+		case *CmdW1:
+			cmd = &CmdW4{Value: scaled(c.Value, z)}
+		case *CmdW2:
+			cmd = &CmdW4{Value: scaled(c.Value, z)}
+		case *CmdW3:
+			cmd = &CmdW4{Value: scaled(c.Value, z)}
+		case *CmdW4:
+			c.Value = scaled(c.Value, z)
+		case *CmdX1:
+			cmd = &CmdX4{Value: scaled(c.Value, z)}
+		case *CmdX2:
+			cmd = &CmdX4{Value: scaled(c.Value, z)}
+		case *CmdX3:
+			cmd = &CmdX4{Value: scaled(c.Value, z)}
+		case *CmdX4:
+			c.Value = scaled(c.Value, z)
+		case *CmdDown1:
+			cmd = &CmdDown4{Value: scaled(c.Value, z)}
+		case *CmdDown2:
+			cmd = &CmdDown4{Value: scaled(c.Value, z)}
+		case *CmdDown3:
+			cmd = &CmdDown4{Value: scaled(c.Value, z)}
+		case *CmdDown4:
+			c.Value = scaled(c.Value, z)
+		case *CmdY1:
+			cmd = &CmdY4{Value: scaled(c.Value, z)}
+		case *CmdY2:
+			cmd = &CmdY4{Value: scaled(c.Value, z)}
+		case *CmdY3:
+			cmd = &CmdY4{Value: scaled(c.Value, z)}
+		case *CmdY4:
+			c.Value = scaled(c.Value, z)
+		case *CmdZ1:
+			cmd = &CmdZ4{Value: scaled(c.Value, z)}
+		case *CmdZ2:
+			cmd = &CmdZ4{Value: scaled(c.Value, z)}
+		case *CmdZ3:
+			cmd = &CmdZ4{Value: scaled(c.Value, z)}
+		case *CmdZ4:
+			c.Value = scaled(c.Value, z)
+		case *CmdBOP, *CmdEOP, *CmdPre, *CmdPost, *CmdPostPost,
+			*CmdFntDef1, *CmdFntDef2, *CmdFntDef3, *CmdFntDef4:
+			return nil, fmt.Errorf("invalid command %s", cmd.Name())
+		}
+		cmd.write(w)
+	}
+	return o.Bytes(), nil
+}
+
+// scaled returns the fix_word v, scaled by the provided size z.
+func scaled(v, z int32) int32 {
+	return int32((int64(v) * int64(z)) >> 20)
+}
@@ -0,0 +1,86 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"star-tex.org/x/tex/kpath"
+)
+
+type glyphRenderer struct {
+	nopRenderer
+	calls []string
+}
+
+func (rdr *glyphRenderer) DrawGlyph(x, y int32, font Font, glyph rune, c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf(
+		"glyph %s@%d %d %d %c", font.Name(), font.Size(), x, y, glyph,
+	))
+}
+
+func (rdr *glyphRenderer) DrawRule(x, y, w, h int32, c color.Color) {
+	rdr.calls = append(rdr.calls, fmt.Sprintf("rule %d %d %d %d", x, y, w, h))
+}
+
+func TestVirtualFont(t *testing.T) {
+	const pt = 1 << 16
+
+	fsys := make(fstest.MapFS)
+	for dst, src := range map[string]string{
+		"fonts/tfm/cmr10.tfm":  "../internal/tds/fonts/tfm/public/cm/cmr10.tfm",
+		"fonts/tfm/xcmr10.tfm": "../internal/tds/fonts/tfm/public/cm/cmr10.tfm",
+		"fonts/tfm/ycmr10.tfm": "../internal/tds/fonts/tfm/public/cm/cmr10.tfm",
+		"fonts/vf/xcmr10.vf":   "../font/vf/testdata/xcmr10.vf",
+		"fonts/vf/ycmr10.vf":   "../font/vf/testdata/ycmr10.vf",
+	} {
+		raw, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("could not read %q: %+v", src, err)
+		}
+		fsys[dst] = &fstest.MapFile{Data: raw}
+	}
+	ctx, err := kpath.NewFromFS(fsys)
+	if err != nil {
+		t.Fatalf("could not create kpath context: %+v", err)
+	}
+
+	prog := writeProgram(t, CmdPre{}, [][]Cmd{{
+		&CmdFntDef1{ID: 0, Size: 10 * pt, Design: 10 * pt, Font: "xcmr10"},
+		&CmdFntDef1{ID: 1, Size: 20 * pt, Design: 10 * pt, Font: "ycmr10"},
+		&CmdFntNum{ID: 0},
+		&CmdSetChar{Value: 'A'},
+		&CmdSetChar{Value: 'B'},
+		&CmdSetChar{Value: 'C'},
+		&CmdDown4{Value: 20 * pt},
+		&CmdFntNum{ID: 1},
+		&CmdSetChar{Value: 'B'},
+	}})
+
+	rdr := new(glyphRenderer)
+	vm := NewMachine(WithContext(ctx), WithRenderer(rdr))
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run DVI document: %+v", err)
+	}
+
+	want := []string{
+		"glyph cmr10@655360 0 0 A",
+		"glyph cmr10@655360 491521 0 A",
+		"rule 819201 0 131071 65535",
+		"glyph cmr10@655360 955736 0 C",
+		// ycmr10 at 20pt: B drawn from xcmr10 at 10pt, drawn from cmr10.
+		"glyph cmr10@655360 1429052 1310720 A",
+		"rule 1756732 1310720 131071 65535",
+	}
+	if !reflect.DeepEqual(rdr.calls, want) {
+		t.Fatalf("invalid renderer calls:\ngot= %q\nwant=%q", rdr.calls, want)
+	}
+}
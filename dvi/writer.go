@@ -0,0 +1,813 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// Units of the DVI documents produced by TeX.
+const (
+	TeXNum = 25400000  // numerator of the DVI unit of TeX (1sp).
+	TeXDen = 473628672 // denominator of the DVI unit of TeX (1sp).
+	TeXMag = 1000      // magnification of unmagnified TeX documents.
+)
+
+// FontDef describes a font definition of a DVI document.
+type FontDef struct {
+	ID       int
+	Checksum uint32
+	Size     int32  // Scaled size of the font, in DVI units.
+	Design   int32  // Design size of the font, in DVI units.
+	Area     string // Directory of the font, usually empty.
+	Name     string // Name of the font, e.g. "cmr10".
+}
+
+// Writer encodes DVI documents.
+//
+// Writer uses the shortest encoding of each command, and the w, x, y and z
+// registers for the movements.
+// It maintains the back-pointers of the pages and computes the postamble
+// of the document when it is closed.
+//
+// The maximal page width and height of the postamble are computed from the
+// movements and the rules of the pages: characters, whose widths are
+// unknown to the Writer, do not contribute to them.
+//
+// The XDV commands of XeTeX and the direction commands of pTeX can be
+// written with WriteCmd, when allowed by the DVI id of the preamble.
+//
+// Methods of Writer return the first error encountered while writing
+// the document.
+type Writer struct {
+	w   *iobuf.Writer
+	cw  countWriter
+	err error
+
+	pre   CmdPre
+	bop   int64 // position of the last bop, or -1.
+	npage int
+	page  bool // whether a page is being written.
+
+	fonts []FontDef
+	fnts  map[int]int        // index of the font definitions, by ID.
+	nfnts []CmdNativeFontDef // native font definitions of XDV documents.
+	nats  map[int]int        // index of the native font definitions, by ID.
+	font  int                // current font, or -1.
+	dir   bool               // whether a pTeX direction command was written.
+
+	stack []wregs
+	max   struct {
+		h     int32
+		v     int32
+		stack int
+	}
+}
+
+// wregs holds the DVI registers of a Writer.
+type wregs struct {
+	h, v       int32
+	w, x, y, z int32
+
+	hreg byte // last horizontal register used ('w' or 'x')
+	vreg byte // last vertical register used ('y' or 'z')
+}
+
+// NewWriter returns a Writer that writes a DVI document, with the provided
+// preamble, to w.
+//
+// Zero fields of the preamble are replaced with the values used by TeX.
+func NewWriter(w io.Writer, pre CmdPre) *Writer {
+	if pre.Version == 0 {
+		pre.Version = dviVersion
+	}
+	if pre.Num == 0 {
+		pre.Num = TeXNum
+	}
+	if pre.Den == 0 {
+		pre.Den = TeXDen
+	}
+	if pre.Mag == 0 {
+		pre.Mag = TeXMag
+	}
+
+	wr := &Writer{
+		cw:   countWriter{w: w},
+		pre:  pre,
+		bop:  -1,
+		fnts: make(map[int]int),
+		nats: make(map[int]int),
+		font: -1,
+	}
+	wr.w = iobuf.NewWriter(&wr.cw)
+
+	if len(pre.Msg) > 255 {
+		wr.err = fmt.Errorf("dvi: preamble comment too long (%d > 255)", len(pre.Msg))
+		return wr
+	}
+	wr.emit(&pre)
+	return wr
+}
+
+// emit writes the provided command.
+func (w *Writer) emit(cmd Cmd) error {
+	if w.err != nil {
+		return w.err
+	}
+	cmd.write(w.w)
+	if w.cw.err != nil {
+		w.err = fmt.Errorf("dvi: could not write %s: %w", cmd.Name(), w.cw.err)
+	}
+	return w.err
+}
+
+func (w *Writer) fail(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func (w *Writer) cur() *wregs {
+	return &w.stack[len(w.stack)-1]
+}
+
+func (w *Writer) inPage(name string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if !w.page {
+		return w.fail(fmt.Errorf("dvi: %s outside of a page", name))
+	}
+	return nil
+}
+
+// BeginPage starts a new page, with the provided \count0 to \count9 values.
+func (w *Writer) BeginPage(counts [10]int32) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.page {
+		return w.fail(fmt.Errorf("dvi: bop inside a page"))
+	}
+	if w.npage >= 1<<16-1 {
+		return w.fail(fmt.Errorf("dvi: too many pages"))
+	}
+
+	pos := w.cw.n
+	err := w.emit(&CmdBOP{
+		C0: counts[0], C1: counts[1], C2: counts[2], C3: counts[3], C4: counts[4],
+		C5: counts[5], C6: counts[6], C7: counts[7], C8: counts[8], C9: counts[9],
+		Prev: int32(w.bop),
+	})
+	if err != nil {
+		return err
+	}
+	w.bop = pos
+	w.npage++
+	w.page = true
+	w.font = -1
+	w.stack = append(w.stack[:0], wregs{})
+	return nil
+}
+
+// EndPage ends the current page.
+func (w *Writer) EndPage() error {
+	if err := w.inPage("eop"); err != nil {
+		return err
+	}
+	if len(w.stack) != 1 {
+		return w.fail(fmt.Errorf("dvi: unbalanced push/pop (depth=%d)", len(w.stack)-1))
+	}
+	w.page = false
+	return w.emit(&CmdEOP{})
+}
+
+// Push saves the current position and registers on the stack.
+func (w *Writer) Push() error {
+	if err := w.inPage("push"); err != nil {
+		return err
+	}
+	w.stack = append(w.stack, *w.cur())
+	if n := len(w.stack) - 1; n > w.max.stack {
+		w.max.stack = n
+	}
+	return w.emit(&CmdPush{})
+}
+
+// Pop restores the position and registers saved by the matching Push.
+func (w *Writer) Pop() error {
+	if err := w.inPage("pop"); err != nil {
+		return err
+	}
+	if len(w.stack) == 1 {
+		return w.fail(fmt.Errorf("dvi: pop without push"))
+	}
+	w.stack = w.stack[:len(w.stack)-1]
+	return w.emit(&CmdPop{})
+}
+
+// Right moves the current position by dx to the right.
+func (w *Writer) Right(dx int32) error {
+	if err := w.inPage("right"); err != nil {
+		return err
+	}
+	if dx == 0 {
+		return nil
+	}
+	st := w.cur()
+	var cmd Cmd
+	switch {
+	case dx == st.w:
+		cmd = &CmdW0{}
+		st.hreg = 'w'
+	case dx == st.x:
+		cmd = &CmdX0{}
+		st.hreg = 'x'
+	case st.hreg == 'w':
+		cmd = xcmd(dx)
+		st.x = dx
+		st.hreg = 'x'
+	default:
+		cmd = wcmd(dx)
+		st.w = dx
+		st.hreg = 'w'
+	}
+	w.moveH(dx)
+	return w.emit(cmd)
+}
+
+// Down moves the current position by dy downwards.
+func (w *Writer) Down(dy int32) error {
+	if err := w.inPage("down"); err != nil {
+		return err
+	}
+	if dy == 0 {
+		return nil
+	}
+	st := w.cur()
+	var cmd Cmd
+	switch {
+	case dy == st.y:
+		cmd = &CmdY0{}
+		st.vreg = 'y'
+	case dy == st.z:
+		cmd = &CmdZ0{}
+		st.vreg = 'z'
+	case st.vreg == 'y':
+		cmd = zcmd(dy)
+		st.z = dy
+		st.vreg = 'z'
+	default:
+		cmd = ycmd(dy)
+		st.y = dy
+		st.vreg = 'y'
+	}
+	w.moveV(dy)
+	return w.emit(cmd)
+}
+
+func (w *Writer) moveH(dx int32) {
+	st := w.cur()
+	st.h += dx
+	if v := absI32(st.h); v > w.max.h {
+		w.max.h = v
+	}
+}
+
+func (w *Writer) moveV(dy int32) {
+	st := w.cur()
+	st.v += dy
+	if v := absI32(st.v); v > w.max.v {
+		w.max.v = v
+	}
+}
+
+// SetChar typesets the character c of the current font, and moves the
+// current position to the right by the width of the character.
+func (w *Writer) SetChar(c uint32) error {
+	if err := w.inChar("set"); err != nil {
+		return err
+	}
+	switch {
+	case c < 128:
+		return w.emit(&CmdSetChar{Value: uint8(c)})
+	case c < 1<<8:
+		return w.emit(&CmdSet1{Value: c})
+	case c < 1<<16:
+		return w.emit(&CmdSet2{Value: c})
+	case c < 1<<24:
+		return w.emit(&CmdSet3{Value: c})
+	default:
+		return w.emit(&CmdSet4{Value: int32(c)})
+	}
+}
+
+// PutChar typesets the character c of the current font, without moving
+// the current position.
+func (w *Writer) PutChar(c uint32) error {
+	if err := w.inChar("put"); err != nil {
+		return err
+	}
+	switch {
+	case c < 1<<8:
+		return w.emit(&CmdPut1{Value: c})
+	case c < 1<<16:
+		return w.emit(&CmdPut2{Value: c})
+	case c < 1<<24:
+		return w.emit(&CmdPut3{Value: c})
+	default:
+		return w.emit(&CmdPut4{Value: int32(c)})
+	}
+}
+
+func (w *Writer) inChar(name string) error {
+	if err := w.inPage(name); err != nil {
+		return err
+	}
+	if w.font < 0 {
+		return w.fail(fmt.Errorf("dvi: %s without a current font", name))
+	}
+	return nil
+}
+
+// SetRule typesets a rule of the provided height and width, with its
+// bottom left corner at the current position, and moves the current
+// position to the right by the width of the rule.
+func (w *Writer) SetRule(height, width int32) error {
+	if err := w.inPage("set_rule"); err != nil {
+		return err
+	}
+	w.rule(height, width)
+	w.moveH(width)
+	return w.emit(&CmdSetRule{Height: height, Width: width})
+}
+
+// PutRule typesets a rule of the provided height and width, with its
+// bottom left corner at the current position.
+func (w *Writer) PutRule(height, width int32) error {
+	if err := w.inPage("put_rule"); err != nil {
+		return err
+	}
+	w.rule(height, width)
+	return w.emit(&CmdPutRule{Height: height, Width: width})
+}
+
+func (w *Writer) rule(height, width int32) {
+	st := w.cur()
+	if v := absI32(st.h + width); width > 0 && v > w.max.h {
+		w.max.h = v
+	}
+	if v := absI32(st.v - height); height > 0 && v > w.max.v {
+		w.max.v = v
+	}
+}
+
+// DefineFont defines a font, to be later selected with SetFont.
+// A font may be defined several times, with the same definition.
+func (w *Writer) DefineFont(def FontDef) error {
+	if w.err != nil {
+		return w.err
+	}
+	if i, ok := w.fnts[def.ID]; ok {
+		if w.fonts[i] != def {
+			return w.fail(fmt.Errorf("dvi: font %d redefined", def.ID))
+		}
+		return nil
+	}
+	if _, ok := w.nats[def.ID]; ok {
+		return w.fail(fmt.Errorf("dvi: font %d redefined", def.ID))
+	}
+	if len(def.Area) > 255 || len(def.Name) > 255 {
+		return w.fail(fmt.Errorf("dvi: font name of font %d too long", def.ID))
+	}
+	err := w.emit(fntDefCmd(def))
+	if err != nil {
+		return err
+	}
+	w.fnts[def.ID] = len(w.fonts)
+	w.fonts = append(w.fonts, def)
+	return nil
+}
+
+// defineNativeFont defines a native font of an XDV document.
+func (w *Writer) defineNativeFont(def CmdNativeFontDef) error {
+	if w.err != nil {
+		return w.err
+	}
+	id := int(def.ID)
+	if i, ok := w.nats[id]; ok {
+		if w.nfnts[i] != def {
+			return w.fail(fmt.Errorf("dvi: font %d redefined", id))
+		}
+		return nil
+	}
+	if _, ok := w.fnts[id]; ok {
+		return w.fail(fmt.Errorf("dvi: font %d redefined", id))
+	}
+	if len(def.Font) > 255 || len(def.Family) > 255 || len(def.Style) > 255 {
+		return w.fail(fmt.Errorf("dvi: font name of font %d too long", id))
+	}
+	err := w.emit(&def)
+	if err != nil {
+		return err
+	}
+	w.nats[id] = len(w.nfnts)
+	w.nfnts = append(w.nfnts, def)
+	return nil
+}
+
+// SetFont selects the font used for the next characters.
+func (w *Writer) SetFont(id int) error {
+	if err := w.inPage("fnt"); err != nil {
+		return err
+	}
+	_, def := w.fnts[id]
+	_, nat := w.nats[id]
+	if !def && !nat {
+		return w.fail(fmt.Errorf("dvi: undefined font %d", id))
+	}
+	w.font = id
+	switch {
+	case 0 <= id && id < 64:
+		return w.emit(&CmdFntNum{ID: uint8(id)})
+	case 0 <= id && id < 1<<8:
+		return w.emit(&CmdFnt1{ID: uint32(id)})
+	case 0 <= id && id < 1<<16:
+		return w.emit(&CmdFnt2{ID: uint32(id)})
+	case 0 <= id && id < 1<<24:
+		return w.emit(&CmdFnt3{ID: uint32(id)})
+	default:
+		return w.emit(&CmdFnt4{ID: int32(id)})
+	}
+}
+
+// Special writes a special command, with the provided content.
+func (w *Writer) Special(data []byte) error {
+	if err := w.inPage("xxx"); err != nil {
+		return err
+	}
+	switch n := len(data); {
+	case n < 1<<8:
+		return w.emit(&CmdXXX1{Value: data})
+	case n < 1<<16:
+		return w.emit(&CmdXXX2{Value: data})
+	case n < 1<<24:
+		return w.emit(&CmdXXX3{Value: data})
+	default:
+		return w.emit(&CmdXXX4{Value: data})
+	}
+}
+
+// WriteCmd writes the provided command.
+//
+// Page, stack and font commands are handled like their Writer method
+// counterparts: e.g. the back-pointer of a bop command is replaced with
+// the position of the previous page.
+// Preamble and postamble commands can not be written with WriteCmd.
+func (w *Writer) WriteCmd(cmd Cmd) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	// native fonts are defined with the layout of the document.
+	if def, ok := cmd.(*CmdNativeFontDef); ok {
+		d := *def
+		d.byName = w.pre.Version == xdv5Version
+		cmd = &d
+	}
+
+	// normalize the command to its pointer form.
+	buf := new(bytes.Buffer)
+	cmd.write(iobuf.NewWriter(buf))
+	op := opCode(buf.Bytes()[0])
+	// glyph_string and text_and_glyphs share their opcode.
+	if !op.valid(w.pre.Version) || (op == opTextAndGlyphs && op.cmdOf(w.pre.Version).Name() != cmd.Name()) {
+		return w.fail(fmt.Errorf("dvi: invalid command %s for DVI id %d", cmd.Name(), w.pre.Version))
+	}
+	cmd = op.cmdOf(w.pre.Version)
+	cmd.read(iobuf.NewReader(buf.Bytes()))
+
+	switch cmd := cmd.(type) {
+	case *CmdPre, *CmdPost, *CmdPostPost:
+		return w.fail(fmt.Errorf("dvi: invalid command %s", cmd.Name()))
+	case *CmdBOP:
+		return w.BeginPage([10]int32{
+			cmd.C0, cmd.C1, cmd.C2, cmd.C3, cmd.C4,
+			cmd.C5, cmd.C6, cmd.C7, cmd.C8, cmd.C9,
+		})
+	case *CmdEOP:
+		return w.EndPage()
+	case *CmdPush:
+		return w.Push()
+	case *CmdPop:
+		return w.Pop()
+	case *CmdFntDef1:
+		return w.DefineFont(FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+	case *CmdFntDef2:
+		return w.DefineFont(FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+	case *CmdFntDef3:
+		return w.DefineFont(FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+	case *CmdFntDef4:
+		return w.DefineFont(FontDef{int(cmd.ID), cmd.Checksum, cmd.Size, cmd.Design, cmd.Area, cmd.Font})
+	case *CmdNativeFontDef:
+		return w.defineNativeFont(*cmd)
+	case *CmdNOP:
+		return w.emit(cmd)
+	}
+
+	if err := w.inPage(cmd.Name()); err != nil {
+		return err
+	}
+
+	st := w.cur()
+	switch cmd := cmd.(type) {
+	case *CmdSetChar, *CmdSet1, *CmdSet2, *CmdSet3, *CmdSet4,
+		*CmdPut1, *CmdPut2, *CmdPut3, *CmdPut4:
+		if err := w.inChar(cmd.Name()); err != nil {
+			return err
+		}
+	case *CmdSetRule:
+		w.rule(cmd.Height, cmd.Width)
+		w.moveH(cmd.Width)
+	case *CmdPutRule:
+		w.rule(cmd.Height, cmd.Width)
+	case *CmdRight1:
+		w.moveH(cmd.Value)
+	case *CmdRight2:
+		w.moveH(cmd.Value)
+	case *CmdRight3:
+		w.moveH(cmd.Value)
+	case *CmdRight4:
+		w.moveH(cmd.Value)
+	case *CmdW0:
+		w.moveH(st.w)
+	case *CmdW1:
+		st.w = cmd.Value
+		w.moveH(st.w)
+	case *CmdW2:
+		st.w = cmd.Value
+		w.moveH(st.w)
+	case *CmdW3:
+		st.w = cmd.Value
+		w.moveH(st.w)
+	case *CmdW4:
+		st.w = cmd.Value
+		w.moveH(st.w)
+	case *CmdX0:
+		w.moveH(st.x)
+	case *CmdX1:
+		st.x = cmd.Value
+		w.moveH(st.x)
+	case *CmdX2:
+		st.x = cmd.Value
+		w.moveH(st.x)
+	case *CmdX3:
+		st.x = cmd.Value
+		w.moveH(st.x)
+	case *CmdX4:
+		st.x = cmd.Value
+		w.moveH(st.x)
+	case *CmdDown1:
+		w.moveV(cmd.Value)
+	case *CmdDown2:
+		w.moveV(cmd.Value)
+	case *CmdDown3:
+		w.moveV(cmd.Value)
+	case *CmdDown4:
+		w.moveV(cmd.Value)
+	case *CmdY0:
+		w.moveV(st.y)
+	case *CmdY1:
+		st.y = cmd.Value
+		w.moveV(st.y)
+	case *CmdY2:
+		st.y = cmd.Value
+		w.moveV(st.y)
+	case *CmdY3:
+		st.y = cmd.Value
+		w.moveV(st.y)
+	case *CmdY4:
+		st.y = cmd.Value
+		w.moveV(st.y)
+	case *CmdZ0:
+		w.moveV(st.z)
+	case *CmdZ1:
+		st.z = cmd.Value
+		w.moveV(st.z)
+	case *CmdZ2:
+		st.z = cmd.Value
+		w.moveV(st.z)
+	case *CmdZ3:
+		st.z = cmd.Value
+		w.moveV(st.z)
+	case *CmdZ4:
+		st.z = cmd.Value
+		w.moveV(st.z)
+	case *CmdFntNum:
+		return w.SetFont(int(cmd.ID))
+	case *CmdFnt1:
+		return w.SetFont(int(cmd.ID))
+	case *CmdFnt2:
+		return w.SetFont(int(cmd.ID))
+	case *CmdFnt3:
+		return w.SetFont(int(cmd.ID))
+	case *CmdFnt4:
+		return w.SetFont(int(cmd.ID))
+	case *CmdXXX1, *CmdXXX2, *CmdXXX3, *CmdXXX4:
+		// ok.
+	case *CmdGlyphs:
+		if err := w.inChar(cmd.Name()); err != nil {
+			return err
+		}
+		w.moveH(cmd.Width)
+	case *CmdGlyphString:
+		if err := w.inChar(cmd.Name()); err != nil {
+			return err
+		}
+		w.moveH(cmd.Width)
+	case *CmdTextAndGlyphs:
+		if err := w.inChar(cmd.Name()); err != nil {
+			return err
+		}
+		w.moveH(cmd.Width)
+	case *CmdPicFile:
+		// ok.
+	case *CmdDir:
+		w.dir = true
+	default:
+		return w.fail(fmt.Errorf("dvi: unknown command %s", cmd.Name()))
+	}
+	return w.emit(cmd)
+}
+
+// Close writes the postamble of the document.
+// Close does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.page {
+		return w.fail(fmt.Errorf("dvi: missing eop"))
+	}
+
+	post := w.cw.n
+	err := w.emit(&CmdPost{
+		BOP:      uint32(w.bop),
+		Num:      w.pre.Num,
+		Den:      w.pre.Den,
+		Mag:      w.pre.Mag,
+		Height:   uint32(w.max.v),
+		Width:    uint32(w.max.h),
+		MaxStack: uint16(w.max.stack),
+		Pages:    uint16(w.npage),
+	})
+	if err != nil {
+		return err
+	}
+	for _, def := range w.fonts {
+		err = w.emit(fntDefCmd(def))
+		if err != nil {
+			return err
+		}
+	}
+	for i := range w.nfnts {
+		err = w.emit(&w.nfnts[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	// pTeX marks the documents with direction changes in their post_post.
+	vers := w.pre.Version
+	if w.dir && vers == dviVersion {
+		vers = ptexVersion
+	}
+
+	// the post_post command is followed by 4 to 7 bytes of padding,
+	// so the total length of the document is a multiple of 4.
+	n := 4 + (4-(w.cw.n+6)%4)%4
+	err = w.emit(&CmdPostPost{
+		BOP:     uint32(post),
+		Version: vers,
+		Trailer: uint8(n),
+	})
+	if err != nil {
+		return err
+	}
+	w.err = errWriterClosed
+	return nil
+}
+
+var errWriterClosed = errors.New("dvi: writer closed")
+
+func fntDefCmd(def FontDef) Cmd {
+	switch id := def.ID; {
+	case 0 <= id && id < 1<<8:
+		return &CmdFntDef1{uint8(id), def.Checksum, def.Size, def.Design, def.Area, def.Name}
+	case 0 <= id && id < 1<<16:
+		return &CmdFntDef2{uint16(id), def.Checksum, def.Size, def.Design, def.Area, def.Name}
+	case 0 <= id && id < 1<<24:
+		return &CmdFntDef3{uint32(id), def.Checksum, def.Size, def.Design, def.Area, def.Name}
+	default:
+		return &CmdFntDef4{int32(id), def.Checksum, def.Size, def.Design, def.Area, def.Name}
+	}
+}
+
+// wcmd returns the shortest w command for the provided value.
+func wcmd(v int32) Cmd {
+	switch sizeOf(v) {
+	case 1:
+		return &CmdW1{v}
+	case 2:
+		return &CmdW2{v}
+	case 3:
+		return &CmdW3{v}
+	default:
+		return &CmdW4{v}
+	}
+}
+
+// xcmd returns the shortest x command for the provided value.
+func xcmd(v int32) Cmd {
+	switch sizeOf(v) {
+	case 1:
+		return &CmdX1{v}
+	case 2:
+		return &CmdX2{v}
+	case 3:
+		return &CmdX3{v}
+	default:
+		return &CmdX4{v}
+	}
+}
+
+// ycmd returns the shortest y command for the provided value.
+func ycmd(v int32) Cmd {
+	switch sizeOf(v) {
+	case 1:
+		return &CmdY1{v}
+	case 2:
+		return &CmdY2{v}
+	case 3:
+		return &CmdY3{v}
+	default:
+		return &CmdY4{v}
+	}
+}
+
+// zcmd returns the shortest z command for the provided value.
+func zcmd(v int32) Cmd {
+	switch sizeOf(v) {
+	case 1:
+		return &CmdZ1{v}
+	case 2:
+		return &CmdZ2{v}
+	case 3:
+		return &CmdZ3{v}
+	default:
+		return &CmdZ4{v}
+	}
+}
+
+// sizeOf returns the number of bytes needed to encode v as a signed
+// integer.
+func sizeOf(v int32) int {
+	switch {
+	case -1<<7 <= v && v < 1<<7:
+		return 1
+	case -1<<15 <= v && v < 1<<15:
+		return 2
+	case -1<<23 <= v && v < 1<<23:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// countWriter counts the bytes written to w, and records the first
+// write error.
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
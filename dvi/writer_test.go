@@ -0,0 +1,282 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// writeDVI writes a DVI document with the provided preamble and pages,
+// with a Writer.
+func writeDVI(pre CmdPre, pages [][]Cmd) []byte {
+	var (
+		buf = new(bytes.Buffer)
+		w   = NewWriter(buf, pre)
+	)
+	for i, cmds := range pages {
+		w.BeginPage([10]int32{int32(i + 1)})
+		for _, cmd := range cmds {
+			w.WriteCmd(cmd)
+		}
+		w.EndPage()
+	}
+	err := w.Close()
+	if err != nil {
+		panic(fmt.Errorf("could not write DVI document: %w", err))
+	}
+	return buf.Bytes()
+}
+
+// writeProgram writes a DVI document with the provided preamble and pages,
+// with a Writer, and compiles it.
+func writeProgram(t *testing.T, pre CmdPre, pages [][]Cmd) Program {
+	t.Helper()
+	prog, err := Compile(writeDVI(pre, pages))
+	if err != nil {
+		t.Fatalf("could not compile DVI document: %+v", err)
+	}
+	return prog
+}
+
+func TestWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf, CmdPre{Msg: "star-tex"})
+	cmr10 := FontDef{
+		ID:       0,
+		Checksum: 0x4bf16079,
+		Size:     655360,
+		Design:   655360,
+		Name:     "cmr10",
+	}
+
+	// errors of a Writer are sticky, and reported by Close.
+	w.DefineFont(cmr10)
+	w.BeginPage([10]int32{1})
+	w.Down(1000)
+	w.SetFont(0)
+	w.SetChar('H')
+	w.Right(1000)
+	w.SetChar('i')
+	w.Right(1000)
+	w.Right(-50000)
+	w.Right(1000)
+	w.Push()
+	w.Down(1000)
+	w.Down(-1 << 20)
+	w.SetRule(10, 20)
+	w.PutChar(200)
+	w.Pop()
+	w.Special([]byte("color push Black"))
+	w.EndPage()
+	w.BeginPage([10]int32{2})
+	w.Right(1000)
+	w.DefineFont(cmr10)
+	w.EndPage()
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("could not write DVI document: %+v", err)
+	}
+
+	if n := buf.Len(); n%4 != 0 {
+		t.Fatalf("invalid DVI document length: %d", n)
+	}
+
+	var got []string
+	err = Dump(bytes.NewReader(buf.Bytes()), func(cmd Cmd) error {
+		switch cmd := cmd.(type) {
+		case *CmdBOP:
+			got = append(got, fmt.Sprintf("bop %d %d", cmd.C0, cmd.Prev))
+		case *CmdPost:
+			got = append(got, fmt.Sprintf(
+				"post %d %d %d %d %d",
+				cmd.BOP, cmd.Height, cmd.Width, cmd.MaxStack, cmd.Pages,
+			))
+		case *CmdPostPost:
+			got = append(got, fmt.Sprintf("post_post %d %d", cmd.Version, cmd.Trailer))
+		default:
+			got = append(got, cmd.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not dump DVI document: %+v", err)
+	}
+
+	want := []string{
+		"pre", "fnt_def1",
+		"bop 1 -1", "y2", "fnt_num_0", "set_char_72", "w2", "set_char_105",
+		"w0", "x3", "w0",
+		"push", "y0", "z3", "set_rule", "put1", "pop",
+		"xxx1", "eop",
+		"bop 2 44", "w2", "eop",
+		"post 141 1046586 48000 1 2", "fnt_def1", "post_post 2 6",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid DVI document:\ngot= %q\nwant=%q", got, want)
+	}
+
+	prog, err := Compile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("could not compile DVI document: %+v", err)
+	}
+	if got, want := len(prog.pages), 2; got != want {
+		t.Fatalf("invalid number of pages: got=%d, want=%d", got, want)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fn   func(w *Writer) error
+		want string
+	}{
+		{
+			name: "no-page",
+			fn:   func(w *Writer) error { return w.Right(1) },
+			want: "dvi: right outside of a page",
+		},
+		{
+			name: "no-font",
+			fn: func(w *Writer) error {
+				w.BeginPage([10]int32{})
+				return w.SetChar('a')
+			},
+			want: "dvi: set without a current font",
+		},
+		{
+			name: "undefined-font",
+			fn: func(w *Writer) error {
+				w.BeginPage([10]int32{})
+				return w.SetFont(2)
+			},
+			want: "dvi: undefined font 2",
+		},
+		{
+			name: "pop",
+			fn: func(w *Writer) error {
+				w.BeginPage([10]int32{})
+				return w.Pop()
+			},
+			want: "dvi: pop without push",
+		},
+		{
+			name: "unbalanced",
+			fn: func(w *Writer) error {
+				w.BeginPage([10]int32{})
+				w.Push()
+				return w.EndPage()
+			},
+			want: "dvi: unbalanced push/pop (depth=1)",
+		},
+		{
+			name: "missing-eop",
+			fn: func(w *Writer) error {
+				w.BeginPage([10]int32{})
+				return w.Close()
+			},
+			want: "dvi: missing eop",
+		},
+		{
+			name: "post",
+			fn:   func(w *Writer) error { return w.WriteCmd(&CmdPost{}) },
+			want: "dvi: invalid command post",
+		},
+		{
+			name: "xdv-in-dvi",
+			fn: func(w *Writer) error {
+				w.BeginPage([10]int32{})
+				return w.WriteCmd(&CmdGlyphs{Width: 1})
+			},
+			want: "dvi: invalid command glyphs for DVI id 2",
+		},
+		{
+			name: "sticky",
+			fn: func(w *Writer) error {
+				w.Pop()
+				return w.Close()
+			},
+			want: "dvi: pop outside of a page",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := NewWriter(new(bytes.Buffer), CmdPre{})
+			err := tc.fn(w)
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("invalid error:\ngot= %v\nwant=%s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, fname := range []string{
+		"../testdata/hello_golden.dvi",
+		"../testdata/pages_golden.dvi",
+		"../testdata/xcolor_golden.dvi",
+	} {
+		t.Run(fname, func(t *testing.T) {
+			raw, err := os.ReadFile(fname)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+
+			var (
+				buf  = new(bytes.Buffer)
+				w    *Writer
+				post bool
+			)
+			err = Dump(bytes.NewReader(raw), func(cmd Cmd) error {
+				switch cmd := cmd.(type) {
+				case *CmdPre:
+					w = NewWriter(buf, *cmd)
+					return nil
+				case *CmdPost:
+					post = true
+					return w.Close()
+				}
+				if post {
+					return nil
+				}
+				return w.WriteCmd(cmd)
+			})
+			if err != nil {
+				t.Fatalf("could not rewrite DVI file: %+v", err)
+			}
+
+			orig, err := Compile(raw)
+			if err != nil {
+				t.Fatalf("could not compile original DVI file: %+v", err)
+			}
+			prog, err := Compile(buf.Bytes())
+			if err != nil {
+				t.Fatalf("could not compile rewritten DVI file: %+v", err)
+			}
+
+			// pages are written verbatim.
+			if got, want := buf.Bytes()[:prog.post.BOP], raw[:orig.post.BOP]; !bytes.Equal(got, want) {
+				t.Fatalf("pages differ")
+			}
+			if got, want := prog.pages, orig.pages; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid pages:\ngot= %v\nwant=%v", got, want)
+			}
+			if got, want := prog.post.MaxStack, orig.post.MaxStack; got != want {
+				t.Fatalf("invalid max stack: got=%d, want=%d", got, want)
+			}
+			if got, want := prog.fonts, orig.fonts; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid fonts:\ngot= %v\nwant=%v", got, want)
+			}
+
+			vm := NewMachine()
+			err = vm.Run(prog)
+			if err != nil {
+				t.Fatalf("could not run rewritten DVI file: %+v", err)
+			}
+		})
+	}
+}
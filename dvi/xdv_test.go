@@ -0,0 +1,473 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dvi
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// encodeDVI encodes a DVI document with the provided preamble, post_post
+// id, postamble font definitions and pages, as is.
+// The postamble maxima are left to zero.
+// encodeDVI is used for the invalid documents a Writer refuses to write.
+func encodeDVI(pre CmdPre, post uint8, fonts []Cmd, pages [][]Cmd) []byte {
+	var (
+		buf = new(bytes.Buffer)
+		w   = iobuf.NewWriter(buf)
+		bop = int32(-1)
+	)
+	pre.write(w)
+	for i, cmds := range pages {
+		pos := int32(buf.Len())
+		CmdBOP{C0: int32(i + 1), Prev: bop}.write(w)
+		bop = pos
+		for _, cmd := range cmds {
+			cmd.write(w)
+		}
+		CmdEOP{}.write(w)
+	}
+
+	ppost := uint32(buf.Len())
+	CmdPost{
+		BOP:   uint32(bop),
+		Num:   pre.Num,
+		Den:   pre.Den,
+		Mag:   pre.Mag,
+		Pages: uint16(len(pages)),
+	}.write(w)
+	for _, cmd := range fonts {
+		cmd.write(w)
+	}
+	n := 4 + (4-(buf.Len()+6)%4)%4
+	CmdPostPost{BOP: ppost, Version: post, Trailer: uint8(n)}.write(w)
+	return buf.Bytes()
+}
+
+const xdvPt = 1 << 16
+
+// xdvDocument returns a small XDV document, using a native font and a
+// TFM font.
+func xdvDocument() []byte {
+	var (
+		pre = CmdPre{
+			Version: xdvVersion,
+			Num:     TeXNum, Den: TeXDen, Mag: TeXMag,
+			Msg: " XeTeX output 1776.07.04:1200",
+		}
+		cmr10  = &CmdFntDef1{ID: 0, Checksum: 0x4bf16079, Size: 10 * xdvPt, Design: 10 * xdvPt, Font: "cmr10"}
+		native = &CmdNativeFontDef{
+			ID:    1,
+			Size:  10 * xdvPt,
+			Flags: XDVFlagColored | XDVFlagSlant,
+			Font:  "[lmroman10-regular.otf]",
+			Color: 0xff0000ff,
+			Slant: 0x3333,
+		}
+	)
+	return writeDVI(pre, [][]Cmd{{
+		native,
+		&CmdFnt1{ID: 1},
+		&CmdDown3{Value: 20 * xdvPt},
+		&CmdRight3{Value: 10 * xdvPt},
+		&CmdGlyphs{
+			Width: 15 * xdvPt,
+			Glyphs: []Glyph{
+				{X: 0, Y: 0, ID: 42},
+				{X: 5 * xdvPt, Y: 0, ID: 43},
+			},
+		},
+		&CmdTextAndGlyphs{
+			Text:  "Hé",
+			Width: 12 * xdvPt,
+			Glyphs: []Glyph{
+				{X: 0, Y: 0, ID: 44},
+				{X: 6 * xdvPt, Y: -xdvPt, ID: 45},
+			},
+		},
+		&CmdPush{},
+		&CmdPicFile{
+			Matrix: [6]int32{1 << 16, 0, 0, 1 << 16, 0, 0},
+			Page:   1,
+			Path:   "fig.pdf",
+		},
+		&CmdPop{},
+		cmr10,
+		&CmdFntNum{ID: 0},
+		&CmdSetChar{Value: 'A'},
+	}})
+}
+
+type xdvItem struct {
+	x, y  int32
+	font  string
+	glyph rune
+	c     color.Color
+}
+
+// xdvRecorder records the glyphs, pictures and directions drawn by a
+// Machine.
+type xdvRecorder struct {
+	glyphs []xdvItem
+	pics   []xdvItem
+	dirs   []Dir
+	rules  [][4]int32
+	fonts  []Font
+}
+
+func (rec *xdvRecorder) BOP(bop *CmdBOP) {}
+func (rec *xdvRecorder) EOP()            {}
+
+func (rec *xdvRecorder) DrawGlyph(x, y int32, font Font, glyph rune, c color.Color) {
+	rec.glyphs = append(rec.glyphs, xdvItem{x, y, font.Name(), glyph, c})
+	rec.fonts = append(rec.fonts, font)
+}
+
+func (rec *xdvRecorder) DrawRule(x, y, w, h int32, c color.Color) {
+	rec.rules = append(rec.rules, [4]int32{x, y, w, h})
+}
+
+func (rec *xdvRecorder) DrawNativeGlyph(x, y int32, font *CmdNativeFontDef, glyph uint16, c color.Color) {
+	rec.glyphs = append(rec.glyphs, xdvItem{x, y, font.Font, rune(glyph), c})
+}
+
+func (rec *xdvRecorder) DrawPicFile(x, y int32, pic *CmdPicFile) {
+	rec.pics = append(rec.pics, xdvItem{x: x, y: y, font: pic.Path})
+}
+
+func (rec *xdvRecorder) Dir(d Dir) {
+	rec.dirs = append(rec.dirs, d)
+}
+
+func TestXDV(t *testing.T) {
+	prog, err := Compile(xdvDocument())
+	if err != nil {
+		t.Fatalf("could not compile XDV document: %+v", err)
+	}
+
+	if got, want := prog.Fonts(), []FontDef{
+		{ID: 0, Checksum: 0x4bf16079, Size: 10 * xdvPt, Design: 10 * xdvPt, Name: "cmr10"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid fonts:\ngot= %+v\nwant=%+v", got, want)
+	}
+	if got, want := prog.NativeFonts(), []CmdNativeFontDef{{
+		ID:    1,
+		Size:  10 * xdvPt,
+		Flags: XDVFlagColored | XDVFlagSlant,
+		Font:  "[lmroman10-regular.otf]",
+		Color: 0xff0000ff,
+		Slant: 0x3333,
+	}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid native fonts:\ngot= %+v\nwant=%+v", got, want)
+	}
+
+	rec := new(xdvRecorder)
+	vm := NewMachine(WithRenderer(rec))
+	err = vm.Run(prog)
+	if err != nil {
+		t.Fatalf("could not run XDV document: %+v", err)
+	}
+
+	const otf = "[lmroman10-regular.otf]"
+	if got, want := rec.glyphs, []xdvItem{
+		{10 * xdvPt, 20 * xdvPt, otf, 42, color.Black},
+		{15 * xdvPt, 20 * xdvPt, otf, 43, color.Black},
+		{25 * xdvPt, 20 * xdvPt, otf, 44, color.Black},
+		{31 * xdvPt, 19 * xdvPt, otf, 45, color.Black},
+		{37 * xdvPt, 20 * xdvPt, "cmr10", 'A', color.Black},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid glyphs:\ngot= %v\nwant=%v", got, want)
+	}
+	if got, want := rec.pics, []xdvItem{
+		{x: 37 * xdvPt, y: 20 * xdvPt, font: "fig.pdf"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid pictures:\ngot= %v\nwant=%v", got, want)
+	}
+}
+
+func TestXDVOlder(t *testing.T) {
+	for _, tc := range []struct {
+		version uint8
+		native  CmdNativeFontDef
+	}{
+		{
+			version: xdv5Version,
+			native: CmdNativeFontDef{
+				ID:     1,
+				Size:   10 * xdvPt,
+				Flags:  XDVFlagColored | XDVFlagVariations | XDVFlagSlant,
+				Font:   "LMRoman10-Regular",
+				Family: "Latin Modern Roman",
+				Style:  "Regular",
+				Color:  0xff0000ff,
+				Slant:  0x3333,
+				byName: true,
+				vars:   "\x00\x00",
+			},
+		},
+		{
+			version: xdv6Version,
+			native: CmdNativeFontDef{
+				ID:    1,
+				Size:  10 * xdvPt,
+				Flags: XDVFlagColored,
+				Font:  "[lmroman10-regular.otf]",
+				Index: 2,
+				Color: 0xff0000ff,
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("xdv-%d", tc.version), func(t *testing.T) {
+			native := tc.native
+			native.byName = false // set by the Writer.
+			native.vars = ""
+			raw := writeDVI(CmdPre{Version: tc.version, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, [][]Cmd{{
+				&native,
+				&CmdFnt1{ID: 1},
+				&CmdDown3{Value: 20 * xdvPt},
+				&CmdGlyphs{
+					Width:  5 * xdvPt,
+					Glyphs: []Glyph{{X: 0, Y: -xdvPt, ID: 41}},
+				},
+				&CmdGlyphString{
+					Width: 15 * xdvPt,
+					Glyphs: []Glyph{
+						{X: 0, ID: 42},
+						{X: 5 * xdvPt, ID: 43},
+					},
+				},
+			}})
+
+			prog, err := Compile(raw)
+			if err != nil {
+				t.Fatalf("could not compile XDV document: %+v", err)
+			}
+			if got, want := prog.NativeFonts(), []CmdNativeFontDef{tc.native}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid native fonts:\ngot= %+v\nwant=%+v", got, want)
+			}
+
+			rec := new(xdvRecorder)
+			vm := NewMachine(WithRenderer(rec))
+			err = vm.Run(prog)
+			if err != nil {
+				t.Fatalf("could not run XDV document: %+v", err)
+			}
+			font := tc.native.Font
+			if got, want := rec.glyphs, []xdvItem{
+				{0, 19 * xdvPt, font, 41, color.Black},
+				{5 * xdvPt, 20 * xdvPt, font, 42, color.Black},
+				{10 * xdvPt, 20 * xdvPt, font, 43, color.Black},
+			}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("invalid glyphs:\ngot= %v\nwant=%v", got, want)
+			}
+
+			_, cmds, err := prog.Page(0)
+			if err != nil {
+				t.Fatalf("could not read page: %+v", err)
+			}
+			pr, err := NewPageReader(bytes.NewReader(raw), int64(len(raw)))
+			if err != nil {
+				t.Fatalf("could not create page reader: %+v", err)
+			}
+			var (
+				dec  = pr.Page(0)
+				page []Cmd
+			)
+			for {
+				cmd, err := dec.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("could not decode XDV document: %+v", err)
+				}
+				switch cmd.(type) {
+				case *CmdBOP, *CmdEOP:
+					continue
+				}
+				page = append(page, cmd)
+			}
+			if !reflect.DeepEqual(page, cmds) {
+				t.Fatalf("invalid decoded page:\ngot= %v\nwant=%v", page, cmds)
+			}
+
+			probs, err := Validate(raw)
+			if err != nil {
+				t.Fatalf("could not validate XDV document: %+v", err)
+			}
+			if len(probs) != 0 {
+				t.Fatalf("invalid XDV document: %v", probs)
+			}
+		})
+	}
+}
+
+func TestXDVErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{
+			name: "glyphs-in-dvi",
+			raw: encodeDVI(CmdPre{Version: dviVersion, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, dviVersion, nil, [][]Cmd{{
+				&CmdGlyphs{Width: 1},
+			}}),
+			want: "dvi: unknown opcode 253 inside a page",
+		},
+		{
+			name: "glyphs-without-native-font",
+			raw: encodeDVI(CmdPre{Version: 7, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, 7, nil, [][]Cmd{{
+				&CmdGlyphs{Width: 1},
+			}}),
+			want: `dvi: could not process page 1: could not glyphs: dvi: current font "" is not a native font`,
+		},
+		{
+			name: "char-of-native-font",
+			raw: encodeDVI(CmdPre{Version: 7, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, 7, nil, [][]Cmd{{
+				&CmdNativeFontDef{ID: 1, Size: xdvPt, Font: "otf"},
+				&CmdFntNum{ID: 1},
+				&CmdSetChar{Value: 'a'},
+			}}),
+			want: `dvi: could not process page 1: could not set char 'a': dvi: can not set character 97 of native font "otf"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prog, err := Compile(tc.raw)
+			if err != nil {
+				t.Fatalf("could not compile document: %+v", err)
+			}
+			_, _, err = prog.Page(0)
+			if err == nil {
+				vm := NewMachine()
+				err = vm.Run(prog)
+			}
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("invalid error:\ngot= %v\nwant=%s", err, tc.want)
+			}
+		})
+	}
+
+	for _, version := range []uint8{1, 4, 8} {
+		raw := encodeDVI(CmdPre{Version: version, Num: TeXNum, Den: TeXDen, Mag: TeXMag}, version, nil, nil)
+		_, err := Compile(raw)
+		if err != errInvalidVersion {
+			t.Fatalf("invalid error for version %d: %+v", version, err)
+		}
+	}
+
+	// text_and_glyphs commands do not exist in older XDV documents.
+	w := NewWriter(new(bytes.Buffer), CmdPre{Version: xdv6Version, Num: TeXNum, Den: TeXDen, Mag: TeXMag})
+	w.BeginPage([10]int32{1})
+	err := w.WriteCmd(&CmdTextAndGlyphs{Text: "a"})
+	if got, want := fmt.Sprint(err), "dvi: invalid command text_and_glyphs for DVI id 6"; got != want {
+		t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+	}
+
+	// XDV documents can not be rewritten.
+	prog, err := Compile(xdvDocument())
+	if err != nil {
+		t.Fatalf("could not compile XDV document: %+v", err)
+	}
+	err = Select(new(bytes.Buffer), prog, []int{0})
+	if err == nil {
+		t.Fatalf("expected an error selecting pages of an XDV document")
+	}
+}
+
+func TestXDVCorrupted(t *testing.T) {
+	var (
+		raw    = xdvDocument()
+		glyphs = -1
+		native = -1 // native font definition of the postamble.
+		dec    = NewDecoder(bytes.NewReader(raw))
+	)
+	for {
+		pos := int(dec.Pos())
+		cmd, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not decode XDV document: %+v", err)
+		}
+		switch cmd.(type) {
+		case *CmdGlyphs:
+			glyphs = pos
+		case *CmdNativeFontDef:
+			native = pos
+		}
+	}
+	corrupt := func(pos int, vs ...byte) []byte {
+		raw := append([]byte(nil), raw...)
+		copy(raw[pos:], vs)
+		return raw
+	}
+
+	pre := CmdPre{Version: dviVersion, Num: TeXNum, Den: TeXDen, Mag: TeXMag}
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{
+			name: "glyphs-count",
+			raw:  corrupt(glyphs+5, 0xff, 0xff),
+			want: "dvi: could not process page 1: dvi: could not read glyphs: unexpected EOF",
+		},
+		{
+			name: "native-font-name",
+			raw:  corrupt(native+11, 0xff),
+			want: "dvi: could not read postamble native_font_def: unexpected EOF",
+		},
+		{
+			name: "dir-pop",
+			raw: encodeDVI(pre, ptexVersion, nil, [][]Cmd{{
+				&CmdDir{Dir: DirVertical},
+				&CmdPop{},
+			}}),
+			want: "dvi: could not process page 1: dvi: unbalanced push/pop",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prog, err := Compile(tc.raw)
+			if err == nil {
+				vm := NewMachine()
+				err = vm.Run(prog)
+			}
+			if got := fmt.Sprint(err); got != tc.want {
+				t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtTestdata(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{"../testdata/ptex.dvi", ptexDocument()},
+		{"../testdata/xdv.dvi", xdvDocument()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := os.ReadFile(tc.name)
+			if err != nil {
+				t.Fatalf("could not read DVI file: %+v", err)
+			}
+			if !bytes.Equal(raw, tc.raw) {
+				_ = os.WriteFile(tc.name+".new", tc.raw, 0644)
+				t.Fatalf("DVI file %q is out of date", tc.name)
+			}
+		})
+	}
+}
@@ -8,12 +8,21 @@ import (
 	"io"
 
 	"star-tex.org/x/tex/internal/xtex"
+	"star-tex.org/x/tex/kpath"
 )
 
 const (
 	defaultJobname = "output"
 )
 
+// OutputFormat describes the format of the documents produced by an Engine.
+type OutputFormat int
+
+const (
+	DVI OutputFormat = iota // DVI documents.
+	PDF                     // PDF documents, with pdfTeX primitives.
+)
+
 // Engine is a TeX engine.
 type Engine struct {
 	stdin  io.ReadCloser
@@ -22,6 +31,34 @@ type Engine struct {
 	// Jobname used for TeX output.
 	// Default is "output".
 	Jobname string
+
+	// Output is the format of the compiled documents.
+	// Default is DVI.
+	Output OutputFormat
+
+	// Fonts is the TeX directory structure used to locate the Type1 fonts
+	// embedded in PDF documents.
+	// Default is kpath.New().
+	Fonts kpath.Context
+
+	// Shell runs the commands written to the \write18 stream.
+	// Default is nil: the shell escape is disabled.
+	Shell Executor
+
+	// ReadPolicy decides which files documents may read.
+	// Default is AnyFile, like openin_any = a.
+	ReadPolicy FilePolicy
+
+	// WritePolicy decides which files documents may write.
+	// Default is ParanoidFile, like openout_any = p.
+	WritePolicy FilePolicy
+
+	// Limits holds the resource quotas of the jobs.
+	// Jobs exceeding a quota are stopped with a *QuotaError.
+	// Default is no limit.
+	Limits Limits
+
+	prims []primitive // primitives implemented in Go
 }
 
 // NewEngine creates a new TeX engine connected to the provided
@@ -43,7 +80,34 @@ func (engine *Engine) Process(w io.Writer, r io.Reader) error {
 	}
 
 	ctx := xtex.New(engine.stdout, engine.stdin)
-	return ctx.Process(writerCloser(w), r, jobname)
+	if engine.Output == PDF {
+		ctx.SetOutputPDF(true)
+		ctx.SetFonts(engine.Fonts)
+	}
+	if engine.Shell != nil {
+		ctx.SetShell(engine.shellMode(), engine.Shell.Exec)
+	}
+	var (
+		rpolicy = engine.ReadPolicy
+		wpolicy = engine.WritePolicy
+	)
+	if rpolicy == nil {
+		rpolicy = AnyFile
+	}
+	if wpolicy == nil {
+		wpolicy = ParanoidFile
+	}
+	ctx.SetFilePolicy(rpolicy, wpolicy)
+	engine.Limits.set(ctx)
+
+	for _, prim := range engine.prims {
+		ctx.Define(prim.xtex())
+	}
+	err := ctx.Process(writerCloser(w), r, jobname)
+	if err != nil {
+		return quotaError(err)
+	}
+	return nil
 }
 
 func writerCloser(w io.Writer) io.WriteCloser {
@@ -0,0 +1,74 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FilePolicy reports whether a TeX document may open the named file.
+//
+// Names are the ones computed by TeX, e.g. "story.tex" or "/etc/passwd",
+// relative to the working directory of the engine.
+// Documents trying to open a forbidden file get a TeX error, and the
+// file is left untouched.
+type FilePolicy func(name string) bool
+
+// File access policies equivalent to the openin_any and openout_any
+// settings of kpathsea.
+var (
+	// AnyFile allows any file (openin_any = a).
+	AnyFile FilePolicy = func(string) bool { return true }
+
+	// RestrictedFile forbids dot files (openin_any = r).
+	RestrictedFile FilePolicy = restrictedFile
+
+	// ParanoidFile forbids dot files, absolute paths and paths going to
+	// a parent directory (openin_any = p).
+	ParanoidFile FilePolicy = paranoidFile
+)
+
+// ParseFilePolicy returns the file access policy for the provided
+// kpathsea openin_any/openout_any value.
+func ParseFilePolicy(mode string) (FilePolicy, error) {
+	switch mode {
+	case "a", "y", "1":
+		return AnyFile, nil
+	case "r", "n", "0":
+		return RestrictedFile, nil
+	case "p":
+		return ParanoidFile, nil
+	default:
+		return nil, fmt.Errorf("tex: invalid file access policy %q", mode)
+	}
+}
+
+func restrictedFile(name string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(name), "/") {
+		if strings.HasPrefix(elem, ".") && elem != "." && elem != ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func paranoidFile(name string) bool {
+	if !restrictedFile(name) {
+		return false
+	}
+	name = filepath.ToSlash(name)
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ok   []string
+		deny []string
+	}{
+		{
+			name: "a",
+			ok:   []string{"x.tex", ".x.tex", "../x.tex", "/etc/passwd"},
+		},
+		{
+			name: "r",
+			ok:   []string{"x.tex", "./x.tex", "../x.tex", "/etc/passwd"},
+			deny: []string{".x.tex", "dir/.x.tex", ".dir/x.tex"},
+		},
+		{
+			name: "p",
+			ok:   []string{"x.tex", "./x.tex", "dir/x.tex"},
+			deny: []string{".x.tex", "dir/.x.tex", "../x.tex", "dir/../../x.tex", "/etc/passwd"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := ParseFilePolicy(tc.name)
+			if err != nil {
+				t.Fatalf("could not parse policy: %+v", err)
+			}
+			for _, name := range tc.ok {
+				if !policy(name) {
+					t.Errorf("%q should be allowed", name)
+				}
+			}
+			for _, name := range tc.deny {
+				if policy(name) {
+					t.Errorf("%q should be denied", name)
+				}
+			}
+		})
+	}
+
+	_, err := ParseFilePolicy("x")
+	if err == nil || err.Error() != `tex: invalid file access policy "x"` {
+		t.Fatalf("invalid error: %v", err)
+	}
+}
+
+func TestEngineFilePolicy(t *testing.T) {
+	// TeX file names are limited to 40 characters.
+	tmp, err := os.MkdirTemp("", "tex-")
+	if err != nil {
+		t.Fatalf("could not create tmp dir: %+v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fname := filepath.ToSlash(filepath.Join(tmp, "out.txt"))
+	doc := `
+\openin2=/etc/passwd
+\message{[\ifeof2 eof\else open\fi]}
+\openin3=.secret
+\immediate\openout1=` + fname + `
+\immediate\write1{hello}
+\immediate\closeout1
+\bye
+`
+
+	for _, tc := range []struct {
+		name   string
+		read   FilePolicy
+		write  FilePolicy
+		output bool // whether the output file is written
+		want   []string
+	}{
+		{
+			name: "default",
+			want: []string{
+				"! Not writing to `" + fname,
+			},
+		},
+		{
+			name:   "any",
+			write:  AnyFile,
+			output: true,
+		},
+		{
+			name: "paranoid",
+			read: ParanoidFile,
+			want: []string{
+				"! Not writing to `" + fname,
+				"! Not reading from `/etc/passwd.tex' (forbidden by the file access policy).",
+				"[eof]",
+				"! Not reading from `.secret' (forbidden by the file access policy).",
+			},
+		},
+		{
+			name: "custom",
+			read: func(name string) bool { return name != ".secret" },
+			write: func(name string) bool {
+				return strings.HasSuffix(name, ".txt")
+			},
+			output: true,
+			want: []string{
+				"! Not reading from `.secret' (forbidden by the file access policy).",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(fname)
+
+			stdout := new(bytes.Buffer)
+			engine := NewEngine(stdout, strings.NewReader(""))
+			engine.ReadPolicy = tc.read
+			engine.WritePolicy = tc.write
+
+			// forbidden output files abort the job, as TeX can not prompt
+			// for another file name in nonstop mode.
+			err := engine.Process(io.Discard, strings.NewReader(doc))
+			if got, want := err == nil, tc.output; got != want {
+				t.Fatalf("invalid error: %+v", err)
+			}
+
+			_, err = os.Stat(fname)
+			if got, want := err == nil, tc.output; got != want {
+				t.Fatalf("invalid output file: got=%v, want=%v (err=%v)", got, want, err)
+			}
+
+			out := stdout.String()
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in output:\n%s", want, out)
+				}
+			}
+			if len(tc.want) == 0 && strings.Contains(out, "file access policy") {
+				t.Errorf("unexpected file access error:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MarshalText implements encoding.TextMarshaler.
+//
+// The textual representation of a GF font follows the output of the
+// gftype program of TeX Live, without its banner, and without mnemonic
+// and pixel outputs.
+func (fnt *Font) MarshalText() ([]byte, error) {
+	o := new(bytes.Buffer)
+	err := fnt.WriteText(o, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return o.Bytes(), nil
+}
+
+// WriteText writes the textual representation of the font to w.
+// mnemonics and images enable the mnemonic and pixel outputs of gftype,
+// that describe the commands and the bitmap of each character.
+func (fnt *Font) WriteText(w io.Writer, mnemonics, images bool) error {
+	te := newTextEncoder(w)
+	te.mnemonics = mnemonics
+	te.images = images
+	return te.encode(fnt)
+}
+
+type textEncoder struct {
+	w io.Writer
+
+	mnemonics bool // whether to print the commands of characters.
+	images    bool // whether to print the bitmaps of characters.
+}
+
+func newTextEncoder(w io.Writer) *textEncoder {
+	return &textEncoder{w: w}
+}
+
+func (te *textEncoder) printf(format string, args ...interface{}) {
+	fmt.Fprintf(te.w, format, args...)
+}
+
+func (te *textEncoder) encode(fnt *Font) error {
+	te.printf("'%s'\n", fnt.comment)
+
+	for _, cmd := range fnt.cmds {
+		switch {
+		case cmd.char >= 0:
+			err := te.encodeGlyph(&fnt.glyphs[cmd.char])
+			if err != nil {
+				return err
+			}
+		case cmd.spec >= 0:
+			te.special(cmd.pos, fnt.specials[cmd.spec])
+		case cmd.op == opNoOp && te.mnemonics:
+			te.printf("%d: no op\n", cmd.pos)
+		}
+	}
+
+	te.printf("%d: beginning of the postamble\n", fnt.post)
+	te.printf(" design size = %d (%spt)\n", int32(fnt.design), scaled(int32(fnt.design)>>4))
+	te.printf(" check sum = %d\n", int32(fnt.checksum))
+	te.printf(" hppp = %d (%s)\n", int32(fnt.hppp), scaled(int32(fnt.hppp)))
+	te.printf(" vppp = %d (%s)\n", int32(fnt.vppp), scaled(int32(fnt.vppp)))
+	if fnt.hppp != fnt.vppp {
+		te.printf("Warning:  aspect ratio not 1:1!\n")
+	}
+	te.printf(" min m = %d, max m = %d\n", fnt.bounds[0], fnt.bounds[1])
+	te.printf(" min n = %d, max n = %d\n", fnt.bounds[2], fnt.bounds[3])
+	for _, i := range fnt.locs {
+		g := &fnt.glyphs[i]
+		te.printf(" Character %d: dx %d", g.code&0xff, int32(g.dx))
+		if g.dx&0xffff == 0 {
+			te.printf(" (%d)", int32(g.dx)>>16)
+		}
+		if g.dy != 0 {
+			te.printf(", dy %d", int32(g.dy))
+			if g.dy&0xffff == 0 {
+				te.printf(" (%d)", int32(g.dy)>>16)
+			}
+		}
+		width := int64(g.wd) * int64(fnt.design) >> 24 // in scaled points.
+		te.printf(", width %d (%spt)", int32(g.wd), scaled(int32(width)))
+		if g.pos >= 0 {
+			te.printf(", loc %d", g.pos)
+		}
+		te.printf("\n")
+	}
+	te.printf("The file had %d character%s altogether.\n", len(fnt.locs), plural(len(fnt.locs)))
+	return nil
+}
+
+func (te *textEncoder) encodeGlyph(g *Glyph) error {
+	minM, maxM, minN, maxN := g.Bounds()
+	te.printf(
+		"%d: beginning of char %d: %d<=m<=%d %d<=n<=%d\n",
+		g.pos, g.code, minM, maxM, minN, maxN,
+	)
+	if !te.mnemonics {
+		_, n, err := g.paint(func(st step) {
+			if st.op >= opXXX1 && st.op <= opYYY {
+				te.special(st.pos, st.spec())
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("could not decode character %d: %w", g.code, err)
+		}
+		te.printf("%d: eoc\n", g.pos+g.hdr+n-1)
+		if te.images {
+			te.image(g)
+		}
+		return nil
+	}
+
+	te.printf("(initially n=%d) paint", maxN)
+	var (
+		line = true // whether a paint line is being written.
+		draw = false
+	)
+	_, _, err := g.paint(func(st step) {
+		switch {
+		case st.op <= opPaint3:
+			if !line {
+				te.printf("%d: paint", st.pos)
+				line = true
+			}
+			switch {
+			case draw:
+				te.printf(" %d", st.v)
+			default:
+				te.printf(" (%d)", st.v)
+			}
+			draw = !draw
+			return
+		}
+
+		if line {
+			te.printf("\n")
+			line = false
+		}
+		switch {
+		case st.op == opEOC:
+			te.printf("%d: eoc\n", st.pos)
+		case st.op == opSkip0:
+			te.printf("%d: skip0 (n=%d)\n", st.pos, st.n)
+			draw = false
+		case st.op <= opSkip3:
+			te.printf("%d: skip%d %d (n=%d)\n", st.pos, st.op-opSkip0, st.v, st.n)
+			draw = false
+		case st.op <= opNewRow:
+			te.printf("%d: newrow %d (n=%d) paint", st.pos, st.v, st.n)
+			line = true
+			draw = true
+		case st.op <= opYYY:
+			te.special(st.pos, st.spec())
+		case st.op == opNoOp:
+			te.printf("%d: no op\n", st.pos)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("could not decode character %d: %w", g.code, err)
+	}
+
+	if te.images {
+		te.image(g)
+	}
+	return nil
+}
+
+// image prints the bitmap of the glyph, with trailing blank columns
+// removed.
+func (te *textEncoder) image(g *Glyph) {
+	minM, _, _, maxN := g.Bounds()
+	var (
+		mask = g.mask
+		w    = mask.Rect.Dx()
+		rows []string
+	)
+	for y := 0; y < mask.Rect.Dy(); y++ {
+		row := []byte(strings.Repeat(" ", w))
+		for x := range row {
+			if mask.Pix[y*mask.Stride+x] != 0 {
+				row[x] = '*'
+			}
+		}
+		rows = append(rows, strings.TrimRight(string(row), " "))
+	}
+	// remove trailing blank rows.
+	for len(rows) > 0 && rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+	if len(rows) == 0 {
+		te.printf("(The character is entirely blank)\n")
+		return
+	}
+	te.printf(".<--This pixel's lower left corner is at (%d,%d) in METAFONT coordinates\n", minM, maxN+1)
+	for _, row := range rows {
+		te.printf("%s\n", row)
+	}
+	te.printf("'<--This pixel's upper left corner is at (%d,%d) in METAFONT coordinates\n", minM, maxN-int32(len(rows))+1)
+}
+
+func (te *textEncoder) special(pos int, spec Special) {
+	switch {
+	case spec.Numeric:
+		te.printf("%d: yyy %d (%s)\n", pos, spec.Value, scaled(spec.Value))
+	default:
+		te.printf("%d: xxx '%s'\n", pos, spec.Data)
+	}
+}
+
+// scaled formats the provided 16.16 fixed-point number with the least
+// number of decimal digits that round back to it, as TeX does.
+func scaled(v int32) string {
+	const unity = 1 << 16
+	var (
+		o = new(strings.Builder)
+		s = int64(v)
+	)
+	if s < 0 {
+		o.WriteByte('-')
+		s = -s
+	}
+	fmt.Fprintf(o, "%d", s/unity)
+	s = 10*(s%unity) + 5
+	if s == 5 {
+		return o.String()
+	}
+	o.WriteByte('.')
+	delta := int64(10)
+	for {
+		if delta > unity {
+			s += 0x8000 - 50000 // round the last digit.
+		}
+		o.WriteByte(byte('0' + s/unity))
+		s = 10 * (s % unity)
+		delta *= 10
+		if s <= delta {
+			break
+		}
+	}
+	return o.String()
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
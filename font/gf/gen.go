@@ -0,0 +1,209 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build ignore
+// +build ignore
+
+// gen generates testdata/cmr10.gf from the bitmaps of the
+// ../pk/testdata/cmr10.pk font, painting rows as METAFONT does.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+
+	"star-tex.org/x/tex/font/pk"
+)
+
+func main() {
+	f, err := os.Open("../pk/testdata/cmr10.pk")
+	if err != nil {
+		log.Fatalf("could not open PK file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := pk.Parse(f)
+	if err != nil {
+		log.Fatalf("could not parse PK file: %+v", err)
+	}
+
+	var (
+		o    = new(bytes.Buffer)
+		u8   = func(v uint8) { o.WriteByte(v) }
+		i32  = func(v int32) { _ = binary.Write(o, binary.BigEndian, v) }
+		bocs = make(map[rune]int32)
+		eoc  = int32(-1)
+		bbox = [4]int32{1 << 30, -1 << 30, 1 << 30, -1 << 30}
+	)
+	u8(247)
+	u8(131)
+	u8(uint8(len(fnt.Comment())))
+	o.WriteString(fnt.Comment())
+
+	for _, g := range fnt.Glyphs() {
+		var (
+			mask       = g.Mask()
+			w, h       = int32(mask.Rect.Dx()), int32(mask.Rect.Dy())
+			hoff, voff = g.Offset()
+			minM, maxM = -hoff, -hoff + w - 1
+			minN, maxN = voff - h + 1, voff
+		)
+		bbox[0] = min(bbox[0], minM)
+		bbox[1] = max(bbox[1], maxM)
+		bbox[2] = min(bbox[2], minN)
+		bbox[3] = max(bbox[3], maxN)
+
+		bocs[g.Code()] = int32(o.Len())
+		if c, dm, dn := g.Code(), maxM-minM, maxN-minN; c < 256 && 0 <= minM && maxM < 256 && 0 <= minN && maxN < 256 {
+			u8(68)
+			u8(uint8(c))
+			u8(uint8(dm))
+			u8(uint8(maxM))
+			u8(uint8(dn))
+			u8(uint8(maxN))
+		} else {
+			u8(67)
+			i32(int32(c))
+			i32(-1)
+			i32(minM)
+			i32(maxM)
+			i32(minN)
+			i32(maxN)
+		}
+
+		paint := func(d int) {
+			switch {
+			case d < 64:
+				u8(uint8(d))
+			case d < 1<<8:
+				u8(64)
+				u8(uint8(d))
+			case d < 1<<16:
+				u8(65)
+				_ = binary.Write(o, binary.BigEndian, uint16(d))
+			default:
+				u8(66)
+				u8(uint8(d >> 16))
+				_ = binary.Write(o, binary.BigEndian, uint16(d))
+			}
+		}
+
+		var (
+			first = true
+			blank = 0
+		)
+		for y := 0; y < int(h); y++ {
+			row := mask.Pix[y*mask.Stride : y*mask.Stride+int(w)]
+			last := bytes.LastIndexByte(row, 0xff)
+			if last < 0 {
+				blank++
+				continue
+			}
+			x := bytes.IndexByte(row, 0xff)
+			switch {
+			case first:
+				for i := 0; i < blank; i++ {
+					// rows above the first painted row.
+					u8(70)
+				}
+				paint(x)
+			case blank == 0 && x <= 164:
+				u8(uint8(74 + x))
+			case blank == 0:
+				u8(70)
+				paint(x)
+			default:
+				if blank < 1<<8 {
+					u8(71)
+					u8(uint8(blank))
+				} else {
+					u8(72)
+					_ = binary.Write(o, binary.BigEndian, uint16(blank))
+				}
+				paint(x)
+			}
+			first = false
+			blank = 0
+
+			black := true
+			for x <= last {
+				n := 0
+				for x+n <= last && (row[x+n] == 0xff) == black {
+					n++
+				}
+				paint(n)
+				x += n
+				black = !black
+			}
+		}
+		eoc = int32(o.Len())
+		u8(69)
+	}
+
+	for _, spec := range fnt.Specials() {
+		if spec.Numeric {
+			u8(243)
+			i32(spec.Value)
+			continue
+		}
+		u8(239)
+		u8(uint8(len(spec.Data)))
+		o.Write(spec.Data)
+	}
+
+	post := int32(o.Len())
+	hppp, vppp := fnt.PixelsPerPoint()
+	u8(248)
+	i32(eoc)
+	i32(int32(fnt.DesignSize()))
+	i32(int32(fnt.Checksum()))
+	i32(int32(hppp))
+	i32(int32(vppp))
+	for _, v := range bbox {
+		i32(v)
+	}
+	for _, g := range fnt.Glyphs() {
+		dx, dy := g.Escapement()
+		switch {
+		case dy == 0 && dx&0xffff == 0 && 0 <= dx && dx < 256<<16:
+			u8(246)
+			u8(uint8(g.Code()))
+			u8(uint8(dx >> 16))
+		default:
+			u8(245)
+			u8(uint8(g.Code()))
+			i32(int32(dx))
+			i32(int32(dy))
+		}
+		i32(int32(g.Width()))
+		i32(bocs[g.Code()])
+	}
+	u8(249)
+	i32(post)
+	u8(131)
+	for i := 0; i < 4 || o.Len()%4 != 0; i++ {
+		u8(223)
+	}
+
+	err = os.WriteFile("testdata/cmr10.gf", o.Bytes(), 0644)
+	if err != nil {
+		log.Fatalf("could not write GF file: %+v", err)
+	}
+}
+
+func min(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
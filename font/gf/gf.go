@@ -0,0 +1,212 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gf implements a decoder for GF (generic font) files.
+//
+// More informations about the GF format can be found in the gftype
+// program of TeX Live.
+package gf // import "star-tex.org/x/tex/font/gf"
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// Font is a GF font.
+type Font struct {
+	comment  string
+	design   fixed.Int12_20
+	checksum uint32
+	hppp     fixed.Int16_16
+	vppp     fixed.Int16_16
+	bounds   [4]int32 // min_m, max_m, min_n, max_n of the postamble.
+
+	glyphs   []Glyph
+	index    map[rune]int
+	specials []Special
+
+	cmds []command // commands, in file order.
+	locs []int     // glyphs, in postamble order.
+	post int       // position of the postamble.
+}
+
+// Glyph is a character of a GF font.
+type Glyph struct {
+	code   rune
+	wd     fixed.Int12_20
+	dx, dy fixed.Int16_16
+	bounds [4]int32 // min_m, max_m, min_n, max_n of the character.
+	mask   *image.Alpha
+
+	pos    int    // position of the boc command, or -1.
+	loc    int    // position of the char_loc command.
+	hdr    int    // size of the boc command.
+	raster []byte // commands of the character, up to its eoc.
+}
+
+// Special is a GF special command: either a xxx command holding a
+// string, or a yyy command holding a number.
+type Special struct {
+	Data    []byte // payload of a xxx special.
+	Value   int32  // value of a yyy special.
+	Numeric bool   // whether the special is a yyy special.
+}
+
+type command struct {
+	pos  int
+	op   uint8
+	spec int // index of the special.
+	char int // index of the glyph.
+}
+
+const (
+	opPaint1   = 64
+	opPaint3   = 66
+	opBOC      = 67
+	opBOC1     = 68
+	opEOC      = 69
+	opSkip0    = 70
+	opSkip1    = 71
+	opSkip3    = 73
+	opNewRow0  = 74
+	opNewRow   = 238 // new_row_164
+	opXXX1     = 239
+	opXXX4     = 242
+	opYYY      = 243
+	opNoOp     = 244
+	opCharLoc  = 245
+	opCharLoc0 = 246
+	opPre      = 247
+	opPost     = 248
+	opPostPost = 249
+
+	gfID  = 131
+	gfEOF = 223
+)
+
+// Parse parses a GF font file.
+func Parse(r io.Reader) (Font, error) {
+	fnt := Font{index: make(map[rune]int)}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return fnt, fmt.Errorf("could not read GF file: %w", err)
+	}
+
+	rr := iobuf.NewReader(p)
+	err = fnt.readPreamble(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse GF file preamble: %w", err)
+	}
+
+	err = fnt.readBody(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse GF file: %w", err)
+	}
+
+	err = fnt.readPostamble(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse GF file postamble: %w", err)
+	}
+
+	return fnt, nil
+}
+
+// Comment returns the comment of the GF file preamble.
+func (fnt *Font) Comment() string {
+	return fnt.comment
+}
+
+// DesignSize returns the design size of the font.
+func (fnt *Font) DesignSize() fixed.Int12_20 {
+	return fnt.design
+}
+
+// Checksum returns the checksum of the font.
+func (fnt *Font) Checksum() uint32 {
+	return fnt.checksum
+}
+
+// PixelsPerPoint returns the horizontal and vertical number of pixels per
+// point.
+func (fnt *Font) PixelsPerPoint() (h, v fixed.Int16_16) {
+	return fnt.hppp, fnt.vppp
+}
+
+// Resolution returns the horizontal resolution of the font, in dots per
+// inch.
+func (fnt *Font) Resolution() float64 {
+	return fnt.hppp.Float64() * 72.27
+}
+
+// Bounds returns the bounds of all the characters of the font, as stated
+// in the postamble of the GF file.
+func (fnt *Font) Bounds() (minM, maxM, minN, maxN int32) {
+	return fnt.bounds[0], fnt.bounds[1], fnt.bounds[2], fnt.bounds[3]
+}
+
+// NumGlyphs returns the number of glyphs of the font.
+func (fnt *Font) NumGlyphs() int {
+	return len(fnt.glyphs)
+}
+
+// Glyphs returns the glyphs of the font, in file order.
+// Glyphs without a raster come last.
+func (fnt *Font) Glyphs() []Glyph {
+	return fnt.glyphs
+}
+
+// Glyph returns the glyph for the provided character code, or nil if the
+// font does not contain it.
+func (fnt *Font) Glyph(x rune) *Glyph {
+	i, ok := fnt.index[x]
+	if !ok {
+		return nil
+	}
+	return &fnt.glyphs[i]
+}
+
+// Specials returns the special commands of the GF file.
+func (fnt *Font) Specials() []Special {
+	return fnt.specials
+}
+
+// Code returns the character code of the glyph.
+func (g *Glyph) Code() rune {
+	return g.code
+}
+
+// Width returns the TFM width of the glyph, as a fraction of the design
+// size of the font.
+func (g *Glyph) Width() fixed.Int12_20 {
+	return g.wd
+}
+
+// Escapement returns the horizontal and vertical escapements of the
+// glyph, in pixels.
+func (g *Glyph) Escapement() (dx, dy fixed.Int16_16) {
+	return g.dx, g.dy
+}
+
+// Bounds returns the bounds of the glyph, as stated by its boc command.
+// Columns range from minM to maxM, and rows from minN to maxN.
+func (g *Glyph) Bounds() (minM, maxM, minN, maxN int32) {
+	return g.bounds[0], g.bounds[1], g.bounds[2], g.bounds[3]
+}
+
+// Offset returns the position of the reference point of the glyph, in
+// pixels, relative to the top-left pixel of its bitmap.
+func (g *Glyph) Offset() (hoff, voff int32) {
+	return -g.bounds[0], g.bounds[3]
+}
+
+// Mask returns the bitmap of the glyph, spanning its bounds.
+// The first row of the bitmap is row maxN.
+// Black pixels are fully opaque.
+func (g *Glyph) Mask() *image.Alpha {
+	return g.mask
+}
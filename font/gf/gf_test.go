@@ -0,0 +1,250 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gf
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/font/pk"
+)
+
+func TestFont(t *testing.T) {
+	f, err := os.Open("testdata/cmr10.gf")
+	if err != nil {
+		t.Fatalf("could not open GF file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse GF file: %+v", err)
+	}
+
+	if got, want := fnt.Comment(), "METAFONT output 2002.02.27:1307"; got != want {
+		t.Fatalf("invalid comment: got=%q, want=%q", got, want)
+	}
+	if got, want := fnt.DesignSize(), fixed.I12_20(10); got != want {
+		t.Fatalf("invalid design size: got=%v, want=%v", got, want)
+	}
+	if got, want := fnt.Checksum(), uint32(1274110073); got != want {
+		t.Fatalf("invalid checksum: got=%d, want=%d", got, want)
+	}
+	if got, want := int(fnt.Resolution()+0.5), 600; got != want {
+		t.Fatalf("invalid resolution: got=%d, want=%d", got, want)
+	}
+	if minM, maxM, minN, maxN := fnt.Bounds(); minM != -4 || maxM != 81 || minN != -21 || maxN != 61 {
+		t.Fatalf("invalid bounds: got=(%d, %d, %d, %d)", minM, maxM, minN, maxN)
+	}
+	if got, want := fnt.NumGlyphs(), 128; got != want {
+		t.Fatalf("invalid number of glyphs: got=%d, want=%d", got, want)
+	}
+	if got, want := len(fnt.Specials()), 11; got != want {
+		t.Fatalf("invalid number of specials: got=%d, want=%d", got, want)
+	}
+
+	g := fnt.Glyph('A')
+	if g == nil {
+		t.Fatalf("could not find glyph 'A'")
+	}
+	if got, want := g.Width(), fixed.Int12_20(786434); got != want {
+		t.Fatalf("invalid TFM width: got=%d, want=%d", got, want)
+	}
+	if dx, dy := g.Escapement(); dx != fixed.I16_16(62) || dy != 0 {
+		t.Fatalf("invalid escapements: got=(%v, %v)", dx, dy)
+	}
+	if minM, maxM, minN, maxN := g.Bounds(); minM != 3 || maxM != 57 || minN != 0 || maxN != 59 {
+		t.Fatalf("invalid glyph bounds: got=(%d, %d, %d, %d)", minM, maxM, minN, maxN)
+	}
+	if hoff, voff := g.Offset(); hoff != -3 || voff != 59 {
+		t.Fatalf("invalid offsets: got=(%d, %d)", hoff, voff)
+	}
+
+	// the GF file holds the bitmaps of the PK font.
+	raw, err := os.ReadFile("../pk/testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not read PK file: %+v", err)
+	}
+	ref, err := pk.Parse(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("could not parse PK file: %+v", err)
+	}
+	for _, want := range ref.Glyphs() {
+		got := fnt.Glyph(want.Code())
+		if got == nil {
+			t.Fatalf("could not find glyph %d", want.Code())
+		}
+		if !bytes.Equal(got.Mask().Pix, want.Mask().Pix) || got.Mask().Rect != want.Mask().Rect {
+			t.Fatalf("invalid bitmap for glyph %d", want.Code())
+		}
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	f, err := os.Open("testdata/cmr10.gf")
+	if err != nil {
+		t.Fatalf("could not open GF file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse GF file: %+v", err)
+	}
+
+	got, err := fnt.MarshalText()
+	if err != nil {
+		t.Fatalf("could not marshal GF file: %+v", err)
+	}
+
+	want, err := os.ReadFile("testdata/cmr10_golden.txt")
+	if err != nil {
+		t.Fatalf("could not read reference file: %+v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		_ = os.WriteFile("testdata/cmr10.txt", got, 0644)
+		t.Fatalf("GF text output differ")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	fnt, err := Parse(bytes.NewReader(newGF()))
+	if err != nil {
+		t.Fatalf("could not parse GF file: %+v", err)
+	}
+
+	g := fnt.Glyph(1)
+	if g == nil {
+		t.Fatalf("could not find glyph 1")
+	}
+	if got, want := g.Mask().Bounds(), image.Rect(0, 0, 4, 4); got != want {
+		t.Fatalf("invalid bitmap size: got=%v, want=%v", got, want)
+	}
+	g = fnt.Glyph(2)
+	if g == nil {
+		t.Fatalf("could not find glyph 2")
+	}
+	if got := g.Mask().Bounds(); !got.Empty() {
+		t.Fatalf("invalid bitmap size: got=%v", got)
+	}
+	specials := fnt.Specials()
+	if len(specials) != 2 || string(specials[0].Data) != "hi" || !specials[1].Numeric || specials[1].Value != 1<<16 {
+		t.Fatalf("invalid specials: %+v", specials)
+	}
+
+	o := new(bytes.Buffer)
+	err = fnt.WriteText(o, true, true)
+	if err != nil {
+		t.Fatalf("could not write GF text: %+v", err)
+	}
+
+	want := `''
+3: beginning of char 1: 0<=m<=3 0<=n<=3
+(initially n=3) paint (1) 2
+11: skip0 (n=2)
+12: xxx 'hi'
+16: paint (0) 4
+19: skip1 1 (n=0)
+21: paint (3) 1
+23: eoc
+.<--This pixel's lower left corner is at (0,4) in METAFONT coordinates
+ **
+****
+
+   *
+'<--This pixel's upper left corner is at (0,0) in METAFONT coordinates
+24: yyy 65536 (1)
+29: beginning of the postamble
+ design size = 10485760 (10pt)
+ check sum = 0
+ hppp = 65536 (1)
+ vppp = 65536 (1)
+ min m = 0, max m = 3
+ min n = 0, max n = 3
+ Character 1: dx 327680 (5), width 524288 (5pt), loc 3
+ Character 2: dx 229376, width 1048576 (10pt)
+The file had 2 characters altogether.
+`
+	if got := o.String(); got != want {
+		t.Fatalf("invalid GF text output:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	raw := newGF()
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"bad-pre", append([]byte{opNoOp}, raw[1:]...)},
+		{"bad-id", append([]byte{opPre, 132}, raw[2:]...)},
+		{"truncated-char", raw[:15]},
+		{"bad-paint", patch(raw, 10, 4)},      // paint outside of the character bounds.
+		{"bad-opcode", patch(raw, 11, opBOC)}, // boc within a character.
+		{"bad-char-loc", patch(raw, 67, 3)},   // character code mismatch.
+		{"bad-char-ptr", patch(raw, 75, 4)},   // invalid pointer to boc.
+		{"bad-post-ptr", patch(raw, 99, 30)},  // invalid pointer to post.
+		{"bad-trailer", patch(raw, 104, 0)},   // invalid trailing byte.
+		{"missing-post-post", raw[:95]},
+		{"missing-char-loc", append(append(append([]byte(nil), raw[:66]...), raw[77:95]...), 249, 0, 0, 0, 29, 131, 223, 223, 223, 223)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader(tc.raw))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func patch(raw []byte, i int, v byte) []byte {
+	o := append([]byte(nil), raw...)
+	o[i] = v
+	return o
+}
+
+// newGF returns a small GF file, with a 4x4 character 1 and a
+// character 2 without a raster.
+func newGF() []byte {
+	return []byte{
+		opPre, gfID, 0,
+		// 3: character 1.
+		opBOC1, 1, 3, 3, 3, 3,
+		1, 2, // paint (1) 2
+		opSkip0,
+		opXXX1, 2, 'h', 'i',
+		0, opPaint1, 4, // paint (0) 4
+		opSkip1, 1,
+		3, 1, // paint (3) 1
+		opEOC,
+		// 24.
+		opYYY, 0, 1, 0, 0,
+		// 29: postamble.
+		opPost,
+		0, 0, 0, 23, // last eoc.
+		0, 0xa0, 0, 0, // design size.
+		0, 0, 0, 0, // checksum.
+		0, 1, 0, 0, // hppp.
+		0, 1, 0, 0, // vppp.
+		0, 0, 0, 0, 0, 0, 0, 3, // min_m, max_m.
+		0, 0, 0, 0, 0, 0, 0, 3, // min_n, max_n.
+		// 66.
+		opCharLoc0, 1, 5, 0, 8, 0, 0, 0, 0, 0, 3,
+		// 77.
+		opCharLoc, 2,
+		0, 3, 0x80, 0, // dx.
+		0, 0, 0, 0, // dy.
+		0, 0x10, 0, 0, // width.
+		0xff, 0xff, 0xff, 0xff, // no raster.
+		// 95.
+		opPostPost, 0, 0, 0, 29, gfID,
+		gfEOF, gfEOF, gfEOF, gfEOF,
+	}
+}
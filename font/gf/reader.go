@@ -0,0 +1,370 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gf
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+func (fnt *Font) readPreamble(r *iobuf.Reader) error {
+	if r.Len()-r.Pos() < 3 {
+		return io.ErrUnexpectedEOF
+	}
+	if op := r.ReadU8(); op != opPre {
+		return fmt.Errorf("invalid GF preamble opcode %d", op)
+	}
+	if id := r.ReadU8(); id != gfID {
+		return fmt.Errorf("invalid GF identification byte %d", id)
+	}
+	n := int(r.ReadU8())
+	if r.Len()-r.Pos() < n {
+		return io.ErrUnexpectedEOF
+	}
+	fnt.comment = string(r.ReadBuf(n))
+	return nil
+}
+
+func (fnt *Font) readBody(r *iobuf.Reader) error {
+	for {
+		if r.Pos() >= r.Len() {
+			return fmt.Errorf("missing GF postamble")
+		}
+		var (
+			pos = r.Pos()
+			op  = r.ReadU8()
+			cmd = command{pos: pos, op: op, spec: -1, char: -1}
+		)
+		switch {
+		case op == opBOC, op == opBOC1:
+			g, err := fnt.readGlyph(r, op, pos)
+			if err != nil {
+				return fmt.Errorf("could not read character at %d: %w", pos, err)
+			}
+			cmd.char = len(fnt.glyphs)
+			fnt.glyphs = append(fnt.glyphs, g)
+		case opXXX1 <= op && op <= opYYY:
+			spec, err := readSpecial(r, op)
+			if err != nil {
+				return err
+			}
+			cmd.spec = len(fnt.specials)
+			fnt.specials = append(fnt.specials, spec)
+		case op == opNoOp:
+		case op == opPost:
+			fnt.post = pos
+			return nil
+		default:
+			return fmt.Errorf("invalid GF opcode %d at %d", op, pos)
+		}
+		fnt.cmds = append(fnt.cmds, cmd)
+	}
+}
+
+func readSpecial(r *iobuf.Reader, op uint8) (Special, error) {
+	if op == opYYY {
+		if r.Len()-r.Pos() < 4 {
+			return Special{}, io.ErrUnexpectedEOF
+		}
+		return Special{Value: r.ReadI32(), Numeric: true}, nil
+	}
+	n := int(op-opXXX1) + 1
+	if r.Len()-r.Pos() < n {
+		return Special{}, io.ErrUnexpectedEOF
+	}
+	var sz int
+	for _, v := range r.ReadBuf(n) {
+		sz = sz<<8 | int(v)
+	}
+	if sz < 0 || r.Len()-r.Pos() < sz {
+		return Special{}, io.ErrUnexpectedEOF
+	}
+	return Special{Data: append([]byte(nil), r.ReadBuf(sz)...)}, nil
+}
+
+func (fnt *Font) readGlyph(r *iobuf.Reader, op uint8, pos int) (Glyph, error) {
+	g := Glyph{pos: pos}
+	switch op {
+	case opBOC:
+		if r.Len()-r.Pos() < 24 {
+			return g, io.ErrUnexpectedEOF
+		}
+		g.code = rune(r.ReadI32())
+		_ = r.ReadI32() // back-pointer to the previous character.
+		g.bounds[0] = r.ReadI32()
+		g.bounds[1] = r.ReadI32()
+		g.bounds[2] = r.ReadI32()
+		g.bounds[3] = r.ReadI32()
+		g.hdr = 25
+	case opBOC1:
+		if r.Len()-r.Pos() < 5 {
+			return g, io.ErrUnexpectedEOF
+		}
+		g.code = rune(r.ReadU8())
+		var (
+			dm = int32(r.ReadU8())
+			mm = int32(r.ReadU8())
+			dn = int32(r.ReadU8())
+			mn = int32(r.ReadU8())
+		)
+		g.bounds = [4]int32{mm - dm, mm, mn - dn, mn}
+		g.hdr = 6
+	}
+	if w, h := int64(g.bounds[1])-int64(g.bounds[0])+1, int64(g.bounds[3])-int64(g.bounds[2])+1; w*h > 1<<24 {
+		return g, fmt.Errorf("invalid character %d", g.code)
+	}
+
+	g.raster = r.Bytes()
+	mask, n, err := g.paint(func(st step) {
+		if opXXX1 <= st.op && st.op <= opYYY {
+			// specials within a character.
+			fnt.specials = append(fnt.specials, st.spec())
+		}
+	})
+	if err != nil {
+		return g, fmt.Errorf("could not decode character %d: %w", g.code, err)
+	}
+	g.raster = g.raster[:n]
+	g.mask = mask
+	r.SetPos(r.Pos() + n)
+	return g, nil
+}
+
+func (fnt *Font) readPostamble(r *iobuf.Reader) error {
+	if r.Len()-r.Pos() < 36 {
+		return io.ErrUnexpectedEOF
+	}
+	_ = r.ReadU32() // pointer to the last boc command.
+	fnt.design = fixed.Int12_20(r.ReadU32())
+	fnt.checksum = r.ReadU32()
+	fnt.hppp = fixed.Int16_16(r.ReadU32())
+	fnt.vppp = fixed.Int16_16(r.ReadU32())
+	for i := range fnt.bounds {
+		fnt.bounds[i] = r.ReadI32()
+	}
+
+	chars := make(map[int]int, len(fnt.glyphs)) // glyph index, by boc position.
+	for i, g := range fnt.glyphs {
+		chars[g.pos] = i
+	}
+
+	for {
+		if r.Pos() >= r.Len() {
+			return fmt.Errorf("missing GF post-postamble")
+		}
+		var (
+			pos = r.Pos()
+			op  = r.ReadU8()
+			g   Glyph
+			ptr int32
+		)
+		switch op {
+		case opCharLoc:
+			if r.Len()-r.Pos() < 17 {
+				return io.ErrUnexpectedEOF
+			}
+			g.code = rune(r.ReadU8())
+			g.dx = fixed.Int16_16(r.ReadI32())
+			g.dy = fixed.Int16_16(r.ReadI32())
+			g.wd = fixed.Int12_20(r.ReadI32())
+			ptr = r.ReadI32()
+		case opCharLoc0:
+			if r.Len()-r.Pos() < 10 {
+				return io.ErrUnexpectedEOF
+			}
+			g.code = rune(r.ReadU8())
+			g.dx = fixed.Int16_16(uint32(r.ReadU8()) << 16)
+			g.wd = fixed.Int12_20(r.ReadI32())
+			ptr = r.ReadI32()
+		case opNoOp:
+			continue
+		case opPostPost:
+			return fnt.readPostPost(r)
+		default:
+			return fmt.Errorf("invalid GF opcode %d at %d", op, pos)
+		}
+
+		if ptr < 0 {
+			// character without a raster.
+			g.bounds = [4]int32{0, -1, 0, -1}
+			g.mask = image.NewAlpha(image.Rectangle{})
+			g.pos = -1
+			g.loc = pos
+			fnt.locs = append(fnt.locs, len(fnt.glyphs))
+			fnt.glyphs = append(fnt.glyphs, g)
+			continue
+		}
+		i, ok := chars[int(ptr)]
+		if !ok {
+			return fmt.Errorf("invalid character pointer %d at %d", ptr, pos)
+		}
+		c := &fnt.glyphs[i]
+		if c.code&0xff != g.code {
+			return fmt.Errorf("invalid character code %d at %d (boc=%d)", g.code, pos, c.code)
+		}
+		c.wd, c.dx, c.dy, c.loc = g.wd, g.dx, g.dy, pos
+		fnt.locs = append(fnt.locs, i)
+		delete(chars, int(ptr))
+	}
+}
+
+func (fnt *Font) readPostPost(r *iobuf.Reader) error {
+	if r.Len()-r.Pos() < 5 {
+		return io.ErrUnexpectedEOF
+	}
+	if q := int(r.ReadU32()); q != fnt.post {
+		return fmt.Errorf("invalid postamble pointer %d (post=%d)", q, fnt.post)
+	}
+	if id := r.ReadU8(); id != gfID {
+		return fmt.Errorf("invalid GF identification byte %d", id)
+	}
+	n := 0
+	for r.Pos() < r.Len() {
+		if v := r.ReadU8(); v != gfEOF {
+			return fmt.Errorf("invalid byte %d after post-postamble", v)
+		}
+		n++
+	}
+	if n < 4 {
+		return fmt.Errorf("invalid number of trailing bytes (%d)", n)
+	}
+
+	for i, g := range fnt.glyphs {
+		if g.loc == 0 {
+			return fmt.Errorf("missing char_loc for character %d", g.code)
+		}
+		fnt.index[g.code] = i
+	}
+	return nil
+}
+
+// step is a command of a character raster, as decoded by paint.
+type step struct {
+	pos  int    // position of the command in the GF file.
+	op   uint8  // opcode of the command.
+	v    int    // parameter of the command.
+	data []byte // payload of a xxx command.
+	n    int32  // current row, after the command.
+}
+
+// spec returns the special of a xxx or yyy command.
+func (st step) spec() Special {
+	if st.op == opYYY {
+		return Special{Value: int32(st.v), Numeric: true}
+	}
+	return Special{Data: st.data}
+}
+
+// paint decodes the raster of the glyph into a bitmap spanning its
+// bounds, and returns the number of bytes of the raster, up to its eoc
+// command.
+// trace, when not nil, is called for each decoded command.
+func (g *Glyph) paint(trace func(st step)) (*image.Alpha, int, error) {
+	var (
+		minM, maxM, minN, maxN = g.Bounds()
+
+		w    = int(maxM) - int(minM) + 1
+		h    = int(maxN) - int(minN) + 1
+		r    = iobuf.NewReader(g.raster)
+		m    = minM
+		n    = maxN
+		draw = false // whether the paint switch is black.
+	)
+	if w < 0 || h < 0 {
+		w, h = 0, 0
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+
+	need := func(n int) error {
+		if r.Len()-r.Pos() < n {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	param := func(k int) int {
+		v := 0
+		for _, c := range r.ReadBuf(k) {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+
+	for {
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		var (
+			pos = r.Pos()
+			op  = r.ReadU8()
+			st  = step{pos: g.pos + g.hdr + pos, op: op}
+		)
+		switch {
+		case op <= opPaint3:
+			d := int(op)
+			if op >= opPaint1 {
+				k := int(op-opPaint1) + 1
+				if err := need(k); err != nil {
+					return nil, 0, err
+				}
+				d = param(k)
+			}
+			if draw && d > 0 {
+				if n < minN || n > maxN || m < minM || int64(m)+int64(d)-1 > int64(maxM) {
+					return nil, 0, fmt.Errorf("pixels (%d..%d, %d) out of bounds", m, int64(m)+int64(d)-1, n)
+				}
+				row := mask.Pix[int(maxN-n)*mask.Stride:]
+				for i := int(m - minM); i < int(m-minM)+d; i++ {
+					row[i] = 0xff
+				}
+			}
+			st.v = d
+			m += int32(d)
+			draw = !draw
+		case op == opEOC:
+			if trace != nil {
+				st.n = n
+				trace(st)
+			}
+			return mask, r.Pos(), nil
+		case op == opSkip0:
+			n--
+			m = minM
+			draw = false
+		case op <= opSkip3:
+			k := int(op-opSkip1) + 1
+			if err := need(k); err != nil {
+				return nil, 0, err
+			}
+			st.v = param(k)
+			n -= int32(st.v) + 1
+			m = minM
+			draw = false
+		case op <= opNewRow:
+			st.v = int(op - opNewRow0)
+			n--
+			m = minM + int32(st.v)
+			draw = true
+		case op <= opYYY:
+			r.SetPos(pos + 1)
+			spec, err := readSpecial(r, op)
+			if err != nil {
+				return nil, 0, err
+			}
+			st.v = int(spec.Value)
+			st.data = spec.Data
+		case op == opNoOp:
+		default:
+			return nil, 0, fmt.Errorf("invalid GF opcode %d at %d", op, st.pos)
+		}
+		if trace != nil {
+			st.n = n
+			trace(st)
+		}
+	}
+}
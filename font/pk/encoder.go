@@ -0,0 +1,132 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// MarshalText implements encoding.TextMarshaler.
+//
+// The textual representation of a PK font matches the output of the
+// pktype program of TeX Live, without its banner.
+func (fnt *Font) MarshalText() ([]byte, error) {
+	o := new(bytes.Buffer)
+	err := newTextEncoder(o).encode(fnt)
+	if err != nil {
+		return nil, err
+	}
+	return o.Bytes(), nil
+}
+
+type textEncoder struct {
+	w   io.Writer
+	pos int // terminal position, for line wrapping.
+}
+
+func newTextEncoder(w io.Writer) *textEncoder {
+	return &textEncoder{w: w}
+}
+
+func (te *textEncoder) printf(format string, args ...interface{}) {
+	fmt.Fprintf(te.w, format, args...)
+}
+
+func (te *textEncoder) encode(fnt *Font) error {
+	te.printf("'%s'\n", fnt.comment)
+	te.printf("Design size = %d\n", int32(fnt.design))
+	te.printf("Checksum = %d\n", int32(fnt.checksum))
+	te.printf(
+		"Resolution: horizontal = %d  vertical = %d  (%d dpi)\n",
+		int32(fnt.hppp), int32(fnt.vppp),
+		int(math.Round(float64(int32(fnt.hppp))*72.27/65536)),
+	)
+	if fnt.hppp != fnt.vppp {
+		te.printf("Warning:  aspect ratio not 1:1!\n")
+	}
+
+	for _, cmd := range fnt.cmds {
+		switch {
+		case cmd.char >= 0:
+			err := te.encodeGlyph(cmd.pos, &fnt.glyphs[cmd.char])
+			if err != nil {
+				return err
+			}
+		case cmd.op <= opXXX4:
+			te.printf("%d:  Special: '%s'\n", cmd.pos, fnt.specials[cmd.spec].Data)
+		case cmd.op == opYYY:
+			te.printf("%d:  Num special: %d\n", cmd.pos, fnt.specials[cmd.spec].Value)
+		case cmd.op == opPost:
+			te.printf("%d:  Postamble\n", cmd.pos)
+		}
+	}
+	te.printf("%d bytes read from packed file.\n", fnt.size)
+	return nil
+}
+
+func (te *textEncoder) encodeGlyph(pos int, g *Glyph) error {
+	var (
+		w = g.mask.Rect.Dx()
+		h = g.mask.Rect.Dy()
+	)
+	te.printf(
+		"%d:  Flag byte = %d  Character = %d  Packet length = %d\n",
+		pos, g.flag, g.code, g.pl,
+	)
+	te.printf("  Dynamic packing variable = %d\n", g.dynF())
+	te.printf("  TFM width = %d  dx = %d\n", int32(g.wd), int32(g.dx))
+	if g.dy != 0 {
+		te.printf("  dy = %d\n", int32(g.dy))
+	}
+	te.printf(
+		"  Height = %d  Width = %d  X-offset = %d  Y-offset = %d\n",
+		h, w, g.hoff, g.voff,
+	)
+
+	if g.dynF() == 14 {
+		for y := 0; y < h; y++ {
+			row := make([]byte, w)
+			for x := range row {
+				row[x] = '.'
+				if g.mask.Pix[y*g.mask.Stride+x] != 0 {
+					row[x] = '*'
+				}
+			}
+			te.printf("  %s \n", row)
+		}
+		return nil
+	}
+
+	te.printf("  ")
+	te.pos = 2
+	_, err := g.unpack(w, h, te.run)
+	if err != nil {
+		return fmt.Errorf("could not decode character %d: %w", g.code, err)
+	}
+	te.printf(" \n")
+	return nil
+}
+
+// run prints a packed number of a run-length encoded raster, wrapping
+// lines at 78 columns.
+func (te *textEncoder) run(v int, kind runKind) {
+	s := strconv.Itoa(v)
+	switch kind {
+	case whiteRun:
+		s = "(" + s + ")"
+	case repeatCount:
+		s = "[" + s + "]"
+	}
+	if te.pos+len(s) > 78 {
+		te.printf(" \n  ")
+		te.pos = 2
+	}
+	te.pos += len(s)
+	te.printf("%s", s)
+}
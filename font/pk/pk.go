@@ -0,0 +1,180 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pk implements a decoder and an encoder for PK (packed raster)
+// font files.
+//
+// More informations about the PK format can be found in the pktype
+// program of TeX Live.
+package pk // import "star-tex.org/x/tex/font/pk"
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// Font is a PK font.
+type Font struct {
+	comment  string
+	design   fixed.Int12_20
+	checksum uint32
+	hppp     fixed.Int16_16
+	vppp     fixed.Int16_16
+
+	glyphs   []Glyph
+	index    map[rune]int
+	specials []Special
+
+	cmds []command // commands, in file order.
+	size int       // size of the PK file, in bytes.
+}
+
+// Glyph is a character of a PK font.
+type Glyph struct {
+	code   rune
+	wd     fixed.Int12_20
+	dx, dy fixed.Int16_16
+	hoff   int32
+	voff   int32
+	mask   *image.Alpha
+
+	flag   uint8  // flag byte of the character definition.
+	pl     int    // packet length.
+	raster []byte // packed raster.
+}
+
+// Special is a PK special command: either a pk_xxx command holding a
+// string, or a pk_yyy command holding a number.
+type Special struct {
+	Data    []byte // payload of a pk_xxx special.
+	Value   int32  // value of a pk_yyy special.
+	Numeric bool   // whether the special is a pk_yyy special.
+}
+
+type command struct {
+	pos  int
+	op   uint8
+	spec int // index of the special.
+	char int // index of the glyph.
+}
+
+const (
+	opXXX1 = 240
+	opXXX4 = 243
+	opYYY  = 244
+	opPost = 245
+	opNoOp = 246
+	opPre  = 247
+
+	pkID = 89
+)
+
+// Parse parses a PK font file.
+func Parse(r io.Reader) (Font, error) {
+	fnt := Font{index: make(map[rune]int)}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return fnt, fmt.Errorf("could not read PK file: %w", err)
+	}
+
+	rr := iobuf.NewReader(p)
+	err = fnt.readPreamble(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse PK file preamble: %w", err)
+	}
+
+	err = fnt.readBody(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse PK file: %w", err)
+	}
+
+	return fnt, nil
+}
+
+// Comment returns the comment of the PK file preamble.
+func (fnt *Font) Comment() string {
+	return fnt.comment
+}
+
+// DesignSize returns the design size of the font, in points.
+func (fnt *Font) DesignSize() fixed.Int12_20 {
+	return fnt.design
+}
+
+// Checksum returns the checksum of the font, which should match the one
+// of the TFM file.
+func (fnt *Font) Checksum() uint32 {
+	return fnt.checksum
+}
+
+// PixelsPerPoint returns the horizontal and vertical number of pixels per
+// point of the font.
+func (fnt *Font) PixelsPerPoint() (h, v fixed.Int16_16) {
+	return fnt.hppp, fnt.vppp
+}
+
+// Resolution returns the horizontal resolution of the font, in dots per
+// inch.
+func (fnt *Font) Resolution() float64 {
+	return fnt.hppp.Float64() * 72.27
+}
+
+// NumGlyphs returns the number of glyphs in this font.
+func (fnt *Font) NumGlyphs() int {
+	return len(fnt.glyphs)
+}
+
+// Glyphs returns the glyphs of the font, in file order.
+func (fnt *Font) Glyphs() []Glyph {
+	return fnt.glyphs
+}
+
+// Glyph returns the glyph for the given rune.
+//
+// Glyph returns nil if there is no such rune.
+func (fnt *Font) Glyph(x rune) *Glyph {
+	i, ok := fnt.index[x]
+	if !ok {
+		return nil
+	}
+	return &fnt.glyphs[i]
+}
+
+// Specials returns the special commands of the PK file.
+func (fnt *Font) Specials() []Special {
+	return fnt.specials
+}
+
+// Code returns the character code of the glyph.
+func (g *Glyph) Code() rune {
+	return g.code
+}
+
+// Width returns the TFM width of the glyph, as a fraction of the design
+// size of the font.
+func (g *Glyph) Width() fixed.Int12_20 {
+	return g.wd
+}
+
+// Escapement returns the horizontal and vertical escapements of the
+// glyph, in pixels.
+func (g *Glyph) Escapement() (dx, dy fixed.Int16_16) {
+	return g.dx, g.dy
+}
+
+// Offset returns the position of the reference point of the glyph, in
+// pixels, relative to the top-left pixel of its bitmap.
+func (g *Glyph) Offset() (hoff, voff int32) {
+	return g.hoff, g.voff
+}
+
+// Mask returns the bitmap of the glyph.
+// Black pixels are fully opaque.
+func (g *Glyph) Mask() *image.Alpha {
+	return g.mask
+}
@@ -0,0 +1,299 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pk
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	"star-tex.org/x/tex/font/fixed"
+)
+
+func TestFont(t *testing.T) {
+	f, err := os.Open("testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not open PK file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse PK file: %+v", err)
+	}
+
+	if got, want := fnt.Comment(), "METAFONT output 2002.02.27:1307"; got != want {
+		t.Fatalf("invalid comment: got=%q, want=%q", got, want)
+	}
+	if got, want := fnt.DesignSize(), fixed.I12_20(10); got != want {
+		t.Fatalf("invalid design size: got=%v, want=%v", got, want)
+	}
+	if got, want := fnt.Checksum(), uint32(1274110073); got != want {
+		t.Fatalf("invalid checksum: got=%d, want=%d", got, want)
+	}
+	if got, want := int(fnt.Resolution()+0.5), 600; got != want {
+		t.Fatalf("invalid resolution: got=%d, want=%d", got, want)
+	}
+	if got, want := fnt.NumGlyphs(), 128; got != want {
+		t.Fatalf("invalid number of glyphs: got=%d, want=%d", got, want)
+	}
+	specials := fnt.Specials()
+	if got, want := len(specials), 11; got != want {
+		t.Fatalf("invalid number of specials: got=%d, want=%d", got, want)
+	}
+	if got, want := string(specials[10].Data), "o_correction=1"; got != want || specials[10].Numeric {
+		t.Fatalf("invalid special: got=%q, want=%q", got, want)
+	}
+	if got, want := specials[3].Value, int32(15335424); got != want || !specials[3].Numeric {
+		t.Fatalf("invalid numeric special: got=%d, want=%d", got, want)
+	}
+
+	if g := fnt.Glyph(200); g != nil {
+		t.Fatalf("unexpected glyph %d", g.Code())
+	}
+
+	g := fnt.Glyph('A')
+	if g == nil {
+		t.Fatalf("could not find glyph 'A'")
+	}
+	if got, want := g.Code(), 'A'; got != want {
+		t.Fatalf("invalid code: got=%d, want=%d", got, want)
+	}
+	if got, want := g.Width(), fixed.Int12_20(786434); got != want {
+		t.Fatalf("invalid TFM width: got=%d, want=%d", got, want)
+	}
+	if dx, dy := g.Escapement(); dx != fixed.I16_16(62) || dy != 0 {
+		t.Fatalf("invalid escapements: got=(%v, %v)", dx, dy)
+	}
+	if hoff, voff := g.Offset(); hoff != -3 || voff != 59 {
+		t.Fatalf("invalid offsets: got=(%d, %d)", hoff, voff)
+	}
+
+	mask := g.Mask()
+	if got, want := mask.Bounds(), image.Rect(0, 0, 55, 60); got != want {
+		t.Fatalf("invalid bitmap size: got=%v, want=%v", got, want)
+	}
+	row := func(y int) string {
+		var o []byte
+		for x := 0; x < mask.Rect.Dx(); x++ {
+			switch mask.AlphaAt(x, y).A {
+			case 0:
+				o = append(o, '.')
+			default:
+				o = append(o, '#')
+			}
+		}
+		return string(o)
+	}
+	for y, want := range map[int]string{
+		0:  "..........................###..........................",
+		40: ".............#############################.............",
+		59: "#################...............#######################",
+	} {
+		if got := row(y); got != want {
+			t.Fatalf("invalid row %d:\ngot= %s\nwant=%s", y, got, want)
+		}
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	f, err := os.Open("testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not open PK file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse PK file: %+v", err)
+	}
+
+	got, err := fnt.MarshalText()
+	if err != nil {
+		t.Fatalf("could not marshal PK file: %+v", err)
+	}
+
+	want, err := os.ReadFile("testdata/cmr10_golden.txt")
+	if err != nil {
+		t.Fatalf("could not read reference file: %+v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		_ = os.WriteFile("testdata/cmr10.txt", got, 0644)
+		t.Fatalf("PK text output differ")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not read PK file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"bad-pre", append([]byte{opNoOp}, raw[1:]...)},
+		{"bad-id", append([]byte{opPre, 90}, raw[2:]...)},
+		{"truncated-preamble", raw[:20]},
+		{"truncated-char", raw[:100]},
+		{"missing-postamble", raw[:10849]},
+		{"bad-opcode", append(append([]byte(nil), raw[:50]...), 250)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader(tc.raw))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not read PK file: %+v", err)
+	}
+
+	// a font with a glyph of each form.
+	var (
+		dot  = image.NewAlpha(image.Rect(0, 0, 2, 2))
+		wide = image.NewAlpha(image.Rect(0, 0, 300, 1))
+	)
+	for i := range dot.Pix {
+		dot.Pix[i] = 0xff
+	}
+	for i := range wide.Pix {
+		wide.Pix[i] = 0xff
+	}
+	fnt, err := New("forms", 10<<20, 0, 1<<16, 1<<16, []Glyph{
+		NewGlyph('a', 1<<19, 2<<16, 0, 0, 2, dot),     // short form.
+		NewGlyph('b', 1<<19, 300<<16, 0, 0, 1, wide),  // extended short form.
+		NewGlyph('c', 1<<19, 2<<16, 1<<16, 0, 2, dot), // long form.
+	}, nil)
+	if err != nil {
+		t.Fatalf("could not create PK font: %+v", err)
+	}
+	for i, want := range []string{"short", "extended", "long"} {
+		got := "long"
+		switch f := fnt.glyphs[i].flag & 7; {
+		case f < 4:
+			got = "short"
+		case f < 7:
+			got = "extended"
+		}
+		if got != want {
+			t.Fatalf("invalid form of glyph %d: got=%s, want=%s", i, got, want)
+		}
+	}
+	forms, err := fnt.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not marshal PK font: %+v", err)
+	}
+	// end of the postamble, before its padding.
+	post := len(forms)
+	for forms[post-1] == opNoOp {
+		post--
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		beg  int
+		end  int
+	}{
+		{"cmr10", raw, 880, 920},
+		{"forms", forms, 0, post},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for n := tc.beg; n < tc.end; n++ {
+				_, err := Parse(bytes.NewReader(tc.raw[:n]))
+				if err == nil {
+					t.Fatalf("expected an error for %d bytes", n)
+				}
+			}
+		})
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not read PK file: %+v", err)
+	}
+
+	fnt, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("could not parse PK file: %+v", err)
+	}
+
+	got, err := fnt.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not marshal PK file: %+v", err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Fatalf("PK binary output differ")
+	}
+}
+
+func TestNew(t *testing.T) {
+	raw, err := os.ReadFile("testdata/cmr10.pk")
+	if err != nil {
+		t.Fatalf("could not read PK file: %+v", err)
+	}
+
+	ref, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("could not parse PK file: %+v", err)
+	}
+
+	glyphs := make([]Glyph, 0, ref.NumGlyphs())
+	for _, g := range ref.Glyphs() {
+		dx, dy := g.Escapement()
+		hoff, voff := g.Offset()
+		glyphs = append(glyphs, NewGlyph(g.Code(), g.Width(), dx, dy, hoff, voff, g.Mask()))
+	}
+	hppp, vppp := ref.PixelsPerPoint()
+	fnt, err := New(ref.Comment(), ref.DesignSize(), ref.Checksum(), hppp, vppp, glyphs, ref.Specials())
+	if err != nil {
+		t.Fatalf("could not create PK font: %+v", err)
+	}
+
+	if got, want := fnt.NumGlyphs(), ref.NumGlyphs(); got != want {
+		t.Fatalf("invalid number of glyphs: got=%d, want=%d", got, want)
+	}
+	if got, want := len(fnt.Specials()), len(ref.Specials()); got != want {
+		t.Fatalf("invalid number of specials: got=%d, want=%d", got, want)
+	}
+	for i := range ref.glyphs {
+		var (
+			got  = fnt.glyphs[i]
+			want = ref.glyphs[i]
+		)
+		// glyphs are packed as gftopk packs them.
+		if got.flag != want.flag || got.pl != want.pl || !bytes.Equal(got.raster, want.raster) {
+			t.Fatalf("invalid packed glyph %d:\ngot= %x\nwant=%x", want.code, got.raster, want.raster)
+		}
+		if !bytes.Equal(got.mask.Pix, want.mask.Pix) {
+			t.Fatalf("invalid bitmap for glyph %d", want.code)
+		}
+	}
+
+	got, err := fnt.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not marshal PK file: %+v", err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Fatalf("PK binary output differ")
+	}
+
+	_, err = New(string(make([]byte, 256)), 0, 0, 0, 0, nil, nil)
+	if err == nil {
+		t.Fatalf("expected an error for a long comment")
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pk
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+func (fnt *Font) readPreamble(r *iobuf.Reader) error {
+	if r.Len()-r.Pos() < 3 {
+		return io.ErrUnexpectedEOF
+	}
+	if op := r.ReadU8(); op != opPre {
+		return fmt.Errorf("invalid PK preamble opcode %d", op)
+	}
+	if id := r.ReadU8(); id != pkID {
+		return fmt.Errorf("invalid PK identification byte %d", id)
+	}
+	n := int(r.ReadU8())
+	if r.Len()-r.Pos() < n+16 {
+		return io.ErrUnexpectedEOF
+	}
+	fnt.comment = string(r.ReadBuf(n))
+	fnt.design = fixed.Int12_20(r.ReadU32())
+	fnt.checksum = r.ReadU32()
+	fnt.hppp = fixed.Int16_16(r.ReadU32())
+	fnt.vppp = fixed.Int16_16(r.ReadU32())
+	return nil
+}
+
+func (fnt *Font) readBody(r *iobuf.Reader) error {
+	for {
+		if r.Pos() >= r.Len() {
+			return fmt.Errorf("missing PK postamble")
+		}
+		var (
+			pos = r.Pos()
+			op  = r.ReadU8()
+			cmd = command{pos: pos, op: op, spec: -1, char: -1}
+		)
+		switch {
+		case op < opXXX1:
+			g, err := readGlyph(r, op)
+			if err != nil {
+				return fmt.Errorf("could not read character at %d: %w", pos, err)
+			}
+			cmd.char = len(fnt.glyphs)
+			fnt.index[g.code] = len(fnt.glyphs)
+			fnt.glyphs = append(fnt.glyphs, g)
+		case op <= opXXX4:
+			n := int(op-opXXX1) + 1
+			if r.Len()-r.Pos() < n {
+				return io.ErrUnexpectedEOF
+			}
+			var sz int
+			for _, v := range r.ReadBuf(n) {
+				sz = sz<<8 | int(v)
+			}
+			if sz < 0 || r.Len()-r.Pos() < sz {
+				return io.ErrUnexpectedEOF
+			}
+			cmd.spec = len(fnt.specials)
+			fnt.specials = append(fnt.specials, Special{
+				Data: append([]byte(nil), r.ReadBuf(sz)...),
+			})
+		case op == opYYY:
+			if r.Len()-r.Pos() < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			cmd.spec = len(fnt.specials)
+			fnt.specials = append(fnt.specials, Special{
+				Value:   r.ReadI32(),
+				Numeric: true,
+			})
+		case op == opNoOp:
+		case op == opPost:
+			fnt.cmds = append(fnt.cmds, cmd)
+			// the postamble is followed by no-ops, up to a multiple of
+			// 4 bytes.
+			for r.Pos() < r.Len() {
+				if v := r.ReadU8(); v != opNoOp {
+					return fmt.Errorf("invalid byte %d after postamble", v)
+				}
+			}
+			fnt.size = r.Pos()
+			return nil
+		default:
+			return fmt.Errorf("invalid PK opcode %d at %d", op, pos)
+		}
+		fnt.cmds = append(fnt.cmds, cmd)
+	}
+}
+
+func readGlyph(r *iobuf.Reader, flag uint8) (Glyph, error) {
+	var (
+		g   = Glyph{flag: flag}
+		w   int
+		h   int
+		hdr int // number of bytes of the character preamble, after the pl and cc fields.
+	)
+	need := func(n int) error {
+		if r.Len()-r.Pos() < n {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+
+	switch flag & 7 {
+	case 0, 1, 2, 3: // short form.
+		hdr = 8
+		if err := need(2 + hdr); err != nil {
+			return g, err
+		}
+		g.pl = int(flag&3)<<8 | int(r.ReadU8())
+		g.code = rune(r.ReadU8())
+		g.wd = fixed.Int12_20(r.ReadU24())
+		g.dx = fixed.Int16_16(uint32(r.ReadU8()) << 16)
+		w = int(r.ReadU8())
+		h = int(r.ReadU8())
+		g.hoff = int32(r.ReadI8())
+		g.voff = int32(r.ReadI8())
+	case 4, 5, 6: // extended short form.
+		hdr = 13
+		if err := need(3 + hdr); err != nil {
+			return g, err
+		}
+		g.pl = int(flag&3)<<16 | int(r.ReadU16())
+		g.code = rune(r.ReadU8())
+		g.wd = fixed.Int12_20(r.ReadU24())
+		g.dx = fixed.Int16_16(uint32(r.ReadU16()) << 16)
+		w = int(r.ReadU16())
+		h = int(r.ReadU16())
+		g.hoff = int32(r.ReadI16())
+		g.voff = int32(r.ReadI16())
+	case 7: // long form.
+		hdr = 28
+		if err := need(8 + hdr); err != nil {
+			return g, err
+		}
+		g.pl = int(r.ReadU32())
+		g.code = rune(r.ReadU32())
+		g.wd = fixed.Int12_20(r.ReadU32())
+		g.dx = fixed.Int16_16(r.ReadU32())
+		g.dy = fixed.Int16_16(r.ReadU32())
+		w = int(r.ReadU32())
+		h = int(r.ReadU32())
+		g.hoff = r.ReadI32()
+		g.voff = r.ReadI32()
+	}
+	if g.pl < hdr || w < 0 || h < 0 || w*h > 1<<24 {
+		return g, fmt.Errorf("invalid character %d", g.code)
+	}
+	if err := need(g.pl - hdr); err != nil {
+		return g, err
+	}
+	g.raster = r.ReadBuf(g.pl - hdr)
+
+	var err error
+	g.mask, err = g.unpack(w, h, nil)
+	if err != nil {
+		return g, fmt.Errorf("could not decode character %d: %w", g.code, err)
+	}
+	return g, nil
+}
+
+// dynF returns the dynamic packing variable of the glyph.
+func (g *Glyph) dynF() int {
+	return int(g.flag >> 4)
+}
+
+// runKind describes a packed number of a run-length encoded raster.
+type runKind uint8
+
+const (
+	whiteRun runKind = iota
+	blackRun
+	repeatCount
+)
+
+// unpack decodes the raster of the glyph into a bitmap of size (w,h).
+// trace, when not nil, is called for each packed number of a run-length
+// encoded raster.
+func (g *Glyph) unpack(w, h int, trace func(v int, kind runKind)) (*image.Alpha, error) {
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	if g.dynF() == 14 {
+		for i := range mask.Pix {
+			if i/8 >= len(g.raster) {
+				return nil, fmt.Errorf("truncated raster")
+			}
+			if g.raster[i/8]&(0x80>>(i%8)) != 0 {
+				mask.Pix[i] = 0xff
+			}
+		}
+		return mask, nil
+	}
+
+	var (
+		dynf  = g.dynF()
+		black = g.flag&8 != 0
+		nyb   = nybbles{p: g.raster}
+		row   = make([]byte, w)
+		x     = 0 // position in the current row.
+		y     = 0 // current row.
+		rep   = 0 // repeat count of the current row.
+	)
+	for y < h {
+		n, r, err := nyb.packed(dynf)
+		if err != nil {
+			return nil, err
+		}
+		if r >= 0 {
+			if trace != nil {
+				trace(r, repeatCount)
+			}
+			rep = r
+			continue
+		}
+		if trace != nil {
+			kind := whiteRun
+			if black {
+				kind = blackRun
+			}
+			trace(n, kind)
+		}
+		if w == 0 {
+			return nil, fmt.Errorf("invalid run in empty row")
+		}
+		for n > 0 && y < h {
+			m := n
+			if m > w-x {
+				m = w - x
+			}
+			if black {
+				for i := x; i < x+m; i++ {
+					row[i] = 0xff
+				}
+			}
+			x += m
+			n -= m
+			if x == w {
+				for i := 0; i <= rep && y < h; i++ {
+					copy(mask.Pix[y*mask.Stride:], row)
+					y++
+				}
+				for i := range row {
+					row[i] = 0
+				}
+				x = 0
+				rep = 0
+			}
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("raster overflow")
+		}
+		black = !black
+	}
+	return mask, nil
+}
+
+type nybbles struct {
+	p   []byte
+	i   int // index of the next nybble.
+	err error
+}
+
+func (nyb *nybbles) next() int {
+	if nyb.i/2 >= len(nyb.p) {
+		nyb.err = fmt.Errorf("truncated raster")
+		return 0
+	}
+	v := nyb.p[nyb.i/2]
+	if nyb.i%2 == 0 {
+		v >>= 4
+	}
+	nyb.i++
+	return int(v & 0xf)
+}
+
+// packed decodes a packed number, as a run count n, or a repeat count r.
+// r is negative when the packed number is a run count.
+func (nyb *nybbles) packed(dynf int) (n, r int, err error) {
+	i := nyb.next()
+	switch {
+	case i == 0:
+		j := 0
+		for i == 0 && nyb.err == nil {
+			i = nyb.next()
+			j++
+		}
+		for ; j > 0; j-- {
+			i = i*16 + nyb.next()
+		}
+		n = i - 15 + (13-dynf)*16 + dynf
+	case i <= dynf:
+		n = i
+	case i < 14:
+		n = (i-dynf-1)*16 + nyb.next() + dynf + 1
+	case i == 14:
+		r, _, err = nyb.packed(dynf)
+		return 0, r, err
+	default:
+		return 0, 1, nyb.err
+	}
+	return n, -1, nyb.err
+}
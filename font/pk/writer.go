@@ -0,0 +1,384 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pk
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// New returns a new PK font, with the provided preamble values, glyphs
+// and specials.
+// Specials are written after the glyphs, as METAFONT and gftopk do.
+func New(comment string, design fixed.Int12_20, checksum uint32, hppp, vppp fixed.Int16_16, glyphs []Glyph, specials []Special) (Font, error) {
+	if len(comment) > 255 {
+		return Font{}, fmt.Errorf("pk: comment too long (%d bytes)", len(comment))
+	}
+	fnt := Font{
+		comment:  comment,
+		design:   design,
+		checksum: checksum,
+		hppp:     hppp,
+		vppp:     vppp,
+		glyphs:   make([]Glyph, len(glyphs)),
+		specials: specials,
+	}
+	for i, g := range glyphs {
+		g.pack()
+		fnt.glyphs[i] = g
+		fnt.cmds = append(fnt.cmds, command{op: g.flag, spec: -1, char: i})
+	}
+	for i := range specials {
+		op := uint8(opYYY)
+		if !specials[i].Numeric {
+			op = opXXX4
+		}
+		fnt.cmds = append(fnt.cmds, command{op: op, spec: i, char: -1})
+	}
+	fnt.cmds = append(fnt.cmds, command{op: opPost, spec: -1, char: -1})
+
+	raw, err := fnt.MarshalBinary()
+	if err != nil {
+		return Font{}, err
+	}
+	// parse the font back, to record the positions of its commands.
+	return Parse(bytes.NewReader(raw))
+}
+
+// NewGlyph returns a new glyph, with the provided TFM width, escapements
+// and offsets.
+// Pixels of the mask with an alpha value of at least 0x80 are black.
+func NewGlyph(code rune, wd fixed.Int12_20, dx, dy fixed.Int16_16, hoff, voff int32, mask *image.Alpha) Glyph {
+	var (
+		w = mask.Rect.Dx()
+		h = mask.Rect.Dy()
+		m = image.NewAlpha(image.Rect(0, 0, w, h))
+	)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if mask.AlphaAt(mask.Rect.Min.X+x, mask.Rect.Min.Y+y).A >= 0x80 {
+				m.Pix[y*m.Stride+x] = 0xff
+			}
+		}
+	}
+	return Glyph{
+		code: code,
+		wd:   wd,
+		dx:   dx,
+		dy:   dy,
+		hoff: hoff,
+		voff: voff,
+		mask: m,
+	}
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (fnt *Font) MarshalBinary() ([]byte, error) {
+	var (
+		o = new(bytes.Buffer)
+		w = iobuf.NewWriter(o)
+	)
+	w.WriteU8(opPre)
+	w.WriteU8(pkID)
+	w.WriteU8(uint8(len(fnt.comment)))
+	w.WriteBuf([]byte(fnt.comment))
+	w.WriteU32(uint32(fnt.design))
+	w.WriteU32(fnt.checksum)
+	w.WriteU32(uint32(fnt.hppp))
+	w.WriteU32(uint32(fnt.vppp))
+
+	for _, cmd := range fnt.cmds {
+		switch {
+		case cmd.char >= 0:
+			fnt.glyphs[cmd.char].write(w)
+		case cmd.op == opYYY:
+			w.WriteU8(opYYY)
+			w.WriteI32(fnt.specials[cmd.spec].Value)
+		case cmd.op <= opXXX4:
+			data := fnt.specials[cmd.spec].Data
+			switch n := len(data); {
+			case n < 1<<8:
+				w.WriteU8(opXXX1)
+				w.WriteU8(uint8(n))
+			case n < 1<<16:
+				w.WriteU8(opXXX1 + 1)
+				w.WriteU16(uint16(n))
+			case n < 1<<24:
+				w.WriteU8(opXXX1 + 2)
+				w.WriteU24(uint32(n))
+			default:
+				w.WriteU8(opXXX4)
+				w.WriteU32(uint32(n))
+			}
+			w.WriteBuf(data)
+		case cmd.op == opPost:
+			w.WriteU8(opPost)
+		}
+	}
+	for o.Len()%4 != 0 {
+		w.WriteU8(opNoOp)
+	}
+	return o.Bytes(), nil
+}
+
+// write writes the character definition of the glyph.
+func (g *Glyph) write(w *iobuf.Writer) {
+	var (
+		wd = g.mask.Rect.Dx()
+		ht = g.mask.Rect.Dy()
+	)
+	w.WriteU8(g.flag)
+	switch g.flag & 7 {
+	case 0, 1, 2, 3:
+		w.WriteU8(uint8(g.pl))
+		w.WriteU8(uint8(g.code))
+		w.WriteU24(uint32(g.wd))
+		w.WriteU8(uint8(g.dx >> 16))
+		w.WriteU8(uint8(wd))
+		w.WriteU8(uint8(ht))
+		w.WriteI8(int8(g.hoff))
+		w.WriteI8(int8(g.voff))
+	case 4, 5, 6:
+		w.WriteU16(uint16(g.pl))
+		w.WriteU8(uint8(g.code))
+		w.WriteU24(uint32(g.wd))
+		w.WriteU16(uint16(g.dx >> 16))
+		w.WriteU16(uint16(wd))
+		w.WriteU16(uint16(ht))
+		w.WriteI16(int16(g.hoff))
+		w.WriteI16(int16(g.voff))
+	default:
+		w.WriteU32(uint32(g.pl))
+		w.WriteU32(uint32(g.code))
+		w.WriteU32(uint32(g.wd))
+		w.WriteU32(uint32(g.dx))
+		w.WriteU32(uint32(g.dy))
+		w.WriteU32(uint32(wd))
+		w.WriteU32(uint32(ht))
+		w.WriteI32(g.hoff)
+		w.WriteI32(g.voff)
+	}
+	w.WriteBuf(g.raster)
+}
+
+// pack encodes the bitmap of the glyph, and sets its flag byte, packet
+// length and raster, choosing the most compact encoding as gftopk does.
+func (g *Glyph) pack() {
+	var (
+		w    = g.mask.Rect.Dx()
+		h    = g.mask.Rect.Dy()
+		bit  = func(x, y int) bool { return g.mask.Pix[y*g.mask.Stride+x] != 0 }
+		dynf = 14
+		on   = false
+	)
+
+	var counts []int // run counts; repeat counts are negative.
+	if w*h != 0 {
+		counts, on = runCounts(g.mask)
+		dynf = 0
+	}
+
+	size := 0 // size of the packed raster, in nybbles.
+	if dynf == 0 {
+		var deriv [14]int
+		for _, j := range counts {
+			if j == -1 {
+				size++
+				continue
+			}
+			if j < 0 {
+				size++
+				j = -j
+			}
+			switch {
+			case j < 209:
+				size += 2
+			default:
+				k := j - 193
+				for k >= 16 {
+					k /= 16
+					size += 2
+				}
+				size++
+			}
+			switch {
+			case j < 14:
+				deriv[j]--
+			case j < 209:
+				deriv[(223-j)/15]++
+			default:
+				k := 16
+				for k*16 < j+3 {
+					k *= 16
+				}
+				if j-k <= 192 {
+					deriv[(207-j+k)/15] += 2
+				}
+			}
+		}
+		best := size
+		for i := 1; i <= 13; i++ {
+			size += deriv[i]
+			if size <= best {
+				best = size
+				dynf = i
+			}
+		}
+		size = best
+	}
+
+	var raster []byte
+	switch {
+	case dynf == 14 || (size+1)/2 > (w*h+7)/8:
+		dynf = 14
+		raster = make([]byte, (w*h+7)/8)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if i := y*w + x; bit(x, y) {
+					raster[i/8] |= 0x80 >> (i % 8)
+				}
+			}
+		}
+	default:
+		var nyb nybbleWriter
+		for _, j := range counts {
+			switch {
+			case j == -1:
+				nyb.put(15)
+			case j < 0:
+				nyb.put(14)
+				nyb.packed(-j, dynf)
+			default:
+				nyb.packed(j, dynf)
+			}
+		}
+		raster = nyb.p
+	}
+
+	g.flag = uint8(dynf) << 4
+	if on {
+		g.flag |= 8
+	}
+	g.raster = raster
+	n := len(raster)
+	switch {
+	case g.dy == 0 && g.dx&0xffff == 0 && g.dx >= 0 && g.dx>>16 < 1<<8 &&
+		g.code >= 0 && g.code < 1<<8 && g.wd >= 0 && g.wd < 1<<24 &&
+		w < 1<<8 && h < 1<<8 &&
+		-1<<7 <= g.hoff && g.hoff < 1<<7 && -1<<7 <= g.voff && g.voff < 1<<7 &&
+		n+8 < 1<<10:
+		g.pl = n + 8
+		g.flag |= uint8(g.pl >> 8)
+	case g.dy == 0 && g.dx&0xffff == 0 && g.dx >= 0 && g.dx>>16 < 1<<16 &&
+		g.code >= 0 && g.code < 1<<8 && g.wd >= 0 && g.wd < 1<<24 &&
+		w < 1<<16 && h < 1<<16 &&
+		-1<<15 <= g.hoff && g.hoff < 1<<15 && -1<<15 <= g.voff && g.voff < 1<<15 &&
+		n+13 < 3<<16:
+		g.pl = n + 13
+		g.flag |= uint8(g.pl>>16) + 4
+	default:
+		g.pl = n + 28
+		g.flag |= 7
+	}
+}
+
+// runCounts returns the run counts of the provided bitmap, with repeat
+// counts stored as negative values, and whether the first run is black.
+//
+// A row that is repeated, and is not all white or all black, is marked
+// with a repeat count right after the first run count ending in it.
+func runCounts(mask *image.Alpha) ([]int, bool) {
+	var (
+		w   = mask.Rect.Dx()
+		h   = mask.Rect.Dy()
+		row = func(y int) []byte { return mask.Pix[y*mask.Stride : y*mask.Stride+w] }
+		on  = mask.Pix[0] != 0
+		cur = on
+		run = 0
+
+		counts []int
+	)
+	for y := 0; y < h; y++ {
+		pix := row(y)
+		rep := 0
+		if !uniform(pix) {
+			for y+rep+1 < h && bytes.Equal(pix, row(y+rep+1)) {
+				rep++
+			}
+		}
+		marked := rep == 0
+		if !marked && y == 0 && on {
+			// the marker follows the empty white run of the first row.
+			counts = append(counts, -rep)
+			marked = true
+		}
+		for _, v := range pix {
+			if black := v != 0; black != cur {
+				counts = append(counts, run)
+				if !marked {
+					counts = append(counts, -rep)
+					marked = true
+				}
+				run = 0
+				cur = black
+			}
+			run++
+		}
+		y += rep
+	}
+	counts = append(counts, run)
+	return counts, on
+}
+
+func uniform(pix []byte) bool {
+	for _, v := range pix {
+		if v != pix[0] {
+			return false
+		}
+	}
+	return true
+}
+
+type nybbleWriter struct {
+	p []byte
+	n int // number of nybbles written.
+}
+
+func (nyb *nybbleWriter) put(v int) {
+	if nyb.n%2 == 0 {
+		nyb.p = append(nyb.p, uint8(v)<<4)
+	} else {
+		nyb.p[len(nyb.p)-1] |= uint8(v)
+	}
+	nyb.n++
+}
+
+// packed writes the packed number n.
+func (nyb *nybbleWriter) packed(n, dynf int) {
+	switch {
+	case n <= dynf:
+		nyb.put(n)
+	case n <= (13-dynf)*16+dynf:
+		n -= dynf + 1
+		nyb.put(n/16 + dynf + 1)
+		nyb.put(n % 16)
+	default:
+		n -= (13-dynf)*16 + dynf - 15
+		var digits []int
+		for ; n > 0; n /= 16 {
+			digits = append(digits, n%16)
+		}
+		for i := 1; i < len(digits); i++ {
+			nyb.put(0)
+		}
+		for i := len(digits) - 1; i >= 0; i-- {
+			nyb.put(digits[i])
+		}
+	}
+}
@@ -57,3 +57,25 @@ func (face *Face) GlyphAdvance(r rune) (adv fixed.Int12_20, ok bool) {
 	}
 	return fixed.Int12_20((int64(adv) * int64(face.scale)) >> 20), true
 }
+
+// GlyphHeight returns the height of r's glyph.
+//
+// It returns !ok if the face does not contain a glyph for r.
+func (face *Face) GlyphHeight(r rune) (ht fixed.Int12_20, ok bool) {
+	ht, ok = face.font.GlyphHeight(r)
+	if !ok {
+		return 0, ok
+	}
+	return fixed.Int12_20((int64(ht) * int64(face.scale)) >> 20), true
+}
+
+// GlyphDepth returns the depth of r's glyph.
+//
+// It returns !ok if the face does not contain a glyph for r.
+func (face *Face) GlyphDepth(r rune) (dp fixed.Int12_20, ok bool) {
+	dp, ok = face.font.GlyphDepth(r)
+	if !ok {
+		return 0, ok
+	}
+	return fixed.Int12_20((int64(dp) * int64(face.scale)) >> 20), true
+}
@@ -65,6 +65,12 @@ func Parse(r io.Reader) (Font, error) {
 	return fnt, nil
 }
 
+// Checksum returns the checksum of the font, as recorded by the TeX
+// documents using it.
+func (fnt *Font) Checksum() uint32 {
+	return fnt.body.header.chksum
+}
+
 func (fnt *Font) DesignSize() fixed.Int12_20 {
 	return fnt.body.header.designSize
 }
@@ -111,6 +117,32 @@ func (fnt *Font) GlyphAdvance(x rune) (fixed.Int12_20, bool) {
 	return fnt.body.width[g.wd()], true
 }
 
+// GlyphHeight returns the height of r's glyph.
+//
+// It returns !ok if the face does not contain a glyph for r.
+func (fnt *Font) GlyphHeight(x rune) (fixed.Int12_20, bool) {
+	i := int(x)
+	if !(int(fnt.hdr.bc) <= i && i <= int(fnt.hdr.ec)) {
+		return 0, false
+	}
+	i -= int(fnt.hdr.bc)
+	g := fnt.body.glyphs[i]
+	return fnt.body.height[g.ht()], true
+}
+
+// GlyphDepth returns the depth of r's glyph.
+//
+// It returns !ok if the face does not contain a glyph for r.
+func (fnt *Font) GlyphDepth(x rune) (fixed.Int12_20, bool) {
+	i := int(x)
+	if !(int(fnt.hdr.bc) <= i && i <= int(fnt.hdr.ec)) {
+		return 0, false
+	}
+	i -= int(fnt.hdr.bc)
+	g := fnt.body.glyphs[i]
+	return fnt.body.depth[g.dp()], true
+}
+
 func (fnt *Font) readHeader(r *iobuf.Reader) error {
 	hdr := &fnt.hdr
 	err := readHeader(r, hdr)
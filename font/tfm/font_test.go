@@ -7,6 +7,7 @@ package tfm
 import (
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -290,3 +291,67 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestGlyphMetrics(t *testing.T) {
+	f, err := os.Open("testdata/cmr10.tfm")
+	if err != nil {
+		t.Fatalf("could not open TFM file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse TFM file: %+v", err)
+	}
+
+	flt := func(v fixed.Int12_20) string {
+		return strconv.FormatFloat(float64(v)/(1<<20), 'f', 6, 64)
+	}
+
+	for _, tc := range []struct {
+		r          rune
+		wd, ht, dp string
+	}{
+		{'A', "0.750002", "0.683332", "0.000000"},
+		{'g', "0.500002", "0.430555", "0.194445"},
+	} {
+		wd, ok := fnt.GlyphAdvance(tc.r)
+		if !ok {
+			t.Fatalf("could not find glyph %q", tc.r)
+		}
+		ht, _ := fnt.GlyphHeight(tc.r)
+		dp, _ := fnt.GlyphDepth(tc.r)
+		for _, v := range []struct {
+			name      string
+			got, want string
+		}{
+			{"width", flt(wd), tc.wd},
+			{"height", flt(ht), tc.ht},
+			{"depth", flt(dp), tc.dp},
+		} {
+			if v.got != v.want {
+				t.Fatalf("invalid %s for %q: got=%s, want=%s", v.name, tc.r, v.got, v.want)
+			}
+		}
+	}
+
+	if _, ok := fnt.GlyphHeight(300); ok {
+		t.Fatalf("expected no glyph")
+	}
+	if _, ok := fnt.GlyphDepth(300); ok {
+		t.Fatalf("expected no glyph")
+	}
+
+	face := NewFace(&fnt, &FaceOptions{Size: 2 * fnt.DesignSize()})
+	ht, _ := face.GlyphHeight('g')
+	dp, _ := face.GlyphDepth('g')
+	if got, want := flt(ht), "8.611107"; got != want {
+		t.Fatalf("invalid face height: got=%s, want=%s", got, want)
+	}
+	if got, want := flt(dp), "3.888893"; got != want {
+		t.Fatalf("invalid face depth: got=%s, want=%s", got, want)
+	}
+	if _, ok := face.GlyphHeight(300); ok {
+		t.Fatalf("expected no glyph")
+	}
+}
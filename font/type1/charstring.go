@@ -0,0 +1,396 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package type1
+
+import (
+	"fmt"
+	"math"
+)
+
+// interp interprets Type 1 charstrings into glyph outlines.
+type interp struct {
+	fnt *Font
+	g   *Glyph
+
+	stack []float64
+	ps    []float64 // PostScript interpreter stack, for othersubrs.
+	x, y  float64   // current point.
+	dx    float64   // horizontal offset of the glyph, for seac accents.
+	dy    float64   // vertical offset of the glyph, for seac accents.
+	open  bool      // whether a contour is opened.
+	drawn bool      // whether the control box has been initialized.
+	width bool      // whether the glyph width has been set.
+
+	flex  bool
+	flexs []float64 // flex points.
+}
+
+var errEndChar = fmt.Errorf("endchar")
+
+func newInterp(fnt *Font, g *Glyph) *interp {
+	return &interp{fnt: fnt, g: g}
+}
+
+// run interprets the provided charstring.
+func (p *interp) run(cs []byte) error {
+	return p.glyph(cs, 0, 0, 0)
+}
+
+// glyph interprets the provided glyph charstring, drawn with an offset
+// (dx,dy).
+func (p *interp) glyph(cs []byte, dx, dy float64, depth int) error {
+	p.dx, p.dy = dx, dy
+	err := p.exec(cs, depth)
+	if err == errEndChar {
+		err = nil
+	}
+	return err
+}
+
+func (p *interp) exec(cs []byte, depth int) error {
+	if depth > 10 {
+		return fmt.Errorf("too many nested subroutines")
+	}
+	for i := 0; i < len(cs); i++ {
+		v := cs[i]
+		switch {
+		case v >= 32 && v <= 246:
+			p.push(float64(int32(v) - 139))
+			continue
+		case v >= 247 && v <= 250:
+			if i+1 >= len(cs) {
+				return fmt.Errorf("truncated charstring")
+			}
+			i++
+			p.push(float64((int32(v)-247)*256 + int32(cs[i]) + 108))
+			continue
+		case v >= 251 && v <= 254:
+			if i+1 >= len(cs) {
+				return fmt.Errorf("truncated charstring")
+			}
+			i++
+			p.push(float64(-(int32(v)-251)*256 - int32(cs[i]) - 108))
+			continue
+		case v == 255:
+			if i+4 >= len(cs) {
+				return fmt.Errorf("truncated charstring")
+			}
+			p.push(float64(int32(uint32(cs[i+1])<<24 | uint32(cs[i+2])<<16 | uint32(cs[i+3])<<8 | uint32(cs[i+4]))))
+			i += 4
+			continue
+		}
+
+		args := p.stack
+		switch v {
+		case 1, 3: // hstem, vstem
+		case 4: // vmoveto
+			if err := p.need(1); err != nil {
+				return err
+			}
+			p.moveto(0, args[0])
+		case 5: // rlineto
+			if err := p.need(2); err != nil {
+				return err
+			}
+			p.lineto(args[0], args[1])
+		case 6: // hlineto
+			if err := p.need(1); err != nil {
+				return err
+			}
+			p.lineto(args[0], 0)
+		case 7: // vlineto
+			if err := p.need(1); err != nil {
+				return err
+			}
+			p.lineto(0, args[0])
+		case 8: // rrcurveto
+			if err := p.need(6); err != nil {
+				return err
+			}
+			p.curveto(args[0], args[1], args[2], args[3], args[4], args[5])
+		case 9: // closepath
+			p.closepath()
+		case 10: // callsubr
+			if err := p.need(1); err != nil {
+				return err
+			}
+			n := int(args[len(args)-1])
+			p.stack = args[:len(args)-1]
+			if n < 0 || n >= len(p.fnt.subrs) {
+				return fmt.Errorf("invalid subroutine %d", n)
+			}
+			err := p.exec(p.fnt.subrs[n], depth+1)
+			if err != nil {
+				return err
+			}
+			continue
+		case 11: // return
+			return nil
+		case 13: // hsbw
+			if err := p.need(2); err != nil {
+				return err
+			}
+			p.sbw(args[0], 0, args[1], 0)
+		case 14: // endchar
+			p.closepath()
+			return errEndChar
+		case 21: // rmoveto
+			if err := p.need(2); err != nil {
+				return err
+			}
+			p.moveto(args[0], args[1])
+		case 22: // hmoveto
+			if err := p.need(1); err != nil {
+				return err
+			}
+			p.moveto(args[0], 0)
+		case 30: // vhcurveto
+			if err := p.need(4); err != nil {
+				return err
+			}
+			p.curveto(0, args[0], args[1], args[2], args[3], 0)
+		case 31: // hvcurveto
+			if err := p.need(4); err != nil {
+				return err
+			}
+			p.curveto(args[0], 0, args[1], args[2], 0, args[3])
+		case 12:
+			if i+1 >= len(cs) {
+				return fmt.Errorf("truncated charstring")
+			}
+			i++
+			err := p.escape(cs[i], depth)
+			if err != nil {
+				return err
+			}
+			switch cs[i] {
+			case 12, 16, 17:
+				// div, callothersubr and pop leave results on the stack.
+				continue
+			}
+		default:
+			return fmt.Errorf("invalid charstring operator %d", v)
+		}
+		p.stack = p.stack[:0]
+	}
+	return nil
+}
+
+func (p *interp) escape(op byte, depth int) error {
+	args := p.stack
+	switch op {
+	case 0, 1, 2: // dotsection, vstem3, hstem3
+	case 6: // seac
+		if err := p.need(5); err != nil {
+			return err
+		}
+		var (
+			asb    = args[0]
+			adx    = args[1]
+			ady    = args[2]
+			bchar  = int(args[3])
+			achar  = int(args[4])
+			base   = p.seacGlyph(bchar)
+			accent = p.seacGlyph(achar)
+		)
+		if base == nil || accent == nil {
+			return fmt.Errorf("invalid seac components %d and %d", bchar, achar)
+		}
+		p.g.comps = []string{StandardEncoding[bchar], StandardEncoding[achar]}
+		p.stack = p.stack[:0]
+		err := p.glyph(base, 0, 0, depth+1)
+		if err != nil {
+			return err
+		}
+		p.stack = p.stack[:0]
+		err = p.glyph(accent, adx-asb, ady, depth+1)
+		if err != nil {
+			return err
+		}
+		return errEndChar
+	case 7: // sbw
+		if err := p.need(4); err != nil {
+			return err
+		}
+		p.sbw(args[0], args[1], args[2], args[3])
+	case 12: // div
+		if err := p.need(2); err != nil {
+			return err
+		}
+		n := len(args)
+		if args[n-1] == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		p.stack = append(args[:n-2], args[n-2]/args[n-1])
+		return nil
+	case 16: // callothersubr
+		if err := p.need(2); err != nil {
+			return err
+		}
+		var (
+			n    = len(args)
+			subr = int(args[n-1])
+			narg = int(args[n-2])
+		)
+		if narg < 0 || narg > n-2 {
+			return fmt.Errorf("invalid number of othersubr arguments")
+		}
+		p.stack = args[:n-2-narg]
+		return p.othersubr(subr, args[n-2-narg:n-2])
+	case 17: // pop
+		if len(p.ps) == 0 {
+			return fmt.Errorf("empty PostScript stack")
+		}
+		n := len(p.ps)
+		p.stack = append(p.stack, p.ps[n-1])
+		p.ps = p.ps[:n-1]
+		return nil
+	case 33: // setcurrentpoint
+		if err := p.need(2); err != nil {
+			return err
+		}
+		p.x = p.dx + args[0]
+		p.y = p.dy + args[1]
+	default:
+		return fmt.Errorf("invalid charstring operator 12 %d", op)
+	}
+	p.stack = p.stack[:0]
+	return nil
+}
+
+// othersubr implements the flex and hint replacement othersubrs.
+func (p *interp) othersubr(subr int, args []float64) error {
+	switch subr {
+	case 0: // end of flex.
+		if len(p.flexs) != 2*7 || len(args) != 3 {
+			return fmt.Errorf("invalid flex")
+		}
+		pts := p.flexs[2:] // skip the reference point.
+		p.flex = false
+		p.flexs = p.flexs[:0]
+		for i := 0; i < 2; i++ {
+			pt := pts[6*i:]
+			p.abscurveto(pt[0], pt[1], pt[2], pt[3], pt[4], pt[5])
+		}
+		// results are popped and used by setcurrentpoint.
+		p.ps = append(p.ps[:0], args[2], args[1])
+	case 1: // start of flex.
+		p.flex = true
+		p.flexs = p.flexs[:0]
+		p.ps = p.ps[:0]
+	case 2: // flex point.
+		p.flexs = append(p.flexs, p.x, p.y)
+	default: // hint replacement and unknown othersubrs.
+		p.ps = p.ps[:0]
+		for i := len(args) - 1; i >= 0; i-- {
+			p.ps = append(p.ps, args[i])
+		}
+	}
+	return nil
+}
+
+// seacGlyph returns the charstring of the seac component with the
+// provided StandardEncoding character code.
+func (p *interp) seacGlyph(code int) []byte {
+	if code < 0 || code > 255 {
+		return nil
+	}
+	name := StandardEncoding[code]
+	if name == "" {
+		return nil
+	}
+	return p.fnt.chars[name]
+}
+
+func (p *interp) push(v float64) {
+	p.stack = append(p.stack, v)
+}
+
+func (p *interp) need(n int) error {
+	if len(p.stack) < n {
+		return fmt.Errorf("charstring stack underflow")
+	}
+	return nil
+}
+
+// sbw sets the side bearing point and the width vector of the glyph.
+// Only the first call is recorded, so the components of accented glyphs
+// do not override the metrics of the composite glyph.
+func (p *interp) sbw(sbx, sby, wx, wy float64) {
+	p.x = p.dx + sbx
+	p.y = p.dy + sby
+	if p.width {
+		return
+	}
+	p.g.sb = Point{sbx, sby}
+	p.g.adv = Point{wx, wy}
+	p.width = true
+}
+
+func (p *interp) moveto(dx, dy float64) {
+	p.x += dx
+	p.y += dy
+	if p.flex {
+		return
+	}
+	p.closepath()
+	p.segment(SegmentOpMoveTo, Point{p.x, p.y})
+}
+
+func (p *interp) lineto(dx, dy float64) {
+	p.x += dx
+	p.y += dy
+	p.segment(SegmentOpLineTo, Point{p.x, p.y})
+	p.open = true
+}
+
+func (p *interp) curveto(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	var (
+		x1 = p.x + dx1
+		y1 = p.y + dy1
+		x2 = x1 + dx2
+		y2 = y1 + dy2
+		x3 = x2 + dx3
+		y3 = y2 + dy3
+	)
+	p.abscurveto(x1, y1, x2, y2, x3, y3)
+}
+
+func (p *interp) abscurveto(x1, y1, x2, y2, x3, y3 float64) {
+	p.segment(SegmentOpCubeTo, Point{x1, y1}, Point{x2, y2}, Point{x3, y3})
+	p.x, p.y = x3, y3
+	p.open = true
+}
+
+func (p *interp) closepath() {
+	if !p.open {
+		return
+	}
+	p.segment(SegmentOpClose)
+	p.open = false
+}
+
+func (p *interp) segment(op SegmentOp, pts ...Point) {
+	seg := Segment{Op: op}
+	copy(seg.Args[:], pts)
+	p.g.segs = append(p.g.segs, seg)
+	for _, pt := range pts {
+		p.extend(pt)
+	}
+}
+
+// extend extends the control box of the glyph to the provided point.
+func (p *interp) extend(pt Point) {
+	bbox := &p.g.bbox
+	if !p.drawn {
+		*bbox = [4]float64{pt.X, pt.Y, pt.X, pt.Y}
+		p.drawn = true
+		return
+	}
+	bbox[0] = math.Min(bbox[0], pt.X)
+	bbox[1] = math.Min(bbox[1], pt.Y)
+	bbox[2] = math.Max(bbox[2], pt.X)
+	bbox[3] = math.Max(bbox[3], pt.Y)
+}
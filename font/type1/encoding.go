@@ -0,0 +1,47 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package type1
+
+// StandardEncoding is the Adobe StandardEncoding.
+var StandardEncoding = func() [256]string {
+	var enc [256]string
+	for i, name := range []string{
+		"space", "exclam", "quotedbl", "numbersign", "dollar", "percent",
+		"ampersand", "quoteright", "parenleft", "parenright", "asterisk",
+		"plus", "comma", "hyphen", "period", "slash",
+		"zero", "one", "two", "three", "four",
+		"five", "six", "seven", "eight", "nine",
+		"colon", "semicolon", "less", "equal", "greater", "question", "at",
+	} {
+		enc[32+i] = name
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		enc[c] = string(c)
+		enc[c+'a'-'A'] = string(c + 'a' - 'A')
+	}
+	for c, name := range map[int]string{
+		0133: "bracketleft", 0134: "backslash", 0135: "bracketright",
+		0136: "asciicircum", 0137: "underscore", 0140: "quoteleft",
+		0173: "braceleft", 0174: "bar", 0175: "braceright", 0176: "asciitilde",
+		0241: "exclamdown", 0242: "cent", 0243: "sterling", 0244: "fraction",
+		0245: "yen", 0246: "florin", 0247: "section", 0250: "currency",
+		0251: "quotesingle", 0252: "quotedblleft", 0253: "guillemotleft",
+		0254: "guilsinglleft", 0255: "guilsinglright", 0256: "fi", 0257: "fl",
+		0261: "endash", 0262: "dagger", 0263: "daggerdbl",
+		0264: "periodcentered", 0266: "paragraph", 0267: "bullet",
+		0270: "quotesinglbase", 0271: "quotedblbase", 0272: "quotedblright",
+		0273: "guillemotright", 0274: "ellipsis", 0275: "perthousand",
+		0277: "questiondown", 0301: "grave", 0302: "acute", 0303: "circumflex",
+		0304: "tilde", 0305: "macron", 0306: "breve", 0307: "dotaccent",
+		0310: "dieresis", 0312: "ring", 0313: "cedilla", 0315: "hungarumlaut",
+		0316: "ogonek", 0317: "caron", 0320: "emdash", 0341: "AE",
+		0343: "ordfeminine", 0350: "Lslash", 0351: "Oslash", 0352: "OE",
+		0353: "ordmasculine", 0361: "ae", 0365: "dotlessi", 0370: "lslash",
+		0371: "oslash", 0372: "oe", 0373: "germandbls",
+	} {
+		enc[c] = name
+	}
+	return enc
+}()
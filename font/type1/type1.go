@@ -0,0 +1,597 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package type1 implements a decoder for Type 1 font programs, in either
+// the PFB (binary) or PFA (ASCII) format.
+//
+// See:
+//   - https://adobe-type-tools.github.io/font-tech-notes/pdfs/T1_SPEC.pdf
+//
+// for more informations.
+package type1 // import "star-tex.org/x/tex/font/type1"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+const (
+	eexecKey      = 55665 // encryption key of the private dictionary.
+	charStringKey = 4330  // encryption key of charstrings.
+)
+
+// Font is a Type 1 font program.
+type Font struct {
+	name   string
+	full   string
+	family string
+	weight string
+	angle  float64
+	fixed  bool
+	matrix [6]float64
+	bbox   [4]float64
+	enc    [256]string
+
+	clear   []byte // clear-text portion of the font program.
+	private []byte // encrypted portion of the font program.
+	trailer []byte // fixed-content portion of the font program.
+
+	priv  []byte            // decrypted private dictionary.
+	cdict [4]int            // positions of the CharStrings count, dictionary, entries and end of entries in priv.
+	spans map[string][2]int // positions of the CharStrings entries in priv.
+
+	subrs  [][]byte          // decrypted subroutines.
+	names  []string          // glyph names, in font program order.
+	chars  map[string][]byte // decrypted charstrings.
+	glyphs map[string]*Glyph // interpreted glyphs.
+}
+
+// Parse decodes a Type 1 font program, in either the PFB or PFA format.
+func Parse(r io.Reader) (Font, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return Font{}, fmt.Errorf("type1: could not read font program: %w", err)
+	}
+
+	var clear, private, trailer []byte
+	switch {
+	case len(raw) > 0 && raw[0] == 0x80:
+		clear, private, trailer, err = readPFB(raw)
+	default:
+		clear, private, trailer, err = readPFA(raw)
+	}
+	if err != nil {
+		return Font{}, err
+	}
+
+	text := clear
+	fnt := Font{
+		name:   string(bytes.TrimPrefix(psToken(text, "/FontName"), []byte("/"))),
+		full:   psString(text, "/FullName"),
+		family: psString(text, "/FamilyName"),
+		weight: psString(text, "/Weight"),
+		fixed:  string(psToken(text, "/isFixedPitch")) == "true",
+		matrix: [6]float64{0.001, 0, 0, 0.001, 0, 0},
+		enc:    encoding(text),
+
+		clear:   clear,
+		private: private,
+		trailer: trailer,
+	}
+	if fnt.name == "" {
+		return Font{}, fmt.Errorf("type1: missing font name")
+	}
+	if v := psToken(text, "/ItalicAngle"); v != nil {
+		fnt.angle, _ = strconv.ParseFloat(string(v), 64)
+	}
+	if v := psArray(text, "/FontMatrix"); len(v) == len(fnt.matrix) {
+		copy(fnt.matrix[:], v)
+	}
+	copy(fnt.bbox[:], psArray(text, "/FontBBox"))
+
+	err = fnt.readPrivate(decrypt(private, eexecKey))
+	if err != nil {
+		return Font{}, err
+	}
+
+	return fnt, nil
+}
+
+// Segments returns the clear-text, encrypted and fixed-content portions
+// of the font program, as embedded in PDF FontFile streams.
+// The encrypted portion is in binary form, for PFA font programs too.
+func (fnt *Font) Segments() (clear, private, trailer []byte) {
+	return fnt.clear, fnt.private, fnt.trailer
+}
+
+// Subset returns a font program holding only the provided glyphs,
+// together with the .notdef glyph and the components of the accented
+// glyphs drawn with the seac operator.
+// Glyphs missing from the font are ignored.
+func (fnt *Font) Subset(glyphs []string) (Font, error) {
+	keep := map[string]bool{".notdef": true}
+	for _, name := range glyphs {
+		if _, ok := fnt.chars[name]; !ok {
+			continue
+		}
+		keep[name] = true
+		g, err := fnt.Glyph(name)
+		if err != nil {
+			continue
+		}
+		for _, c := range g.comps {
+			if _, ok := fnt.chars[c]; ok {
+				keep[c] = true
+			}
+		}
+	}
+
+	var (
+		o = new(bytes.Buffer)
+		n = 0
+	)
+	for _, name := range fnt.names {
+		if keep[name] {
+			n++
+		}
+	}
+	o.Write(fnt.priv[:fnt.cdict[0]])
+	fmt.Fprintf(o, " %d", n)
+	o.Write(fnt.priv[fnt.cdict[1]:fnt.cdict[2]])
+	for _, name := range fnt.names {
+		if keep[name] {
+			span := fnt.spans[name]
+			o.Write(fnt.priv[span[0]:span[1]])
+		}
+	}
+	o.Write(fnt.priv[fnt.cdict[3]:])
+
+	sub := *fnt
+	sub.private = encrypt(o.Bytes(), eexecKey)
+	sub.names = nil
+	err := sub.readPrivate(o.Bytes())
+	if err != nil {
+		return Font{}, fmt.Errorf("type1: could not subset font %q: %w", fnt.name, err)
+	}
+	return sub, nil
+}
+
+// Name returns the PostScript name of the font.
+func (fnt *Font) Name() string { return fnt.name }
+
+// FullName returns the full name of the font.
+func (fnt *Font) FullName() string { return fnt.full }
+
+// FamilyName returns the family name of the font.
+func (fnt *Font) FamilyName() string { return fnt.family }
+
+// Weight returns the weight of the font, e.g. "Medium".
+func (fnt *Font) Weight() string { return fnt.weight }
+
+// ItalicAngle returns the italic angle of the font, in degrees
+// counter-clockwise from the vertical.
+func (fnt *Font) ItalicAngle() float64 { return fnt.angle }
+
+// IsFixedPitch returns whether the font is a monospaced font.
+func (fnt *Font) IsFixedPitch() bool { return fnt.fixed }
+
+// FontMatrix returns the matrix mapping glyph space to text space.
+func (fnt *Font) FontMatrix() [6]float64 { return fnt.matrix }
+
+// FontBBox returns the bounding box of the font, in glyph space units.
+func (fnt *Font) FontBBox() [4]float64 { return fnt.bbox }
+
+// Encoding returns the built-in encoding of the font, mapping character
+// codes to glyph names.
+func (fnt *Font) Encoding() [256]string { return fnt.enc }
+
+// GlyphNames returns the names of the glyphs of the font, in font program
+// order.
+func (fnt *Font) GlyphNames() []string { return fnt.names }
+
+// Glyph returns the glyph with the provided name.
+func (fnt *Font) Glyph(name string) (*Glyph, error) {
+	if g, ok := fnt.glyphs[name]; ok {
+		return g, nil
+	}
+	cs, ok := fnt.chars[name]
+	if !ok {
+		return nil, fmt.Errorf("type1: no glyph %q in font %q", name, fnt.name)
+	}
+
+	g := &Glyph{name: name}
+	err := newInterp(fnt, g).run(cs)
+	if err != nil {
+		return nil, fmt.Errorf("type1: could not interpret glyph %q of font %q: %w", name, fnt.name, err)
+	}
+	fnt.glyphs[name] = g
+	return g, nil
+}
+
+// Glyph is a glyph of a Type 1 font, in glyph space units.
+type Glyph struct {
+	name string
+	sb   Point
+	adv  Point
+	segs []Segment
+	bbox [4]float64
+
+	comps []string // names of the base and accent glyphs of an accented glyph.
+}
+
+// Name returns the name of the glyph.
+func (g *Glyph) Name() string { return g.name }
+
+// SideBearing returns the left side bearing point of the glyph.
+func (g *Glyph) SideBearing() Point { return g.sb }
+
+// Advance returns the width vector of the glyph.
+func (g *Glyph) Advance() Point { return g.adv }
+
+// Segments returns the outline of the glyph.
+func (g *Glyph) Segments() []Segment { return g.segs }
+
+// Bounds returns the control box of the outline of the glyph, as
+// xmin, ymin, xmax, ymax.
+// The control box of a glyph without outline is the zero box.
+func (g *Glyph) Bounds() [4]float64 { return g.bbox }
+
+// Point is a point in glyph space.
+type Point struct {
+	X, Y float64
+}
+
+// SegmentOp is the operator of a path segment.
+type SegmentOp uint8
+
+const (
+	SegmentOpMoveTo SegmentOp = iota // starts a new contour.
+	SegmentOpLineTo                  // draws a line to Args[0].
+	SegmentOpCubeTo                  // draws a cubic Bézier curve to Args[2].
+	SegmentOpClose                   // closes the current contour.
+)
+
+// Segment is a segment of a glyph outline.
+//
+// MoveTo and LineTo segments use Args[0], CubeTo segments use Args[0]
+// and Args[1] as control points and Args[2] as end point.
+type Segment struct {
+	Op   SegmentOp
+	Args [3]Point
+}
+
+func readPFB(raw []byte) (clear, private, trailer []byte, err error) {
+	for len(raw) > 0 {
+		if len(raw) < 2 || raw[0] != 0x80 {
+			return nil, nil, nil, fmt.Errorf("type1: invalid PFB segment header")
+		}
+		kind := raw[1]
+		if kind == 3 {
+			break
+		}
+		if len(raw) < 6 {
+			return nil, nil, nil, fmt.Errorf("type1: invalid PFB segment header")
+		}
+		n := int(binary.LittleEndian.Uint32(raw[2:6]))
+		raw = raw[6:]
+		if n > len(raw) {
+			return nil, nil, nil, fmt.Errorf("type1: invalid PFB segment length")
+		}
+		seg := raw[:n]
+		raw = raw[n:]
+		switch {
+		case kind == 2:
+			private = append(private, seg...)
+		case kind == 1 && private == nil:
+			clear = append(clear, seg...)
+		case kind == 1:
+			trailer = append(trailer, seg...)
+		default:
+			return nil, nil, nil, fmt.Errorf("type1: invalid PFB segment type %d", kind)
+		}
+	}
+	if private == nil {
+		return nil, nil, nil, fmt.Errorf("type1: missing PFB encrypted segment")
+	}
+	return clear, private, trailer, nil
+}
+
+func readPFA(raw []byte) (clear, private, trailer []byte, err error) {
+	const eexec = "eexec"
+	i := bytes.Index(raw, []byte(eexec))
+	if i < 0 {
+		return nil, nil, nil, fmt.Errorf("type1: could not find eexec section in PFA font")
+	}
+	i += len(eexec)
+	for i < len(raw) && isSpace(raw[i]) {
+		i++
+	}
+	clear = raw[:i]
+
+	end := bytes.LastIndex(raw, []byte("cleartomark"))
+	if end < 0 {
+		end = len(raw)
+	}
+	// the encrypted portion is followed by 512 zeros, possibly with whitespace.
+	j, zeros := end, 0
+	for j > i && zeros < 512 {
+		j--
+		switch c := raw[j]; {
+		case c == '0':
+			zeros++
+		case isSpace(c):
+		default:
+			return nil, nil, nil, fmt.Errorf("type1: invalid PFA font trailer")
+		}
+	}
+	if zeros < 512 {
+		return nil, nil, nil, fmt.Errorf("type1: invalid PFA font trailer")
+	}
+	trailer = raw[j:]
+
+	src := make([]byte, 0, j-i)
+	for _, c := range raw[i:j] {
+		if !isSpace(c) {
+			src = append(src, c)
+		}
+	}
+	private = make([]byte, hex.DecodedLen(len(src)))
+	_, err = hex.Decode(private, src)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("type1: could not decode PFA encrypted section: %w", err)
+	}
+	return clear, private, trailer, nil
+}
+
+// readPrivate reads the subroutines and charstrings of the decrypted
+// private dictionary.
+func (fnt *Font) readPrivate(priv []byte) error {
+	lenIV := 4
+	if v := psToken(priv, "/lenIV"); v != nil {
+		lenIV, _ = strconv.Atoi(string(v))
+	}
+	// a negative lenIV indicates charstrings are not encrypted.
+	plain := func(cs []byte) []byte {
+		if lenIV < 0 {
+			return cs
+		}
+		cs = decrypt(cs, charStringKey)
+		if lenIV > len(cs) {
+			return nil
+		}
+		return cs[lenIV:]
+	}
+
+	if i := bytes.Index(priv, []byte("/Subrs")); i >= 0 {
+		tok, rest := psNext(priv[i+len("/Subrs"):])
+		n, err := strconv.Atoi(string(tok))
+		if err != nil || n < 0 {
+			return fmt.Errorf("type1: invalid Subrs array of font %q", fnt.name)
+		}
+		fnt.subrs = make([][]byte, n)
+		_, rest = psNext(rest) // array
+	loop:
+		for {
+			tok, rest = psNext(rest)
+			switch string(tok) {
+			case "dup":
+			case "NP", "|", "noaccess", "put":
+				continue
+			default:
+				break loop
+			}
+			tok, rest = psNext(rest)
+			idx, err := strconv.Atoi(string(tok))
+			if err != nil || idx < 0 || idx >= len(fnt.subrs) {
+				return fmt.Errorf("type1: invalid subroutine index %q of font %q", tok, fnt.name)
+			}
+			var cs []byte
+			cs, rest, err = psBinary(rest)
+			if err != nil {
+				return fmt.Errorf("type1: invalid subroutine %d of font %q: %w", idx, fnt.name, err)
+			}
+			fnt.subrs[idx] = plain(cs)
+		}
+	}
+
+	i := bytes.Index(priv, []byte("/CharStrings"))
+	if i < 0 {
+		return fmt.Errorf("type1: could not find CharStrings of font %q", fnt.name)
+	}
+	i += len("/CharStrings")
+	m := reCharStrings.FindSubmatchIndex(priv[i:])
+	if m == nil || m[0] != 0 {
+		return fmt.Errorf("type1: invalid CharStrings dictionary of font %q", fnt.name)
+	}
+	rest := priv[i+m[1]:]
+	pos := func() int { return len(priv) - len(rest) }
+
+	fnt.priv = priv
+	fnt.cdict = [4]int{i, i + m[4], i + m[1]}
+	fnt.spans = make(map[string][2]int)
+	fnt.chars = make(map[string][]byte)
+	fnt.glyphs = make(map[string]*Glyph)
+	for {
+		rest = bytes.TrimLeft(rest, " \t\r\n")
+		if len(rest) == 0 || rest[0] != '/' {
+			break
+		}
+		var (
+			beg     = pos()
+			tok, cs []byte
+			err     error
+		)
+		tok, rest = psNext(rest)
+		name := string(tok[1:])
+		cs, rest, err = psBinary(rest)
+		if err != nil {
+			return fmt.Errorf("type1: invalid charstring %q of font %q: %w", name, fnt.name, err)
+		}
+		_, rest = psNext(rest) // ND
+		// an entry spans up to the end of its line.
+		if j := bytes.IndexByte(rest, '\n'); j >= 0 && len(bytes.TrimSpace(rest[:j])) == 0 {
+			rest = rest[j+1:]
+		}
+		if _, dup := fnt.chars[name]; !dup {
+			fnt.names = append(fnt.names, name)
+		}
+		fnt.chars[name] = plain(cs)
+		fnt.spans[name] = [2]int{beg, pos()}
+	}
+	fnt.cdict[3] = pos()
+
+	return nil
+}
+
+var (
+	reCharStrings = regexp.MustCompile(`^\s*(\d+)(\s+dict\s+dup\s+begin\s*)`)
+	reEncoding    = regexp.MustCompile(`dup\s+(\d+)\s*/([^\s/\[\]{}()<>]+)\s+put`)
+)
+
+// encoding returns the built-in encoding of the clear-text font program.
+func encoding(src []byte) [256]string {
+	var enc [256]string
+	i := bytes.Index(src, []byte("/Encoding"))
+	if i < 0 {
+		return enc
+	}
+	src = src[i+len("/Encoding"):]
+	if bytes.HasPrefix(bytes.TrimLeft(src, " \t\r\n"), []byte("StandardEncoding")) {
+		return StandardEncoding
+	}
+	if j := bytes.Index(src, []byte("readonly def")); j >= 0 {
+		src = src[:j]
+	}
+	for _, m := range reEncoding.FindAllSubmatch(src, -1) {
+		code, err := strconv.Atoi(string(m[1]))
+		if err != nil || code < 0 || code > 255 {
+			continue
+		}
+		enc[code] = string(m[2])
+	}
+	return enc
+}
+
+// psToken returns the PostScript token following key in src.
+func psToken(src []byte, key string) []byte {
+	i := bytes.Index(src, []byte(key))
+	if i < 0 {
+		return nil
+	}
+	tok, _ := psNext(src[i+len(key):])
+	if len(tok) == 0 {
+		return nil
+	}
+	return tok
+}
+
+// psString returns the PostScript string following key in src.
+func psString(src []byte, key string) string {
+	i := bytes.Index(src, []byte(key))
+	if i < 0 {
+		return ""
+	}
+	src = bytes.TrimLeft(src[i+len(key):], " \t\r\n")
+	if len(src) == 0 || src[0] != '(' {
+		return ""
+	}
+	depth := 0
+	for j := 0; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(src[1:j])
+			}
+		}
+	}
+	return ""
+}
+
+// psArray returns the numbers of the PostScript array or procedure
+// following key in src.
+func psArray(src []byte, key string) []float64 {
+	i := bytes.Index(src, []byte(key))
+	if i < 0 {
+		return nil
+	}
+	src = src[i+len(key):]
+	if j := bytes.IndexAny(src, "]}"); j >= 0 {
+		src = src[:j]
+	}
+	src = bytes.Trim(src, " \t\r\n{[")
+	var vs []float64
+	for _, tok := range bytes.Fields(src) {
+		v, err := strconv.ParseFloat(string(tok), 64)
+		if err != nil {
+			return nil
+		}
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// psNext returns the next whitespace-delimited token of src, and the
+// remaining bytes following it.
+func psNext(src []byte) (tok, rest []byte) {
+	i := 0
+	for i < len(src) && isSpace(src[i]) {
+		i++
+	}
+	j := i
+	for j < len(src) && !isSpace(src[j]) {
+		j++
+	}
+	return src[i:j], src[j:]
+}
+
+// psBinary decodes a "n RD <n bytes>" binary string.
+func psBinary(src []byte) (bin, rest []byte, err error) {
+	tok, rest := psNext(src)
+	n, err := strconv.Atoi(string(tok))
+	if err != nil || n < 0 {
+		return nil, nil, fmt.Errorf("invalid binary string length %q", tok)
+	}
+	_, rest = psNext(rest) // RD
+	if len(rest) < 1+n {
+		return nil, nil, fmt.Errorf("truncated binary string")
+	}
+	return rest[1 : 1+n], rest[1+n:], nil
+}
+
+func decrypt(src []byte, r uint16) []byte {
+	dst := make([]byte, len(src))
+	for i, c := range src {
+		dst[i] = c ^ byte(r>>8)
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	return dst
+}
+
+func encrypt(src []byte, r uint16) []byte {
+	dst := make([]byte, len(src))
+	for i, c := range src {
+		e := c ^ byte(r>>8)
+		dst[i] = e
+		r = (uint16(e)+r)*52845 + 22719
+	}
+	return dst
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,392 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package type1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const cmr10 = "../../internal/tds/fonts/type1/public/amsfonts/cm/cmr10.pfb"
+
+func TestFont(t *testing.T) {
+	raw, err := os.ReadFile(cmr10)
+	if err != nil {
+		t.Fatalf("could not read font file: %+v", err)
+	}
+
+	fnt, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("could not parse font: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"name", fnt.Name(), "CMR10"},
+		{"full-name", fnt.FullName(), "CMR10"},
+		{"family-name", fnt.FamilyName(), "Computer Modern"},
+		{"weight", fnt.Weight(), "Medium"},
+		{"italic-angle", fnt.ItalicAngle(), 0.0},
+		{"fixed-pitch", fnt.IsFixedPitch(), false},
+		{"font-matrix", fnt.FontMatrix(), [6]float64{0.001, 0, 0, 0.001, 0, 0}},
+		{"font-bbox", fnt.FontBBox(), [4]float64{-40, -250, 1009, 750}},
+		{"num-glyphs", len(fnt.GlyphNames()), 132},
+		{"enc-A", fnt.Encoding()['A'], "A"},
+		{"enc-fi", fnt.Encoding()[014], "fi"},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Fatalf("invalid %s: got=%v, want=%v", tc.name, tc.got, tc.want)
+		}
+	}
+
+	for _, name := range fnt.GlyphNames() {
+		_, err := fnt.Glyph(name)
+		if err != nil {
+			t.Fatalf("could not interpret glyph %q: %+v", name, err)
+		}
+	}
+
+	g, err := fnt.Glyph("A")
+	if err != nil {
+		t.Fatalf("could not load glyph: %+v", err)
+	}
+	if got, want := g.SideBearing(), (Point{32, 0}); got != want {
+		t.Fatalf("invalid side bearing: got=%v, want=%v", got, want)
+	}
+	if got, want := g.Advance(), (Point{750, 0}); got != want {
+		t.Fatalf("invalid advance: got=%v, want=%v", got, want)
+	}
+	if got, want := g.Bounds(), [4]float64{32, 0, 717, 716}; got != want {
+		t.Fatalf("invalid bounds: got=%v, want=%v", got, want)
+	}
+	segs := g.Segments()
+	if got, want := len(segs), 27; got != want {
+		t.Fatalf("invalid number of segments: got=%d, want=%d", got, want)
+	}
+	if got, want := segs[0], (Segment{Op: SegmentOpMoveTo, Args: [3]Point{{398, 696}}}); got != want {
+		t.Fatalf("invalid first segment: got=%v, want=%v", got, want)
+	}
+	if got, want := segs[len(segs)-1].Op, SegmentOpClose; got != want {
+		t.Fatalf("invalid last segment: got=%v, want=%v", got, want)
+	}
+
+	g, err = fnt.Glyph("space")
+	if err != nil {
+		t.Fatalf("could not load glyph: %+v", err)
+	}
+	if got, want := g.Advance(), (Point{333, 0}); got != want {
+		t.Fatalf("invalid advance: got=%v, want=%v", got, want)
+	}
+	if len(g.Segments()) != 0 || g.Bounds() != [4]float64{} {
+		t.Fatalf("invalid empty glyph: %v %v", g.Segments(), g.Bounds())
+	}
+
+	_, err = fnt.Glyph("not-there")
+	if err == nil {
+		t.Fatalf("expected an error for a missing glyph")
+	}
+
+	pfa, err := Parse(bytes.NewReader(toPFA(t, raw)))
+	if err != nil {
+		t.Fatalf("could not parse PFA font: %+v", err)
+	}
+	fnt.glyphs = make(map[string]*Glyph)
+	if !reflect.DeepEqual(pfa, fnt) {
+		t.Fatalf("PFB and PFA fonts differ")
+	}
+}
+
+func TestSeac(t *testing.T) {
+	fnt := newFont(map[string]string{
+		"A":      "0 600 hsbw 0 0 rmoveto 100 0 rlineto 0 100 rlineto closepath endchar",
+		"grave":  "10 300 hsbw 0 0 rmoveto 10 10 rlineto endchar",
+		"Agrave": "0 600 hsbw 10 50 100 65 193 seac",
+	})
+
+	g, err := fnt.Glyph("Agrave")
+	if err != nil {
+		t.Fatalf("could not interpret glyph: %+v", err)
+	}
+	if got, want := g.Advance(), (Point{600, 0}); got != want {
+		t.Fatalf("invalid advance: got=%v, want=%v", got, want)
+	}
+	want := []Segment{
+		{Op: SegmentOpMoveTo, Args: [3]Point{{0, 0}}},
+		{Op: SegmentOpLineTo, Args: [3]Point{{100, 0}}},
+		{Op: SegmentOpLineTo, Args: [3]Point{{100, 100}}},
+		{Op: SegmentOpClose},
+		{Op: SegmentOpMoveTo, Args: [3]Point{{50, 100}}},
+		{Op: SegmentOpLineTo, Args: [3]Point{{60, 110}}},
+		{Op: SegmentOpClose},
+	}
+	if got := g.Segments(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid segments:\ngot= %v\nwant=%v", got, want)
+	}
+	if got, want := g.Bounds(), [4]float64{0, 0, 100, 110}; got != want {
+		t.Fatalf("invalid bounds: got=%v, want=%v", got, want)
+	}
+}
+
+func TestFlex(t *testing.T) {
+	fnt := newFont(map[string]string{
+		"a": strings.Join([]string{
+			"0 500 hsbw 0 0 rmoveto",
+			"0 1 callothersubr",
+			"20 0 rmoveto 0 2 callothersubr",
+			"-10 10 rmoveto 0 2 callothersubr",
+			"10 0 rmoveto 0 2 callothersubr",
+			"10 -10 rmoveto 0 2 callothersubr",
+			"10 -10 rmoveto 0 2 callothersubr",
+			"10 0 rmoveto 0 2 callothersubr",
+			"-10 10 rmoveto 0 2 callothersubr",
+			"50 40 0 3 0 callothersubr pop pop setcurrentpoint",
+			"0 10 rlineto closepath endchar",
+		}, " "),
+	})
+
+	g, err := fnt.Glyph("a")
+	if err != nil {
+		t.Fatalf("could not interpret glyph: %+v", err)
+	}
+	want := []Segment{
+		{Op: SegmentOpMoveTo, Args: [3]Point{{0, 0}}},
+		{Op: SegmentOpCubeTo, Args: [3]Point{{10, 10}, {20, 10}, {30, 0}}},
+		{Op: SegmentOpCubeTo, Args: [3]Point{{40, -10}, {50, -10}, {40, 0}}},
+		{Op: SegmentOpLineTo, Args: [3]Point{{40, 10}}},
+		{Op: SegmentOpClose},
+	}
+	if got := g.Segments(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid segments:\ngot= %v\nwant=%v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  string
+		err  string
+	}{
+		{"empty", "", "type1: could not find eexec section in PFA font"},
+		{"pfb-header", "\x80\x01\x10", "type1: invalid PFB segment header"},
+		{"pfb-length", "\x80\x01\x10\x00\x00\x00abc", "type1: invalid PFB segment length"},
+		{"pfb-type", "\x80\x07\x01\x00\x00\x00a", "type1: invalid PFB segment type 7"},
+		{"pfb-eexec", "\x80\x01\x01\x00\x00\x00a\x80\x03", "type1: missing PFB encrypted segment"},
+		{"pfa-trailer", "/FontName /X def currentfile eexec 0123 cleartomark", "type1: invalid PFA font trailer"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.raw))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if got, want := err.Error(), tc.err; got != want {
+				t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+			}
+		})
+	}
+}
+
+func TestSubset(t *testing.T) {
+	f, err := os.Open(cmr10)
+	if err != nil {
+		t.Fatalf("could not open font file: %+v", err)
+	}
+	defer f.Close()
+
+	fnt, err := Parse(f)
+	if err != nil {
+		t.Fatalf("could not parse font: %+v", err)
+	}
+
+	sub, err := fnt.Subset([]string{"H", "e", "missing"})
+	if err != nil {
+		t.Fatalf("could not subset font: %+v", err)
+	}
+	if got, want := sub.Name(), fnt.Name(); got != want {
+		t.Fatalf("invalid subset name: got=%q, want=%q", got, want)
+	}
+	if got, want := sub.GlyphNames(), []string{".notdef", "H", "e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid subset glyphs:\ngot= %q\nwant=%q", got, want)
+	}
+
+	clear, private, trailer := sub.Segments()
+	if len(private) >= len(fnt.private) {
+		t.Fatalf("subset is not smaller than original font")
+	}
+	if !bytes.Equal(clear, fnt.clear) || !bytes.Equal(trailer, fnt.trailer) {
+		t.Fatalf("invalid clear-text or fixed-content portions")
+	}
+	priv := decrypt(private, eexecKey)
+	if !bytes.Contains(priv, []byte("/CharStrings 3 dict dup begin")) {
+		t.Fatalf("invalid number of charstrings")
+	}
+	for _, name := range sub.GlyphNames() {
+		got, err := sub.Glyph(name)
+		if err != nil {
+			t.Fatalf("could not interpret glyph %q: %+v", name, err)
+		}
+		want, err := fnt.Glyph(name)
+		if err != nil {
+			t.Fatalf("could not interpret glyph %q: %+v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("invalid subset glyph %q", name)
+		}
+	}
+}
+
+func TestSubsetSeac(t *testing.T) {
+	fnt, err := Parse(bytes.NewReader(newPFB(map[string]string{
+		".notdef": "0 0 hsbw endchar",
+		"A":       "0 600 hsbw 0 0 rmoveto 100 0 rlineto 0 100 rlineto closepath endchar",
+		"B":       "0 600 hsbw 0 0 rmoveto 100 100 rlineto closepath endchar",
+		"grave":   "10 300 hsbw 0 0 rmoveto 10 10 rlineto endchar",
+		"Agrave":  "0 600 hsbw 10 50 100 65 193 seac",
+	})))
+	if err != nil {
+		t.Fatalf("could not parse font: %+v", err)
+	}
+
+	sub, err := fnt.Subset([]string{"Agrave"})
+	if err != nil {
+		t.Fatalf("could not subset font: %+v", err)
+	}
+	if got, want := sub.GlyphNames(), []string{".notdef", "A", "Agrave", "grave"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid subset glyphs:\ngot= %q\nwant=%q", got, want)
+	}
+	g, err := sub.Glyph("Agrave")
+	if err != nil {
+		t.Fatalf("could not interpret glyph: %+v", err)
+	}
+	if got, want := len(g.Segments()), 7; got != want {
+		t.Fatalf("invalid number of segments: got=%d, want=%d", got, want)
+	}
+}
+
+func TestCrypt(t *testing.T) {
+	want := []byte("/CharStrings 2 dict dup begin\n")
+	got := decrypt(encrypt(want, eexecKey), eexecKey)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("invalid round-trip: got=%q, want=%q", got, want)
+	}
+}
+
+// newFont returns a font with the provided glyphs, described as
+// charstring programs.
+func newFont(glyphs map[string]string) *Font {
+	fnt := &Font{
+		name:   "test",
+		chars:  make(map[string][]byte),
+		glyphs: make(map[string]*Glyph),
+	}
+	for name, src := range glyphs {
+		fnt.chars[name] = compile(src)
+	}
+	return fnt
+}
+
+// compile compiles a charstring program into its (unencrypted) binary form.
+func compile(src string) []byte {
+	ops := map[string][]byte{
+		"rmoveto": {21}, "rlineto": {5}, "closepath": {9}, "hsbw": {13},
+		"endchar": {14}, "callsubr": {10}, "seac": {12, 6}, "div": {12, 12},
+		"callothersubr": {12, 16}, "pop": {12, 17}, "setcurrentpoint": {12, 33},
+	}
+	var cs []byte
+	for _, tok := range strings.Fields(src) {
+		if op, ok := ops[tok]; ok {
+			cs = append(cs, op...)
+			continue
+		}
+		v, err := strconv.Atoi(tok)
+		if err != nil {
+			panic(err)
+		}
+		switch {
+		case -107 <= v && v <= 107:
+			cs = append(cs, byte(v+139))
+		case 108 <= v && v <= 1131:
+			v -= 108
+			cs = append(cs, byte(v/256+247), byte(v%256))
+		case -1131 <= v && v <= -108:
+			v = -v - 108
+			cs = append(cs, byte(v/256+251), byte(v%256))
+		default:
+			cs = append(cs, 255, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(cs[len(cs)-4:], uint32(int32(v)))
+		}
+	}
+	return cs
+}
+
+// newPFB returns a PFB font program with the provided glyphs, described
+// as charstring programs.
+func newPFB(glyphs map[string]string) []byte {
+	names := make([]string, 0, len(glyphs))
+	for name := range glyphs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var priv bytes.Buffer
+	priv.WriteString("dup /Private 8 dict dup begin /lenIV 4 def\n")
+	fmt.Fprintf(&priv, "2 index /CharStrings %d dict dup begin\n", len(names))
+	for _, name := range names {
+		cs := encrypt(append([]byte{0, 0, 0, 0}, compile(glyphs[name])...), charStringKey)
+		fmt.Fprintf(&priv, "/%s %d RD ", name, len(cs))
+		priv.Write(cs)
+		priv.WriteString(" ND\n")
+	}
+	priv.WriteString("end\nend\nreadonly put\nmark currentfile closefile\n")
+
+	var (
+		o   bytes.Buffer
+		seg = func(kind byte, data []byte) {
+			o.Write([]byte{0x80, kind, 0, 0, 0, 0})
+			binary.LittleEndian.PutUint32(o.Bytes()[o.Len()-4:], uint32(len(data)))
+			o.Write(data)
+		}
+	)
+	seg(1, []byte("%!PS-AdobeFont-1.0: Test\n/FontName /Test def\ncurrentfile eexec\n"))
+	seg(2, encrypt(append([]byte{0, 0, 0, 0}, priv.Bytes()...), eexecKey))
+	seg(1, []byte(strings.Repeat("0", 512)+"\ncleartomark\n"))
+	o.Write([]byte{0x80, 3})
+	return o.Bytes()
+}
+
+// toPFA converts a PFB font program into the PFA format.
+func toPFA(t *testing.T, raw []byte) []byte {
+	t.Helper()
+
+	var o bytes.Buffer
+	for len(raw) >= 6 && raw[1] != 3 {
+		var (
+			kind = raw[1]
+			n    = int(binary.LittleEndian.Uint32(raw[2:6]))
+			seg  = raw[6 : 6+n]
+		)
+		raw = raw[6+n:]
+		if kind == 1 {
+			o.Write(seg)
+			continue
+		}
+		enc := hex.EncodeToString(seg)
+		for len(enc) > 64 {
+			o.WriteString(enc[:64] + "\n")
+			enc = enc[64:]
+		}
+		o.WriteString(enc + "\n")
+	}
+	return o.Bytes()
+}
@@ -0,0 +1,135 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vf
+
+import (
+	"fmt"
+	"io"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+func (fnt *Font) readPreamble(r *iobuf.Reader) error {
+	if r.Len()-r.Pos() < 3 {
+		return io.ErrUnexpectedEOF
+	}
+	if op := r.ReadU8(); op != opPre {
+		return fmt.Errorf("invalid VF preamble opcode %d", op)
+	}
+	if id := r.ReadU8(); id != vfID {
+		return fmt.Errorf("invalid VF identification byte %d", id)
+	}
+	n := int(r.ReadU8())
+	if r.Len()-r.Pos() < n+8 {
+		return io.ErrUnexpectedEOF
+	}
+	fnt.comment = string(r.ReadBuf(n))
+	fnt.checksum = r.ReadU32()
+	fnt.design = fixed.Int12_20(r.ReadU32())
+	return nil
+}
+
+func (fnt *Font) readBody(r *iobuf.Reader) error {
+	for {
+		if r.Pos() >= r.Len() {
+			return fmt.Errorf("missing VF postamble")
+		}
+		pos := r.Pos()
+		switch op := r.ReadU8(); {
+		case op < opLongChar:
+			if len(fnt.fonts) == 0 {
+				return fmt.Errorf("missing font definition before character at %d", pos)
+			}
+			if r.Len()-r.Pos() < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			var (
+				n    = int(op)
+				code = rune(r.ReadU8())
+				wd   = fixed.Int12_20(r.ReadU24())
+			)
+			err := fnt.addGlyph(r, code, wd, n)
+			if err != nil {
+				return fmt.Errorf("could not read character at %d: %w", pos, err)
+			}
+		case op == opLongChar:
+			if len(fnt.fonts) == 0 {
+				return fmt.Errorf("missing font definition before character at %d", pos)
+			}
+			if r.Len()-r.Pos() < 12 {
+				return io.ErrUnexpectedEOF
+			}
+			var (
+				n    = int(r.ReadU32())
+				code = rune(r.ReadU32())
+				wd   = fixed.Int12_20(r.ReadU32())
+			)
+			err := fnt.addGlyph(r, code, wd, n)
+			if err != nil {
+				return fmt.Errorf("could not read character at %d: %w", pos, err)
+			}
+		case op <= opFntDef4:
+			if len(fnt.glyphs) > 0 {
+				return fmt.Errorf("invalid font definition at %d after characters", pos)
+			}
+			def, err := readFontDef(r, int(op-opFntDef1)+1)
+			if err != nil {
+				return fmt.Errorf("could not read font definition at %d: %w", pos, err)
+			}
+			fnt.fonts = append(fnt.fonts, def)
+		case op == opPre:
+			return fmt.Errorf("invalid VF preamble at %d", pos)
+		case op == opPost:
+			for r.Pos() < r.Len() {
+				if op := r.ReadU8(); op != opPost {
+					return fmt.Errorf("invalid opcode %d after VF postamble", op)
+				}
+			}
+			return nil
+		default:
+			return fmt.Errorf("invalid VF opcode %d at %d", op, pos)
+		}
+	}
+}
+
+func (fnt *Font) addGlyph(r *iobuf.Reader, code rune, wd fixed.Int12_20, n int) error {
+	if n < 0 || r.Len()-r.Pos() < n {
+		return io.ErrUnexpectedEOF
+	}
+	if _, dup := fnt.index[code]; dup {
+		return fmt.Errorf("duplicate character %d", code)
+	}
+	fnt.index[code] = len(fnt.glyphs)
+	fnt.glyphs = append(fnt.glyphs, Glyph{
+		code: code,
+		wd:   wd,
+		dvi:  append([]byte(nil), r.ReadBuf(n)...),
+	})
+	return nil
+}
+
+func readFontDef(r *iobuf.Reader, k int) (FontDef, error) {
+	if r.Len()-r.Pos() < k+14 {
+		return FontDef{}, io.ErrUnexpectedEOF
+	}
+	var def FontDef
+	for _, v := range r.ReadBuf(k) {
+		def.ID = def.ID<<8 | uint32(v)
+	}
+	def.Checksum = r.ReadU32()
+	def.Scale = fixed.Int12_20(r.ReadU32())
+	def.Design = fixed.Int12_20(r.ReadU32())
+	var (
+		a = int(r.ReadU8())
+		l = int(r.ReadU8())
+	)
+	if r.Len()-r.Pos() < a+l {
+		return def, io.ErrUnexpectedEOF
+	}
+	def.Area = string(r.ReadBuf(a))
+	def.Name = string(r.ReadBuf(l))
+	return def, nil
+}
@@ -0,0 +1,143 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vf implements a decoder for VF (virtual font) files.
+//
+// A virtual font describes each of its characters as a packet of DVI
+// commands, drawing characters of other (local) fonts.
+//
+// More informations about the VF format can be found in the vftype
+// program of TeX Live.
+package vf // import "star-tex.org/x/tex/font/vf"
+
+import (
+	"fmt"
+	"io"
+
+	"star-tex.org/x/tex/font/fixed"
+	"star-tex.org/x/tex/internal/iobuf"
+)
+
+// Font is a virtual font.
+type Font struct {
+	comment  string
+	checksum uint32
+	design   fixed.Int12_20
+
+	fonts  []FontDef
+	glyphs []Glyph
+	index  map[rune]int
+}
+
+// FontDef is the definition of a local font of a virtual font.
+type FontDef struct {
+	ID       uint32
+	Checksum uint32
+	Scale    fixed.Int12_20 // scale factor of the font, relative to the size of the virtual font.
+	Design   fixed.Int12_20 // design size of the font, in points.
+	Area     string
+	Name     string
+}
+
+// Glyph is a character of a virtual font.
+type Glyph struct {
+	code rune
+	wd   fixed.Int12_20
+	dvi  []byte
+}
+
+const (
+	opLongChar = 242
+	opFntDef1  = 243
+	opFntDef4  = 246
+	opPre      = 247
+	opPost     = 248
+
+	vfID = 202
+)
+
+// Parse parses a VF font file.
+func Parse(r io.Reader) (Font, error) {
+	fnt := Font{index: make(map[rune]int)}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return fnt, fmt.Errorf("could not read VF file: %w", err)
+	}
+
+	rr := iobuf.NewReader(p)
+	err = fnt.readPreamble(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse VF file preamble: %w", err)
+	}
+
+	err = fnt.readBody(rr)
+	if err != nil {
+		return fnt, fmt.Errorf("could not parse VF file: %w", err)
+	}
+
+	return fnt, nil
+}
+
+// Comment returns the comment of the VF file preamble.
+func (fnt *Font) Comment() string {
+	return fnt.comment
+}
+
+// Checksum returns the checksum of the font, which should match the one
+// of the TFM file.
+func (fnt *Font) Checksum() uint32 {
+	return fnt.checksum
+}
+
+// DesignSize returns the design size of the font, in points.
+func (fnt *Font) DesignSize() fixed.Int12_20 {
+	return fnt.design
+}
+
+// Fonts returns the local fonts of the virtual font, in file order.
+//
+// Characters of the first local font are drawn until a packet selects
+// another font.
+func (fnt *Font) Fonts() []FontDef {
+	return fnt.fonts
+}
+
+// NumGlyphs returns the number of glyphs in this font.
+func (fnt *Font) NumGlyphs() int {
+	return len(fnt.glyphs)
+}
+
+// Glyphs returns the glyphs of the font, in file order.
+func (fnt *Font) Glyphs() []Glyph {
+	return fnt.glyphs
+}
+
+// Glyph returns the glyph for the given rune.
+//
+// Glyph returns nil if there is no such rune.
+func (fnt *Font) Glyph(x rune) *Glyph {
+	i, ok := fnt.index[x]
+	if !ok {
+		return nil
+	}
+	return &fnt.glyphs[i]
+}
+
+// Code returns the character code of the glyph.
+func (g *Glyph) Code() rune {
+	return g.code
+}
+
+// Width returns the TFM width of the glyph, as a fraction of the design
+// size of the font.
+func (g *Glyph) Width() fixed.Int12_20 {
+	return g.wd
+}
+
+// DVI returns the packet of DVI commands drawing the glyph.
+//
+// Dimensions in the packet are fractions of the size of the virtual font.
+func (g *Glyph) DVI() []byte {
+	return g.dvi
+}
@@ -0,0 +1,133 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vf
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"star-tex.org/x/tex/font/fixed"
+)
+
+func TestFont(t *testing.T) {
+	raw, err := os.ReadFile("testdata/xcmr10.vf")
+	if err != nil {
+		t.Fatalf("could not read VF file: %+v", err)
+	}
+
+	fnt, err := Parse(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("could not parse VF file: %+v", err)
+	}
+
+	if got, want := fnt.Comment(), "virtual cmr10"; got != want {
+		t.Fatalf("invalid comment: got=%q, want=%q", got, want)
+	}
+	if got, want := fnt.Checksum(), uint32(1274110073); got != want {
+		t.Fatalf("invalid checksum: got=%d, want=%d", got, want)
+	}
+	if got, want := fnt.DesignSize(), fixed.Int12_20(10<<20); got != want {
+		t.Fatalf("invalid design size: got=%v, want=%v", got, want)
+	}
+
+	want := []FontDef{{
+		ID:       0,
+		Checksum: 1274110073,
+		Scale:    1 << 20,
+		Design:   10 << 20,
+		Name:     "cmr10",
+	}}
+	if got := fnt.Fonts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid fonts:\ngot= %+v\nwant=%+v", got, want)
+	}
+
+	if got, want := fnt.NumGlyphs(), 3; got != want {
+		t.Fatalf("invalid number of glyphs: got=%d, want=%d", got, want)
+	}
+
+	for _, tc := range []struct {
+		code rune
+		wd   fixed.Int12_20
+		dvi  []byte
+	}{
+		{'A', 786434, []byte{65}},
+		{'B', 742744, []byte{141, 65, 142, 146, 0, 8, 0, 0, 132, 0, 1, 0x99, 0x99, 0, 3, 0x33, 0x33}},
+		{'C', 757307, []byte{171, 128, 67}},
+	} {
+		g := fnt.Glyph(tc.code)
+		if g == nil {
+			t.Fatalf("could not find glyph %q", tc.code)
+		}
+		if got, want := g.Code(), tc.code; got != want {
+			t.Fatalf("invalid code: got=%d, want=%d", got, want)
+		}
+		if got, want := g.Width(), tc.wd; got != want {
+			t.Fatalf("invalid width for %q: got=%d, want=%d", tc.code, got, want)
+		}
+		if got, want := g.DVI(), tc.dvi; !bytes.Equal(got, want) {
+			t.Fatalf("invalid packet for %q:\ngot= %v\nwant=%v", tc.code, got, want)
+		}
+	}
+
+	if g := fnt.Glyph('Z'); g != nil {
+		t.Fatalf("unexpected glyph %q", g.Code())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/xcmr10.vf")
+	if err != nil {
+		t.Fatalf("could not read VF file: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		err  string
+	}{
+		{
+			name: "empty",
+			raw:  nil,
+			err:  "could not parse VF file preamble: unexpected EOF",
+		},
+		{
+			name: "invalid-id",
+			raw:  []byte{247, 89, 0},
+			err:  "could not parse VF file preamble: invalid VF identification byte 89",
+		},
+		{
+			name: "no-postamble",
+			raw:  raw[:24],
+			err:  "could not parse VF file: missing VF postamble",
+		},
+		{
+			name: "truncated-char",
+			raw:  raw[:50],
+			err:  "could not parse VF file: could not read character at 45: unexpected EOF",
+		},
+		{
+			name: "char-before-fntdef",
+			raw:  append(raw[:24:24], 1, 65, 0, 0, 0, 65, 248),
+			err:  "could not parse VF file: missing font definition before character at 24",
+		},
+		{
+			name: "invalid-post",
+			raw:  append(raw[:len(raw):len(raw)], 0),
+			err:  "could not parse VF file: invalid opcode 0 after VF postamble",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader(tc.raw))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if got, want := err.Error(), tc.err; got != want {
+				t.Fatalf("invalid error:\ngot= %s\nwant=%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pdf provides a minimal writer for PDF documents.
+//
+// More informations about the PDF format can be found here:
+//
+//   - https://www.adobe.com/content/dam/acom/en/devnet/pdf/pdfs/PDF32000_2008.pdf
+package pdf // import "star-tex.org/x/tex/internal/pdf"
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Ref is a reference to an indirect PDF object.
+type Ref int
+
+func (ref Ref) String() string {
+	return strconv.Itoa(int(ref)) + " 0 R"
+}
+
+// Writer writes PDF objects to an underlying io.Writer.
+//
+// Objects may be written in any order, as long as they have been
+// allocated with Alloc first.
+type Writer struct {
+	w    io.Writer
+	n    int64   // number of bytes written so far
+	offs []int64 // file offsets of objects, indexed by object number
+	err  error
+}
+
+// NewWriter creates a new PDF writer and writes the PDF header to w.
+func NewWriter(w io.Writer) *Writer {
+	pw := &Writer{
+		w:    w,
+		offs: []int64{0},
+	}
+	pw.printf("%%PDF-1.5\n%%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+// Len returns the number of bytes written so far.
+func (w *Writer) Len() int64 { return w.n }
+
+// Err returns the first error encountered while writing.
+func (w *Writer) Err() error { return w.err }
+
+// Alloc reserves a new object number.
+func (w *Writer) Alloc() Ref {
+	w.offs = append(w.offs, -1)
+	return Ref(len(w.offs) - 1)
+}
+
+// WriteObject writes the indirect object ref with the provided body.
+func (w *Writer) WriteObject(ref Ref, body string) error {
+	w.begin(ref)
+	w.printf("%s\nendobj\n", body)
+	return w.err
+}
+
+// WriteStream writes the indirect stream object ref.
+// dict holds the entries of the stream dictionary, without the
+// enclosing angle brackets and without the /Length entry.
+// The stream data is compressed with the Flate filter.
+func (w *Writer) WriteStream(ref Ref, dict string, data []byte) error {
+	buf := new(bytes.Buffer)
+	zw := zlib.NewWriter(buf)
+	_, err := zw.Write(data)
+	if err != nil {
+		return fmt.Errorf("pdf: could not compress stream %d: %w", ref, err)
+	}
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("pdf: could not compress stream %d: %w", ref, err)
+	}
+
+	if dict != "" {
+		dict = " " + dict
+	}
+	return w.writeStream(ref, dict+" /Filter /FlateDecode", buf.Bytes())
+}
+
+// WriteRawStream writes the indirect stream object ref, without
+// compressing its data.
+func (w *Writer) WriteRawStream(ref Ref, dict string, data []byte) error {
+	if dict != "" {
+		dict = " " + dict
+	}
+	return w.writeStream(ref, dict, data)
+}
+
+func (w *Writer) writeStream(ref Ref, dict string, data []byte) error {
+	w.begin(ref)
+	w.printf("<<%s /Length %d >>\nstream\n", dict, len(data))
+	w.write(data)
+	w.printf("\nendstream\nendobj\n")
+	return w.err
+}
+
+func (w *Writer) begin(ref Ref) {
+	if int(ref) <= 0 || int(ref) >= len(w.offs) {
+		if w.err == nil {
+			w.err = fmt.Errorf("pdf: invalid object reference %d", ref)
+		}
+		return
+	}
+	if w.offs[ref] >= 0 && w.err == nil {
+		w.err = fmt.Errorf("pdf: object %d written twice", ref)
+	}
+	w.offs[ref] = w.n
+	w.printf("%d 0 obj\n", ref)
+}
+
+// Close writes the cross-reference table and the trailer of the document.
+// Close does not close the underlying io.Writer.
+func (w *Writer) Close(root, info Ref) error {
+	for i, off := range w.offs[1:] {
+		if off < 0 && w.err == nil {
+			w.err = fmt.Errorf("pdf: object %d was allocated but never written", i+1)
+		}
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	xref := w.n
+	w.printf("xref\n0 %d\n", len(w.offs))
+	w.printf("%010d %05d f\r\n", 0, 65535)
+	for _, off := range w.offs[1:] {
+		w.printf("%010d %05d n\r\n", off, 0)
+	}
+	w.printf("trailer\n<< /Size %d /Root %v", len(w.offs), root)
+	if info > 0 {
+		w.printf(" /Info %v", info)
+	}
+	w.printf(" >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+}
+
+// String returns s encoded as a PDF literal string.
+func String(s string) string {
+	var o strings.Builder
+	o.Grow(len(s) + 2)
+	o.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			o.WriteByte('\\')
+			o.WriteByte(c)
+		case '\n':
+			o.WriteString(`\n`)
+		case '\r':
+			o.WriteString(`\r`)
+		default:
+			o.WriteByte(c)
+		}
+	}
+	o.WriteByte(')')
+	return o.String()
+}
+
+// Real returns v formatted as a PDF real number.
+func Real(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 4, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// SubsetTag returns the 6 uppercase letters tag of a font subset holding
+// the provided glyphs.
+func SubsetTag(glyphs []string) string {
+	names := append([]string(nil), glyphs...)
+	sort.Strings(names)
+	hash := fnv.New32a()
+	for _, name := range names {
+		hash.Write([]byte(name))
+		hash.Write([]byte{0})
+	}
+	h := hash.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(h%26)
+		h /= 26
+	}
+	return string(tag)
+}
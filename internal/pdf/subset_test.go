@@ -0,0 +1,31 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf
+
+import (
+	"testing"
+)
+
+func TestSubsetTag(t *testing.T) {
+	var (
+		tag1 = SubsetTag([]string{"A", "B", "space"})
+		tag2 = SubsetTag([]string{"space", "B", "A"})
+		tag3 = SubsetTag([]string{"A", "B"})
+	)
+	if len(tag1) != 6 {
+		t.Fatalf("invalid tag length: %q", tag1)
+	}
+	for _, c := range tag1 {
+		if c < 'A' || c > 'Z' {
+			t.Fatalf("invalid tag %q", tag1)
+		}
+	}
+	if tag1 != tag2 {
+		t.Fatalf("tag depends on glyphs order: %q != %q", tag1, tag2)
+	}
+	if tag1 == tag3 {
+		t.Fatalf("tags of different subsets collide: %q", tag1)
+	}
+}
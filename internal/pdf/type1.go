@@ -0,0 +1,33 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf
+
+import (
+	"fmt"
+
+	"star-tex.org/x/tex/font/type1"
+)
+
+// EmbedType1 writes the Type 1 font program as a FontFile stream, and
+// returns its reference.
+func EmbedType1(w *Writer, fnt *type1.Font) (Ref, error) {
+	var (
+		ref                     = w.Alloc()
+		clear, private, trailer = fnt.Segments()
+		data                    = make([]byte, 0, len(clear)+len(private)+len(trailer))
+	)
+	data = append(data, clear...)
+	data = append(data, private...)
+	data = append(data, trailer...)
+
+	err := w.WriteStream(ref, fmt.Sprintf(
+		"/Length1 %d /Length2 %d /Length3 %d",
+		len(clear), len(private), len(trailer),
+	), data)
+	if err != nil {
+		return ref, fmt.Errorf("pdf: could not embed font %q: %w", fnt.Name(), err)
+	}
+	return ref, nil
+}
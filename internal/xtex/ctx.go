@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"star-tex.org/x/tex/kpath"
 )
 
 func New(stdout io.WriteCloser, stdin io.ReadCloser) *Context {
@@ -19,6 +21,29 @@ func New(stdout io.WriteCloser, stdin io.ReadCloser) *Context {
 	}
 }
 
+// SetOutputPDF sets whether documents are compiled to PDF instead of DVI,
+// by setting the initial value of \pdfoutput.
+func (ctx *Context) SetOutputPDF(v bool) {
+	ctx.pdf.enabled = v
+}
+
+// SetFonts sets the TeX directory structure used to locate the Type1 fonts
+// embedded in PDF documents.
+func (ctx *Context) SetFonts(fonts kpath.Context) {
+	ctx.pdf.fonts = fonts
+}
+
+// SetShell sets the executor of the commands written to the \write18
+// stream, and the shell escape mode reported by \pdfshellescape.
+// A nil exec disables the shell escape.
+func (ctx *Context) SetShell(mode int32, exec func(cmd string) (int, error)) {
+	if exec == nil {
+		mode = ShellDisabled
+	}
+	ctx.shell.mode = mode
+	ctx.shell.exec = exec
+}
+
 func (ctx *Context) Process(dvi io.WriteCloser, f io.Reader, jobname string) (err error) {
 	tmp, err := os.MkdirTemp("", "go-xtex-")
 	if err != nil {
@@ -62,7 +87,7 @@ func (ctx *Context) Process(dvi io.WriteCloser, f io.Reader, jobname string) (er
 		erstat:        0,
 		componentSize: 1,
 		name:          "out.dvi",
-		out:           dvi,
+		out:           ctx.quota.writer(dvi, OutputQuota),
 	}
 
 	stdin := ctx.stdin
@@ -70,12 +95,29 @@ func (ctx *Context) Process(dvi io.WriteCloser, f io.Reader, jobname string) (er
 		ctx.stdout.Write([]byte("\n"))
 
 		ctx.stdin = stdin
-		e := recover()
-		if e != nil {
-			err = e.(error)
+		var perr error // error of a recovered panic.
+		switch e := recover().(type) {
+		case nil:
+		case error:
+			perr = e
+		default:
+			perr = fmt.Errorf("xtex: %v", e)
+		}
+		switch {
+		case ctx.primErr != nil && perr != nil && perr != ctx.primErr:
+			err = fmt.Errorf("%w (recovered: %v)", ctx.primErr, perr)
+		case ctx.primErr != nil:
+			err = ctx.primErr
+		case perr != nil:
+			err = perr
 		}
 	}()
 
+	// the primitives of a reused context are only declared once.
+	if ctx.primErr != nil {
+		return ctx.primErr
+	}
+
 	ctx.stdin = io.NopCloser(strings.NewReader(`\input ` + jobname))
 	ctx.main()
 
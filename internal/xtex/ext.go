@@ -0,0 +1,64 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtex
+
+// extInitPrim declares the primitives that extend TeX.
+func (tex *Context) extInitPrim() {
+	tex.strs = make(map[string]uint16)
+	tex.pdfInitPrim()
+	tex.shellInitPrim()
+	tex.goInitPrim()
+}
+
+// poolString returns the pool string for s, creating it if needed.
+func (tex *Context) poolString(s string) uint16 {
+	if v, ok := tex.strs[s]; ok && v < tex.strPtr {
+		return v
+	}
+	if int32(tex.poolPtr)+int32(len(s)) > poolSize {
+		tex.overflow(257, poolSize-int32(tex.initPoolPtr))
+	}
+	for i := 0; i < len(s); i++ {
+		tex.strPool[tex.poolPtr] = s[i]
+		tex.poolPtr++
+	}
+	v := tex.makeString()
+	tex.strs[s] = v
+	return v
+}
+
+// printString prints the provided Go string.
+func (tex *Context) printString(s string) {
+	for i := 0; i < len(s); i++ {
+		tex.printChar(s[i])
+	}
+}
+
+// extError issues a TeX error with the provided message and help lines.
+func (tex *Context) extError(msg string, help ...string) {
+	tex.printNl(262)
+	tex.printString(msg)
+	tex.helpPtr = byte(len(help))
+	for i, s := range help {
+		tex.helpLine[len(help)-1-i] = tex.poolString(s)
+	}
+	tex.error1()
+}
+
+// tokensToString converts the token list referenced by ref to a string.
+func (tex *Context) tokensToString(ref uint16) string {
+	oldSetting := tex.selector
+	tex.selector = 21
+	tex.showTokenList(int32(tex.mem[ref].hh().rh), 0, poolSize-int32(tex.poolPtr))
+	tex.selector = oldSetting
+	s := string(tex.strPool[tex.strStart[tex.strPtr]:tex.poolPtr])
+	tex.poolPtr = tex.strStart[tex.strPtr]
+	return s
+}
+
+// goString returns the pool string s as a Go string.
+func (tex *Context) goString(s uint16) string {
+	return string(tex.strPool[tex.strStart[s]:tex.strStart[s+1]])
+}
@@ -0,0 +1,70 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// filePolicy holds the predicates deciding which files may be opened by
+// documents. A nil predicate allows any file.
+type filePolicy struct {
+	read  func(name string) bool
+	write func(name string) bool
+}
+
+// SetFilePolicy sets the predicates deciding which files may be opened
+// for reading and for writing by documents.
+// A nil predicate allows any file.
+func (ctx *Context) SetFilePolicy(read, write func(name string) bool) {
+	ctx.files.read = read
+	ctx.files.write = write
+}
+
+// texAreas holds the prefixes of the file names pointing at the resources
+// embedded with TeX.
+var texAreas = []string{texArea, texFontArea, "TeXformats:"}
+
+// canOpen reports whether the named file may be opened, and issues a TeX
+// error when it may not.
+func (tex *Context) canOpen(name string, write bool) bool {
+	allow := tex.files.read
+	if write {
+		allow = tex.files.write
+	}
+	if allow == nil || name == texPool {
+		return true
+	}
+	fname := name
+	for _, area := range texAreas {
+		if strings.HasPrefix(fname, area) {
+			fname = fname[len(area):]
+			break
+		}
+	}
+	if allow(fname) {
+		return true
+	}
+	if write && tex.jobName != 0 {
+		// output files of the job itself.
+		job := tex.goString(tex.jobName)
+		switch fname {
+		case job + ".log", job + ".dvi", job + ".pdf", job + ".fmt":
+			return true
+		}
+	}
+
+	msg := "Not reading from"
+	if write {
+		msg = "Not writing to"
+	}
+	tex.extError(
+		fmt.Sprintf("%s `%s' (forbidden by the file access policy)", msg, fname),
+		"The file access policy of this job does not allow this file.",
+		"I'll pretend the file could not be opened.",
+	)
+	return false
+}
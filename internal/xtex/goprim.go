@@ -0,0 +1,157 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtex
+
+import (
+	"fmt"
+)
+
+// goPrimBase is the first modifier of the convert command (108) used for
+// primitives implemented in Go.
+const goPrimBase = 6
+
+// ArgKind describes the kind of an argument scanned by a Go primitive.
+type ArgKind int
+
+const (
+	TokensArg ArgKind = iota // A balanced text, fully expanded.
+	IntArg                   // An integer.
+	DimenArg                 // A dimension, in scaled points.
+)
+
+// Arg is an argument scanned by a Go primitive.
+type Arg struct {
+	Kind ArgKind
+	Toks string // Value of a TokensArg argument.
+	Int  int32  // Value of an IntArg or DimenArg argument.
+}
+
+// Primitive is an expandable primitive implemented in Go.
+type Primitive struct {
+	Name string    // Name of the control sequence, without the escape character.
+	Args []ArgKind // Arguments scanned after the control sequence.
+
+	// Expand returns the TeX source inserted in the input in place of the
+	// primitive and its arguments.
+	Expand func(args []Arg) (string, error)
+}
+
+type goPrim struct {
+	Primitive
+	name uint16 // pool string of the name of the primitive
+}
+
+// Define declares a new primitive implemented in Go.
+// Primitives must be defined before the document is processed.
+func (ctx *Context) Define(prim Primitive) {
+	ctx.prims = append(ctx.prims, goPrim{Primitive: prim})
+}
+
+// goInitPrim declares the primitives implemented in Go.
+// Primitives clashing with an existing control sequence are not declared,
+// and the error is returned by Process, without processing the document.
+func (tex *Context) goInitPrim() {
+	for i := range tex.prims {
+		prim := &tex.prims[i]
+		if tex.isDefined(prim.Name) {
+			if tex.primErr == nil {
+				tex.primErr = fmt.Errorf("xtex: primitive \\%s is already defined", prim.Name)
+			}
+			continue
+		}
+		switch len(prim.Name) {
+		case 1:
+			prim.name = uint16(prim.Name[0])
+		default:
+			prim.name = tex.poolString(prim.Name)
+		}
+		tex.primitive(prim.name, 108, uint16(goPrimBase+i))
+	}
+}
+
+// isDefined reports whether the control sequence name is already defined.
+func (tex *Context) isDefined(name string) bool {
+	if len(name) == 1 {
+		return tex.eqtb[257+int32(name[0])-1].hh().b0() != 101
+	}
+	for i := 0; i < len(name); i++ {
+		tex.buffer[i] = tex.xord[name[i]]
+	}
+	noNew := tex.noNewControlSequence
+	tex.noNewControlSequence = true
+	p := tex.idLookup(0, int32(len(name)))
+	tex.noNewControlSequence = noNew
+	return p != 2881
+}
+
+// goExpand expands the Go primitive whose modifier is tex.curChr.
+func (tex *Context) goExpand() {
+	prim := tex.prims[tex.curChr-goPrimBase]
+	args := make([]Arg, len(prim.Args))
+	for i, kind := range prim.Args {
+		args[i].Kind = kind
+		switch kind {
+		case TokensArg:
+			var (
+				defRef        = tex.defRef
+				warningIndex  = tex.warningIndex
+				scannerStatus = tex.scannerStatus
+			)
+			tex.scanToks(false, true)
+			args[i].Toks = tex.tokensToString(tex.defRef)
+			tex.flushList(tex.defRef)
+			tex.defRef = defRef
+			tex.warningIndex = warningIndex
+			tex.scannerStatus = scannerStatus
+		case IntArg:
+			tex.scanInt()
+			args[i].Int = tex.curVal
+		case DimenArg:
+			tex.scanDimen(false, false, false)
+			args[i].Int = tex.curVal
+		default:
+			panic(fmt.Errorf("xtex: invalid argument kind %d for primitive \\%s", kind, prim.Name))
+		}
+	}
+
+	out, err := prim.Expand(args)
+	if err != nil {
+		tex.extError(
+			fmt.Sprintf(`\%s failed: %v`, prim.Name, err),
+			"The Go implementation of this primitive returned an error.",
+			"I'll ignore its output and proceed.",
+		)
+		return
+	}
+	tex.insertString(out)
+}
+
+// insertString inserts the provided TeX source in the input, as if it
+// had been typed on the terminal.
+// New lines are converted to the end of line character.
+func (tex *Context) insertString(s string) {
+	if s == "" {
+		return
+	}
+	tex.beginFileReading()
+	if int32(tex.first)+int32(len(s)) >= bufSize {
+		tex.overflow(256, bufSize)
+	}
+	tex.last = tex.first
+	for i := 0; i < len(s); i++ {
+		c := tex.xord[s[i]]
+		if s[i] == '\n' {
+			c = ' '
+			if v := tex.eqtb[5311-1].int(); 0 <= v && v <= 255 {
+				c = byte(v)
+			}
+		}
+		tex.buffer[tex.last] = c
+		tex.last++
+	}
+	tex.curInput.locField = tex.first
+	tex.curInput.limitField = tex.last - 1
+	tex.first = tex.last
+}
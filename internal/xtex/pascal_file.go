@@ -97,6 +97,15 @@ func reset(ctx *Context, f *pasFile, componentSize int, name, mode string) {
 		return
 	}
 
+	if !ctx.canOpen(name, false) {
+		f.ioFile = &ioFile{
+			erstat:        1,
+			componentSize: componentSize,
+			name:          name,
+		}
+		return
+	}
+
 	g, err := os.Open(name)
 ok:
 	switch {
@@ -193,6 +202,16 @@ func rewrite(ctx *Context, f *pasFile, componentSize int, name, mode string) {
 		return
 	}
 
+	if !ctx.canOpen(name, true) {
+		f.ioFile = &ioFile{
+			eof:           false,
+			erstat:        1,
+			componentSize: componentSize,
+			name:          name,
+		}
+		return
+	}
+
 	g, err := os.Create(name)
 	if err != nil {
 		f.ioFile = &ioFile{
@@ -209,7 +228,7 @@ func rewrite(ctx *Context, f *pasFile, componentSize int, name, mode string) {
 		erstat:        0,
 		componentSize: componentSize,
 		name:          name,
-		out:           g, //TODO bufio
+		out:           ctx.quota.writer(g, WriteQuota), //TODO bufio
 	}
 }
 
@@ -0,0 +1,1170 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"star-tex.org/x/tex/font/type1"
+	"star-tex.org/x/tex/internal/pdf"
+	"star-tex.org/x/tex/kpath"
+)
+
+// Locations of the pdfTeX parameters, appended after the end of
+// the regular TeX eqtb.
+const (
+	pdfOutputCode     = 6107 // \pdfoutput
+	pdfPageWidthCode  = 6108 // \pdfpagewidth
+	pdfPageHeightCode = 6109 // \pdfpageheight
+
+	eqtbMax = pdfPageHeightCode // last location of eqtb
+	xeqSize = eqtbMax - 5262    // size of xeqLevel
+)
+
+// Modifiers of the extension command (59) for the pdfTeX primitives.
+// The modifiers of the primitives that are kept in the node lists are
+// also used as whatsit subtypes.
+const (
+	pdfLiteralCode = 6 + iota // \pdfliteral
+	pdfObjCode                // \pdfobj
+	pdfAnnotCode              // \pdfannot
+	pdfDestCode               // \pdfdest
+	pdfOutlineCode            // \pdfoutline
+	pdfInfoCode               // \pdfinfo
+)
+
+// pdfLastObjCode is the modifier of the last_item command (70) for \pdflastobj.
+const pdfLastObjCode = 5
+
+const (
+	nullFlag   = -1073741824 // signifies a missing dimension of a rule
+	oneInch    = 4736287     // 1in, in scaled points
+	spToBP     = 72 / 72.27 / 65536
+	pdfWdNode  = 1 // offset of the width of an annotation node
+	pdfHtNode  = 2 // offset of the height of an annotation node
+	pdfDpNode  = 3 // offset of the depth of an annotation node
+	pdfAnnSize = 5 // size of an annotation node
+	pdfDstSize = 4 // size of a destination node
+)
+
+// pdfExtNames holds the names of the pdfTeX primitives implemented
+// with the extension command.
+var pdfExtNames = map[uint16]string{
+	pdfLiteralCode: "pdfliteral",
+	pdfObjCode:     "pdfobj",
+	pdfAnnotCode:   "pdfannot",
+	pdfDestCode:    "pdfdest",
+	pdfOutlineCode: "pdfoutline",
+	pdfInfoCode:    "pdfinfo",
+}
+
+// pdfDestTypes holds the keywords for the destination types of \pdfdest,
+// in the order they are scanned.
+var pdfDestTypes = []struct {
+	key string
+	typ string
+}{
+	{"xyz", "XYZ"},
+	{"fitbh", "FitBH"},
+	{"fitbv", "FitBV"},
+	{"fitb", "FitB"},
+	{"fith", "FitH"},
+	{"fitv", "FitV"},
+	{"fit", "Fit"},
+}
+
+// pdfStrings holds the strings used by the pdfTeX primitives that are
+// added to the string pool when the primitives are initialized.
+var pdfStrings = []string{
+	".pdf", "stream", "attr", "direct", "page", "width", "height", "depth",
+	"name", "num", "zoom", "goto", "user", "count", "pdflastobj",
+}
+
+// pdfState holds the state of the PDF output.
+type pdfState struct {
+	enabled bool          // whether PDF output is the default output
+	fonts   kpath.Context // TeX directory structure used to locate Type1 fonts
+
+	fixed  bool // whether the output format has been fixed
+	output bool // whether the output format is PDF
+
+	w       *pdf.Writer
+	pages   []pdf.Ref
+	parent  pdf.Ref // reference of the pages tree
+	res     pdf.Ref // reference of the shared resources
+	fnts    map[byte]pdf.Ref
+	dests   map[string]string
+	outline []*pdfOutline
+	info    strings.Builder
+	lastObj int32
+
+	page    pdf.Ref      // reference of the current page
+	height  int32        // height of the current page
+	content bytes.Buffer // content stream of the current page
+	annots  []pdf.Ref    // annotations of the current page
+}
+
+// pdfOutline is an entry of the document outline.
+type pdfOutline struct {
+	attr   string
+	action string
+	page   int32 // page number of a 'goto page' action
+	count  int32
+	title  string
+	kids   []*pdfOutline
+	ref    pdf.Ref
+	parent pdf.Ref
+}
+
+// pdfInitPrim declares the pdfTeX primitives.
+func (tex *Context) pdfInitPrim() {
+	for _, s := range pdfStrings {
+		tex.poolString(s)
+	}
+
+	tex.primitive(tex.poolString("pdfoutput"), 73, pdfOutputCode)
+	tex.primitive(tex.poolString("pdfpagewidth"), 74, pdfPageWidthCode)
+	tex.primitive(tex.poolString("pdfpageheight"), 74, pdfPageHeightCode)
+	tex.primitive(tex.poolString("pdflastobj"), 70, pdfLastObjCode)
+	for _, code := range []uint16{
+		pdfLiteralCode, pdfObjCode, pdfAnnotCode,
+		pdfDestCode, pdfOutlineCode, pdfInfoCode,
+	} {
+		tex.primitive(tex.poolString(pdfExtNames[code]), 59, code)
+	}
+	for _, dst := range pdfDestTypes {
+		tex.poolString(dst.key)
+	}
+
+	var out int32
+	if tex.pdf.enabled {
+		out = 1
+	}
+	*tex.eqtb[pdfOutputCode-1].pInt() = out
+	*tex.eqtb[pdfPageWidthCode-1].pInt() = 0
+	*tex.eqtb[pdfPageHeightCode-1].pInt() = 0
+}
+
+// pdfWarning prints a warning on the terminal and in the log file.
+func (tex *Context) pdfWarning(msg string) {
+	tex.printNl(338)
+	tex.printString("pdfTeX warning: ")
+	tex.printString(msg)
+	tex.printLn()
+}
+
+func (tex *Context) pdfKeyword(s string) bool {
+	return tex.scanKeyword(tex.poolString(s))
+}
+
+// pdfToks scans an expanded token list and returns it as a string.
+func (tex *Context) pdfToks() string {
+	tex.scanToks(false, true)
+	s := tex.tokensToString(tex.defRef)
+	tex.flushList(tex.defRef)
+	return s
+}
+
+// pdfFixOutput freezes the output format, from the value of \pdfoutput,
+// and reports whether the output format is PDF.
+func (tex *Context) pdfFixOutput() bool {
+	if !tex.pdf.fixed {
+		tex.pdf.fixed = true
+		tex.pdf.output = tex.eqtb[pdfOutputCode-1].int() > 0
+	}
+	return tex.pdf.output
+}
+
+// pdfCheckOutput reports whether the output format is PDF, and issues an
+// error mentioning the current primitive otherwise.
+func (tex *Context) pdfCheckOutput() bool {
+	if tex.pdfFixOutput() {
+		return true
+	}
+	tex.extError(
+		`\`+pdfExtNames[tex.curChr]+` used while \pdfoutput is not set`,
+		"You can't use PDF specific primitives when writing DVI.",
+		`Set \pdfoutput to a positive value before the first page is shipped out.`,
+	)
+	return false
+}
+
+// pdfBegin opens the PDF output file and writes its header.
+func (tex *Context) pdfBegin() {
+	if tex.pdf.w != nil {
+		return
+	}
+	if tex.outputFileName == 0 {
+		if tex.jobName == 0 {
+			tex.openLogFile()
+		}
+		tex.packJobName(tex.poolString(".pdf"))
+		for !tex.bOpenOut(&tex.dviFile) {
+			tex.promptFileName(795, tex.poolString(".pdf"))
+		}
+		tex.outputFileName = tex.bMakeNameString(&tex.dviFile)
+	}
+
+	var w io.Writer = io.Discard
+	if tex.dviFile.ioFile != nil && tex.dviFile.out != nil {
+		w = tex.dviFile.out
+	}
+	tex.pdf.w = pdf.NewWriter(w)
+	tex.pdf.parent = tex.pdf.w.Alloc()
+	tex.pdf.res = tex.pdf.w.Alloc()
+	tex.pdf.fnts = make(map[byte]pdf.Ref)
+	tex.pdf.dests = make(map[string]string)
+}
+
+// pdfExtension handles the pdfTeX primitives of the extension command.
+func (tex *Context) pdfExtension() {
+	switch tex.curChr {
+	case pdfLiteralCode:
+		tex.newWhatsit(pdfLiteralCode, 2)
+		var mode uint16
+		switch {
+		case tex.pdfKeyword("direct"):
+			mode = 1
+		case tex.pdfKeyword("page"):
+			mode = 2
+		}
+		*tex.mem[int32(tex.curList.tailField)+1].pHh().pLh() = mode
+		tex.scanToks(false, true)
+		tex.mem[int32(tex.curList.tailField)+1].pHh().rh = tex.defRef
+
+	case pdfObjCode:
+		ok := tex.pdfCheckOutput()
+		var (
+			stream = tex.pdfKeyword("stream")
+			attr   string
+		)
+		if stream && tex.pdfKeyword("attr") {
+			attr = tex.pdfToks()
+		}
+		body := tex.pdfToks()
+		if !ok {
+			return
+		}
+		tex.pdfBegin()
+		ref := tex.pdf.w.Alloc()
+		switch {
+		case stream:
+			tex.pdfCheck(tex.pdf.w.WriteStream(ref, attr, []byte(body)))
+		default:
+			tex.pdfCheck(tex.pdf.w.WriteObject(ref, body))
+		}
+		tex.pdf.lastObj = int32(ref)
+
+	case pdfAnnotCode:
+		tex.newWhatsit(pdfAnnotCode, pdfAnnSize)
+		p := int32(tex.curList.tailField)
+		*tex.mem[p+pdfWdNode].pInt() = nullFlag
+		*tex.mem[p+pdfHtNode].pInt() = nullFlag
+		*tex.mem[p+pdfDpNode].pInt() = nullFlag
+		for {
+			switch {
+			case tex.pdfKeyword("width"):
+				tex.scanDimen(false, false, false)
+				*tex.mem[p+pdfWdNode].pInt() = tex.curVal
+				continue
+			case tex.pdfKeyword("height"):
+				tex.scanDimen(false, false, false)
+				*tex.mem[p+pdfHtNode].pInt() = tex.curVal
+				continue
+			case tex.pdfKeyword("depth"):
+				tex.scanDimen(false, false, false)
+				*tex.mem[p+pdfDpNode].pInt() = tex.curVal
+				continue
+			}
+			break
+		}
+		tex.scanToks(false, true)
+		tex.mem[p+4].pHh().rh = tex.defRef
+
+	case pdfDestCode:
+		tex.newWhatsit(pdfDestCode, pdfDstSize)
+		p := int32(tex.curList.tailField)
+		tex.mem[p+1].pHh().rh = 0
+		*tex.mem[p+2].pInt() = 0
+		*tex.mem[p+3].pInt() = 0
+		switch {
+		case tex.pdfKeyword("num"):
+			tex.scanInt()
+			*tex.mem[p+2].pInt() = tex.curVal
+		case tex.pdfKeyword("name"):
+			tex.scanToks(false, true)
+			tex.mem[p+1].pHh().rh = tex.defRef
+		default:
+			tex.extError(
+				"Identifier type missing",
+				"A destination must be identified with `name {...}' or `num n'.",
+				"I'll use `num 0'.",
+			)
+		}
+		typ := -1
+		for i, dst := range pdfDestTypes {
+			if tex.pdfKeyword(dst.key) {
+				typ = i
+				break
+			}
+		}
+		if typ < 0 {
+			tex.extError(
+				"Destination type missing",
+				"A destination type (xyz, fit, fith, fitv, fitb, fitbh or fitbv)",
+				"is required. I'll use `xyz'.",
+			)
+			typ = 0
+		}
+		*tex.mem[p+1].pHh().pLh() = uint16(typ)
+		if typ == 0 && tex.pdfKeyword("zoom") {
+			tex.scanInt()
+			*tex.mem[p+3].pInt() = tex.curVal
+		}
+
+	case pdfOutlineCode:
+		ok := tex.pdfCheckOutput()
+		var item pdfOutline
+		if tex.pdfKeyword("attr") {
+			item.attr = tex.pdfToks()
+		}
+		switch {
+		case tex.pdfKeyword("goto"):
+			switch {
+			case tex.pdfKeyword("name"):
+				item.action = "/A << /S /GoTo /D " + pdf.String(tex.pdfToks()) + " >>"
+			case tex.pdfKeyword("num"):
+				tex.scanInt()
+				item.action = "/A << /S /GoTo /D " + pdf.String(pdfNumDest(tex.curVal)) + " >>"
+			case tex.pdfKeyword("page"):
+				tex.scanInt()
+				item.page = tex.curVal
+				item.action = tex.pdfToks()
+			default:
+				tex.extError(
+					"Action type missing",
+					"A `goto' action must be followed by `name {...}', `num n'",
+					"or `page n {...}'.",
+				)
+			}
+		case tex.pdfKeyword("user"):
+			item.action = "/A " + tex.pdfToks()
+		default:
+			tex.extError(
+				"Action type missing",
+				"An outline entry needs an action: `goto ...' or `user {...}'.",
+			)
+		}
+		if tex.pdfKeyword("count") {
+			tex.scanInt()
+			item.count = tex.curVal
+		}
+		item.title = tex.pdfToks()
+		if ok {
+			tex.pdf.outline = append(tex.pdf.outline, &item)
+		}
+
+	case pdfInfoCode:
+		ok := tex.pdfCheckOutput()
+		info := tex.pdfToks()
+		if ok {
+			tex.pdf.info.WriteString(" ")
+			tex.pdf.info.WriteString(info)
+		}
+
+	default:
+		tex.confusion(1291)
+	}
+}
+
+func pdfNumDest(n int32) string {
+	return fmt.Sprintf("num.%d", n)
+}
+
+// pdfCheck stops the job if an I/O error occurred while writing the
+// PDF output.
+func (tex *Context) pdfCheck(err error) {
+	if err != nil {
+		panic(fmt.Errorf("xtex: could not write PDF output: %w", err))
+	}
+}
+
+// pdfShowWhatsit displays a pdfTeX whatsit node.
+func (tex *Context) pdfShowWhatsit(p int32) {
+	s := tex.mem[p].hh().b1()
+	tex.printEsc(tex.poolString(pdfExtNames[uint16(s)]))
+	switch s {
+	case pdfLiteralCode:
+		switch tex.mem[p+1].hh().lh() {
+		case 1:
+			tex.printString(" direct")
+		case 2:
+			tex.printString(" page")
+		}
+		tex.printMark(int32(tex.mem[p+1].hh().rh))
+	case pdfAnnotCode:
+		for i, name := range []string{"width", "height", "depth"} {
+			tex.printString("(" + name[:1] + ")")
+			tex.printRuleDimen(tex.mem[p+int32(i)+1].int())
+		}
+		tex.printMark(int32(tex.mem[p+4].hh().rh))
+	case pdfDestCode:
+		if ref := tex.mem[p+1].hh().rh; ref != 0 {
+			tex.printString(" name")
+			tex.printMark(int32(ref))
+		} else {
+			tex.printString(" num")
+			tex.printInt(tex.mem[p+2].int())
+		}
+		tex.printString(" " + pdfDestTypes[tex.mem[p+1].hh().lh()].key)
+	}
+}
+
+// pdfFlushWhatsit frees the annotation and destination whatsit node p.
+func (tex *Context) pdfFlushWhatsit(p uint16) {
+	switch tex.mem[p].hh().b1() {
+	case pdfAnnotCode:
+		tex.deleteTokenRef(tex.mem[int32(p)+4].hh().rh)
+		tex.freeNode(p, pdfAnnSize)
+	case pdfDestCode:
+		if ref := tex.mem[int32(p)+1].hh().rh; ref != 0 {
+			tex.deleteTokenRef(ref)
+		}
+		tex.freeNode(p, pdfDstSize)
+	}
+}
+
+// pdfCopyWhatsit allocates a copy of the annotation and destination
+// whatsit node p. The content of the node is copied by the caller.
+func (tex *Context) pdfCopyWhatsit(p uint16) (uint16, byte) {
+	var ref uint16
+	var size byte
+	switch tex.mem[p].hh().b1() {
+	case pdfAnnotCode:
+		ref = tex.mem[int32(p)+4].hh().rh
+		size = pdfAnnSize
+	case pdfDestCode:
+		ref = tex.mem[int32(p)+1].hh().rh
+		size = pdfDstSize
+	}
+	if ref != 0 {
+		*tex.mem[ref].pHh().pLh() = tex.mem[ref].hh().lh() + 1
+	}
+	return tex.getNode(int32(size)), size
+}
+
+// pdfShipOut outputs the box p as a new page of the PDF document.
+func (tex *Context) pdfShipOut(p uint16) {
+	tex.pdfBegin()
+	st := &tex.pdf
+	hoff := oneInch + tex.eqtb[5848-1].int()
+	voff := oneInch + tex.eqtb[5849-1].int()
+
+	width := tex.eqtb[pdfPageWidthCode-1].int()
+	if width == 0 {
+		width = tex.mem[int32(p)+1].int() + 2*hoff
+	}
+	height := tex.eqtb[pdfPageHeightCode-1].int()
+	if height == 0 {
+		height = tex.mem[int32(p)+3].int() + tex.mem[int32(p)+2].int() + 2*voff
+	}
+
+	st.page = st.w.Alloc()
+	st.pages = append(st.pages, st.page)
+	st.height = height
+	st.content.Reset()
+	st.annots = st.annots[:0]
+
+	tex.curH = hoff
+	tex.curV = tex.mem[int32(p)+3].int() + voff
+	tex.tempPtr = p
+	if tex.mem[p].hh().b0() == 1 {
+		tex.pdfVlistOut()
+	} else {
+		tex.pdfHlistOut()
+	}
+
+	contents := st.w.Alloc()
+	tex.pdfCheck(st.w.WriteStream(contents, "", st.content.Bytes()))
+
+	var o strings.Builder
+	fmt.Fprintf(&o, "<< /Type /Page /Parent %v /MediaBox [0 0 %s %s]",
+		st.parent, pdfBP(width), pdfBP(height),
+	)
+	fmt.Fprintf(&o, " /Resources %v /Contents %v", st.res, contents)
+	if len(st.annots) > 0 {
+		o.WriteString(" /Annots [")
+		for _, ref := range st.annots {
+			fmt.Fprintf(&o, " %v", ref)
+		}
+		o.WriteString(" ]")
+	}
+	o.WriteString(" >>")
+	tex.pdfCheck(st.w.WriteObject(st.page, o.String()))
+
+	tex.totalPages = tex.totalPages + 1
+}
+
+// pdfBP returns the provided dimension, in big points.
+func pdfBP(v int32) string {
+	return pdf.Real(float64(v) * spToBP)
+}
+
+// pdfPos returns the PDF coordinates of the current position.
+func (tex *Context) pdfPos() (string, string) {
+	return pdfBP(tex.curH), pdfBP(tex.pdf.height - tex.curV)
+}
+
+// pdfCharsOut outputs the run of characters starting at p, and
+// returns the node following them.
+func (tex *Context) pdfCharsOut(p uint16) uint16 {
+	o := &tex.pdf.content
+	f := byte(0)
+	for p >= tex.hiMemMin {
+		tex.f = tex.mem[p].hh().b0()
+		tex.c = tex.mem[p].hh().b1()
+		if tex.f != f || f == 0 {
+			if f != 0 {
+				o.WriteString(") Tj ET\n")
+			}
+			f = tex.f
+			tex.pdfUseFont(f)
+			x, y := tex.pdfPos()
+			fmt.Fprintf(o, "BT /F%d %s Tf 1 0 0 1 %s %s Tm (", f, pdfBP(tex.fontSize[f]), x, y)
+		}
+		switch c := tex.c; {
+		case c == '(' || c == ')' || c == '\\':
+			o.WriteByte('\\')
+			o.WriteByte(c)
+		case c < 32 || c > 126:
+			fmt.Fprintf(o, "\\%03o", c)
+		default:
+			o.WriteByte(c)
+		}
+		tex.curH = tex.curH + tex.fontInfo[tex.widthBase[tex.f]+int32(tex.fontInfo[tex.charBase[tex.f]+int32(tex.c)].qqqq().b0)].int()
+		p = tex.mem[p].hh().rh
+	}
+	if f != 0 {
+		o.WriteString(") Tj ET\n")
+	}
+	return p
+}
+
+// pdfUseFont registers the font f as a resource of the document.
+func (tex *Context) pdfUseFont(f byte) {
+	if _, ok := tex.pdf.fnts[f]; ok {
+		return
+	}
+	tex.pdf.fnts[f] = tex.pdf.w.Alloc()
+	tex.fontUsed[f] = true
+}
+
+// pdfRuleOut outputs a rule whose bottom left corner is at the current
+// position.
+func (tex *Context) pdfRuleOut(wd, ht int32) {
+	x, y := tex.pdfPos()
+	fmt.Fprintf(&tex.pdf.content, "%s %s %s %s re f\n", x, y, pdfBP(wd), pdfBP(ht))
+}
+
+// pdfOutWhat outputs the whatsit node p, contained in the box thisBox.
+func (tex *Context) pdfOutWhat(p, thisBox uint16) {
+	st := &tex.pdf
+	switch tex.mem[p].hh().b1() {
+	case 0, 1, 2, 4:
+		tex.outWhat(p)
+	case 3:
+		// \special is meaningless in PDF output.
+	case pdfLiteralCode:
+		s := tex.tokensToString(tex.mem[int32(p)+1].hh().rh)
+		switch tex.mem[int32(p)+1].hh().lh() {
+		case 0:
+			x, y := tex.pdfPos()
+			fmt.Fprintf(&st.content, "1 0 0 1 %s %s cm\n%s\n1 0 0 1 -%s -%s cm\n", x, y, s, x, y)
+		default:
+			st.content.WriteString(s)
+			st.content.WriteByte('\n')
+		}
+	case pdfAnnotCode:
+		wd := tex.mem[int32(p)+pdfWdNode].int()
+		ht := tex.mem[int32(p)+pdfHtNode].int()
+		dp := tex.mem[int32(p)+pdfDpNode].int()
+		if wd == nullFlag {
+			wd = tex.mem[int32(thisBox)+1].int()
+		}
+		if ht == nullFlag {
+			ht = tex.mem[int32(thisBox)+3].int()
+		}
+		if dp == nullFlag {
+			dp = tex.mem[int32(thisBox)+2].int()
+		}
+		x := tex.curH
+		y := st.height - tex.curV
+		ref := st.w.Alloc()
+		tex.pdfCheck(st.w.WriteObject(ref, fmt.Sprintf(
+			"<< /Type /Annot /Rect [%s %s %s %s] %s >>",
+			pdfBP(x), pdfBP(y-dp), pdfBP(x+wd), pdfBP(y+ht),
+			tex.tokensToString(tex.mem[int32(p)+4].hh().rh),
+		)))
+		st.annots = append(st.annots, ref)
+	case pdfDestCode:
+		var name string
+		if ref := tex.mem[int32(p)+1].hh().rh; ref != 0 {
+			name = tex.tokensToString(ref)
+		} else {
+			name = pdfNumDest(tex.mem[int32(p)+2].int())
+		}
+		if _, dup := st.dests[name]; dup {
+			tex.pdfWarning("destination with the same identifier (" + name + ") has been already used, duplicate ignored")
+			return
+		}
+		x, y := tex.pdfPos()
+		typ := pdfDestTypes[tex.mem[int32(p)+1].hh().lh()].typ
+		var dst string
+		switch typ {
+		case "XYZ":
+			zoom := "null"
+			if z := tex.mem[int32(p)+3].int(); z != 0 {
+				zoom = pdf.Real(float64(z) / 1000)
+			}
+			dst = fmt.Sprintf("/XYZ %s %s %s", x, y, zoom)
+		case "FitH", "FitBH":
+			dst = fmt.Sprintf("/%s %s", typ, y)
+		case "FitV", "FitBV":
+			dst = fmt.Sprintf("/%s %s", typ, x)
+		default:
+			dst = "/" + typ
+		}
+		st.dests[name] = fmt.Sprintf("[%v %s]", st.page, dst)
+	default:
+		tex.confusion(1299)
+	}
+}
+
+// pdfHlistOut outputs the hlist box tex.tempPtr.
+func (tex *Context) pdfHlistOut() {
+	var (
+		thisBox   = tex.tempPtr
+		gOrder    = tex.mem[int32(thisBox)+5].hh().b1()
+		gSign     = tex.mem[int32(thisBox)+5].hh().b0()
+		p         = tex.mem[int32(thisBox)+5].hh().rh
+		baseLine  = tex.curV
+		leftEdge  = tex.curH
+		curG      int32
+		curGlue   float32
+		leaderBox uint16
+		leaderWd  int32
+		lx        int32
+		edge      int32
+		saveH     int32
+	)
+	for p != 0 {
+	label21:
+		if p >= tex.hiMemMin {
+			p = tex.pdfCharsOut(p)
+			continue
+		}
+		switch tex.mem[p].hh().b0() {
+		case 0, 1:
+			if tex.mem[int32(p)+5].hh().rh == 0 {
+				tex.curH = tex.curH + tex.mem[int32(p)+1].int()
+			} else {
+				tex.curV = baseLine + tex.mem[int32(p)+4].int()
+				tex.tempPtr = p
+				edge = tex.curH
+				if tex.mem[p].hh().b0() == 1 {
+					tex.pdfVlistOut()
+				} else {
+					tex.pdfHlistOut()
+				}
+				tex.curH = edge + tex.mem[int32(p)+1].int()
+				tex.curV = baseLine
+			}
+		case 2:
+			tex.ruleHt = tex.mem[int32(p)+3].int()
+			tex.ruleDp = tex.mem[int32(p)+2].int()
+			tex.ruleWd = tex.mem[int32(p)+1].int()
+			goto label14
+		case 8:
+			tex.pdfOutWhat(p, thisBox)
+		case 10:
+			tex.g = tex.mem[int32(p)+1].hh().lh()
+			tex.ruleWd = tex.mem[int32(tex.g)+1].int() - curG
+			curG = tex.pdfGlueSet(thisBox, gSign, gOrder, &curGlue, curG)
+			tex.ruleWd = tex.ruleWd + curG
+			if tex.mem[p].hh().b1() >= 100 {
+				leaderBox = tex.mem[int32(p)+1].hh().rh
+				if tex.mem[leaderBox].hh().b0() == 2 {
+					tex.ruleHt = tex.mem[int32(leaderBox)+3].int()
+					tex.ruleDp = tex.mem[int32(leaderBox)+2].int()
+					goto label14
+				}
+				leaderWd = tex.mem[int32(leaderBox)+1].int()
+				if (leaderWd > 0) && (tex.ruleWd > 0) {
+					tex.ruleWd = tex.ruleWd + 10
+					edge = tex.curH + tex.ruleWd
+					lx = 0
+					if tex.mem[p].hh().b1() == 100 {
+						saveH = tex.curH
+						tex.curH = leftEdge + (leaderWd * ((tex.curH - leftEdge) / leaderWd))
+						if tex.curH < saveH {
+							tex.curH = tex.curH + leaderWd
+						}
+					} else {
+						tex.lq = (tex.ruleWd / leaderWd)
+						tex.lr = (tex.ruleWd % leaderWd)
+						if tex.mem[p].hh().b1() == 101 {
+							tex.curH = tex.curH + (tex.lr / 2)
+						} else {
+							lx = (tex.lr / (tex.lq + 1))
+							tex.curH = tex.curH + ((tex.lr - ((tex.lq - 1) * lx)) / 2)
+						}
+					}
+					for tex.curH+leaderWd <= edge {
+						tex.curV = baseLine + tex.mem[int32(leaderBox)+4].int()
+						saveH = tex.curH
+						tex.tempPtr = leaderBox
+						outerDoingLeaders := tex.doingLeaders
+						tex.doingLeaders = true
+						if tex.mem[leaderBox].hh().b0() == 1 {
+							tex.pdfVlistOut()
+						} else {
+							tex.pdfHlistOut()
+						}
+						tex.doingLeaders = outerDoingLeaders
+						tex.curV = baseLine
+						tex.curH = saveH + leaderWd + lx
+					}
+					tex.curH = edge - 10
+					goto label15
+				}
+			}
+			goto label13
+		case 11, 9:
+			tex.curH = tex.curH + tex.mem[int32(p)+1].int()
+		case 6:
+			tex.mem[29988] = tex.mem[int32(p)+1]
+			tex.mem[29988].pHh().rh = tex.mem[p].hh().rh
+			p = 29988
+			goto label21
+		}
+		goto label15
+	label14:
+		if tex.ruleHt == nullFlag {
+			tex.ruleHt = tex.mem[int32(thisBox)+3].int()
+		}
+		if tex.ruleDp == nullFlag {
+			tex.ruleDp = tex.mem[int32(thisBox)+2].int()
+		}
+		tex.ruleHt = tex.ruleHt + tex.ruleDp
+		if (tex.ruleHt > 0) && (tex.ruleWd > 0) {
+			tex.curV = baseLine + tex.ruleDp
+			tex.pdfRuleOut(tex.ruleWd, tex.ruleHt)
+			tex.curV = baseLine
+		}
+	label13:
+		tex.curH = tex.curH + tex.ruleWd
+	label15:
+		p = tex.mem[p].hh().rh
+	}
+}
+
+// pdfVlistOut outputs the vlist box tex.tempPtr.
+func (tex *Context) pdfVlistOut() {
+	var (
+		thisBox   = tex.tempPtr
+		gOrder    = tex.mem[int32(thisBox)+5].hh().b1()
+		gSign     = tex.mem[int32(thisBox)+5].hh().b0()
+		p         = tex.mem[int32(thisBox)+5].hh().rh
+		leftEdge  = tex.curH
+		topEdge   int32
+		curG      int32
+		curGlue   float32
+		leaderBox uint16
+		leaderHt  int32
+		lx        int32
+		edge      int32
+		saveV     int32
+	)
+	tex.curV = tex.curV - tex.mem[int32(thisBox)+3].int()
+	topEdge = tex.curV
+	for p != 0 {
+		if p >= tex.hiMemMin {
+			tex.confusion(828)
+		}
+		switch tex.mem[p].hh().b0() {
+		case 0, 1:
+			if tex.mem[int32(p)+5].hh().rh == 0 {
+				tex.curV = tex.curV + tex.mem[int32(p)+3].int() + tex.mem[int32(p)+2].int()
+			} else {
+				tex.curV = tex.curV + tex.mem[int32(p)+3].int()
+				saveV = tex.curV
+				tex.curH = leftEdge + tex.mem[int32(p)+4].int()
+				tex.tempPtr = p
+				if tex.mem[p].hh().b0() == 1 {
+					tex.pdfVlistOut()
+				} else {
+					tex.pdfHlistOut()
+				}
+				tex.curV = saveV + tex.mem[int32(p)+2].int()
+				tex.curH = leftEdge
+			}
+		case 2:
+			tex.ruleHt = tex.mem[int32(p)+3].int()
+			tex.ruleDp = tex.mem[int32(p)+2].int()
+			tex.ruleWd = tex.mem[int32(p)+1].int()
+			goto label14
+		case 8:
+			tex.pdfOutWhat(p, thisBox)
+		case 10:
+			tex.g = tex.mem[int32(p)+1].hh().lh()
+			tex.ruleHt = tex.mem[int32(tex.g)+1].int() - curG
+			curG = tex.pdfGlueSet(thisBox, gSign, gOrder, &curGlue, curG)
+			tex.ruleHt = tex.ruleHt + curG
+			if tex.mem[p].hh().b1() >= 100 {
+				leaderBox = tex.mem[int32(p)+1].hh().rh
+				if tex.mem[leaderBox].hh().b0() == 2 {
+					tex.ruleWd = tex.mem[int32(leaderBox)+1].int()
+					tex.ruleDp = 0
+					goto label14
+				}
+				leaderHt = tex.mem[int32(leaderBox)+3].int() + tex.mem[int32(leaderBox)+2].int()
+				if (leaderHt > 0) && (tex.ruleHt > 0) {
+					tex.ruleHt = tex.ruleHt + 10
+					edge = tex.curV + tex.ruleHt
+					lx = 0
+					if tex.mem[p].hh().b1() == 100 {
+						saveV = tex.curV
+						tex.curV = topEdge + (leaderHt * ((tex.curV - topEdge) / leaderHt))
+						if tex.curV < saveV {
+							tex.curV = tex.curV + leaderHt
+						}
+					} else {
+						tex.lq = (tex.ruleHt / leaderHt)
+						tex.lr = (tex.ruleHt % leaderHt)
+						if tex.mem[p].hh().b1() == 101 {
+							tex.curV = tex.curV + (tex.lr / 2)
+						} else {
+							lx = (tex.lr / (tex.lq + 1))
+							tex.curV = tex.curV + ((tex.lr - ((tex.lq - 1) * lx)) / 2)
+						}
+					}
+					for tex.curV+leaderHt <= edge {
+						tex.curH = leftEdge + tex.mem[int32(leaderBox)+4].int()
+						tex.curV = tex.curV + tex.mem[int32(leaderBox)+3].int()
+						saveV = tex.curV
+						tex.tempPtr = leaderBox
+						outerDoingLeaders := tex.doingLeaders
+						tex.doingLeaders = true
+						if tex.mem[leaderBox].hh().b0() == 1 {
+							tex.pdfVlistOut()
+						} else {
+							tex.pdfHlistOut()
+						}
+						tex.doingLeaders = outerDoingLeaders
+						tex.curH = leftEdge
+						tex.curV = saveV - tex.mem[int32(leaderBox)+3].int() + leaderHt + lx
+					}
+					tex.curV = edge - 10
+					goto label15
+				}
+			}
+			goto label13
+		case 11:
+			tex.curV = tex.curV + tex.mem[int32(p)+1].int()
+		}
+		goto label15
+	label14:
+		if tex.ruleWd == nullFlag {
+			tex.ruleWd = tex.mem[int32(thisBox)+1].int()
+		}
+		tex.ruleHt = tex.ruleHt + tex.ruleDp
+		tex.curV = tex.curV + tex.ruleHt
+		if (tex.ruleHt > 0) && (tex.ruleWd > 0) {
+			tex.pdfRuleOut(tex.ruleWd, tex.ruleHt)
+		}
+		goto label15
+	label13:
+		tex.curV = tex.curV + tex.ruleHt
+	label15:
+		p = tex.mem[p].hh().rh
+	}
+}
+
+// pdfGlueSet returns the amount of stretching or shrinking of the glue
+// specification tex.g, set in the box thisBox.
+func (tex *Context) pdfGlueSet(thisBox uint16, gSign, gOrder byte, curGlue *float32, curG int32) int32 {
+	switch {
+	case gSign == 1 && tex.mem[tex.g].hh().b0() == gOrder:
+		*curGlue = *curGlue + float32(tex.mem[int32(tex.g)+2].int())
+	case gSign == 2 && tex.mem[tex.g].hh().b1() == gOrder:
+		*curGlue = *curGlue - float32(tex.mem[int32(tex.g)+3].int())
+	default:
+		return curG
+	}
+	glueTemp := tex.mem[int32(thisBox)+6].gr() * *curGlue
+	if glueTemp > 1e+09 {
+		glueTemp = 1e+09
+	} else if glueTemp < -1e+09 {
+		glueTemp = -1e+09
+	}
+	return round(glueTemp)
+}
+
+// pdfFinish writes the fonts, the document structure and the trailer of
+// the PDF document.
+func (tex *Context) pdfFinish() {
+	st := &tex.pdf
+	if st.w == nil {
+		tex.printNl(837)
+		return
+	}
+
+	tex.pdfWriteFonts()
+
+	var o strings.Builder
+	o.WriteString("<< /ProcSet [/PDF /Text] /Font <<")
+	for _, f := range st.usedFonts() {
+		fmt.Fprintf(&o, " /F%d %v", f, st.fnts[f])
+	}
+	o.WriteString(" >> >>")
+	tex.pdfCheck(st.w.WriteObject(st.res, o.String()))
+
+	o.Reset()
+	o.WriteString("<< /Type /Pages /Kids [")
+	for _, ref := range st.pages {
+		fmt.Fprintf(&o, " %v", ref)
+	}
+	fmt.Fprintf(&o, " ] /Count %d >>", len(st.pages))
+	tex.pdfCheck(st.w.WriteObject(st.parent, o.String()))
+
+	catalog := st.w.Alloc()
+	o.Reset()
+	fmt.Fprintf(&o, "<< /Type /Catalog /Pages %v", st.parent)
+	if outlines := tex.pdfWriteOutlines(); outlines != 0 {
+		fmt.Fprintf(&o, " /Outlines %v /PageMode /UseOutlines", outlines)
+	}
+	if len(st.dests) > 0 {
+		names := make([]string, 0, len(st.dests))
+		for k := range st.dests {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		dests := st.w.Alloc()
+		var d strings.Builder
+		d.WriteString("<< /Names [")
+		for _, k := range names {
+			fmt.Fprintf(&d, " %s %s", pdf.String(k), st.dests[k])
+		}
+		d.WriteString(" ] >>")
+		tex.pdfCheck(st.w.WriteObject(dests, d.String()))
+		fmt.Fprintf(&o, " /Names << /Dests %v >>", dests)
+	}
+	o.WriteString(" >>")
+	tex.pdfCheck(st.w.WriteObject(catalog, o.String()))
+
+	info := st.w.Alloc()
+	o.Reset()
+	o.WriteString("<<")
+	o.WriteString(st.info.String())
+	if !strings.Contains(st.info.String(), "/Producer") {
+		o.WriteString(" /Producer (star-tex)")
+	}
+	if !strings.Contains(st.info.String(), "/CreationDate") {
+		fmt.Fprintf(&o, " /CreationDate (D:%04d%02d%02d%02d%02d00)",
+			tex.eqtb[5286-1].int(), tex.eqtb[5285-1].int(), tex.eqtb[5284-1].int(),
+			tex.eqtb[5283-1].int()/60, tex.eqtb[5283-1].int()%60,
+		)
+	}
+	o.WriteString(" >>")
+	tex.pdfCheck(st.w.WriteObject(info, o.String()))
+	tex.pdfCheck(st.w.Close(catalog, info))
+
+	tex.printNl(838)
+	tex.slowPrint(int32(tex.outputFileName))
+	tex.print(286)
+	tex.printInt(tex.totalPages)
+	tex.print(839)
+	if tex.totalPages != 1 {
+		tex.printChar(115)
+	}
+	tex.print(840)
+	tex.printInt(int32(st.w.Len()))
+	tex.print(841)
+	tex.bClose(&tex.dviFile)
+}
+
+func (st *pdfState) usedFonts() []byte {
+	fnts := make([]byte, 0, len(st.fnts))
+	for f := range st.fnts {
+		fnts = append(fnts, f)
+	}
+	sort.Slice(fnts, func(i, j int) bool { return fnts[i] < fnts[j] })
+	return fnts
+}
+
+// pdfWriteFonts writes the font dictionaries of the fonts used in the
+// document, embedding their Type1 font program when it can be found.
+func (tex *Context) pdfWriteFonts() {
+	st := &tex.pdf
+	if st.fonts.FS() == nil {
+		st.fonts = kpath.New()
+	}
+	for _, f := range st.usedFonts() {
+		var (
+			name = tex.goString(tex.fontName[f])
+			size = float64(tex.fontSize[f])
+			bc   = int32(tex.fontBc[f])
+			ec   = int32(tex.fontEc[f])
+			o    strings.Builder
+		)
+		if bc > ec {
+			bc, ec = 0, 0
+		}
+
+		fnt, err := tex.pdfLoadType1(name)
+		if err != nil {
+			tex.pdfWarning(fmt.Sprintf("could not embed font %s: %+v", name, err))
+		}
+
+		base := strings.ToUpper(name)
+		if fnt != nil {
+			base = fnt.Name()
+		}
+		fmt.Fprintf(&o, "<< /Type /Font /Subtype /Type1 /BaseFont /%s", base)
+		fmt.Fprintf(&o, " /FirstChar %d /LastChar %d /Widths [", bc, ec)
+		for c := bc; c <= ec; c++ {
+			var wd int32
+			if ci := tex.fontInfo[tex.charBase[f]+c].qqqq(); ci.b0 > 0 {
+				wd = tex.fontInfo[tex.widthBase[f]+int32(ci.b0)].int()
+			}
+			fmt.Fprintf(&o, " %s", pdf.Real(float64(wd)/size*1000))
+		}
+		o.WriteString(" ]")
+
+		if fnt != nil {
+			file, err := pdf.EmbedType1(st.w, fnt)
+			tex.pdfCheck(err)
+			flags := 4
+			if fnt.IsFixedPitch() {
+				flags |= 1
+			}
+			var (
+				bbox = fnt.FontBBox()
+				desc = st.w.Alloc()
+			)
+			tex.pdfCheck(st.w.WriteObject(desc, fmt.Sprintf(
+				"<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%s %s %s %s] /ItalicAngle %s /Ascent %s /Descent %s /CapHeight %s /StemV 80 /FontFile %v >>",
+				fnt.Name(), flags,
+				pdf.Real(bbox[0]), pdf.Real(bbox[1]), pdf.Real(bbox[2]), pdf.Real(bbox[3]),
+				pdf.Real(fnt.ItalicAngle()), pdf.Real(bbox[3]), pdf.Real(bbox[1]), pdf.Real(bbox[3]),
+				file,
+			)))
+			fmt.Fprintf(&o, " /FontDescriptor %v", desc)
+		}
+		o.WriteString(" >>")
+		tex.pdfCheck(st.w.WriteObject(st.fnts[f], o.String()))
+	}
+}
+
+// pdfLoadType1 locates and parses the Type1 font program of the TeX font name.
+func (tex *Context) pdfLoadType1(name string) (*type1.Font, error) {
+	fname, err := tex.pdf.fonts.Find(name + ".pfb")
+	if err != nil {
+		return nil, err
+	}
+	f, err := tex.pdf.fonts.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fnt, err := type1.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	return &fnt, nil
+}
+
+// pdfWriteOutlines writes the document outline and returns its reference,
+// or zero if the document has no outline.
+func (tex *Context) pdfWriteOutlines() pdf.Ref {
+	st := &tex.pdf
+	if len(st.outline) == 0 {
+		return 0
+	}
+
+	var (
+		items = st.outline
+		build func(n int) []*pdfOutline
+	)
+	build = func(n int) []*pdfOutline {
+		var kids []*pdfOutline
+		for len(items) > 0 && (n < 0 || len(kids) < n) {
+			item := items[0]
+			items = items[1:]
+			kids = append(kids, item)
+			if item.count != 0 {
+				item.kids = build(int(iabs(item.count)))
+			}
+		}
+		return kids
+	}
+	root := st.w.Alloc()
+	top := build(-1)
+
+	var write func(parent pdf.Ref, kids []*pdfOutline)
+	write = func(parent pdf.Ref, kids []*pdfOutline) {
+		for _, kid := range kids {
+			kid.ref = st.w.Alloc()
+			kid.parent = parent
+		}
+		for i, kid := range kids {
+			var o strings.Builder
+			fmt.Fprintf(&o, "<< /Title %s /Parent %v", pdf.String(kid.title), parent)
+			if i > 0 {
+				fmt.Fprintf(&o, " /Prev %v", kids[i-1].ref)
+			}
+			if i < len(kids)-1 {
+				fmt.Fprintf(&o, " /Next %v", kids[i+1].ref)
+			}
+			if len(kid.kids) > 0 {
+				fmt.Fprintf(&o, " /First %v /Last %v /Count %d",
+					kid.kids[0].ref, kid.kids[len(kid.kids)-1].ref, kid.count,
+				)
+			}
+			switch {
+			case kid.page > 0:
+				page := int(kid.page)
+				if page > len(st.pages) {
+					page = len(st.pages)
+				}
+				if page > 0 {
+					fmt.Fprintf(&o, " /A << /S /GoTo /D [%v %s] >>", st.pages[page-1], kid.action)
+				}
+			case kid.action != "":
+				o.WriteString(" " + kid.action)
+			}
+			if kid.attr != "" {
+				o.WriteString(" " + kid.attr)
+			}
+			o.WriteString(" >>")
+			tex.pdfCheck(st.w.WriteObject(kid.ref, o.String()))
+		}
+		for _, kid := range kids {
+			write(kid.ref, kid.kids)
+		}
+	}
+	write(root, top)
+
+	tex.pdfCheck(st.w.WriteObject(root, fmt.Sprintf(
+		"<< /Type /Outlines /First %v /Last %v /Count %d >>",
+		top[0].ref, top[len(top)-1].ref, len(top),
+	)))
+	return root
+}
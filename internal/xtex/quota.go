@@ -0,0 +1,79 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtex
+
+import (
+	"fmt"
+	"io"
+)
+
+// Kinds of resource quotas.
+const (
+	PageQuota      = iota // pages shipped out
+	OutputQuota           // bytes of DVI or PDF output
+	WriteQuota            // bytes written to \openout streams and to the log
+	ExpansionQuota        // macro expansions
+	numQuotas
+)
+
+var quotaNames = [numQuotas]string{
+	PageQuota:      "page",
+	OutputQuota:    "output",
+	WriteQuota:     "write",
+	ExpansionQuota: "expansion",
+}
+
+// QuotaError is raised when a job exceeds one of its resource quotas.
+type QuotaError struct {
+	Quota int   // kind of the exceeded quota
+	Limit int64 // value of the exceeded quota
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("xtex: %s quota exceeded (limit=%d)", quotaNames[e.Quota], e.Limit)
+}
+
+// quotaState holds the resource quotas of a job, and their usage.
+// A zero limit means no limit.
+type quotaState struct {
+	limits [numQuotas]int64
+	usage  [numQuotas]int64
+}
+
+// SetQuota sets the limit of the provided kind of quota.
+// A zero limit means no limit.
+func (ctx *Context) SetQuota(kind int, limit int64) {
+	ctx.quota.limits[kind] = limit
+}
+
+// use accounts for n more units of the provided kind of quota, and stops
+// the job when the quota is exceeded.
+func (q *quotaState) use(kind int, n int64) {
+	q.usage[kind] += n
+	if limit := q.limits[kind]; limit > 0 && q.usage[kind] > limit {
+		panic(&QuotaError{Quota: kind, Limit: limit})
+	}
+}
+
+// writer returns w, accounting the written bytes for the provided kind
+// of quota.
+func (q *quotaState) writer(w io.WriteCloser, kind int) io.WriteCloser {
+	return &quotaWriter{w: w, q: q, kind: kind}
+}
+
+type quotaWriter struct {
+	w    io.WriteCloser
+	q    *quotaState
+	kind int
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	w.q.use(w.kind, int64(len(p)))
+	return w.w.Write(p)
+}
+
+func (w *quotaWriter) Close() error {
+	return w.w.Close()
+}
@@ -0,0 +1,91 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xtex
+
+import (
+	"errors"
+)
+
+// ErrShellDenied is returned by shell executors for the commands they
+// refuse to run.
+var ErrShellDenied = errors.New("xtex: shell command not allowed")
+
+// Shell escape modes, reported by \pdfshellescape.
+const (
+	ShellDisabled   = 0 // \write18 commands are not executed.
+	ShellEnabled    = 1 // all \write18 commands are executed.
+	ShellRestricted = 2 // only allowed \write18 commands are executed.
+)
+
+// Modifiers of the last_item command (70) for the shell escape primitives.
+const (
+	shellEscapeCode      = 6 // \pdfshellescape
+	lastSystemStatusCode = 7 // \lastsystemstatus
+	lastSystemExitCode   = 8 // \lastsystemexit
+)
+
+// Statuses of the last \write18 command, reported by \lastsystemstatus.
+const (
+	shellExecuted = 0 // the command was executed
+	shellOff      = 1 // shell escape is disabled
+	shellDenied   = 2 // the command is not allowed
+	shellFailed   = 3 // the command could not be executed
+)
+
+// shellStream is the stream number of \write18.
+const shellStream = 18
+
+// shellState holds the state of the shell escape.
+type shellState struct {
+	mode   int32
+	exec   func(cmd string) (int, error)
+	status int32 // status of the last command
+	exit   int32 // exit code of the last command
+}
+
+// shellInitPrim declares the shell escape primitives.
+func (tex *Context) shellInitPrim() {
+	tex.poolString("runsystem(")
+	tex.primitive(tex.poolString("pdfshellescape"), 70, shellEscapeCode)
+	tex.primitive(tex.poolString("lastsystemstatus"), 70, lastSystemStatusCode)
+	tex.primitive(tex.poolString("lastsystemexit"), 70, lastSystemExitCode)
+}
+
+// runSystem runs the command written to the \write18 stream, and reports
+// the outcome in the transcript, the way TeX Live does.
+func (tex *Context) runSystem(cmd string) {
+	var (
+		sh  = &tex.shell
+		msg string
+	)
+	sh.exit = 0
+	switch {
+	case sh.exec == nil || sh.mode == ShellDisabled:
+		sh.status = shellOff
+		msg = "disabled"
+	default:
+		code, err := sh.exec(cmd)
+		switch {
+		case errors.Is(err, ErrShellDenied):
+			sh.status = shellDenied
+			msg = "disabled (restricted)"
+		case err != nil:
+			sh.status = shellFailed
+			msg = "failed"
+		default:
+			sh.status = shellExecuted
+			sh.exit = int32(code)
+			msg = "executed"
+			if sh.mode == ShellRestricted {
+				msg = "executed safely (allowed)"
+			}
+		}
+	}
+
+	tex.printNl(tex.poolString("runsystem("))
+	tex.printString(cmd)
+	tex.printString(")..." + msg + ".")
+	tex.printNl(338)
+}
@@ -197,6 +197,13 @@ type inStateRecord struct {
 type Context struct {
 	stdin                io.ReadCloser
 	stdout               io.WriteCloser
+	pdf                  pdfState
+	strs                 map[string]uint16
+	shell                shellState
+	files                filePolicy
+	quota                quotaState
+	prims                []goPrim
+	primErr              error // error of the declaration of the Go primitives.
 	bad                  int32               // integer
 	xord                 [256]byte           // array[char] of 0..255
 	xchr                 [256]byte           // array[0..255] of char
@@ -258,8 +265,8 @@ type Context struct {
 	sysDay               int32               // integer
 	sysMonth             int32               // integer
 	sysYear              int32               // integer
-	eqtb                 [6106]memoryWord    // array[1..6106] of record memoryWord
-	xeqLevel             [844]byte           // array[5263..6106] of 0..255
+	eqtb                 [eqtbMax]memoryWord // array[1..eqtbMax] of record memoryWord
+	xeqLevel             [xeqSize]byte       // array[5263..eqtbMax] of 0..255
 	hash                 [2367]twoHalves     // array[514..2880] of record twoHalves
 	hashUsed             uint16              // 0..65535
 	noNewControlSequence bool                // boolean
@@ -657,7 +664,7 @@ func (tex *Context) initialize() {
 	tex.lastKern = 0
 	tex.pageSoFar[7] = 0
 	tex.pageMaxDepth = 0
-	for _i := int64(5263); _i <= int64(6106); _i++ {
+	for _i := int64(5263); _i <= int64(eqtbMax); _i++ {
 		k = int32(_i)
 		tex.xeqLevel[k-5263] = 1
 	}
@@ -1184,7 +1191,7 @@ func (tex *Context) printSize(s int32) {
 
 func (tex *Context) printWriteWhatsit(s uint16, p uint16) {
 	tex.printEsc(s)
-	if tex.mem[int32(p)+1].hh().lh() < 16 {
+	if tex.mem[int32(p)+1].hh().lh() < 16 || tex.mem[int32(p)+1].hh().lh() == shellStream {
 		tex.printInt(int32(tex.mem[int32(p)+1].hh().lh()))
 	} else if tex.mem[int32(p)+1].hh().lh() == 16 {
 		tex.printChar(42)
@@ -2707,6 +2714,8 @@ func (tex *Context) showNodeList(p int32) {
 					tex.printChar(44)
 					tex.printInt(int32(tex.mem[p+1].hh().b1()))
 					tex.printChar(41)
+				case pdfLiteralCode, pdfAnnotCode, pdfDestCode:
+					tex.pdfShowWhatsit(p)
 				default:
 					tex.print(1293)
 				}
@@ -2959,12 +2968,14 @@ func (tex *Context) flushNodeList(p uint16) {
 				switch tex.mem[p].hh().b1() {
 				case 0:
 					tex.freeNode(p, 3)
-				case 1, 3:
+				case 1, 3, pdfLiteralCode:
 					tex.deleteTokenRef(tex.mem[int32(p)+1].hh().rh)
 					tex.freeNode(p, 2)
 					goto label30
 				case 2, 4:
 					tex.freeNode(p, 2)
+				case pdfAnnotCode, pdfDestCode:
+					tex.pdfFlushWhatsit(p)
 				default:
 					tex.confusion(1295)
 				}
@@ -3067,13 +3078,15 @@ func (tex *Context) copyNodeList(p uint16) (ret uint16) {
 				case 0:
 					r = tex.getNode(3)
 					words = 3
-				case 1, 3:
+				case 1, 3, pdfLiteralCode:
 					r = tex.getNode(2)
 					*tex.mem[tex.mem[int32(p)+1].hh().rh].pHh().pLh() = uint16(int32(tex.mem[tex.mem[int32(p)+1].hh().rh].hh().lh()) + 1)
 					words = 2
 				case 2, 4:
 					r = tex.getNode(2)
 					words = 2
+				case pdfAnnotCode, pdfDestCode:
+					r, words = tex.pdfCopyWhatsit(p)
 				default:
 					tex.confusion(1294)
 				}
@@ -3547,6 +3560,8 @@ func (tex *Context) printCmdChr(cmd byte, chrCode uint16) {
 	case 73:
 		if chrCode < 5318 {
 			tex.printParam(int32(chrCode) - 5263)
+		} else if chrCode == pdfOutputCode {
+			tex.printEsc(tex.poolString("pdfoutput"))
 		} else {
 			tex.printEsc(476)
 			tex.printInt(int32(chrCode) - 5318)
@@ -3554,6 +3569,10 @@ func (tex *Context) printCmdChr(cmd byte, chrCode uint16) {
 	case 74:
 		if chrCode < 5851 {
 			tex.printLengthParam(int32(chrCode) - 5830)
+		} else if chrCode == pdfPageWidthCode {
+			tex.printEsc(tex.poolString("pdfpagewidth"))
+		} else if chrCode == pdfPageHeightCode {
+			tex.printEsc(tex.poolString("pdfpageheight"))
 		} else {
 			tex.printEsc(500)
 			tex.printInt(int32(chrCode) - 5851)
@@ -3705,6 +3724,14 @@ func (tex *Context) printCmdChr(cmd byte, chrCode uint16) {
 			tex.printEsc(677)
 		case 3:
 			tex.printEsc(678)
+		case pdfLastObjCode:
+			tex.printEsc(tex.poolString("pdflastobj"))
+		case shellEscapeCode:
+			tex.printEsc(tex.poolString("pdfshellescape"))
+		case lastSystemStatusCode:
+			tex.printEsc(tex.poolString("lastsystemstatus"))
+		case lastSystemExitCode:
+			tex.printEsc(tex.poolString("lastsystemexit"))
 		default:
 			tex.printEsc(679)
 		}
@@ -3720,8 +3747,10 @@ func (tex *Context) printCmdChr(cmd byte, chrCode uint16) {
 			tex.printEsc(738)
 		case 4:
 			tex.printEsc(739)
-		default:
+		case 5:
 			tex.printEsc(740)
+		default:
+			tex.printEsc(tex.prims[chrCode-goPrimBase].name)
 		}
 	case 105:
 		switch chrCode {
@@ -4119,6 +4148,8 @@ func (tex *Context) printCmdChr(cmd byte, chrCode uint16) {
 			tex.printEsc(1288)
 		case 5:
 			tex.printEsc(1289)
+		case pdfLiteralCode, pdfObjCode, pdfAnnotCode, pdfDestCode, pdfOutlineCode, pdfInfoCode:
+			tex.printEsc(tex.poolString(pdfExtNames[chrCode]))
 		default:
 			tex.print(1290)
 		}
@@ -5247,6 +5278,7 @@ func (tex *Context) macroCall() {
 	var saveScannerStatus byte  // 0..63
 	var saveWarningIndex uint16 // 0..65535
 	var matchChr byte           // 0..255
+	tex.quota.use(ExpansionQuota, 1)
 	saveScannerStatus = tex.scannerStatus
 	saveWarningIndex = tex.warningIndex
 	tex.warningIndex = tex.curCs
@@ -5629,7 +5661,11 @@ func (tex *Context) expand() {
 			tex.curTok = uint16(int32(tex.curCs) + 4095)
 			tex.backInput()
 		case 108:
-			tex.convToks()
+			if tex.curChr >= goPrimBase {
+				tex.goExpand()
+			} else {
+				tex.convToks()
+			}
 		case 109:
 			tex.insTheToks()
 		case 105:
@@ -6127,6 +6163,14 @@ func (tex *Context) scanSomethingInternal(level byte, negative bool) {
 		if tex.curChr > 2 {
 			if tex.curChr == 3 {
 				tex.curVal = tex.line
+			} else if tex.curChr == pdfLastObjCode {
+				tex.curVal = tex.pdf.lastObj
+			} else if tex.curChr == shellEscapeCode {
+				tex.curVal = tex.shell.mode
+			} else if tex.curChr == lastSystemStatusCode {
+				tex.curVal = tex.shell.status
+			} else if tex.curChr == lastSystemExitCode {
+				tex.curVal = tex.shell.exit
 			} else {
 				tex.curVal = tex.lastBadness
 			}
@@ -8681,6 +8725,11 @@ func (tex *Context) writeOut(p uint16) {
 	}
 	tex.curList.modeField = int16(oldMode)
 	tex.endTokenList()
+	if tex.mem[int32(p)+1].hh().lh() == shellStream {
+		tex.runSystem(tex.tokensToString(tex.defRef))
+		tex.flushList(tex.defRef)
+		return
+	}
 	oldSetting = tex.selector
 	j = byte(tex.mem[int32(p)+1].hh().lh())
 	if tex.writeOpen[j] {
@@ -8729,6 +8778,7 @@ func (tex *Context) outWhat(p uint16) {
 	case 3:
 		tex.specialOut(p)
 	case 4:
+	case pdfLiteralCode, pdfAnnotCode, pdfDestCode:
 	default:
 		tex.confusion(1299)
 	}
@@ -9204,6 +9254,7 @@ func (tex *Context) shipOut(p uint16) {
 	var j, k byte       // 0..9
 	var s uint16        // 0..32000
 	var oldSetting byte // 0..21
+	tex.quota.use(PageQuota, 1)
 	if tex.eqtb[5297-1].int() > 0 {
 		tex.printNl(338)
 		tex.printLn()
@@ -9256,6 +9307,10 @@ func (tex *Context) shipOut(p uint16) {
 	if tex.mem[int32(p)+1].int()+tex.eqtb[5848-1].int() > tex.maxH {
 		tex.maxH = tex.mem[int32(p)+1].int() + tex.eqtb[5848-1].int()
 	}
+	if tex.pdfFixOutput() {
+		tex.pdfShipOut(p)
+		goto label30
+	}
 	tex.dviH = 0
 	tex.dviV = 0
 	tex.curH = tex.eqtb[5848-1].int()
@@ -17785,7 +17840,8 @@ func (tex *Context) newWriteWhatsit(w byte) {
 		tex.scanInt()
 		if tex.curVal < 0 {
 			tex.curVal = 17
-		} else if tex.curVal > 15 {
+		} else if tex.curVal > 15 && (tex.mem[tex.curList.tailField].hh().b1() != 1 || tex.curVal != shellStream) {
+			// only \write keeps the shell stream.
 			tex.curVal = 16
 		}
 	}
@@ -17847,7 +17903,7 @@ func (tex *Context) doExtension() {
 			*tex.mem[int32(tex.curList.tailField)+1].pHh().pB1() = tex.normMin(tex.eqtb[5315-1].int())
 		}
 	default:
-		tex.confusion(1291)
+		tex.pdfExtension()
 	}
 }
 
@@ -19205,7 +19261,9 @@ func (tex *Context) closeFilesAndTerminate() {
 		}
 		tex.curS = tex.curS - 1
 	}
-	if tex.totalPages == 0 {
+	if tex.pdfFixOutput() {
+		tex.pdfFinish()
+	} else if tex.totalPages == 0 {
 		tex.printNl(837)
 	} else {
 		tex.dviBuf[tex.dviPtr] = 248
@@ -19717,6 +19775,7 @@ func (tex *Context) initPrim() {
 	tex.primitive(1287, 59, 3)
 	tex.primitive(1288, 59, 4)
 	tex.primitive(1289, 59, 5)
+	tex.extInitPrim()
 	tex.noNewControlSequence = true
 }
 
@@ -19799,6 +19858,9 @@ func (tex *Context) main() {
 		panic(pasFinalEnd)
 	}
 	tex.initPrim()
+	if tex.primErr != nil {
+		panic(tex.primErr)
+	}
 	tex.initStrPtr = tex.strPtr
 	tex.initPoolPtr = tex.poolPtr
 	tex.fixDateAndTime()
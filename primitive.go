@@ -0,0 +1,139 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"fmt"
+
+	"star-tex.org/x/tex/internal/xtex"
+)
+
+// ArgKind describes the kind of an argument scanned by a Go primitive.
+type ArgKind int
+
+const (
+	TokensArg ArgKind = iota // A balanced text, like {...}, fully expanded.
+	IntArg                   // An integer, like 42 or \count0.
+	DimenArg                 // A dimension, like 2pt or \hsize.
+)
+
+func (k ArgKind) String() string {
+	switch k {
+	case TokensArg:
+		return "tokens"
+	case IntArg:
+		return "int"
+	case DimenArg:
+		return "dimen"
+	default:
+		return fmt.Sprintf("ArgKind(%d)", int(k))
+	}
+}
+
+// Arg is an argument scanned by a Go primitive.
+type Arg struct {
+	Kind ArgKind
+
+	// Tokens holds the value of a TokensArg argument.
+	Tokens string
+
+	// Int holds the value of an IntArg argument, or the value of
+	// a DimenArg argument, in scaled points.
+	Int int
+}
+
+// PrimitiveFunc implements a TeX primitive in Go.
+//
+// A PrimitiveFunc receives the scanned arguments of the primitive and
+// returns the TeX source that replaces the primitive in the input.
+// The returned source is tokenized with the category codes in effect
+// at the time of the expansion.
+// A non-nil error is reported as a TeX error.
+type PrimitiveFunc func(args []Arg) (string, error)
+
+type primitive struct {
+	name string
+	args []ArgKind
+	fn   PrimitiveFunc
+}
+
+// Primitive declares a new expandable primitive \name, implemented in Go.
+//
+// When the primitive is expanded, the arguments described by args are
+// scanned from the input and fn is invoked with their values.
+// The name of the primitive must either be a single character or only
+// contain ASCII letters, and must not already be defined by TeX:
+// Process reports an error for primitives clashing with TeX ones.
+func (engine *Engine) Primitive(name string, fn PrimitiveFunc, args ...ArgKind) error {
+	if !validPrimitiveName(name) {
+		return fmt.Errorf("tex: invalid primitive name %q", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("tex: nil function for primitive \\%s", name)
+	}
+	for _, arg := range args {
+		switch arg {
+		case TokensArg, IntArg, DimenArg:
+		default:
+			return fmt.Errorf("tex: invalid argument kind %v for primitive \\%s", arg, name)
+		}
+	}
+	for _, prim := range engine.prims {
+		if prim.name == name {
+			return fmt.Errorf("tex: primitive \\%s already declared", name)
+		}
+	}
+
+	engine.prims = append(engine.prims, primitive{
+		name: name,
+		args: append([]ArgKind(nil), args...),
+		fn:   fn,
+	})
+	return nil
+}
+
+func validPrimitiveName(name string) bool {
+	switch len(name) {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (prim primitive) xtex() xtex.Primitive {
+	kinds := make([]xtex.ArgKind, len(prim.args))
+	for i, arg := range prim.args {
+		switch arg {
+		case TokensArg:
+			kinds[i] = xtex.TokensArg
+		case IntArg:
+			kinds[i] = xtex.IntArg
+		case DimenArg:
+			kinds[i] = xtex.DimenArg
+		}
+	}
+	return xtex.Primitive{
+		Name: prim.name,
+		Args: kinds,
+		Expand: func(vs []xtex.Arg) (string, error) {
+			args := make([]Arg, len(vs))
+			for i, v := range vs {
+				args[i] = Arg{
+					Kind:   prim.args[i],
+					Tokens: v.Toks,
+					Int:    int(v.Int),
+				}
+			}
+			return prim.fn(args)
+		},
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPrimitive(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	engine := NewEngine(stdout, strings.NewReader(""))
+
+	db := map[string]string{
+		"author": `D. E. \TeX nician`,
+	}
+
+	for _, prim := range []struct {
+		name string
+		fn   PrimitiveFunc
+		args []ArgKind
+	}{
+		{
+			name: "gonow",
+			fn: func([]Arg) (string, error) {
+				return "1776-07-04", nil
+			},
+		},
+		{
+			name: "golookup",
+			fn: func(args []Arg) (string, error) {
+				v, ok := db[args[0].Tokens]
+				if !ok {
+					return "", fmt.Errorf("unknown key %q", args[0].Tokens)
+				}
+				return v, nil
+			},
+			args: []ArgKind{TokensArg},
+		},
+		{
+			name: "goimage",
+			fn: func(args []Arg) (string, error) {
+				return fmt.Sprintf(`\hsize=%dsp \count1=%d `, 2*args[1].Int, args[0].Int), nil
+			},
+			args: []ArgKind{IntArg, DimenArg},
+		},
+	} {
+		err := engine.Primitive(prim.name, prim.fn, prim.args...)
+		if err != nil {
+			t.Fatalf("could not declare primitive %q: %+v", prim.name, err)
+		}
+	}
+
+	const doc = `
+\message{[\gonow]}
+\def\TeX{TeX}
+\edef\x{\golookup{author}}
+\message{[\meaning\x]}
+\goimage 42 1pt
+\message{[\the\hsize,\the\count1]}
+\message{[\golookup{not-there}]}
+\bye
+`
+	err := engine.Process(io.Discard, strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("could not process document: %+v", err)
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		"[1776-07-04]",
+		`[macro:->D. E. TeXnician]`,
+		"[2.0pt,42]",
+		`! \golookup failed: unknown key "not-there".`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrimitiveInvalid(t *testing.T) {
+	fn := func([]Arg) (string, error) { return "", nil }
+	engine := NewEngine(io.Discard, strings.NewReader(""))
+
+	for _, tc := range []struct {
+		name string
+		fn   PrimitiveFunc
+		args []ArgKind
+		err  string
+	}{
+		{
+			name: "",
+			fn:   fn,
+			err:  `tex: invalid primitive name ""`,
+		},
+		{
+			name: "go2",
+			fn:   fn,
+			err:  `tex: invalid primitive name "go2"`,
+		},
+		{
+			name: "gonil",
+			err:  `tex: nil function for primitive \gonil`,
+		},
+		{
+			name: "goargs",
+			fn:   fn,
+			args: []ArgKind{-1},
+			err:  `tex: invalid argument kind ArgKind(-1) for primitive \goargs`,
+		},
+		{
+			name: "godup",
+			fn:   fn,
+		},
+		{
+			name: "godup",
+			fn:   fn,
+			err:  `tex: primitive \godup already declared`,
+		},
+	} {
+		err := engine.Primitive(tc.name, tc.fn, tc.args...)
+		switch {
+		case err == nil && tc.err != "":
+			t.Errorf("%q: expected an error", tc.name)
+		case err != nil && err.Error() != tc.err:
+			t.Errorf("%q: invalid error:\ngot= %v\nwant=%s", tc.name, err, tc.err)
+		}
+	}
+
+	engine = NewEngine(io.Discard, strings.NewReader(""))
+	err := engine.Primitive("hbox", fn)
+	if err != nil {
+		t.Fatalf("could not declare primitive: %+v", err)
+	}
+	out := new(bytes.Buffer)
+	err = engine.Process(out, strings.NewReader(`\shipout\hbox{}\bye`))
+	if err == nil || err.Error() != `xtex: primitive \hbox is already defined` {
+		t.Fatalf("invalid error: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("document processed despite the clashing primitive: %d bytes", out.Len())
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"errors"
+	"fmt"
+
+	"star-tex.org/x/tex/internal/xtex"
+)
+
+// Limits holds the resource quotas of the jobs run by an Engine.
+// A zero value means no limit.
+//
+// The usage of the quotas includes the preloading of the plain format.
+type Limits struct {
+	Pages       int64 // Maximum number of pages shipped out.
+	OutputBytes int64 // Maximum size of the DVI (or PDF) output, in bytes.
+	WriteBytes  int64 // Maximum number of bytes written to \openout streams and to the log.
+	Expansions  int64 // Maximum number of macro expansions.
+}
+
+// Quota describes a kind of resource quota.
+type Quota int
+
+const (
+	PageQuota      Quota = xtex.PageQuota      // Quota of pages shipped out.
+	OutputQuota    Quota = xtex.OutputQuota    // Quota of DVI (or PDF) bytes.
+	WriteQuota     Quota = xtex.WriteQuota     // Quota of bytes written to files.
+	ExpansionQuota Quota = xtex.ExpansionQuota // Quota of macro expansions.
+)
+
+func (q Quota) String() string {
+	switch q {
+	case PageQuota:
+		return "page"
+	case OutputQuota:
+		return "output"
+	case WriteQuota:
+		return "write"
+	case ExpansionQuota:
+		return "expansion"
+	default:
+		return fmt.Sprintf("Quota(%d)", int(q))
+	}
+}
+
+// QuotaError is returned when a job is stopped because it exceeded one
+// of its resource quotas.
+type QuotaError struct {
+	Quota Quota // Exceeded quota.
+	Limit int64 // Value of the exceeded quota.
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tex: %v quota exceeded (limit=%d)", e.Quota, e.Limit)
+}
+
+func (lim Limits) set(ctx *xtex.Context) {
+	ctx.SetQuota(xtex.PageQuota, lim.Pages)
+	ctx.SetQuota(xtex.OutputQuota, lim.OutputBytes)
+	ctx.SetQuota(xtex.WriteQuota, lim.WriteBytes)
+	ctx.SetQuota(xtex.ExpansionQuota, lim.Expansions)
+}
+
+// quotaError converts quota errors from the TeX engine.
+func quotaError(err error) error {
+	var qerr *xtex.QuotaError
+	if errors.As(err, &qerr) {
+		return &QuotaError{Quota: Quota(qerr.Quota), Limit: qerr.Limit}
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits Limits
+		doc    string
+		want   Quota
+	}{
+		{
+			name:   "pages",
+			limits: Limits{Pages: 10},
+			doc:    `\def\x{\shipout\hbox{x}\x}\x`,
+			want:   PageQuota,
+		},
+		{
+			name:   "output",
+			limits: Limits{OutputBytes: 1 << 10},
+			doc:    `\def\x{\shipout\hbox{x}\x}\x`,
+			want:   OutputQuota,
+		},
+		{
+			name:   "write",
+			limits: Limits{WriteBytes: 1 << 16},
+			doc: `\immediate\openout1=out.txt
+\def\x{\immediate\write1{0123456789}\x}\x`,
+			want: WriteQuota,
+		},
+		{
+			name:   "log",
+			limits: Limits{WriteBytes: 1 << 16},
+			doc:    `\def\x{\wlog{0123456789}\x}\x`,
+			want:   WriteQuota,
+		},
+		{
+			name:   "expansions",
+			limits: Limits{Expansions: 1 << 20},
+			doc:    `\def\x{\x}\x`,
+			want:   ExpansionQuota,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := NewEngine(io.Discard, strings.NewReader(""))
+			engine.Limits = tc.limits
+
+			err := engine.Process(io.Discard, strings.NewReader(tc.doc))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+
+			var qerr *QuotaError
+			if !errors.As(err, &qerr) {
+				t.Fatalf("invalid error type %T: %+v", err, err)
+			}
+			if got, want := qerr.Quota, tc.want; got != want {
+				t.Fatalf("invalid quota: got=%v, want=%v", got, want)
+			}
+		})
+	}
+}
+
+func TestLimitsOK(t *testing.T) {
+	engine := NewEngine(io.Discard, strings.NewReader(""))
+	engine.Limits = Limits{
+		Pages:       2,
+		OutputBytes: 1 << 20,
+		WriteBytes:  1 << 20,
+		Expansions:  1 << 20,
+	}
+
+	err := engine.Process(io.Discard, strings.NewReader(`Hello \par\vfill\eject World \bye`))
+	if err != nil {
+		t.Fatalf("could not process document: %+v", err)
+	}
+}
+
+func TestQuotaError(t *testing.T) {
+	err := &QuotaError{Quota: ExpansionQuota, Limit: 42}
+	if got, want := err.Error(), "tex: expansion quota exceeded (limit=42)"; got != want {
+		t.Fatalf("invalid error message:\ngot= %q\nwant=%q", got, want)
+	}
+}
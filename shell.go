@@ -0,0 +1,152 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"star-tex.org/x/tex/internal/xtex"
+)
+
+// ErrShellDenied is returned by an Executor for the commands it refuses
+// to run.
+var ErrShellDenied = xtex.ErrShellDenied
+
+// Executor runs the shell commands written by TeX documents to the
+// \write18 stream.
+//
+// The outcome of the last command is available to documents through
+// \lastsystemstatus (0: executed, 1: disabled, 2: denied, 3: failed) and
+// \lastsystemexit (the exit code of the command), and is reported in the
+// transcript as "runsystem(<cmd>)...<outcome>.", like TeX Live does.
+type Executor interface {
+	// Exec runs the provided command line and returns its exit code.
+	Exec(cmd string) (int, error)
+}
+
+// ExecutorFunc is an adapter to use an ordinary function as an Executor.
+// It can be used to fake the execution of commands, e.g. in tests.
+type ExecutorFunc func(cmd string) (int, error)
+
+// Exec calls f(cmd).
+func (f ExecutorFunc) Exec(cmd string) (int, error) { return f(cmd) }
+
+// Restricted returns an Executor that only runs, with exec, the commands
+// whose name is part of the allow-list, like the shell_escape_commands
+// setting of TeX Live.
+// Other commands, and commands containing shell metacharacters, are denied
+// with ErrShellDenied.
+func Restricted(exec Executor, allowed ...string) Executor {
+	cmds := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		cmds[name] = true
+	}
+	return &restricted{exec: exec, cmds: cmds}
+}
+
+type restricted struct {
+	exec Executor
+	cmds map[string]bool
+}
+
+func (r *restricted) Exec(cmd string) (int, error) {
+	if strings.ContainsAny(cmd, shellMeta) {
+		return 0, ErrShellDenied
+	}
+	args, err := splitCommand(cmd)
+	if err != nil || len(args) == 0 || !r.cmds[args[0]] {
+		return 0, ErrShellDenied
+	}
+	return r.exec.Exec(cmd)
+}
+
+// shellMeta holds the characters with a special meaning for the shell.
+const shellMeta = ";&|<>`$()\n\r"
+
+// OSExecutor runs commands as processes of the host.
+//
+// The command line is split into words, honoring single and double quotes,
+// and executed without a shell.
+// The command is run from the working directory of the TeX engine.
+type OSExecutor struct {
+	Stdout io.Writer // standard output of the commands. Default is discarded.
+	Stderr io.Writer // standard error of the commands. Default is discarded.
+}
+
+// Exec runs the provided command line and returns its exit code.
+func (e OSExecutor) Exec(cmd string) (int, error) {
+	args, err := splitCommand(cmd)
+	if err != nil {
+		return 0, err
+	}
+	if len(args) == 0 {
+		return 0, fmt.Errorf("tex: empty shell command")
+	}
+	proc := exec.Command(args[0], args[1:]...)
+	proc.Stdout = e.Stdout
+	proc.Stderr = e.Stderr
+	err = proc.Run()
+	if err != nil {
+		var eerr *exec.ExitError
+		if errors.As(err, &eerr) {
+			return eerr.ExitCode(), nil
+		}
+		return 0, fmt.Errorf("tex: could not run %q: %w", args[0], err)
+	}
+	return 0, nil
+}
+
+// splitCommand splits a command line into words, honoring single and
+// double quotes.
+func splitCommand(cmd string) ([]string, error) {
+	var (
+		args  []string
+		word  strings.Builder
+		quote rune
+		inArg bool
+	)
+	for _, c := range cmd {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, word.String())
+				word.Reset()
+				inArg = false
+			}
+		default:
+			word.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("tex: unterminated quote in shell command %q", cmd)
+	}
+	if inArg {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+func (engine *Engine) shellMode() int32 {
+	switch engine.Shell.(type) {
+	case nil:
+		return xtex.ShellDisabled
+	case *restricted:
+		return xtex.ShellRestricted
+	default:
+		return xtex.ShellEnabled
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright ©2021 The star-tex Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShell(t *testing.T) {
+	const doc = `
+\immediate\write18{kpsewhich cmr10.tfm}
+\message{[\the\pdfshellescape,\the\lastsystemstatus,\the\lastsystemexit]}
+\immediate\write18{rm -rf /; echo pwned}
+\message{[\the\pdfshellescape,\the\lastsystemstatus,\the\lastsystemexit]}
+\bye
+`
+	var cmds []string
+	fake := ExecutorFunc(func(cmd string) (int, error) {
+		cmds = append(cmds, cmd)
+		switch {
+		case strings.HasPrefix(cmd, "kpsewhich"):
+			return 3, nil
+		default:
+			return 0, fmt.Errorf("could not run %q", cmd)
+		}
+	})
+
+	for _, tc := range []struct {
+		name  string
+		shell Executor
+		cmds  []string
+		want  []string
+	}{
+		{
+			name: "deny",
+			want: []string{
+				"runsystem(kpsewhich cmr10.tfm)...disabled.",
+				"[0,1,0]",
+				"runsystem(rm -rf /; echo pwned)...disabled.",
+				"[0,1,0]",
+			},
+		},
+		{
+			name:  "enabled",
+			shell: fake,
+			cmds:  []string{"kpsewhich cmr10.tfm", "rm -rf /; echo pwned"},
+			want: []string{
+				"runsystem(kpsewhich cmr10.tfm)...executed.",
+				"[1,0,3]",
+				"runsystem(rm -rf /; echo pwned)...failed.",
+				"[1,3,0]",
+			},
+		},
+		{
+			name:  "restricted",
+			shell: Restricted(fake, "kpsewhich", "rm"),
+			cmds:  []string{"kpsewhich cmr10.tfm"},
+			want: []string{
+				"runsystem(kpsewhich cmr10.tfm)...executed safely (allowed).",
+				"[2,0,3]",
+				"runsystem(rm -rf /; echo pwned)...disabled (restricted).",
+				"[2,2,0]",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmds = nil
+			stdout := new(bytes.Buffer)
+			engine := NewEngine(stdout, strings.NewReader(""))
+			engine.Shell = tc.shell
+
+			err := engine.Process(io.Discard, strings.NewReader(doc))
+			if err != nil {
+				t.Fatalf("could not process document: %+v", err)
+			}
+
+			if !reflect.DeepEqual(cmds, tc.cmds) {
+				t.Fatalf("invalid commands:\ngot= %q\nwant=%q", cmds, tc.cmds)
+			}
+
+			out := stdout.String()
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in output:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRestricted(t *testing.T) {
+	exec := Restricted(ExecutorFunc(func(string) (int, error) { return 0, nil }), "bibtex", "kpsewhich")
+	for _, tc := range []struct {
+		cmd string
+		ok  bool
+	}{
+		{cmd: "bibtex doc", ok: true},
+		{cmd: `  "kpsewhich" 'my file.tex'`, ok: true},
+		{cmd: "kpsewhich $HOME"},
+		{cmd: "bibtex doc && rm doc.tex"},
+		{cmd: "bibtex `rm doc.tex`"},
+		{cmd: "bibtex 'doc"},
+		{cmd: "rm doc.tex"},
+		{cmd: "/usr/bin/bibtex doc"},
+		{cmd: ""},
+	} {
+		_, err := exec.Exec(tc.cmd)
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%q: unexpected error: %+v", tc.cmd, err)
+		case !tc.ok && err != ErrShellDenied:
+			t.Errorf("%q: invalid error: %v", tc.cmd, err)
+		}
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	got, err := splitCommand(`epstopdf  --outfile='my fig.pdf' "a b"c ''`)
+	if err != nil {
+		t.Fatalf("could not split command: %+v", err)
+	}
+	want := []string{"epstopdf", "--outfile=my fig.pdf", "a bc", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid words:\ngot= %q\nwant=%q", got, want)
+	}
+}
+
+func TestShellStreams(t *testing.T) {
+	// only \write uses the shell stream: \closeout18 closes the
+	// terminal stream, as with any stream above 15, and \openout18 is a
+	// bad number.
+	const doc = `
+\immediate\closeout18
+\closeout18
+\immediate\openout18=shell-streams
+\openout18=shell-streams
+\immediate\write18{echo}
+\hbox{}\shipout\hbox{}
+\bye
+`
+	var cmds []string
+	stdout := new(bytes.Buffer)
+	engine := NewEngine(stdout, strings.NewReader(""))
+	engine.Shell = ExecutorFunc(func(cmd string) (int, error) {
+		cmds = append(cmds, cmd)
+		return 0, nil
+	})
+
+	err := engine.Process(io.Discard, strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("could not process document: %+v\n%s", err, stdout.String())
+	}
+	if got, want := cmds, []string{"echo"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid commands:\ngot= %q\nwant=%q", got, want)
+	}
+}